@@ -0,0 +1,876 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/config"
+	"github.com/heathcliff26/speedtest-exporter/pkg/history"
+	"github.com/heathcliff26/speedtest-exporter/pkg/influx"
+	"github.com/heathcliff26/speedtest-exporter/pkg/mqtt"
+	"github.com/heathcliff26/speedtest-exporter/pkg/notify"
+	"github.com/heathcliff26/speedtest-exporter/pkg/otlp"
+	"github.com/heathcliff26/speedtest-exporter/pkg/pushgateway"
+	"github.com/heathcliff26/speedtest-exporter/pkg/remote"
+	"github.com/heathcliff26/speedtest-exporter/pkg/report"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/tracing"
+	"github.com/heathcliff26/speedtest-exporter/pkg/version"
+	"github.com/heathcliff26/speedtest-exporter/pkg/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	cachePath       = "/cache/speedtest-result.json"
+	historyPath     = "/cache/speedtest-history.json"
+	remoteQueuePath = "/cache/remote-write-queue"
+	ipHashKeyPath   = "/cache/ip-hash-key"
+)
+
+// Maximum time to flush the outputs during shutdown, after the running speedtest finished or was cancelled
+const flushTimeout = 10 * time.Second
+
+// Contains all components of the running exporter
+type exporter struct {
+	configPath string
+	env        bool
+	cfg        config.Config
+	// Used for the hashed ip label when the config contains no key
+	ipHashKey []byte
+
+	speedtest speedtest.Speedtest
+	cache     *cache.Cache
+	history   *history.History
+	collector *collector.Collector
+	registry  *prometheus.Registry
+	auth      *web.BasicAuth
+	tracing   *tracing.Provider
+	// Read without holding the lock when a speedtest completes, see pushResult
+	rwClients    atomic.Pointer[[]*remote.Client]
+	otlpClient   atomic.Pointer[otlp.Client]
+	influxClient atomic.Pointer[influx.Client]
+	mqttClient   atomic.Pointer[mqtt.Client]
+	pgClient     atomic.Pointer[pushgateway.Client]
+	notifier     atomic.Pointer[notify.Notifier]
+	reporter     atomic.Pointer[report.Reporter]
+	scheduler    atomic.Pointer[collector.Scheduler]
+
+	sync.Mutex
+}
+
+// Create a new exporter with all components initialized from the given config.
+// The configPath and env arguments are used when reloading the config.
+func newExporter(cfg config.Config, configPath string, env bool) (*exporter, error) {
+	s, err := createSpeedtest(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resultCache := cache.NewCache(cfg.PersistCache, cachePath, cfg.Cache)
+
+	resultHistory := history.NewHistory(cfg.PersistCache, historyPath, cfg.HistoryRetention())
+
+	ipHashKey := loadIPHashKey(resultCache.Persistent(), ipHashKeyPath)
+
+	c, err := collector.NewCollector(resultCache, resultHistory, s, cfg.Instance)
+	if err != nil {
+		return nil, err
+	}
+	c.SetTimestamps(cfg.Metrics.Timestamps)
+	err = c.SetLabels(labelOptions(cfg, ipHashKey))
+	if err != nil {
+		return nil, err
+	}
+	err = c.SetHistograms(cfg.Metrics.Histograms.HistogramOptions())
+	if err != nil {
+		return nil, err
+	}
+	err = c.SetSLA(cfg.SLA.SLAOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var tp *tracing.Provider
+	if cfg.Tracing.Enable {
+		tp, err = tracing.NewProvider(context.Background(), cfg.Tracing.Options(cfg.Instance))
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Exporting traces via OTLP", slog.String("endpoint", cfg.Tracing.Endpoint))
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		c,
+		newBuildInfoCollector(),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	e := &exporter{
+		configPath: configPath,
+		env:        env,
+		cfg:        cfg,
+		ipHashKey:  ipHashKey,
+		speedtest:  s,
+		cache:      resultCache,
+		history:    resultHistory,
+		collector:  c,
+		registry:   reg,
+		auth:       web.NewBasicAuth(cfg.Web.BasicAuthUsers),
+		tracing:    tp,
+	}
+	c.OnResult(e.pushResult)
+	return e, nil
+}
+
+// Load the key for hashing the ip label from path, or generate a new one.
+// The generated key is only stored when persist is true, otherwise it changes with every restart.
+func loadIPHashKey(persist bool, path string) []byte {
+	if persist {
+		key, err := os.ReadFile(path)
+		if err == nil && len(key) > 0 {
+			return key
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Failed to read the key for hashing the ip label, generating a new one", slog.String("file", path), "err", err)
+		}
+	}
+
+	key := make([]byte, collector.IPHashKeyLength)
+	_, _ = rand.Read(key)
+	if !persist {
+		return key
+	}
+
+	err := os.WriteFile(path, key, 0600)
+	if err != nil {
+		slog.Error("Failed to store the key for hashing the ip label, the hash will change on restart", slog.String("file", path), "err", err)
+	}
+	return key
+}
+
+// Return the label options of the config, falling back to the generated key for hashing the ip label
+func labelOptions(cfg config.Config, ipHashKey []byte) collector.LabelOptions {
+	opts := cfg.Metrics.LabelOptions()
+	if len(opts.IPHashKey) == 0 {
+		opts.IPHashKey = ipHashKey
+	}
+	return opts
+}
+
+// Create a collector exporting the build information as labels of a constant metric
+func newBuildInfoCollector() prometheus.Collector {
+	info := version.BuildInfo()
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_exporter_build_info",
+		Help: "A metric with a constant '1' value labeled by version, commit and goversion from which speedtest-exporter was built",
+	}, []string{"version", "commit", "goversion"})
+	buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+	return buildInfo
+}
+
+// Create the remote write client from the given config.
+// Failed pushes are persisted in queueDir, or only kept in memory when it is empty.
+func createRemoteWriteClient(cfg config.RemoteConfig, reg *prometheus.Registry, queueDir string) (*remote.Client, error) {
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		remote.WithQueue(queueDir, int64(cfg.Queue.MaxSizeMB)<<20),
+		remote.WithMaxBackoff(cfg.Queue.MaxBackoff),
+	)
+	return remote.NewClient(cfg.URL, reg, opts...)
+}
+
+// Start a remote write client for every enabled target in the config.
+// Assumes the caller holds the lock.
+func (e *exporter) startRemoteWrite(cfg config.Config) error {
+	return start(e.prepareRemoteWrite(cfg))
+}
+
+// Create a remote write client for every enabled target in the config.
+// Returns a function replacing the running clients with them.
+// The old clients are stopped before the new ones are started, as they share the queue directory of their target.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareRemoteWrite(cfg config.Config) (func() error, error) {
+	targets := cfg.Remote.Enabled()
+	rwClients := make([]*remote.Client, 0, len(targets))
+	for _, target := range targets {
+		rwClient, err := createRemoteWriteClient(target, e.registry, e.remoteQueueDir(target.Name))
+		if err != nil {
+			return nil, err
+		}
+		rwClients = append(rwClients, rwClient)
+	}
+
+	return func() error {
+		e.stopRemoteWrite()
+
+		if len(rwClients) == 0 {
+			return nil
+		}
+
+		for i, rwClient := range rwClients {
+			err := e.runRemoteWrite(rwClient, targets[i])
+			if err != nil {
+				e.stopRemoteWriteClients(rwClients[:i])
+				return err
+			}
+		}
+		e.rwClients.Store(&rwClients)
+		return nil
+	}, nil
+}
+
+// Register the metrics of the client and start it in the push mode of the target
+func (e *exporter) runRemoteWrite(rwClient *remote.Client, target config.RemoteConfig) error {
+	// Exposes the queue metrics, which are pushed as well
+	err := e.registry.Register(rwClient)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Starting remote_write client", slog.String("target", rwClient.Name()), slog.String("push", target.Push), slog.String("interval", target.Interval.String()))
+	if target.Push == config.PUSH_COMPLETION {
+		// The gatherer is still collected on every interval, to keep running speedtests
+		err = rwClient.RunOnCompletion(target.Interval, target.Heartbeat, e.collector.UpGatherer())
+	} else {
+		err = rwClient.Run(target.Interval)
+	}
+	if err != nil {
+		e.registry.Unregister(rwClient)
+		return err
+	}
+	return nil
+}
+
+// Stop the remote write clients if they are running.
+// Assumes the caller holds the lock.
+func (e *exporter) stopRemoteWrite() {
+	rwClients := e.rwClients.Swap(nil)
+	if rwClients == nil {
+		return
+	}
+	e.stopRemoteWriteClients(*rwClients)
+}
+
+func (e *exporter) stopRemoteWriteClients(rwClients []*remote.Client) {
+	for _, rwClient := range rwClients {
+		rwClient.Stop()
+		e.registry.Unregister(rwClient)
+	}
+}
+
+// Return the running remote write clients, can be called without holding the lock
+func (e *exporter) remoteWriteClients() []*remote.Client {
+	rwClients := e.rwClients.Load()
+	if rwClients == nil {
+		return nil
+	}
+	return *rwClients
+}
+
+// Failed remote_write pushes are persisted next to the cache, when the cache is persisted.
+// Every target has its own queue.
+func (e *exporter) remoteQueueDir(target string) string {
+	if !e.cache.Persistent() {
+		return ""
+	}
+	return filepath.Join(remoteQueuePath, target)
+}
+
+// Create the OTLP metrics client from the given config
+func createOTLPClient(cfg config.OTLPConfig, reg *prometheus.Registry) (*otlp.Client, error) {
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	return otlp.NewClient(cfg.Endpoint, reg, opts...)
+}
+
+// Start the OTLP metrics client if enabled in the config.
+// Assumes the caller holds the lock.
+func (e *exporter) startOTLP(cfg config.Config) error {
+	return start(e.prepareOTLP(cfg))
+}
+
+// Create the OTLP metrics client if enabled in the config.
+// Returns a function replacing the running client with it.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareOTLP(cfg config.Config) (func() error, error) {
+	var otlpClient *otlp.Client
+	if cfg.OTLP.Enable {
+		var err error
+		otlpClient, err = createOTLPClient(cfg.OTLP, e.registry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		e.stopOTLP()
+
+		if otlpClient == nil {
+			return nil
+		}
+
+		// Without an interval the client only pushes when triggered by a completed speedtest
+		var interval time.Duration
+		if cfg.OTLP.Push == config.PUSH_INTERVAL {
+			interval = cfg.OTLP.Interval
+		}
+		slog.Info("Starting OTLP metrics client", slog.String("endpoint", cfg.OTLP.Endpoint), slog.String("push", cfg.OTLP.Push), slog.String("interval", interval.String()))
+		err := otlpClient.Run(interval)
+		if err != nil {
+			return err
+		}
+		e.otlpClient.Store(otlpClient)
+		return nil
+	}, nil
+}
+
+// Stop the OTLP metrics client if it is running.
+// Assumes the caller holds the lock.
+func (e *exporter) stopOTLP() {
+	otlpClient := e.otlpClient.Swap(nil)
+	if otlpClient == nil {
+		return
+	}
+	otlpClient.Stop()
+}
+
+// Start the influx client if enabled in the config.
+// Assumes the caller holds the lock.
+func (e *exporter) startInflux(cfg config.Config) error {
+	return start(e.prepareInflux(cfg))
+}
+
+// Create the influx client if enabled in the config.
+// Returns a function replacing the running client with it.
+// Points still queued in the old client are written before it is replaced.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareInflux(cfg config.Config) (func() error, error) {
+	var influxClient *influx.Client
+	if cfg.Influx.Enable {
+		var err error
+		influxClient, err = influx.NewClient(cfg.Influx.Options())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		e.stopInflux(context.Background())
+
+		if influxClient == nil {
+			return nil
+		}
+
+		slog.Info("Starting influx client", slog.String("url", cfg.Influx.URL), slog.String("flushInterval", cfg.Influx.FlushInterval.String()))
+		err := influxClient.Run()
+		if err != nil {
+			return err
+		}
+		e.influxClient.Store(influxClient)
+		return nil
+	}, nil
+}
+
+// Stop the influx client if it is running and write the remaining points.
+// Assumes the caller holds the lock.
+func (e *exporter) stopInflux(ctx context.Context) {
+	influxClient := e.influxClient.Swap(nil)
+	if influxClient == nil {
+		return
+	}
+	influxClient.Stop()
+
+	err := influxClient.Flush(ctx)
+	if err != nil {
+		slog.Error("Failed to write remaining points to influx", "err", err)
+	}
+}
+
+// Start the MQTT client if enabled in the config.
+// Assumes the caller holds the lock.
+func (e *exporter) startMQTT(cfg config.Config) error {
+	return start(e.prepareMQTT(cfg))
+}
+
+// Create the MQTT client if enabled in the config.
+// Returns a function replacing the running client with it.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareMQTT(cfg config.Config) (func() error, error) {
+	var mqttClient *mqtt.Client
+	if cfg.MQTT.Enable {
+		opts, err := cfg.MQTT.ClientOptions(cfg.Instance)
+		if err != nil {
+			return nil, err
+		}
+		// Published results contain the client IP, which is converted like the ip label of the metrics
+		opts = append(opts, mqtt.WithIPAnonymizer(e.collector.AnonymizeIP))
+		mqttClient, err = mqtt.NewClient(cfg.MQTT.Broker, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		e.stopMQTT()
+
+		if mqttClient == nil {
+			return nil
+		}
+
+		slog.Info("Starting MQTT client", slog.String("broker", cfg.MQTT.Broker), slog.Bool("discovery", cfg.MQTT.Discovery.Enable))
+		err := mqttClient.Run()
+		if err != nil {
+			return err
+		}
+		e.mqttClient.Store(mqttClient)
+		return nil
+	}, nil
+}
+
+// Stop the MQTT client if it is running, which marks the exporter as offline.
+// Assumes the caller holds the lock.
+func (e *exporter) stopMQTT() {
+	mqttClient := e.mqttClient.Swap(nil)
+	if mqttClient == nil {
+		return
+	}
+	mqttClient.Stop()
+}
+
+// Start the pushgateway client if enabled in the config.
+// Assumes the caller holds the lock and e.cfg still contains the config of the running client.
+func (e *exporter) startPushgateway(cfg config.Config) error {
+	return start(e.preparePushgateway(cfg))
+}
+
+// Create the pushgateway client if enabled in the config.
+// Returns a function replacing the running client with it.
+// Assumes the caller holds the lock and e.cfg still contains the config of the running client.
+func (e *exporter) preparePushgateway(cfg config.Config) (func() error, error) {
+	var pgClient *pushgateway.Client
+	if cfg.Pushgateway.Enable {
+		opts, err := cfg.Pushgateway.ClientOptions()
+		if err != nil {
+			return nil, err
+		}
+		pgClient, err = pushgateway.NewClient(cfg.Pushgateway.URL, cfg.Pushgateway.JobName, e.registry, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		// The group of the old client would otherwise keep its last values forever
+		e.stopPushgateway(e.cfg.Pushgateway.DeleteOnShutdown)
+
+		if pgClient == nil {
+			return nil
+		}
+
+		slog.Info("Starting pushgateway client", slog.String("url", cfg.Pushgateway.URL), slog.String("job", cfg.Pushgateway.JobName), slog.String("instance", cfg.Pushgateway.Instance))
+		err := pgClient.Run()
+		if err != nil {
+			return err
+		}
+		e.pgClient.Store(pgClient)
+		return nil
+	}, nil
+}
+
+// Stop the pushgateway client if it is running and optionally delete its group from the pushgateway.
+// Assumes the caller holds the lock.
+func (e *exporter) stopPushgateway(deleteGroup bool) {
+	pgClient := e.pgClient.Swap(nil)
+	if pgClient == nil {
+		return
+	}
+	pgClient.Stop()
+
+	if !deleteGroup {
+		return
+	}
+	slog.Info("Deleting metrics from pushgateway")
+	err := pgClient.Delete()
+	if err != nil {
+		slog.Error("Failed to delete metrics from pushgateway", "err", err)
+	}
+}
+
+// Start the notifier if enabled in the config.
+// Assumes the caller holds the lock.
+func (e *exporter) startNotify(cfg config.Config) error {
+	return start(e.prepareNotify(cfg))
+}
+
+// Create the notifier if enabled in the config.
+// Returns a function replacing the running notifier with it.
+// The state of breached thresholds is not carried over, so a persisting breach is notified again.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareNotify(cfg config.Config) (func() error, error) {
+	var notifier *notify.Notifier
+	if cfg.Notify.Enable {
+		opts, err := cfg.Notify.NotifierOptions(cfg.Instance, cfg.SLA)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err = notify.NewNotifier(opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		e.stopNotify(context.Background())
+
+		if notifier == nil {
+			return nil
+		}
+
+		slog.Info("Starting notifier", slog.Int("channels", cfg.Notify.Channels()))
+		err := notifier.Run()
+		if err != nil {
+			return err
+		}
+		e.notifier.Store(notifier)
+		return nil
+	}, nil
+}
+
+// Stop the notifier if it is running and send the notifications for the remaining results.
+// Assumes the caller holds the lock.
+func (e *exporter) stopNotify(ctx context.Context) {
+	notifier := e.notifier.Swap(nil)
+	if notifier == nil {
+		return
+	}
+	notifier.Stop()
+	notifier.Flush(ctx)
+}
+
+// Start the reporter if enabled in the config.
+// Assumes the caller holds the lock.
+func (e *exporter) startReport(cfg config.Config) error {
+	return start(e.prepareReport(cfg))
+}
+
+// Create the reporter if enabled in the config.
+// Returns a function replacing the running reporter with it.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareReport(cfg config.Config) (func() error, error) {
+	var reporter *report.Reporter
+	if cfg.Report.Enable {
+		opts, err := cfg.Report.ReporterOptions(cfg.Instance, cfg.SLA)
+		if err != nil {
+			return nil, err
+		}
+		reporter, err = report.NewReporter(cfg.Report.SMTP.Host, cfg.Report.From, cfg.Report.To, e.history, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		e.stopReport()
+
+		if reporter == nil {
+			return nil
+		}
+
+		slog.Info("Starting reporter", slog.String("schedule", cfg.Report.Schedule), slog.String("smtp", cfg.Report.SMTP.Host), slog.Int("recipients", len(cfg.Report.To)))
+		err := reporter.Run()
+		if err != nil {
+			return err
+		}
+		e.reporter.Store(reporter)
+		return nil
+	}, nil
+}
+
+// Stop the reporter if it is running.
+// Assumes the caller holds the lock.
+func (e *exporter) stopReport() {
+	reporter := e.reporter.Swap(nil)
+	if reporter == nil {
+		return
+	}
+	reporter.Stop()
+}
+
+// Start the scheduler if an output depends on speedtests being run without scrapes.
+// Assumes the caller holds the lock.
+func (e *exporter) startScheduler(cfg config.Config) error {
+	return start(e.prepareScheduler(cfg))
+}
+
+// Create the scheduler if an output depends on speedtests being run without scrapes.
+// Returns a function replacing the running scheduler with it.
+// Assumes the caller holds the lock.
+func (e *exporter) prepareScheduler(cfg config.Config) (func() error, error) {
+	var scheduler *collector.Scheduler
+	if cfg.ScheduleSpeedtests() {
+		var err error
+		scheduler, err = collector.NewScheduler(e.collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		e.stopScheduler()
+
+		if scheduler == nil {
+			return nil
+		}
+
+		slog.Info("Scheduling speedtests, as an output depends on them", slog.String("interval", cfg.Cache.String()))
+		err := scheduler.Run()
+		if err != nil {
+			return err
+		}
+		e.scheduler.Store(scheduler)
+		return nil
+	}, nil
+}
+
+// Stop the scheduler if it is running.
+// Assumes the caller holds the lock.
+func (e *exporter) stopScheduler() {
+	scheduler := e.scheduler.Swap(nil)
+	if scheduler == nil {
+		return
+	}
+	scheduler.Stop()
+}
+
+// Request a push of the new result from the clients that push on completion.
+// Called by the collector while the speedtest lock is held, so it must not block or take the exporter lock.
+func (e *exporter) pushResult(result *speedtest.SpeedtestResult) {
+	if rwClients := e.remoteWriteClients(); len(rwClients) > 0 {
+		gatherer := e.collector.ResultGatherer(result)
+		for _, rwClient := range rwClients {
+			rwClient.Enqueue(gatherer)
+		}
+	}
+	if otlpClient := e.otlpClient.Load(); otlpClient != nil {
+		otlpClient.Trigger()
+	}
+	if influxClient := e.influxClient.Load(); influxClient != nil {
+		influxClient.Add(result)
+	}
+	if mqttClient := e.mqttClient.Load(); mqttClient != nil {
+		mqttClient.Publish(result)
+	}
+	if pgClient := e.pgClient.Load(); pgClient != nil {
+		pgClient.Trigger()
+	}
+	if notifier := e.notifier.Load(); notifier != nil {
+		notifier.Notify(e.anonymizeResult(result))
+	}
+}
+
+// Gracefully stop all components of the exporter.
+// Waits for a running speedtest to finish, but cancels it once ctx expires.
+// Afterwards pushes the final result via remote_write, OTLP, influx and MQTT, sends the remaining notifications
+// and exports the remaining spans, to ensure they are not lost.
+// The flushes get their own deadline of flushTimeout, so they are not skipped when waiting for the speedtest used up ctx.
+// The group in the pushgateway is deleted when configured, otherwise it keeps the last pushed result.
+// The cache is saved to disk after every speedtest, so it does not need to be persisted here.
+func (e *exporter) Shutdown(ctx context.Context) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.stopScheduler()
+	e.collector.Shutdown(ctx)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+	defer cancel()
+
+	if rwClients := e.remoteWriteClients(); len(rwClients) > 0 {
+		e.stopRemoteWrite()
+
+		slog.Info("Flushing metrics via remote_write")
+		for _, rwClient := range rwClients {
+			err := rwClient.Flush(ctx)
+			if err != nil {
+				slog.Error("Failed to flush metrics via remote_write", slog.String("target", rwClient.Name()), "err", err)
+			}
+		}
+	}
+
+	if otlpClient := e.otlpClient.Load(); otlpClient != nil {
+		e.stopOTLP()
+
+		slog.Info("Flushing metrics via OTLP")
+		err := otlpClient.Push(ctx)
+		if err != nil {
+			slog.Error("Failed to flush metrics via OTLP", "err", err)
+		}
+	}
+
+	if e.influxClient.Load() != nil {
+		slog.Info("Writing remaining points to influx")
+		e.stopInflux(ctx)
+	}
+
+	e.stopMQTT()
+
+	e.stopPushgateway(e.cfg.Pushgateway.DeleteOnShutdown)
+
+	e.stopNotify(ctx)
+
+	e.stopReport()
+
+	err := e.tracing.Shutdown(ctx)
+	if err != nil {
+		slog.Error("Failed to flush traces", "err", err)
+	}
+}
+
+// A component of the exporter that is replaced when its config changes during a reload
+type reloadStep struct {
+	name    string
+	changed bool
+	prepare func(cfg config.Config) (func() error, error)
+}
+
+// Reload the config from disk and apply the changes to the running exporter.
+// All changed components are created before any of them is replaced, so an invalid config leaves the exporter untouched.
+// Should replacing a component fail, the already replaced ones are restored from the old config.
+// Returns an error if the new config is invalid or contains changes that require a restart,
+// in which case the exporter keeps running with the old config.
+func (e *exporter) Reload() error {
+	e.Lock()
+	defer e.Unlock()
+
+	cfg, level, err := config.ReloadConfig(e.cfg, e.configPath, e.env)
+	if err != nil {
+		return err
+	}
+
+	// Validated upfront, so applying them after the components were replaced can not fail
+	err = labelOptions(cfg, e.ipHashKey).Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.Metrics.Histograms.HistogramOptions().Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.SLA.SLAOptions().Validate()
+	if err != nil {
+		return err
+	}
+
+	steps := []reloadStep{
+		{"remote_write", !reflect.DeepEqual(cfg.Remote, e.cfg.Remote), e.prepareRemoteWrite},
+		{"otlp", !reflect.DeepEqual(cfg.OTLP, e.cfg.OTLP), e.prepareOTLP},
+		{"mqtt", !reflect.DeepEqual(cfg.MQTT, e.cfg.MQTT) || (cfg.MQTT.Enable && cfg.Instance != e.cfg.Instance), e.prepareMQTT},
+		{"influx", cfg.Influx != e.cfg.Influx, e.prepareInflux},
+		{"pushgateway", !reflect.DeepEqual(cfg.Pushgateway, e.cfg.Pushgateway), e.preparePushgateway},
+		{"notify", !reflect.DeepEqual(cfg.Notify, e.cfg.Notify) || (cfg.Notify.Enable && (cfg.Instance != e.cfg.Instance || cfg.SLA != e.cfg.SLA)), e.prepareNotify},
+		{"report", !reflect.DeepEqual(cfg.Report, e.cfg.Report) || (cfg.Report.Enable && (cfg.Instance != e.cfg.Instance || cfg.SLA != e.cfg.SLA)), e.prepareReport},
+		// Started last, so the outputs depending on it are running when the first speedtest completes
+		{"scheduler", cfg.ScheduleSpeedtests() != e.cfg.ScheduleSpeedtests(), e.prepareScheduler},
+	}
+
+	// The created components are not running yet, so they can simply be dropped on error
+	apply := make([]func() error, len(steps))
+	for i, step := range steps {
+		if !step.changed {
+			continue
+		}
+		apply[i], err = step.prepare(cfg)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range steps {
+		if apply[i] == nil {
+			continue
+		}
+		err = apply[i]()
+		if err != nil {
+			e.rollbackReload(steps[:i+1])
+			return err
+		}
+	}
+
+	// The options were validated above, so setting them can not fail
+	_ = e.collector.SetLabels(labelOptions(cfg, e.ipHashKey))
+	_ = e.collector.SetHistograms(cfg.Metrics.Histograms.HistogramOptions())
+	_ = e.collector.SetSLA(cfg.SLA.SLAOptions())
+	if cfg.Cache != e.cfg.Cache {
+		e.cache.SetCacheTime(cfg.Cache)
+	}
+	if cfg.HistoryRetention() != e.cfg.HistoryRetention() {
+		e.history.SetRetention(cfg.HistoryRetention())
+	}
+	if cfg.Instance != e.cfg.Instance {
+		e.collector.SetInstance(cfg.Instance)
+	}
+	e.collector.SetTimestamps(cfg.Metrics.Timestamps)
+	e.auth.SetUsers(cfg.Web.BasicAuthUsers)
+	config.SetLogLevel(level)
+
+	e.cfg = cfg
+	slog.Info("Reloaded configuration", slog.String("path", e.configPath))
+	return nil
+}
+
+// Restore the components replaced during a failed reload from the old config, which is still stored in e.cfg.
+// Assumes the caller holds the lock.
+func (e *exporter) rollbackReload(steps []reloadStep) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		if !steps[i].changed {
+			continue
+		}
+		err := start(steps[i].prepare(e.cfg))
+		if err != nil {
+			slog.Error("Failed to restore component after failed reload", slog.String("component", steps[i].name), "err", err)
+		}
+	}
+}
+
+// Replace a running component with a prepared one, unless preparing it failed
+func start(apply func() error, err error) error {
+	if err != nil {
+		return err
+	}
+	return apply()
+}
+
+// Handle requests to reload the configuration, only accepts POST requests
+func (e *exporter) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := e.Reload()
+	if err != nil {
+		slog.Error("Failed to reload configuration", slog.String("path", e.configPath), "err", err)
+		http.Error(w, "Failed to reload configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,862 @@
+package main
+
+import (
+	"context"
+	"encoding/json/v2"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/config"
+	"github.com/heathcliff26/speedtest-exporter/pkg/history"
+	"github.com/heathcliff26/speedtest-exporter/pkg/notify"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/version"
+	"github.com/heathcliff26/speedtest-exporter/pkg/web"
+	"github.com/prometheus/client_golang/exp/api/remote"
+	writev2 "github.com/prometheus/client_golang/exp/api/remote/genproto/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Write the given config content to path
+func writeTestConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600), "Should write config file")
+}
+
+// Create a new exporter from a config file in a temporary directory
+func newTestExporter(t *testing.T, content string) (*exporter, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, content)
+
+	cfg, err := config.LoadConfig(path, false)
+	require.NoError(t, err, "Should load config")
+
+	e, err := newExporter(cfg, path, false)
+	require.NoError(t, err, "Should create exporter")
+	t.Cleanup(func() {
+		e.Lock()
+		defer e.Unlock()
+		e.stopRemoteWrite()
+		e.stopOTLP()
+		e.stopInflux(context.Background())
+		e.stopMQTT()
+		e.stopPushgateway(false)
+		e.stopReport()
+		e.stopScheduler()
+	})
+	return e, path
+}
+
+func TestNewExporterRegistersCollectors(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.PersistCache = false
+	e, err := newExporter(cfg, "", false)
+	require.NoError(t, err, "Should create exporter")
+
+	for name, c := range map[string]prometheus.Collector{
+		"BuildInfo": newBuildInfoCollector(),
+		"Go":        collectors.NewGoCollector(),
+		"Process":   collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := e.registry.Register(c)
+			assert.ErrorAs(t, err, &prometheus.AlreadyRegisteredError{}, "Should already be registered")
+		})
+	}
+}
+
+func TestLoadIPHashKey(t *testing.T) {
+	t.Run("Persist", func(t *testing.T) {
+		assert := assert.New(t)
+
+		path := filepath.Join(t.TempDir(), "ip-hash-key")
+		key := loadIPHashKey(true, path)
+		assert.Len(key, collector.IPHashKeyLength, "Should generate a new key")
+
+		stored, err := os.ReadFile(path)
+		require.NoError(t, err, "Should store the key")
+		assert.Equal(key, stored)
+		assert.Equal(key, loadIPHashKey(true, path), "Should load the stored key")
+	})
+	t.Run("ConfiguredFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ip-hash-key")
+		writeTestConfig(t, path, "my-secret")
+
+		assert.Equal(t, []byte("my-secret"), loadIPHashKey(true, path), "Should use the existing key")
+	})
+	t.Run("InMemory", func(t *testing.T) {
+		assert := assert.New(t)
+
+		path := filepath.Join(t.TempDir(), "ip-hash-key")
+		key := loadIPHashKey(false, path)
+		assert.Len(key, collector.IPHashKeyLength, "Should generate a new key")
+		assert.NotEqual(key, loadIPHashKey(false, path), "Should generate a different key every time")
+		assert.NoFileExists(path, "Should not store the key")
+	})
+}
+
+func TestLabelOptions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	assert.Equal(t, []byte("generated"), labelOptions(cfg, []byte("generated")).IPHashKey, "Should use the generated key")
+
+	cfg.Metrics.IPHashKey = "configured"
+	assert.Equal(t, []byte("configured"), labelOptions(cfg, []byte("generated")).IPHashKey, "Should prefer the configured key")
+}
+
+func TestBuildInfoCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(newBuildInfoCollector())
+
+	families, err := reg.Gather()
+	require.NoError(t, err, "Should gather metrics")
+	require.Len(t, families, 1)
+
+	info := version.BuildInfo()
+	assert.Equal("speedtest_exporter_build_info", families[0].GetName())
+	metric := families[0].GetMetric()[0]
+	assert.Equal(1.0, metric.GetGauge().GetValue())
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, l := range metric.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	assert.Equal(map[string]string{"version": info.Version, "commit": info.Commit, "goversion": info.GoVersion}, labels)
+}
+
+func TestReload(t *testing.T) {
+	t.Run("ApplyChanges", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e, path := newTestExporter(t, "instance: \"old\"\ncache: \"5m\"\npersistCache: false\n")
+		writeTestConfig(t, path, "logLevel: \"debug\"\ninstance: \"new\"\ncache: \"10m\"\npersistCache: false\nmetrics:\n  timestamps: true\nsla:\n  download: 100\n  window: \"24h\"\n")
+
+		assert.NoError(e.Reload(), "Should reload config")
+		assert.Equal("new", e.collector.Instance(), "Should update the instance label")
+		assert.Equal(10*time.Minute, e.cfg.Cache, "Should update the cache time")
+		assert.True(e.collector.Timestamps(), "Should enable timestamps")
+		assert.Equal(100.0, e.collector.SLA().Download, "Should update the sla")
+		assert.Equal(24*time.Hour, e.history.Retention(), "Should update the history retention")
+		assert.Empty(e.remoteWriteClients(), "Should not start remote write")
+		assert.True(slog.Default().Enabled(t.Context(), slog.LevelDebug), "Should apply the new log level")
+		config.SetLogLevel(slog.LevelInfo)
+	})
+	t.Run("StartReport", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e, path := newTestExporter(t, "persistCache: false\nsla:\n  window: \"24h\"\n")
+		assert.Nil(e.reporter.Load(), "Should not start the reporter by default")
+
+		writeTestConfig(t, path, "persistCache: false\nsla:\n  window: \"24h\"\nreport:\n  enable: true\n  from: \"speedtest@example.org\"\n  to: [\"admin@example.org\"]\n  smtp:\n    host: \"smtp.example.org\"\n")
+		assert.NoError(e.Reload(), "Should reload config")
+
+		reporter := e.reporter.Load()
+		require.NotNil(t, reporter, "Should start the reporter")
+		assert.True(reporter.IsRunning())
+		assert.Equal(7*24*time.Hour, e.history.Retention(), "Should keep the results of a weekly report")
+		assert.NotNil(e.scheduler.Load(), "Should schedule speedtests for the report")
+
+		writeTestConfig(t, path, "persistCache: false\nsla:\n  window: \"24h\"\n")
+		assert.NoError(e.Reload(), "Should reload config")
+		assert.Nil(e.reporter.Load(), "Should stop the reporter")
+		assert.False(reporter.IsRunning())
+		assert.Equal(24*time.Hour, e.history.Retention(), "Should reset the history retention")
+		assert.Nil(e.scheduler.Load(), "Should stop scheduling speedtests")
+	})
+	t.Run("RestartRequired", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e, path := newTestExporter(t, "instance: \"old\"\npersistCache: false\n")
+		writeTestConfig(t, path, "instance: \"new\"\nport: 9090\npersistCache: false\n")
+
+		err := e.Reload()
+		assert.Equal(&config.ErrRestartRequired{Options: []string{"port"}}, err, "Should reject changed port")
+		assert.Equal("old", e.collector.Instance(), "Should keep the old instance label")
+		assert.Equal(config.DEFAULT_PORT, e.cfg.Port, "Should keep the old config")
+	})
+	t.Run("InvalidConfig", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e, path := newTestExporter(t, "instance: \"old\"\npersistCache: false\n")
+		writeTestConfig(t, path, "instance: \"new\"\ncache: \"not-a-time\"\npersistCache: false\n")
+
+		assert.Error(e.Reload(), "Should fail to reload invalid config")
+		assert.Equal("old", e.collector.Instance(), "Should keep the old instance label")
+	})
+	t.Run("KeepsRunningConfigOnFailure", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e, path := newTestExporter(t, "instance: \"old\"\npersistCache: false\n")
+		writeTestConfig(t, path, "logLevel: \"debug\"\ninstance: \"new\"\ncache: \"10m\"\npersistCache: false\nmqtt:\n  enable: true\n  broker: \"tcp://127.0.0.1:1883\"\nreport:\n  enable: true\n  from: \"speedtest@example.org\"\n  to: [\"admin@example.org\"]\n  smtp:\n    host: \"smtp.example.org\"\n    tls:\n      caFile: \"testdata/missing.crt\"\n")
+
+		assert.Error(e.Reload(), "Should fail to create the reporter")
+		assert.Nil(e.mqttClient.Load(), "Should not start the MQTT client")
+		assert.Nil(e.reporter.Load(), "Should not start the reporter")
+		assert.Equal("old", e.collector.Instance(), "Should keep the old instance label")
+		assert.Equal(config.DEFAULT_CACHE, e.cfg.Cache, "Should keep the old config")
+		assert.False(e.cfg.MQTT.Enable, "Should keep the old config")
+		assert.False(slog.Default().Enabled(t.Context(), slog.LevelDebug), "Should keep the old log level")
+	})
+	t.Run("RollbackOnFailure", func(t *testing.T) {
+		assert := assert.New(t)
+
+		oldCfg := "instance: \"old\"\npersistCache: false\nremote:\n  - enable: true\n    name: \"a\"\n    url: \"http://127.0.0.1:1/\"\n"
+		e, path := newTestExporter(t, oldCfg)
+		require.NoError(t, e.startRemoteWrite(e.cfg), "Should start remote write")
+		old := e.remoteWriteClients()
+		require.Len(t, old, 1)
+
+		// Occupies the metrics of the new target, so registering its client fails
+		conflict := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "speedtest_remote_write_queue_length",
+			Help:        "Number of remote_write requests waiting to be sent",
+			ConstLabels: prometheus.Labels{"target": "b"},
+		})
+		e.registry.MustRegister(conflict)
+
+		writeTestConfig(t, path, oldCfg+"  - enable: true\n    name: \"b\"\n    url: \"http://127.0.0.1:1/\"\n")
+		assert.Error(e.Reload(), "Should fail to start the new target")
+
+		rwClients := e.remoteWriteClients()
+		require.Len(t, rwClients, 1, "Should restore the old target")
+		assert.Equal("a", rwClients[0].Name())
+		assert.True(rwClients[0].IsRunning(), "Should run the restored client")
+		assert.False(old[0].IsRunning(), "Should have stopped the old client")
+		assert.Len(e.cfg.Remote, 1, "Should keep the old config")
+		assert.Equal("old", e.collector.Instance(), "Should keep the old instance label")
+	})
+	t.Run("BasicAuthUsers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e, path := newTestExporter(t, "persistCache: false\n")
+		server, err := createServer(e)
+		require.NoError(t, err, "Should create server")
+
+		writeTestConfig(t, path, "persistCache: false\nweb:\n  basicAuthUsers:\n    somebody: \"$2a$10$K1H1Cu6SHY8CdV600KAYAe81MpQrK.fadY4Op1qzGQJsZYtoq01si\"\n")
+		assert.NoError(e.Reload(), "Should reload config")
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, req)
+		assert.Equal(http.StatusUnauthorized, rr.Code, "Should require authentication")
+
+		rr = httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(http.StatusOK, rr.Code, "Probes should not require authentication")
+
+		req.SetBasicAuth("somebody", "password")
+		rr = httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, req)
+		assert.Equal(http.StatusOK, rr.Code, "Should accept valid credentials")
+	})
+}
+
+func TestReloadHandler(t *testing.T) {
+	e, path := newTestExporter(t, "instance: \"old\"\npersistCache: false\n")
+	server, err := createServer(e)
+	require.NoError(t, err, "Should create server")
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/-/reload", nil)
+		rr := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+	t.Run("Success", func(t *testing.T) {
+		writeTestConfig(t, path, "instance: \"new\"\npersistCache: false\n")
+
+		req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+		rr := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "new", e.collector.Instance())
+	})
+	t.Run("Failure", func(t *testing.T) {
+		writeTestConfig(t, path, "instance: \"new\"\npersistCache: true\n")
+
+		req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+		rr := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "persistCache")
+	})
+}
+
+// Create a new exporter that uses a mock speedtest
+func newMockExporter(t *testing.T, cfg config.Config) *exporter {
+	t.Helper()
+
+	resultCache := cache.NewCache(false, "", cfg.Cache)
+	resultHistory := history.NewHistory(false, "", cfg.SLA.Window)
+	s := &speedtest.MockSpeedtest{Result: speedtest.MockSpeedtestResult(time.Now().UnixMilli())}
+	c, err := collector.NewCollector(resultCache, resultHistory, s, cfg.Instance)
+	require.NoError(t, err, "Should create collector")
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	e := &exporter{
+		cfg:       cfg,
+		speedtest: s,
+		cache:     resultCache,
+		history:   resultHistory,
+		collector: c,
+		registry:  reg,
+		auth:      web.NewBasicAuth(nil),
+	}
+	c.OnResult(e.pushResult)
+	return e
+}
+
+// Create an enabled remote write target with the defaults applied by the config
+func newRemoteTarget(cfg config.Config, name, url string) config.RemoteConfig {
+	target := config.DefaultRemoteConfig()
+	target.Enable = true
+	target.Name = name
+	target.URL = url
+	target.Instance = cfg.Instance
+	target.Interval = cfg.Cache
+	return target
+}
+
+// Returns true if the registry contains a metric with the given name
+func hasMetric(t *testing.T, reg prometheus.Gatherer, name string) bool {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err, "Should gather metrics")
+	for _, family := range families {
+		if family.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var pushes atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushes.Add(1)
+		w.Header().Set("X-Prometheus-Remote-Write-Samples-Written", "1")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Remote = config.RemoteTargets{newRemoteTarget(cfg, config.DEFAULT_REMOTE_NAME, receiver.URL)}
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startRemoteWrite(cfg), "Should start remote write")
+	require.Eventually(func() bool {
+		return pushes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push metrics on start")
+	assert.True(hasMetric(t, e.registry, "speedtest_remote_write_queue_length"), "Should expose the queue metrics")
+
+	e.Shutdown(t.Context())
+
+	assert.Equal(int32(2), pushes.Load(), "Should flush metrics on shutdown")
+	assert.Empty(e.remoteWriteClients(), "Should stop remote write client")
+	assert.False(hasMetric(t, e.registry, "speedtest_remote_write_queue_length"), "Should remove the queue metrics")
+	_, valid := e.cache.Read()
+	assert.True(valid, "Should keep the result in the cache")
+}
+
+func TestShutdownFlushesAfterDeadline(t *testing.T) {
+	var pushes atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushes.Add(1)
+		w.Header().Set("X-Prometheus-Remote-Write-Samples-Written", "1")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Remote = config.RemoteTargets{newRemoteTarget(cfg, config.DEFAULT_REMOTE_NAME, receiver.URL)}
+	e := newMockExporter(t, cfg)
+
+	require.NoError(t, e.startRemoteWrite(cfg), "Should start remote write")
+	require.Eventually(t, func() bool {
+		return pushes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push metrics on start")
+
+	// Waiting for the speedtest used up the whole shutdown timeout
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	e.Shutdown(ctx)
+
+	assert.Equal(t, int32(2), pushes.Load(), "Should still flush metrics on shutdown")
+}
+
+// Records the received remote_write requests
+type rwStore struct {
+	requests []*writev2.Request
+	lock     sync.Mutex
+}
+
+func (s *rwStore) Store(req *http.Request, _ remote.WriteMessageType) (*remote.WriteResponse, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	r := &writev2.Request{}
+	err = r.UnmarshalVT(body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r)
+	return remote.NewWriteResponse(), nil
+}
+
+func (s *rwStore) Requests() []*writev2.Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*writev2.Request(nil), s.requests...)
+}
+
+func TestRemoteWritePushOnCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := &rwStore{}
+	receiver := httptest.NewServer(remote.NewWriteHandler(store, remote.MessageTypes{remote.WriteV2MessageType}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	target := newRemoteTarget(cfg, config.DEFAULT_REMOTE_NAME, receiver.URL)
+	target.Push = config.PUSH_COMPLETION
+	cfg.Remote = config.RemoteTargets{target}
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startRemoteWrite(cfg), "Should start remote write")
+	require.Eventually(func() bool {
+		return len(store.Requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push after the speedtest completed")
+
+	result, valid := e.cache.Read()
+	require.True(valid, "Should have run a speedtest")
+
+	req := store.Requests()[0]
+	names := make([]string, 0, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		labels := writev2.DesymbolizeLabels(ts.LabelsRefs, req.Symbols, nil)
+		names = append(names, labels[1])
+		require.Len(ts.Samples, 1)
+		assert.Equal(result.Timestamp(), ts.Samples[0].Timestamp, "Should use the timestamp of the result for %s", labels[1])
+	}
+	assert.Contains(names, "speedtest_download_megabits_per_second", "Should push the result")
+	assert.Contains(names, "speedtest_up", "Should push the status of the result")
+	assert.NotContains(names, "speedtest_remote_write_queue_length", "Should only push the result")
+
+	_, err := e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(store.Requests(), 1, "Should not push cached results again")
+
+	e.Shutdown(t.Context())
+
+	assert.Len(store.Requests(), 1, "Should not push anything new on shutdown")
+	assert.Empty(e.remoteWriteClients(), "Should stop remote write client")
+}
+
+func TestRemoteWriteMultipleTargets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	working := &rwStore{}
+	workingReceiver := httptest.NewServer(remote.NewWriteHandler(working, remote.MessageTypes{remote.WriteV2MessageType}))
+	t.Cleanup(workingReceiver.Close)
+	failingReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failingReceiver.Close)
+
+	cfg := config.DefaultConfig()
+	mimir := newRemoteTarget(cfg, "mimir", workingReceiver.URL)
+	mimir.Relabel = []config.RelabelConfig{{TargetLabel: "cluster", Replacement: "lab"}}
+	cfg.Remote = config.RemoteTargets{
+		mimir,
+		newRemoteTarget(cfg, "grafana-cloud", failingReceiver.URL),
+	}
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startRemoteWrite(cfg), "Should start remote write")
+	require.Len(e.remoteWriteClients(), 2, "Should start a client per target")
+	require.Eventually(func() bool {
+		return len(working.Requests()) == 1 && e.remoteWriteClients()[1].Status().Queued == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push to both targets")
+
+	req := working.Requests()[0]
+	labels := writev2.DesymbolizeLabels(req.Timeseries[0].LabelsRefs, req.Symbols, nil)
+	assert.Contains(labels, "cluster", "Should apply the relabel rules of the target")
+
+	res := e.health()
+	require.Len(res.RemoteWrite, 2)
+	assert.Equal("mimir", res.RemoteWrite[0].Target)
+	assert.Empty(res.RemoteWrite[0].LastError, "Should not be affected by the failing target")
+	assert.Equal("grafana-cloud", res.RemoteWrite[1].Target)
+	assert.NotEmpty(res.RemoteWrite[1].LastError)
+	assert.Equal(healthStatusDegraded, res.Status)
+
+	families, err := e.registry.Gather()
+	require.NoError(err, "Should gather metrics")
+	targets := []string{}
+	for _, family := range families {
+		if family.GetName() != "speedtest_remote_write_failed_pushes_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			targets = append(targets, m.GetLabel()[0].GetValue())
+		}
+	}
+	assert.ElementsMatch([]string{"mimir", "grafana-cloud"}, targets, "Should expose the metrics of every target")
+}
+
+func TestOTLPPushOnCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var pushes atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushes.Add(1)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.OTLP.Enable = true
+	cfg.OTLP.Endpoint = receiver.URL + "/v1/metrics"
+	cfg.OTLP.Instance = cfg.Instance
+	cfg.OTLP.Push = config.PUSH_COMPLETION
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startOTLP(cfg), "Should start OTLP client")
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(pushes.Load(), "Should not push before a speedtest completed")
+
+	_, err := e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	require.Eventually(func() bool {
+		return pushes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push after the speedtest completed")
+
+	_, err = e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(int32(1), pushes.Load(), "Should not push cached results again")
+
+	e.Shutdown(t.Context())
+
+	assert.Equal(int32(2), pushes.Load(), "Should flush metrics on shutdown")
+	assert.Nil(e.otlpClient.Load(), "Should stop OTLP client")
+}
+
+func TestOTLPPushWithoutScrape(t *testing.T) {
+	var pushes atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushes.Add(1)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.OTLP.Enable = true
+	cfg.OTLP.Endpoint = receiver.URL + "/v1/metrics"
+	cfg.OTLP.Instance = cfg.Instance
+	cfg.OTLP.Push = config.PUSH_COMPLETION
+	e := newMockExporter(t, cfg)
+	t.Cleanup(func() {
+		e.Shutdown(context.Background())
+	})
+
+	require.NoError(t, e.startOTLP(cfg), "Should start OTLP client")
+	require.NoError(t, e.startScheduler(cfg), "Should start scheduler")
+
+	require.Eventually(t, func() bool {
+		return pushes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push without the exporter being scraped")
+}
+
+func TestInfluxWriteOnCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var bodies []string
+	var lock sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Influx.Enable = true
+	cfg.Influx.URL = receiver.URL
+	cfg.Influx.Org = "home"
+	cfg.Influx.Bucket = "network"
+	cfg.Influx.Instance = cfg.Instance
+	cfg.Influx.FlushInterval = time.Hour
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startInflux(cfg), "Should start influx client")
+
+	_, err := e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	_, err = e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	assert.Equal(1, e.influxClient.Load().Status().Queued, "Should only queue new results")
+
+	e.Shutdown(t.Context())
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(bodies, 1, "Should write the queued point on shutdown")
+	assert.True(strings.HasPrefix(bodies[0], "speedtest,"))
+	assert.Nil(e.influxClient.Load(), "Should stop influx client")
+}
+
+func TestInfluxWriteWithoutScrape(t *testing.T) {
+	require := require.New(t)
+
+	var writes atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writes.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Influx.Enable = true
+	cfg.Influx.URL = receiver.URL
+	cfg.Influx.Org = "home"
+	cfg.Influx.Bucket = "network"
+	cfg.Influx.Instance = cfg.Instance
+	cfg.Influx.BatchSize = 1
+	e := newMockExporter(t, cfg)
+	t.Cleanup(func() {
+		e.Shutdown(context.Background())
+	})
+
+	require.NoError(e.startInflux(cfg), "Should start influx client")
+	require.NoError(e.startScheduler(cfg), "Should start scheduler")
+
+	require.Eventually(func() bool {
+		return writes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should write a point without the exporter being scraped")
+}
+
+func TestPushgatewayPushOnCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var requests []string
+	var lock sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		lock.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+username+":"+password)
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+	countRequests := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(requests)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Instance = "testhost"
+	cfg.Pushgateway.Enable = true
+	cfg.Pushgateway.URL = receiver.URL
+	cfg.Pushgateway.Instance = cfg.Instance
+	cfg.Pushgateway.Username = "somebody"
+	cfg.Pushgateway.Password = "secret"
+	cfg.Pushgateway.DeleteOnShutdown = true
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startPushgateway(cfg), "Should start pushgateway client")
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(countRequests(), "Should not push before a speedtest completed")
+
+	_, err := e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	require.Eventually(func() bool {
+		return countRequests() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push after the speedtest completed")
+	assert.Empty(e.pgClient.Load().Status().LastError, "Push should succeed")
+
+	e.Shutdown(t.Context())
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal([]string{
+		"PUT /metrics/job/speedtest-exporter/instance/testhost somebody:secret",
+		"DELETE /metrics/job/speedtest-exporter/instance/testhost somebody:secret",
+	}, requests, "Should delete the group on shutdown")
+	assert.Nil(e.pgClient.Load(), "Should stop pushgateway client")
+}
+
+func TestPushgatewayPushWithoutScrape(t *testing.T) {
+	require := require.New(t)
+
+	var pushes atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			pushes.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Pushgateway.Enable = true
+	cfg.Pushgateway.URL = receiver.URL
+	cfg.Pushgateway.Instance = cfg.Instance
+	e := newMockExporter(t, cfg)
+	t.Cleanup(func() {
+		e.Shutdown(context.Background())
+	})
+
+	require.NoError(e.startPushgateway(cfg), "Should start pushgateway client")
+	require.NoError(e.startScheduler(cfg), "Should start scheduler")
+	require.NotNil(e.scheduler.Load(), "Should schedule speedtests for the pushgateway")
+
+	require.Eventually(func() bool {
+		return pushes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push without the exporter being scraped")
+}
+
+func TestNotifyOnCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var events []string
+	var lock sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		events = append(events, r.Header.Get(notify.EventHeader))
+		lock.Unlock()
+		assert.Equal("sha256="+notify.Sign([]byte("secret"), body), r.Header.Get(notify.SignatureHeader), "Should sign the payload")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	countEvents := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(events)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Notify.Enable = true
+	// The mock speedtest is always slower
+	cfg.Notify.Thresholds.Download = 10000
+	cfg.Notify.Webhooks = config.Webhooks{{URL: receiver.URL, Secret: "secret", ChannelConfig: config.ChannelConfig{Timeout: time.Second}}}
+	e := newMockExporter(t, cfg)
+
+	require.NoError(e.startNotify(cfg), "Should start notifier")
+
+	_, err := e.registry.Gather()
+	require.NoError(err, "Should collect metrics")
+	require.Eventually(func() bool {
+		return countEvents() == 2
+	}, 5*time.Second, 10*time.Millisecond, "Should notify after the speedtest completed")
+
+	e.Shutdown(t.Context())
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal([]string{notify.EventTest, notify.EventBreach}, events)
+	assert.Nil(e.notifier.Load(), "Should stop notifier")
+}
+
+func TestReportResultsWithoutScrape(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Report.Enable = true
+	e := newMockExporter(t, cfg)
+	t.Cleanup(func() {
+		e.Shutdown(context.Background())
+	})
+
+	require.NoError(t, e.startScheduler(cfg), "Should start scheduler")
+
+	require.Eventually(t, func() bool {
+		return len(e.history.Results(time.Time{})) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should record results for the report without the exporter being scraped")
+}
+
+func TestNotifyWithoutScrape(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var bodies [][]byte
+	var lock sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		bodies = append(bodies, body)
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	countBodies := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(bodies)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Notify.Enable = true
+	cfg.Notify.Webhooks = config.Webhooks{{URL: receiver.URL, ChannelConfig: config.ChannelConfig{Timeout: time.Second}}}
+	e := newMockExporter(t, cfg)
+	t.Cleanup(func() {
+		e.Shutdown(context.Background())
+	})
+	setIPMode(t, e, collector.IPModeHashed)
+
+	require.NoError(e.startNotify(cfg), "Should start notifier")
+	require.NoError(e.startScheduler(cfg), "Should start scheduler")
+
+	require.Eventually(func() bool {
+		return countBodies() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should notify without the exporter being scraped")
+
+	lock.Lock()
+	defer lock.Unlock()
+	var payload struct {
+		Result struct {
+			ClientIP string `json:"client_ip"`
+		} `json:"result"`
+	}
+	require.NoError(json.Unmarshal(bodies[0], &payload), "Should send a json payload")
+	assert.Equal(anonymizedIP(t, collector.IPModeHashed), payload.Result.ClientIP, "Should anonymize the client ip")
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Detailed health information, served as json on /api/v1/health
+type healthResponse struct {
+	Status      string          `json:"status"`
+	Ready       bool            `json:"ready"`
+	Reason      string          `json:"reason,omitempty"`
+	Speedtest   speedtestHealth `json:"speedtest"`
+	Cache       cacheHealth     `json:"cache"`
+	RemoteWrite []targetHealth  `json:"remoteWrite"`
+	OTLP        pushHealth      `json:"otlp"`
+	Influx      queueHealth     `json:"influx"`
+	MQTT        mqttHealth      `json:"mqtt"`
+	Pushgateway pushHealth      `json:"pushgateway"`
+	Notify      notifyHealth    `json:"notify"`
+	Report      reportHealth    `json:"report"`
+}
+
+type speedtestHealth struct {
+	Running             bool      `json:"running"`
+	LastAttempt         time.Time `json:"lastAttempt,omitzero"`
+	LastSuccess         time.Time `json:"lastSuccess,omitzero"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+type cacheHealth struct {
+	Persistent bool      `json:"persistent"`
+	ExpiresAt  time.Time `json:"expiresAt,omitzero"`
+}
+
+// Status of a client pushing the metrics
+type pushHealth struct {
+	Enabled     bool      `json:"enabled"`
+	Running     bool      `json:"running"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Status of a client that queues data which could not be sent yet
+type queueHealth struct {
+	pushHealth
+	Queued  int `json:"queued"`
+	Dropped int `json:"dropped"`
+}
+
+// Status of a client pushing to one of multiple targets
+type targetHealth struct {
+	Target string `json:"target"`
+	queueHealth
+}
+
+// Status of the notifier and each of its channels
+type notifyHealth struct {
+	Enabled  bool            `json:"enabled"`
+	Running  bool            `json:"running"`
+	Channels []channelHealth `json:"channels"`
+}
+
+// Status of a single notification channel
+type channelHealth struct {
+	Name        string    `json:"name"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Status of the reporter, including when the next report is sent
+type reportHealth struct {
+	pushHealth
+	NextReport time.Time `json:"nextReport,omitzero"`
+}
+
+// Status of the MQTT client, including the connection to the broker
+type mqttHealth struct {
+	pushHealth
+	Connected bool `json:"connected"`
+}
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+)
+
+// Return nil if the exporter is ready to serve metrics, otherwise the reason why it is not.
+// Not ready when the speedtest backend can not run or the cache can not be persisted as configured.
+func (e *exporter) ready() error {
+	if e.speedtest == nil || e.collector == nil || e.cache == nil {
+		return errors.New("exporter is not initialized")
+	}
+	if e.collector.Stopped() {
+		return errors.New("exporter is shutting down")
+	}
+	if checker, ok := e.speedtest.(speedtest.Checker); ok {
+		err := checker.Check()
+		if err != nil {
+			return errors.New("speedtest backend is not available: " + err.Error())
+		}
+	}
+	err := e.cache.Check()
+	if err != nil {
+		return errors.New("cache can not be persisted: " + err.Error())
+	}
+	return nil
+}
+
+// Collect the current health of all components
+func (e *exporter) health() healthResponse {
+	res := healthResponse{
+		Status: healthStatusOK,
+		Ready:  true,
+	}
+
+	err := e.ready()
+	if err != nil {
+		res.Ready = false
+		res.Reason = err.Error()
+		return res
+	}
+
+	status := e.collector.Status()
+	res.Speedtest = speedtestHealth{
+		Running:             status.Running,
+		LastAttempt:         status.LastAttempt,
+		LastSuccess:         status.LastSuccess,
+		ConsecutiveFailures: status.ConsecutiveFailures,
+	}
+	if status.ConsecutiveFailures > 0 {
+		res.Status = healthStatusDegraded
+	}
+
+	res.Cache = cacheHealth{
+		Persistent: e.cache.Persistent(),
+		ExpiresAt:  e.cache.ExpiresAt(),
+	}
+
+	res.RemoteWrite = []targetHealth{}
+	for _, rwClient := range e.remoteWriteClients() {
+		rwStatus := rwClient.Status()
+		res.RemoteWrite = append(res.RemoteWrite, targetHealth{
+			Target: rwClient.Name(),
+			queueHealth: queueHealth{
+				pushHealth: pushHealth{
+					Enabled:     true,
+					Running:     rwStatus.Running,
+					LastSuccess: rwStatus.LastSuccess,
+					LastError:   rwStatus.LastError,
+				},
+				Queued:  rwStatus.Queued,
+				Dropped: rwStatus.Dropped,
+			},
+		})
+		if rwStatus.LastError != "" {
+			res.Status = healthStatusDegraded
+		}
+	}
+
+	if otlpClient := e.otlpClient.Load(); otlpClient != nil {
+		otlpStatus := otlpClient.Status()
+		res.OTLP = pushHealth{
+			Enabled:     true,
+			Running:     otlpStatus.Running,
+			LastSuccess: otlpStatus.LastSuccess,
+			LastError:   otlpStatus.LastError,
+		}
+		if otlpStatus.LastError != "" {
+			res.Status = healthStatusDegraded
+		}
+	}
+
+	if influxClient := e.influxClient.Load(); influxClient != nil {
+		influxStatus := influxClient.Status()
+		res.Influx = queueHealth{
+			pushHealth: pushHealth{
+				Enabled:     true,
+				Running:     influxStatus.Running,
+				LastSuccess: influxStatus.LastSuccess,
+				LastError:   influxStatus.LastError,
+			},
+			Queued:  influxStatus.Queued,
+			Dropped: influxStatus.Dropped,
+		}
+		if influxStatus.LastError != "" {
+			res.Status = healthStatusDegraded
+		}
+	}
+
+	if mqttClient := e.mqttClient.Load(); mqttClient != nil {
+		mqttStatus := mqttClient.Status()
+		res.MQTT = mqttHealth{
+			pushHealth: pushHealth{
+				Enabled:     true,
+				Running:     mqttStatus.Running,
+				LastSuccess: mqttStatus.LastSuccess,
+				LastError:   mqttStatus.LastError,
+			},
+			Connected: mqttStatus.Connected,
+		}
+		if mqttStatus.LastError != "" {
+			res.Status = healthStatusDegraded
+		}
+	}
+
+	if pgClient := e.pgClient.Load(); pgClient != nil {
+		pgStatus := pgClient.Status()
+		res.Pushgateway = pushHealth{
+			Enabled:     true,
+			Running:     pgStatus.Running,
+			LastSuccess: pgStatus.LastSuccess,
+			LastError:   pgStatus.LastError,
+		}
+		if pgStatus.LastError != "" {
+			res.Status = healthStatusDegraded
+		}
+	}
+
+	res.Notify.Channels = []channelHealth{}
+	if notifier := e.notifier.Load(); notifier != nil {
+		notifyStatus := notifier.Status()
+		res.Notify.Enabled = true
+		res.Notify.Running = notifyStatus.Running
+		for _, channel := range notifyStatus.Channels {
+			res.Notify.Channels = append(res.Notify.Channels, channelHealth{
+				Name:        channel.Name,
+				LastSuccess: channel.LastSuccess,
+				LastError:   channel.LastError,
+			})
+			if channel.LastError != "" {
+				res.Status = healthStatusDegraded
+			}
+		}
+	}
+
+	if reporter := e.reporter.Load(); reporter != nil {
+		reportStatus := reporter.Status()
+		res.Report = reportHealth{
+			pushHealth: pushHealth{
+				Enabled:     true,
+				Running:     reportStatus.Running,
+				LastSuccess: reportStatus.LastSuccess,
+				LastError:   reportStatus.LastError,
+			},
+			NextReport: reportStatus.NextReport,
+		}
+		if reportStatus.LastError != "" {
+			res.Status = healthStatusDegraded
+		}
+	}
+
+	return res
+}
+
+// Liveness probe, reports that the process is able to serve requests.
+// Never runs a speedtest.
+func HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+// Readiness probe, reports if the exporter is initialized and not shutting down.
+// Never runs a speedtest.
+func (e *exporter) ReadyzHandler(w http.ResponseWriter, _ *http.Request) {
+	err := e.ready()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
+
+// Serve detailed health information as json.
+// Returns 503 when the exporter is not ready.
+func (e *exporter) HealthHandler(w http.ResponseWriter, _ *http.Request) {
+	res := e.health()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !res.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.MarshalWrite(w, res)
+	if err != nil {
+		slog.Error("Failed to write health response", "err", err)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
+	"github.com/heathcliff26/speedtest-exporter/pkg/config"
+	"github.com/heathcliff26/speedtest-exporter/pkg/influx"
+	"github.com/heathcliff26/speedtest-exporter/pkg/pushgateway"
+	"github.com/heathcliff26/speedtest-exporter/pkg/remote"
+	"github.com/heathcliff26/speedtest-exporter/pkg/report"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HealthzHandler(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ok", rr.Body.String())
+}
+
+func TestReadyzHandler(t *testing.T) {
+	t.Run("Ready", func(t *testing.T) {
+		e := newMockExporter(t, config.DefaultConfig())
+
+		rr := httptest.NewRecorder()
+		e.ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusOK, rr.Code, "Should be ready")
+	})
+	t.Run("ShuttingDown", func(t *testing.T) {
+		e := newMockExporter(t, config.DefaultConfig())
+		e.collector.Shutdown(t.Context())
+
+		rr := httptest.NewRecorder()
+		e.ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Should not be ready during shutdown")
+	})
+	t.Run("NoBackend", func(t *testing.T) {
+		e := newMockExporter(t, config.DefaultConfig())
+		e.speedtest = nil
+
+		rr := httptest.NewRecorder()
+		e.ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Should not be ready without a backend")
+		assert.Contains(t, rr.Body.String(), "not initialized")
+	})
+	t.Run("BackendUnavailable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "speedtest")
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0755)) // #nosec G306 -- Needs to be executable
+		s, err := speedtest.NewSpeedtestCLI(path)
+		require.NoError(t, err, "Should create speedtest-cli")
+		require.NoError(t, os.Remove(path))
+
+		e := newMockExporter(t, config.DefaultConfig())
+		e.speedtest = s
+
+		rr := httptest.NewRecorder()
+		e.ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Should not be ready when the speedtest binary is missing")
+		assert.Contains(t, rr.Body.String(), "speedtest backend is not available")
+	})
+	t.Run("CacheNotWritable", func(t *testing.T) {
+		e := newMockExporter(t, config.DefaultConfig())
+		e.cache = cache.NewCache(true, "/nonexistent/path/result.json", time.Minute)
+
+		rr := httptest.NewRecorder()
+		e.ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Should not be ready when the cache can not be persisted")
+		assert.Contains(t, rr.Body.String(), "cache can not be persisted")
+	})
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Run("NoSpeedtest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e := newMockExporter(t, config.DefaultConfig())
+
+		rr := httptest.NewRecorder()
+		e.HealthHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.Equal("application/json", rr.Header().Get("Content-Type"))
+
+		var res healthResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Should return valid json")
+		assert.Equal(healthStatusOK, res.Status)
+		assert.True(res.Ready)
+		assert.Zero(res.Speedtest.LastAttempt, "Should not have run a speedtest")
+		assert.Empty(res.RemoteWrite)
+		assert.False(res.Notify.Enabled)
+		assert.Empty(res.Notify.Channels)
+	})
+	t.Run("AfterSpeedtest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e := newMockExporter(t, config.DefaultConfig())
+		_, err := e.registry.Gather()
+		require.NoError(t, err, "Should run speedtest")
+
+		res := e.health()
+
+		assert.Equal(healthStatusOK, res.Status)
+		assert.NotZero(res.Speedtest.LastAttempt, "Should have run a speedtest")
+		assert.NotZero(res.Speedtest.LastSuccess, "Should have a successful speedtest")
+		assert.Zero(res.Speedtest.ConsecutiveFailures)
+		assert.NotZero(res.Cache.ExpiresAt, "Should have a cached result")
+	})
+	t.Run("RemoteWriteFailure", func(t *testing.T) {
+		assert := assert.New(t)
+
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}))
+		t.Cleanup(receiver.Close)
+
+		cfg := config.DefaultConfig()
+		e := newMockExporter(t, cfg)
+
+		rwClient, err := createRemoteWriteClient(newRemoteTarget(cfg, config.DEFAULT_REMOTE_NAME, receiver.URL), e.registry, "")
+		require.NoError(t, err, "Should create remote write client")
+		require.Error(t, rwClient.Push(t.Context()), "Push should fail")
+		e.rwClients.Store(&[]*remote.Client{rwClient})
+
+		res := e.health()
+
+		assert.Equal(healthStatusDegraded, res.Status)
+		require.Len(t, res.RemoteWrite, 1)
+		assert.Equal(config.DEFAULT_REMOTE_NAME, res.RemoteWrite[0].Target)
+		assert.True(res.RemoteWrite[0].Enabled)
+		assert.False(res.RemoteWrite[0].Running)
+		assert.NotEmpty(res.RemoteWrite[0].LastError)
+		assert.Equal(1, res.RemoteWrite[0].Queued, "Should keep the failed push for a retry")
+	})
+	t.Run("OTLPFailing", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := config.DefaultConfig()
+		cfg.OTLP.Endpoint = "http://localhost:0/v1/metrics"
+		cfg.OTLP.Instance = cfg.Instance
+		e := newMockExporter(t, cfg)
+
+		otlpClient, err := createOTLPClient(cfg.OTLP, e.registry)
+		require.NoError(t, err, "Should create OTLP client")
+		require.Error(t, otlpClient.Push(t.Context()), "Push should fail")
+		e.otlpClient.Store(otlpClient)
+
+		res := e.health()
+
+		assert.Equal(healthStatusDegraded, res.Status)
+		assert.True(res.OTLP.Enabled)
+		assert.False(res.OTLP.Running)
+		assert.NotEmpty(res.OTLP.LastError)
+	})
+	t.Run("InfluxFailing", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := config.DefaultConfig()
+		cfg.Influx.URL = "tcp://localhost:0"
+		cfg.Influx.Instance = cfg.Instance
+		cfg.Influx.MaxRetries = 0
+		e := newMockExporter(t, cfg)
+
+		influxClient, err := influx.NewClient(cfg.Influx.Options())
+		require.NoError(t, err, "Should create influx client")
+		influxClient.Add(speedtest.NewFailedSpeedtestResult())
+		require.Error(t, influxClient.Flush(t.Context()), "Write should fail")
+		e.influxClient.Store(influxClient)
+
+		res := e.health()
+
+		assert.Equal(healthStatusDegraded, res.Status)
+		assert.True(res.Influx.Enabled)
+		assert.False(res.Influx.Running)
+		assert.NotEmpty(res.Influx.LastError)
+		assert.Equal(1, res.Influx.Queued, "Should keep the point")
+	})
+	t.Run("MQTTDisconnected", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := config.DefaultConfig()
+		cfg.MQTT.Enable = true
+		cfg.MQTT.Broker = "tcp://localhost:0"
+		e := newMockExporter(t, cfg)
+		require.NoError(t, e.startMQTT(cfg), "Should start MQTT client")
+		t.Cleanup(e.stopMQTT)
+
+		_, err := e.registry.Gather()
+		require.NoError(t, err, "Should collect metrics")
+		require.Eventually(t, func() bool {
+			return e.health().MQTT.LastError != ""
+		}, 5*time.Second, 10*time.Millisecond, "Should try to publish the result")
+
+		res := e.health()
+
+		assert.Equal(healthStatusDegraded, res.Status)
+		assert.True(res.MQTT.Enabled)
+		assert.True(res.MQTT.Running)
+		assert.False(res.MQTT.Connected)
+	})
+	t.Run("PushgatewayFailing", func(t *testing.T) {
+		assert := assert.New(t)
+
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(receiver.Close)
+
+		cfg := config.DefaultConfig()
+		cfg.Pushgateway.URL = receiver.URL
+		e := newMockExporter(t, cfg)
+
+		pgClient, err := pushgateway.NewClient(cfg.Pushgateway.URL, cfg.Pushgateway.JobName, e.registry)
+		require.NoError(t, err, "Should create pushgateway client")
+		require.Error(t, pgClient.Push(t.Context()), "Push should fail")
+		e.pgClient.Store(pgClient)
+
+		res := e.health()
+
+		assert.Equal(healthStatusDegraded, res.Status)
+		assert.True(res.Pushgateway.Enabled)
+		assert.False(res.Pushgateway.Running)
+		assert.NotEmpty(res.Pushgateway.LastError)
+	})
+	t.Run("NotifyFailing", func(t *testing.T) {
+		assert := assert.New(t)
+
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		t.Cleanup(receiver.Close)
+
+		cfg := config.DefaultConfig()
+		cfg.Notify.Enable = true
+		cfg.Notify.Webhooks = config.Webhooks{{URL: receiver.URL, ChannelConfig: config.ChannelConfig{Name: "failing", Timeout: time.Second}}}
+		e := newMockExporter(t, cfg)
+
+		require.NoError(t, e.startNotify(cfg), "Should start notifier")
+		t.Cleanup(func() { e.stopNotify(t.Context()) })
+
+		_, err := e.registry.Gather()
+		require.NoError(t, err, "Should collect metrics")
+		require.Eventually(t, func() bool {
+			return e.health().Status == healthStatusDegraded
+		}, 5*time.Second, 10*time.Millisecond, "Should report the failed notification")
+
+		res := e.health()
+		assert.True(res.Notify.Enabled)
+		assert.True(res.Notify.Running)
+		require.Len(t, res.Notify.Channels, 1)
+		assert.Equal("failing", res.Notify.Channels[0].Name)
+		assert.Zero(res.Notify.Channels[0].LastSuccess)
+		assert.NotEmpty(res.Notify.Channels[0].LastError)
+	})
+	t.Run("ReportFailing", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// Nothing listens on the port once the listener is closed
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := l.Addr().(*net.TCPAddr).Port
+		require.NoError(t, l.Close())
+
+		e := newMockExporter(t, config.DefaultConfig())
+		reporter, err := report.NewReporter("127.0.0.1", "speedtest@example.org", []string{"admin@example.org"}, e.history, report.WithPort(port), report.WithSecurity(report.SecurityNone, nil))
+		require.NoError(t, err, "Should create reporter")
+		require.Error(t, reporter.Send(t.Context(), time.Now()), "Sending the report should fail")
+		e.reporter.Store(reporter)
+
+		res := e.health()
+
+		assert.Equal(healthStatusDegraded, res.Status)
+		assert.True(res.Report.Enabled)
+		assert.False(res.Report.Running)
+		assert.Zero(res.Report.NextReport, "Should not have a next report while stopped")
+		assert.NotEmpty(res.Report.LastError)
+	})
+	t.Run("ShuttingDown", func(t *testing.T) {
+		assert := assert.New(t)
+
+		e := newMockExporter(t, config.DefaultConfig())
+		e.collector.Shutdown(t.Context())
+
+		rr := httptest.NewRecorder()
+		e.HealthHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+
+		assert.Equal(http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(rr.Body.String(), "shutting down")
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Serve the results in the history as json.
+// The optional query parameter "since" limits the results to those run after the given RFC3339 timestamp.
+func (e *exporter) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid value for since, needs to be a RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := e.history.Results(since)
+	for i, result := range results {
+		results[i] = e.anonymizeResult(result)
+	}
+	writeJSON(w, results)
+}
+
+// Serve the result of a single run as json, identified by the run ID in the path.
+// Returns 404 if the run is not in the history.
+func (e *exporter) HistoryRunHandler(w http.ResponseWriter, r *http.Request) {
+	result := e.history.Get(r.PathValue("runID"))
+	if result == nil {
+		http.Error(w, "Run not found in history", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, e.anonymizeResult(result))
+}
+
+// Return a copy of the result with the client IP converted like the ip label, see metrics.ipLabel
+func (e *exporter) anonymizeResult(result *speedtest.SpeedtestResult) *speedtest.SpeedtestResult {
+	return result.WithClientIP(e.collector.AnonymizeIP(result.ClientIP()))
+}
+
+// Write the value as json response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.MarshalWrite(w, v)
+	if err != nil {
+		slog.Error("Failed to write json response", "err", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/config"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run a speedtest by gathering the metrics and return the run ID of the result
+func runMockSpeedtest(t *testing.T, e *exporter) string {
+	t.Helper()
+
+	_, err := e.registry.Gather()
+	require.NoError(t, err, "Should run speedtest")
+	result, _ := e.cache.Read()
+	require.NotNil(t, result, "Should have a result")
+	return result.RunID()
+}
+
+// Change the ip label of the exporter for the duration of the test
+func setIPMode(t *testing.T, e *exporter, mode string) {
+	t.Helper()
+
+	opts := collector.DefaultLabelOptions()
+	opts.IPMode = mode
+	opts.IPHashKey = []byte("test-key")
+	require.NoError(t, e.collector.SetLabels(opts), "Should set the ip label")
+	t.Cleanup(func() {
+		_ = e.collector.SetLabels(collector.DefaultLabelOptions())
+	})
+}
+
+// Return the client IP of the mock speedtest converted with the given mode and the key used by setIPMode
+func anonymizedIP(t *testing.T, mode string) string {
+	t.Helper()
+
+	c, err := collector.NewCollector(nil, nil, &speedtest.MockSpeedtest{}, "")
+	require.NoError(t, err, "Should create collector")
+	require.NoError(t, c.SetLabels(collector.LabelOptions{IPMode: mode, IPHashKey: []byte("test-key")}))
+	return c.AnonymizeIP("127.0.0.1")
+}
+
+func TestHistoryHandler(t *testing.T) {
+	e := newMockExporter(t, config.DefaultConfig())
+
+	t.Run("Empty", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		e.HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, "[]", rr.Body.String(), "Should return an empty list")
+	})
+
+	runID := runMockSpeedtest(t, e)
+
+	t.Run("Results", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rr := httptest.NewRecorder()
+		e.HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history", nil))
+		assert.Equal(http.StatusOK, rr.Code)
+
+		var res []map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Should return valid json")
+		if assert.Len(res, 1, "Should return the result") {
+			assert.Equal(runID, res[0]["run_id"])
+		}
+	})
+	t.Run("IPLabel", func(t *testing.T) {
+		tMatrix := []struct {
+			Mode     string
+			Expected any
+		}{
+			{collector.IPModeRaw, "127.0.0.1"},
+			{collector.IPModeHashed, anonymizedIP(t, collector.IPModeHashed)},
+			{collector.IPModeTruncated, "127.0.0.0/24"},
+			{collector.IPModeDropped, nil},
+		}
+		for _, tCase := range tMatrix {
+			t.Run(tCase.Mode, func(t *testing.T) {
+				setIPMode(t, e, tCase.Mode)
+
+				rr := httptest.NewRecorder()
+				e.HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history", nil))
+
+				var res []map[string]any
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Should return valid json")
+				require.Len(t, res, 1, "Should return the result")
+				assert.Equal(t, tCase.Expected, res[0]["client_ip"], "Should convert the client IP like the ip label")
+			})
+		}
+	})
+	t.Run("Since", func(t *testing.T) {
+		since := url.QueryEscape(time.Now().Add(time.Minute).Format(time.RFC3339))
+		rr := httptest.NewRecorder()
+		e.HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history?since="+since, nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, "[]", rr.Body.String(), "Should filter older results")
+	})
+	t.Run("InvalidSince", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		e.HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history?since=yesterday", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestHistoryRunHandler(t *testing.T) {
+	require := require.New(t)
+
+	e := newMockExporter(t, config.DefaultConfig())
+	server, err := createServer(e)
+	require.NoError(err, "Should create server")
+
+	runID := runMockSpeedtest(t, e)
+
+	rr := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history/"+runID, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var res map[string]any
+	require.NoError(json.Unmarshal(rr.Body.Bytes(), &res), "Should return valid json")
+	assert.Equal(t, runID, res["run_id"], "Should return the requested run")
+	assert.Equal(t, "127.0.0.1", res["client_ip"], "Should return the raw IP by default")
+
+	setIPMode(t, e, collector.IPModeDropped)
+	rr = httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history/"+runID, nil))
+	res = nil
+	require.NoError(json.Unmarshal(rr.Body.Bytes(), &res), "Should return valid json")
+	assert.NotContains(t, res, "client_ip", "Should omit the dropped IP")
+
+	rr = httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/history/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should return 404 for unknown runs")
+}
+
+func TestMetricsExemplars(t *testing.T) {
+	require := require.New(t)
+
+	e := newMockExporter(t, config.DefaultConfig())
+	server, err := createServer(e)
+	require.NoError(err, "Should create server")
+
+	runID := runMockSpeedtest(t, e)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rr := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, req)
+	require.Equal(http.StatusOK, rr.Code)
+
+	body, err := io.ReadAll(rr.Body)
+	require.NoError(err)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "application/openmetrics-text", "Should negotiate OpenMetrics")
+	assert.Contains(t, string(body), `speedtest_download_megabits_per_second_histogram_bucket{le="1000.0"} 1 # {run_id="`+runID+`"}`, "Should add exemplars to the histograms")
+	assert.Contains(t, string(body), `speedtest_runs_total{result="success"} 1.0 # {run_id="`+runID+`"}`, "Should link the run via exemplar")
+}
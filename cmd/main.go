@@ -1,23 +1,24 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/heathcliff26/promremote/v2/promremote"
 	"github.com/heathcliff26/simple-fileserver/pkg/middleware"
-	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
-	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
 	"github.com/heathcliff26/speedtest-exporter/pkg/config"
 	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
 	"github.com/heathcliff26/speedtest-exporter/pkg/version"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/heathcliff26/speedtest-exporter/pkg/web"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -40,29 +41,110 @@ func ServerRootHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "<html><body><h1>Welcome to speedtest-exporter</h1>Click <a href='/metrics'>here</a> to see metrics.</body></html>")
 }
 
-func createSpeedtest(path string) (speedtest.Speedtest, error) {
-	if path == "" {
-		slog.Debug("Using go-native speedtest implementation")
-		return speedtest.NewSpeedtest(), nil
-	} else {
+// Create the speedtest backend selected in the config
+func createSpeedtest(cfg config.Config) (speedtest.Speedtest, error) {
+	switch cfg.SpeedtestBackend() {
+	case speedtest.BackendSpeedtestCLI:
+		path := cfg.SpeedtestCLI
+		if path == "" {
+			path = config.DEFAULT_SPEEDTEST_CLI
+		}
 		slog.Debug("Using external speedtest-cli binary", "path", path)
 		return speedtest.NewSpeedtestCLI(path)
+	case speedtest.BackendIperf3:
+		slog.Debug("Using iperf3", "server", cfg.Iperf3.Server, "path", cfg.Iperf3.Executable)
+		return speedtest.NewIperf3(cfg.Iperf3.Executable, cfg.Iperf3.Server, cfg.Iperf3.Iperf3Options()...)
+	case speedtest.BackendLibreSpeed:
+		slog.Debug("Using LibreSpeed", "servers", cfg.LibreSpeed.Servers, "serverList", cfg.LibreSpeed.ServerList)
+		return speedtest.NewLibreSpeed(cfg.LibreSpeed.LibreSpeedOptions()...)
+	default:
+		slog.Debug("Using go-native speedtest implementation")
+		return speedtest.NewSpeedtest(), nil
 	}
 }
 
-func createServer(port int, reg *prometheus.Registry) *http.Server {
+func createServer(e *exporter) (*http.Server, error) {
 	router := http.NewServeMux()
 	router.HandleFunc("/", ServerRootHandler)
-	router.Handle("/metrics", middleware.Logging(promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})))
+	// OpenMetrics is required for exemplars, which link the metrics to the runs in the history
+	router.Handle("/metrics", middleware.Logging(promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{Registry: e.registry, EnableOpenMetrics: true})))
+	router.HandleFunc("/-/reload", e.ReloadHandler)
+	router.HandleFunc("/api/v1/health", e.HealthHandler)
+	router.HandleFunc("GET /api/v1/history", e.HistoryHandler)
+	router.HandleFunc("GET /api/v1/history/{runID}", e.HistoryRunHandler)
 
-	return &http.Server{
-		Addr:        ":" + strconv.Itoa(port),
-		Handler:     router,
+	authenticated := e.auth.Middleware(router)
+	if e.cfg.Web.TLS.ClientCAFile != "" {
+		authenticated = web.RequireClientCert(authenticated)
+	}
+
+	// Probes are served without authentication or client certificate, as they do not expose any details
+	handler := http.NewServeMux()
+	handler.HandleFunc("/healthz", HealthzHandler)
+	handler.HandleFunc("/readyz", e.ReadyzHandler)
+	handler.Handle("/", authenticated)
+
+	server := &http.Server{
+		Handler:     handler,
 		ReadTimeout: 10 * time.Second,
 		// The speedtest takes roughly 22-24 seconds on average.
 		// Ensure timeout has some buffer for a worst case.
 		WriteTimeout: 60 * time.Second,
 	}
+
+	tlsCfg := e.cfg.Web.TLS
+	if tlsCfg.Enabled() {
+		var err error
+		server.TLSConfig, err = web.NewTLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return server, nil
+}
+
+// Open listeners for all configured addresses
+func listen(cfg config.Config) ([]net.Listener, error) {
+	addresses := cfg.ListenAddresses()
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := web.Listen(address, cfg.Web.UnixSocket.FileMode(), cfg.Web.UnixSocket.Group)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// Serve requests on the listener, serves TLS when configured
+func serve(server *http.Server, l net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(l, "", "")
+	}
+	return server.Serve(l)
+}
+
+// Maximum time to wait for a running speedtest and in-flight requests during shutdown
+const shutdownTimeout = 30 * time.Second
+
+// Reload the configuration whenever SIGHUP is received
+func handleReloadSignal(e *exporter) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			slog.Info("Received SIGHUP, reloading configuration")
+			err := e.Reload()
+			if err != nil {
+				slog.Error("Failed to reload configuration", slog.String("path", e.configPath), "err", err)
+			}
+		}
+	}()
 }
 
 func main() {
@@ -79,49 +161,114 @@ func main() {
 		os.Exit(1)
 	}
 
-	s, err := createSpeedtest(cfg.SpeedtestCLI)
+	e, err := newExporter(cfg, configPath, env)
 	if err != nil {
-		slog.Error("Failed initialize speedtest", "err", err)
+		slog.Error("Failed to initialize exporter", "err", err)
 		os.Exit(1)
 	}
 
-	resultCache := cache.NewCache(cfg.PersistCache, "/cache/speedtest-result.json", cfg.Cache)
+	err = e.startRemoteWrite(cfg)
+	if err != nil {
+		slog.Error("Failed to start remote write client", "err", err)
+		os.Exit(1)
+	}
 
-	collector, err := collector.NewCollector(resultCache, s, cfg.Instance)
+	err = e.startOTLP(cfg)
 	if err != nil {
-		slog.Error("Failed to create collector", "err", err)
+		slog.Error("Failed to start OTLP metrics client", "err", err)
 		os.Exit(1)
 	}
 
-	reg := prometheus.NewRegistry()
-	reg.MustRegister(collector)
+	err = e.startInflux(cfg)
+	if err != nil {
+		slog.Error("Failed to start influx client", "err", err)
+		os.Exit(1)
+	}
 
-	if cfg.Remote.Enable {
-		opts := []promremote.ClientOption{promremote.WithInstanceLabel(cfg.Remote.Instance), promremote.WithJobLabel(cfg.Remote.JobName)}
-		if cfg.Remote.Username != "" {
-			opts = append(opts, promremote.WithBasicAuth(cfg.Remote.Username, cfg.Remote.Password))
-		}
-		rwClient, err := promremote.NewWriteClient(cfg.Remote.URL, reg, opts...)
-		if err != nil {
-			slog.Error("Failed to create remote write client", "err", err)
-			os.Exit(1)
-		}
+	err = e.startMQTT(cfg)
+	if err != nil {
+		slog.Error("Failed to start MQTT client", "err", err)
+		os.Exit(1)
+	}
 
-		slog.Info("Starting remote_write client", slog.String("interval", cfg.Cache.String()))
-		err = rwClient.Run(cfg.Cache)
-		if err != nil {
-			slog.Error("Failed to start remote write client", "err", err)
-			os.Exit(1)
-		}
-		defer rwClient.Stop()
+	err = e.startPushgateway(cfg)
+	if err != nil {
+		slog.Error("Failed to start pushgateway client", "err", err)
+		os.Exit(1)
+	}
+
+	err = e.startNotify(cfg)
+	if err != nil {
+		slog.Error("Failed to start notifier", "err", err)
+		os.Exit(1)
+	}
+
+	err = e.startReport(cfg)
+	if err != nil {
+		slog.Error("Failed to start reporter", "err", err)
+		os.Exit(1)
+	}
+
+	err = e.startScheduler(cfg)
+	if err != nil {
+		slog.Error("Failed to start speedtest scheduler", "err", err)
+		os.Exit(1)
 	}
 
-	server := createServer(cfg.Port, reg)
+	handleReloadSignal(e)
 
-	slog.Info("Starting http server", slog.String("addr", server.Addr))
-	err = server.ListenAndServe()
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+	server, err := createServer(e)
+	if err != nil {
+		slog.Error("Failed to create http server", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listeners, err := listen(cfg)
+	if err != nil {
+		slog.Error("Failed to listen on configured address", "err", err)
+		os.Exit(1)
+	}
+
+	serverErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			slog.Info("Starting http server", slog.String("addr", l.Addr().String()), slog.Bool("tls", server.TLSConfig != nil), slog.Bool("auth", e.auth.Enabled()))
+			serverErr <- serve(server, l)
+		}()
+	}
+
+	select {
+	case err = <-serverErr:
 		slog.Error("Failed to start http server", "err", err)
 		os.Exit(1)
+	case <-ctx.Done():
+		stop()
 	}
+
+	slog.Info("Received termination signal, shutting down", slog.Duration("timeout", shutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		slog.Info("Stopping http server")
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			slog.Error("Failed to gracefully stop http server, closing remaining connections", "err", err)
+			_ = server.Close()
+		}
+		for range listeners {
+			err := <-serverErr
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Http server returned an error", "err", err)
+			}
+		}
+	})
+	e.Shutdown(shutdownCtx)
+	wg.Wait()
+
+	slog.Info("Shutdown complete")
 }
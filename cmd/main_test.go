@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,9 +9,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
 	"github.com/heathcliff26/speedtest-exporter/pkg/config"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,36 +32,74 @@ func TestServerRootHandler(t *testing.T) {
 }
 
 func TestCreateSpeedtest(t *testing.T) {
-	t.Run("SpeedtestCLI", func(t *testing.T) {
-		s, err := createSpeedtest("../pkg/speedtest/testdata/speedtest-cli.sh")
-		require.NoError(t, err, "Should create speedtest-cli")
-		assert.Equal(t, "*speedtest.SpeedtestCLI", reflect.TypeOf(s).String())
-	})
-	t.Run("Speedtest", func(t *testing.T) {
-		s, err := createSpeedtest("")
-		require.NoError(t, err, "Should create speedtest-cli")
-		assert.Equal(t, "*speedtest.SpeedtestGo", reflect.TypeOf(s).String())
-	})
+	tMatrix := []struct {
+		Name   string
+		Config func(cfg *config.Config)
+		Type   string
+	}{
+		{
+			Name: "SpeedtestCLI",
+			Config: func(cfg *config.Config) {
+				cfg.SpeedtestCLI = "../pkg/speedtest/testdata/speedtest-cli.sh"
+			},
+			Type: "*speedtest.SpeedtestCLI",
+		},
+		{
+			Name:   "Speedtest",
+			Config: func(cfg *config.Config) {},
+			Type:   "*speedtest.SpeedtestGo",
+		},
+		{
+			Name: "Iperf3",
+			Config: func(cfg *config.Config) {
+				cfg.Backend = speedtest.BackendIperf3
+				cfg.Iperf3.Server = "iperf.example.org"
+				cfg.Iperf3.Executable = "../pkg/speedtest/testdata/iperf3.sh"
+			},
+			Type: "*speedtest.Iperf3",
+		},
+		{
+			Name: "LibreSpeed",
+			Config: func(cfg *config.Config) {
+				cfg.Backend = speedtest.BackendLibreSpeed
+				cfg.LibreSpeed.Servers = []string{"https://speedtest.example.org/backend"}
+			},
+			Type: "*speedtest.LibreSpeed",
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			tCase.Config(&cfg)
+
+			s, err := createSpeedtest(cfg)
+			require.NoError(t, err, "Should create speedtest")
+			assert.Equal(t, tCase.Type, reflect.TypeOf(s).String())
+		})
+	}
 }
 
 func TestServerWriteTimeout(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
 
-	s, err := createSpeedtest("")
-	require.NoError(err, "Should create speedtest")
-	c, err := collector.NewCollector(nil, s, "testinstance") // Ensure we do not use a cache
-	require.NoError(err, "Should create collector")
+	cfg := config.DefaultConfig()
+	cfg.PersistCache = false
+	e, err := newExporter(cfg, "", false)
+	require.NoError(err, "Should create exporter")
 
-	reg := prometheus.NewRegistry()
-	reg.MustRegister(c)
-
-	server := createServer(config.DEFAULT_PORT, reg) // Use port 0 to let the OS assign a free port
+	server, err := createServer(e)
+	require.NoError(err, "Should create server")
 	require.NotNil(server, "Server should not be nil")
 
+	listeners, err := listen(cfg)
+	require.NoError(err, "Should listen on default port")
+	require.Len(listeners, 1, "Should listen on a single address")
+
 	serverError := make(chan error, 1)
 	go func() {
-		err := server.ListenAndServe()
+		err := serve(server, listeners[0])
 		if err == http.ErrServerClosed {
 			err = nil
 		}
@@ -85,3 +123,36 @@ func TestServerWriteTimeout(t *testing.T) {
 	assert.NoError(server.Shutdown(t.Context()), "Server should shut down without error")
 	assert.NoError(<-serverError, "Server should not return an error on shutdown")
 }
+
+func TestServerProbesWithoutClientCert(t *testing.T) {
+	require := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.PersistCache = false
+	cfg.Web.TLS.ClientCAFile = "ca.crt"
+	e, err := newExporter(cfg, "", false)
+	require.NoError(err, "Should create exporter")
+
+	server, err := createServer(e)
+	require.NoError(err, "Should create server")
+
+	tMatrix := []struct {
+		Path   string
+		Status int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/metrics", http.StatusForbidden},
+		{"/", http.StatusForbidden},
+	}
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tCase.Path, nil)
+			req.TLS = &tls.ConnectionState{}
+
+			server.Handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tCase.Status, rr.Code, "Should return the expected status")
+		})
+	}
+}
@@ -22,6 +22,8 @@ type Cache struct {
 	path         string
 	cacheTime    time.Duration
 	cachedResult *speedtest.SpeedtestResult
+	// Reason why the cache is not persisted, although it was requested
+	persistErr error
 
 	sync.RWMutex
 }
@@ -48,6 +50,7 @@ func NewCache(persist bool, path string, cacheTime time.Duration) *Cache {
 	if err != nil {
 		slog.Info("Failed to open cache file, will not persist cache to disk", slog.String("file", cache.path), slog.Any("error", err))
 		cache.persist = false
+		cache.persistErr = err
 		return cache
 	}
 	defer f.Close()
@@ -117,6 +120,49 @@ func (c *Cache) Save(result *speedtest.SpeedtestResult) {
 	}
 }
 
+// Change the time for which results will be cached.
+// This method is safe to call even if the Cache instance is nil.
+func (c *Cache) SetCacheTime(cacheTime time.Duration) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	c.cacheTime = cacheTime
+}
+
+// Returns true if the cache is persisted to disk.
+// This can be false even if persistence was requested, when the cache file is not writable.
+func (c *Cache) Persistent() bool {
+	if c == nil {
+		return false
+	}
+	return c.persist
+}
+
+// Verify that the cache file can be read and written, when persisting the cache was requested.
+// Returns nil when the cache is only kept in memory.
+// This method is safe to call even if the Cache instance is nil.
+func (c *Cache) Check() error {
+	if c == nil {
+		return nil
+	}
+	if c.persistErr != nil {
+		return c.persistErr
+	}
+	if !c.persist {
+		return nil
+	}
+
+	// #nosec G302: Cache does not contain sensitive data, can be world readable
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 // Return when the cache will expire
 func (c *Cache) ExpiresAt() time.Time {
 	if c == nil {
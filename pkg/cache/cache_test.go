@@ -2,6 +2,7 @@ package cache
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -69,10 +70,12 @@ func TestNewCache(t *testing.T) {
 			cache := NewCache(tCase.Persist, tCase.Path, time.Minute)
 
 			assert.Equal(tCase.ExpectedPersist, cache.persist, "Persist flag should be set correctly")
+			assert.Equal(tCase.ExpectedPersist, cache.Persistent(), "Should report if the cache is persisted")
 			assert.Equal(tCase.Path, cache.path, "Path should be set correctly")
 			assert.Equal(time.Minute, cache.cacheTime, "Cache time should be set correctly")
 			if tCase.ShouldHaveResult {
 				assert.NotNil(cache.cachedResult, "Cached result should be initialized")
+				assert.Equal("CKQKDVLWGNYFB4Y5HOIMK2RHB4", cache.cachedResult.RunID(), "Should restore the run ID")
 			} else {
 				assert.Nil(cache.cachedResult, "Cached result should be empty")
 			}
@@ -106,6 +109,36 @@ func TestCacheNil(t *testing.T) {
 		}, "ExpiresAt should not panic on nil Cache")
 		assert.Zero(c.ExpiresAt(), "Cache should return zero time")
 	})
+	t.Run("SetCacheTime", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			c.SetCacheTime(time.Minute)
+		}, "SetCacheTime should not panic on nil Cache")
+	})
+	t.Run("Persistent", func(t *testing.T) {
+		assert.False(t, c.Persistent(), "Nil Cache should not be persistent")
+	})
+	t.Run("Check", func(t *testing.T) {
+		assert.NoError(t, c.Check(), "Nil Cache should not fail the check")
+	})
+}
+
+func TestSetCacheTime(t *testing.T) {
+	assert := assert.New(t)
+
+	expectedResult := speedtest.MockSpeedtestResult(time.Now().Add(-2 * time.Minute).UnixMilli())
+	c := &Cache{
+		cacheTime:    time.Minute,
+		cachedResult: expectedResult,
+	}
+
+	_, valid := c.Read()
+	assert.False(valid, "Cache should be expired")
+
+	c.SetCacheTime(time.Hour)
+
+	assert.Equal(time.Hour, c.cacheTime, "Should update the cache time")
+	_, valid = c.Read()
+	assert.True(valid, "Cache should be valid with the new cache time")
 }
 
 func TestRead(t *testing.T) {
@@ -206,6 +239,30 @@ func TestSave(t *testing.T) {
 	})
 }
 
+func TestCheck(t *testing.T) {
+	t.Run("InMemory", func(t *testing.T) {
+		assert.NoError(t, NewCache(false, "", time.Minute).Check(), "Should not check the disk")
+	})
+	t.Run("Writable", func(t *testing.T) {
+		assert.NoError(t, NewCache(true, filepath.Join(t.TempDir(), "cache.json"), time.Minute).Check())
+	})
+	t.Run("NotOpened", func(t *testing.T) {
+		c := NewCache(true, "/nonexistent/path/result.json", time.Minute)
+
+		assert.False(t, c.Persistent(), "Should not persist the cache")
+		assert.Error(t, c.Check(), "Should report that the cache could not be persisted")
+	})
+	t.Run("RemovedDirectory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "cache")
+		require.NoError(t, os.Mkdir(dir, 0755))
+		c := NewCache(true, filepath.Join(dir, "cache.json"), time.Minute)
+		require.NoError(t, c.Check())
+
+		require.NoError(t, os.RemoveAll(dir))
+		assert.Error(t, c.Check(), "Should report that the cache file is no longer writable")
+	})
+}
+
 func TestExpiresAt(t *testing.T) {
 	t.Run("ResultNil", func(t *testing.T) {
 		c := &Cache{
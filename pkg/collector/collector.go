@@ -1,30 +1,117 @@
 package collector
 
 import (
+	"context"
+	"crypto/rand"
 	"log/slog"
+	"maps"
 	"sync"
+	"time"
 
 	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
+	"github.com/heathcliff26/speedtest-exporter/pkg/history"
 	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type Collector struct {
-	cache     *cache.Cache
-	speedtest speedtest.Speedtest
-	instance  string
-}
-
-var (
-	variableLabels    = []string{"ip", "isp", "instance"}
-	jitterLatencyDesc = prometheus.NewDesc("speedtest_jitter_latency_milliseconds", "Speedtest current Jitter in ms", variableLabels, nil)
-	pingDesc          = prometheus.NewDesc("speedtest_ping_latency_milliseconds", "Speedtest current Ping in ms", variableLabels, nil)
-	downloadSpeedDesc = prometheus.NewDesc("speedtest_download_megabits_per_second", "Speedtest current Download Speed in Mbit/s", variableLabels, nil)
-	uploadSpeedDesc   = prometheus.NewDesc("speedtest_upload_megabits_per_second", "Speedtest current Upload Speed in Mbit/s", variableLabels, nil)
-	dataUsedDesc      = prometheus.NewDesc("speedtest_data_used_megabytes", "Data used for speedtest in MB", variableLabels, nil)
-	durationDesc      = prometheus.NewDesc("speedtest_duration_milliseconds", "Duration of the speedtest in milliseconds", variableLabels, nil)
-	upDesc            = prometheus.NewDesc("speedtest_up", "Indicates if the speedtest was successful", nil, nil)
-)
+	cache      *cache.Cache
+	history    *history.History
+	speedtest  speedtest.Speedtest
+	instance   string
+	timestamps bool
+	labels     LabelOptions
+	descs      *descriptors
+	// Used to hash the ip label when the options contain no key
+	ipHashKey []byte
+	sla       SLAOptions
+
+	histogramOpts HistogramOptions
+	histograms    *histograms
+
+	// Called after every completed speedtest, see OnResult
+	resultHandlers []func(*speedtest.SpeedtestResult)
+
+	optionsLock sync.RWMutex
+
+	status     Status
+	statusLock sync.RWMutex
+
+	// Cancelled on shutdown, aborts the running speedtest and prevents new ones from starting
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Status of the speedtest runs, used for health reporting
+type Status struct {
+	// Start of the last speedtest run, zero if no test has been run yet
+	LastAttempt time.Time
+	// Time of the last successful speedtest, may be initialized from the cache
+	LastSuccess time.Time
+	// Number of failed speedtests since the last success
+	ConsecutiveFailures int
+	// Total number of successful and failed speedtests, cancelled runs are not counted
+	SuccessfulRuns int
+	FailedRuns     int
+	// True while a speedtest is running
+	Running bool
+}
+
+// Descriptions of all metrics exported by the collector, recreated when the labels change
+type descriptors struct {
+	jitterLatency *prometheus.Desc
+	ping          *prometheus.Desc
+	downloadSpeed *prometheus.Desc
+	uploadSpeed   *prometheus.Desc
+	dataUsed      *prometheus.Desc
+	duration      *prometheus.Desc
+	up            *prometheus.Desc
+
+	lastSuccess         *prometheus.Desc
+	lastAttempt         *prometheus.Desc
+	consecutiveFailures *prometheus.Desc
+	cacheExpires        *prometheus.Desc
+	runs                *prometheus.Desc
+
+	contractedDownload *prometheus.Desc
+	contractedUpload   *prometheus.Desc
+	contractedLatency  *prometheus.Desc
+	downloadRatio      *prometheus.Desc
+	uploadRatio        *prometheus.Desc
+	slaTests           *prometheus.Desc
+	slaCompliantTests  *prometheus.Desc
+	slaCompliance      *prometheus.Desc
+}
+
+// Create the descriptions for all metrics.
+// The variable labels are only added to the metrics of the speedtest result, the const labels are added to all metrics.
+func newDescriptors(variableLabels []string, constLabels prometheus.Labels) *descriptors {
+	return &descriptors{
+		jitterLatency: prometheus.NewDesc("speedtest_jitter_latency_milliseconds", "Speedtest current Jitter in ms", variableLabels, constLabels),
+		ping:          prometheus.NewDesc("speedtest_ping_latency_milliseconds", "Speedtest current Ping in ms", variableLabels, constLabels),
+		downloadSpeed: prometheus.NewDesc("speedtest_download_megabits_per_second", "Speedtest current Download Speed in Mbit/s", variableLabels, constLabels),
+		uploadSpeed:   prometheus.NewDesc("speedtest_upload_megabits_per_second", "Speedtest current Upload Speed in Mbit/s", variableLabels, constLabels),
+		dataUsed:      prometheus.NewDesc("speedtest_data_used_megabytes", "Data used for speedtest in MB", variableLabels, constLabels),
+		duration:      prometheus.NewDesc("speedtest_duration_milliseconds", "Duration of the speedtest in milliseconds", variableLabels, constLabels),
+		up:            prometheus.NewDesc("speedtest_up", "Indicates if the speedtest was successful", nil, constLabels),
+
+		lastSuccess:         prometheus.NewDesc("speedtest_last_success_timestamp_seconds", "Unix timestamp of the last successful speedtest, 0 if there was none", nil, constLabels),
+		lastAttempt:         prometheus.NewDesc("speedtest_last_attempt_timestamp_seconds", "Unix timestamp of the start of the last speedtest, 0 if there was none", nil, constLabels),
+		consecutiveFailures: prometheus.NewDesc("speedtest_consecutive_failures", "Number of failed speedtests since the last success", nil, constLabels),
+		cacheExpires:        prometheus.NewDesc("speedtest_cache_expires_timestamp_seconds", "Unix timestamp when the cached result expires and a new speedtest will be run, 0 if nothing is cached", nil, constLabels),
+		runs:                prometheus.NewDesc("speedtest_runs_total", "Total number of speedtest runs by result", []string{"result"}, constLabels),
+
+		contractedDownload: prometheus.NewDesc("speedtest_contracted_download_megabits_per_second", "Contracted Download Speed in Mbit/s", nil, constLabels),
+		contractedUpload:   prometheus.NewDesc("speedtest_contracted_upload_megabits_per_second", "Contracted Upload Speed in Mbit/s", nil, constLabels),
+		contractedLatency:  prometheus.NewDesc("speedtest_contracted_latency_milliseconds", "Maximum contracted Ping in ms", nil, constLabels),
+		downloadRatio:      prometheus.NewDesc("speedtest_download_ratio_of_contracted", "Speedtest current Download Speed as ratio of the contracted speed", variableLabels, constLabels),
+		uploadRatio:        prometheus.NewDesc("speedtest_upload_ratio_of_contracted", "Speedtest current Upload Speed as ratio of the contracted speed", variableLabels, constLabels),
+		slaTests:           prometheus.NewDesc("speedtest_sla_window_tests", "Number of speedtests within the sla window", []string{"target"}, constLabels),
+		slaCompliantTests:  prometheus.NewDesc("speedtest_sla_window_compliant_tests", "Number of speedtests within the sla window that met the contracted target", []string{"target"}, constLabels),
+		slaCompliance:      prometheus.NewDesc("speedtest_sla_compliance_ratio", "Share of speedtests within the sla window that met the contracted target", []string{"target"}, constLabels),
+	}
+}
 
 // Used to prevent concurrent runs of Speedtest's
 var speedtestMutex sync.Mutex
@@ -32,29 +119,250 @@ var speedtestMutex sync.Mutex
 // Create new instance of collector, returns error if an instance of speedtest is not provided
 // Arguments:
 //
-//	cacheTime: Minimum time between speedtest runs
+//	cache: Cache for the latest result, determines the minimum time between speedtest runs
+//	history: History the results are added to, used for the sla compliance metrics, may be nil
 //	instance: Name of this instance, provided as label on all metrics
 //	speedtest: Instance of speedtest to use for collection metrics
-func NewCollector(cache *cache.Cache, speedtest speedtest.Speedtest, instance string) (*Collector, error) {
+func NewCollector(cache *cache.Cache, history *history.History, speedtest speedtest.Speedtest, instance string) (*Collector, error) {
 	if speedtest == nil {
 		return nil, ErrNoSpeedtest{}
 	}
-	return &Collector{
+	ctx, cancel := context.WithCancel(context.Background())
+	labels := DefaultLabelOptions()
+	ipHashKey := make([]byte, IPHashKeyLength)
+	_, _ = rand.Read(ipHashKey)
+	c := &Collector{
 		cache:     cache,
+		history:   history,
 		speedtest: speedtest,
 		instance:  instance,
-	}, nil
+		labels:    labels,
+		ipHashKey: ipHashKey,
+		descs:     newDescriptors(labels.variableLabels(), nil),
+		sla:       DefaultSLAOptions(),
+		ctx:       ctx,
+		cancel:    cancel,
+
+		histogramOpts: DefaultHistogramOptions(),
+		histograms:    newHistograms(DefaultHistogramOptions(), nil),
+	}
+	if result, _ := cache.Read(); result != nil && result.Success() {
+		c.status.LastSuccess = result.TimestampAsTime()
+	}
+	return c, nil
+}
+
+// Change the instance label used for all metrics
+func (c *Collector) SetInstance(instance string) {
+	c.optionsLock.Lock()
+	defer c.optionsLock.Unlock()
+
+	c.instance = instance
+}
+
+// Return the instance label used for all metrics
+func (c *Collector) Instance() string {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+
+	return c.instance
+}
+
+// When enabled, the speedtest metrics are exported with the time the speedtest was run,
+// instead of the time they are collected.
+func (c *Collector) SetTimestamps(enabled bool) {
+	c.optionsLock.Lock()
+	defer c.optionsLock.Unlock()
+
+	c.timestamps = enabled
+}
+
+// Returns true if the speedtest metrics are exported with the time the speedtest was run
+func (c *Collector) Timestamps() bool {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+
+	return c.timestamps
+}
+
+// Change the labels added to the metrics.
+// Returns an error if the options are invalid, in which case the labels are not changed.
+func (c *Collector) SetLabels(opts LabelOptions) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+	if opts.IPMode == "" {
+		opts.IPMode = IPModeRaw
+	}
+	if len(opts.IPHashKey) == 0 {
+		opts.IPHashKey = c.ipHashKey
+	}
+
+	c.optionsLock.Lock()
+	defer c.optionsLock.Unlock()
+
+	if !maps.Equal(c.labels.ExtraLabels, opts.ExtraLabels) {
+		c.histograms = newHistograms(c.histogramOpts, opts.ExtraLabels)
+	}
+	c.labels = opts
+	c.descs = newDescriptors(opts.variableLabels(), opts.ExtraLabels)
+	return nil
+}
+
+// Change the buckets of the result histograms.
+// The histograms are reset when the options change.
+// Returns an error if the options are invalid, in which case the histograms are not changed.
+func (c *Collector) SetHistograms(opts HistogramOptions) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	c.optionsLock.Lock()
+	defer c.optionsLock.Unlock()
+
+	if c.histogramOpts.equal(opts) {
+		return nil
+	}
+	c.histogramOpts = opts
+	c.histograms = newHistograms(opts, c.labels.ExtraLabels)
+	return nil
+}
+
+// Return the histograms currently in use
+func (c *Collector) currentHistograms() *histograms {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+
+	return c.histograms
+}
+
+// Change the contracted speeds used for the sla metrics.
+// Returns an error if the options are invalid, in which case the sla is not changed.
+func (c *Collector) SetSLA(opts SLAOptions) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	c.optionsLock.Lock()
+	defer c.optionsLock.Unlock()
+
+	c.sla = opts
+	return nil
+}
+
+// Convert the client IP of a result the same way as the ip label, see LabelOptions.IPMode
+func (c *Collector) AnonymizeIP(ip string) string {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+
+	return anonymizeIP(ip, c.labels.IPMode, c.labels.IPHashKey)
+}
+
+// Return the contracted speeds used for the sla metrics
+func (c *Collector) SLA() SLAOptions {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+
+	return c.sla
+}
+
+// Register a function that is called with the result of every completed speedtest.
+// Cancelled runs and cached results are not passed to the handlers.
+// The handlers are called while the speedtest lock is held, so they must not block or collect metrics.
+func (c *Collector) OnResult(handler func(*speedtest.SpeedtestResult)) {
+	c.optionsLock.Lock()
+	defer c.optionsLock.Unlock()
+
+	c.resultHandlers = append(c.resultHandlers, handler)
+}
+
+// Pass the result to all registered handlers
+func (c *Collector) notifyResult(result *speedtest.SpeedtestResult) {
+	c.optionsLock.RLock()
+	handlers := c.resultHandlers
+	c.optionsLock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(result)
+	}
+}
+
+// Return the label options and metric descriptions currently in use
+func (c *Collector) currentLabels() (LabelOptions, *descriptors) {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+
+	return c.labels, c.descs
+}
+
+// Return the current status of the speedtest runs
+func (c *Collector) Status() Status {
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+
+	return c.status
+}
+
+// Returns true once the collector has been shut down
+func (c *Collector) Stopped() bool {
+	return c.ctx.Err() != nil
+}
+
+// Mark the start of a speedtest run
+func (c *Collector) startRun(start time.Time) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	c.status.Running = true
+	c.status.LastAttempt = start
+}
+
+// Record the outcome of a speedtest run.
+// A nil result marks a cancelled run, which is neither counted as success nor failure.
+func (c *Collector) finishRun(result *speedtest.SpeedtestResult) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	c.status.Running = false
+	switch {
+	case result == nil:
+	case result.Success():
+		c.status.LastSuccess = result.TimestampAsTime()
+		c.status.ConsecutiveFailures = 0
+		c.status.SuccessfulRuns++
+	default:
+		c.status.ConsecutiveFailures++
+		c.status.FailedRuns++
+	}
 }
 
 // Implements the Describe function for prometheus.Collector
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- jitterLatencyDesc
-	ch <- pingDesc
-	ch <- downloadSpeedDesc
-	ch <- uploadSpeedDesc
-	ch <- dataUsedDesc
-	ch <- durationDesc
-	ch <- upDesc
+	_, descs := c.currentLabels()
+	ch <- descs.jitterLatency
+	ch <- descs.ping
+	ch <- descs.downloadSpeed
+	ch <- descs.uploadSpeed
+	ch <- descs.dataUsed
+	ch <- descs.duration
+	ch <- descs.downloadRatio
+	ch <- descs.uploadRatio
+	ch <- descs.up
+	ch <- descs.lastSuccess
+	ch <- descs.lastAttempt
+	ch <- descs.consecutiveFailures
+	ch <- descs.cacheExpires
+	ch <- descs.runs
+	ch <- descs.contractedDownload
+	ch <- descs.contractedUpload
+	ch <- descs.contractedLatency
+	ch <- descs.slaTests
+	ch <- descs.slaCompliantTests
+	ch <- descs.slaCompliance
+	c.currentHistograms().describe(ch)
 }
 
 // Concurrency safe function to get the latest result of the speedtest.
@@ -69,9 +377,28 @@ func (c *Collector) getSpeedtestResult() *speedtest.SpeedtestResult {
 		slog.Debug("Cache has not expired, returning cached results", slog.String("expires", c.cache.ExpiresAt().Local().String()))
 		return result
 	}
+	if c.ctx.Err() != nil {
+		slog.Debug("Collector is shutting down, not running a new Speedtest")
+		if result == nil {
+			result = speedtest.NewFailedSpeedtestResult()
+		}
+		return result
+	}
+
 	slog.Debug("Cache expired, running new Speedtest")
-	result = c.speedtest.Speedtest()
+	start := time.Now()
+	c.startRun(start)
+	result = c.speedtest.Speedtest(c.ctx)
+	if c.ctx.Err() != nil {
+		c.finishRun(nil)
+		slog.Warn("Speedtest was cancelled due to shutdown, discarding the result", slog.Duration("elapsed", time.Since(start)))
+		return result
+	}
+	c.finishRun(result)
+	c.currentHistograms().observe(result)
 	c.cache.Save(result)
+	c.history.Add(result)
+	c.notifyResult(result)
 	return result
 }
 
@@ -79,17 +406,187 @@ func (c *Collector) getSpeedtestResult() *speedtest.SpeedtestResult {
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	slog.Debug("Starting collection of speedtest metrics")
 	result := c.getSpeedtestResult()
+
+	c.collectResult(ch, result, c.Timestamps())
+
+	_, descs := c.currentLabels()
+	status := c.Status()
+	ch <- prometheus.MustNewConstMetric(descs.lastSuccess, prometheus.GaugeValue, unixSeconds(status.LastSuccess))
+	ch <- prometheus.MustNewConstMetric(descs.lastAttempt, prometheus.GaugeValue, unixSeconds(status.LastAttempt))
+	ch <- prometheus.MustNewConstMetric(descs.consecutiveFailures, prometheus.GaugeValue, float64(status.ConsecutiveFailures))
+	ch <- prometheus.MustNewConstMetric(descs.cacheExpires, prometheus.GaugeValue, unixSeconds(c.cache.ExpiresAt()))
+	successfulRuns := prometheus.MustNewConstMetric(descs.runs, prometheus.CounterValue, float64(status.SuccessfulRuns), "success")
+	failedRuns := prometheus.MustNewConstMetric(descs.runs, prometheus.CounterValue, float64(status.FailedRuns), "failure")
+	if result.Success() && status.SuccessfulRuns > 0 {
+		successfulRuns = withRunExemplar(successfulRuns, result)
+	} else if !result.Success() && status.FailedRuns > 0 {
+		failedRuns = withRunExemplar(failedRuns, result)
+	}
+	ch <- successfulRuns
+	ch <- failedRuns
+
+	sla := c.SLA()
+	if sla.Download > 0 {
+		ch <- prometheus.MustNewConstMetric(descs.contractedDownload, prometheus.GaugeValue, sla.Download)
+	}
+	if sla.Upload > 0 {
+		ch <- prometheus.MustNewConstMetric(descs.contractedUpload, prometheus.GaugeValue, sla.Upload)
+	}
+	if sla.Latency > 0 {
+		ch <- prometheus.MustNewConstMetric(descs.contractedLatency, prometheus.GaugeValue, sla.Latency)
+	}
+	if sla.Enabled() {
+		results := c.history.Results(time.Now().Add(-sla.Window))
+		for _, compliance := range sla.Compliance(results) {
+			ch <- prometheus.MustNewConstMetric(descs.slaTests, prometheus.GaugeValue, float64(compliance.Tests), compliance.Target)
+			ch <- prometheus.MustNewConstMetric(descs.slaCompliantTests, prometheus.GaugeValue, float64(compliance.Compliant), compliance.Target)
+			if compliance.Tests > 0 {
+				ch <- prometheus.MustNewConstMetric(descs.slaCompliance, prometheus.GaugeValue, float64(compliance.Compliant)/float64(compliance.Tests), compliance.Target)
+			}
+		}
+	}
+	c.currentHistograms().collect(ch)
+	slog.Debug("Finished collection of speedtest metrics")
+}
+
+// Send the metrics describing the result itself, e.g. the measured speeds and speedtest_up.
+// With timestamps the metrics carry the time the speedtest was run.
+func (c *Collector) collectResult(ch chan<- prometheus.Metric, result *speedtest.SpeedtestResult, timestamps bool) {
+	newMetric := func(desc *prometheus.Desc, value float64, labelValues ...string) prometheus.Metric {
+		return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+	}
+	if timestamps {
+		newMetric = func(desc *prometheus.Desc, value float64, labelValues ...string) prometheus.Metric {
+			return prometheus.NewMetricWithTimestamp(result.TimestampAsTime(), prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labelValues...))
+		}
+	}
+
+	labels, descs := c.currentLabels()
+
 	var up float64
 	if result.Success() {
 		up = 1
-		labelValues := []string{result.ClientIP(), result.ClientISP(), c.instance}
-		ch <- prometheus.MustNewConstMetric(jitterLatencyDesc, prometheus.GaugeValue, result.JitterLatency(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(pingDesc, prometheus.GaugeValue, result.Ping(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(downloadSpeedDesc, prometheus.GaugeValue, result.DownloadSpeed(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(uploadSpeedDesc, prometheus.GaugeValue, result.UploadSpeed(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(dataUsedDesc, prometheus.GaugeValue, result.DataUsed(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(durationDesc, prometheus.GaugeValue, float64(result.Duration()), labelValues...)
-	}
-	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up)
-	slog.Debug("Finished collection of speedtest metrics")
+		labelValues := labels.labelValues(result, c.Instance())
+		ch <- newMetric(descs.jitterLatency, result.JitterLatency(), labelValues...)
+		ch <- newMetric(descs.ping, result.Ping(), labelValues...)
+		ch <- newMetric(descs.downloadSpeed, result.DownloadSpeed(), labelValues...)
+		ch <- newMetric(descs.uploadSpeed, result.UploadSpeed(), labelValues...)
+		ch <- newMetric(descs.dataUsed, result.DataUsed(), labelValues...)
+		ch <- newMetric(descs.duration, float64(result.Duration()), labelValues...)
+
+		sla := c.SLA()
+		if sla.Download > 0 {
+			ch <- newMetric(descs.downloadRatio, result.DownloadSpeed()/sla.Download, labelValues...)
+		}
+		if sla.Upload > 0 {
+			ch <- newMetric(descs.uploadRatio, result.UploadSpeed()/sla.Upload, labelValues...)
+		}
+	}
+	ch <- newMetric(descs.up, up)
+}
+
+// Returns a gatherer for the metrics of a single result, e.g. to push them right after the speedtest completed.
+// The metrics always carry the time the speedtest was run. Never runs a speedtest.
+// The metrics are only created when gathering, so it is safe to call from a result handler.
+func (c *Collector) ResultGatherer(result *speedtest.SpeedtestResult) prometheus.Gatherer {
+	return newCollectorFuncGatherer(func(ch chan<- prometheus.Metric) {
+		c.collectResult(ch, result, true)
+	})
+}
+
+// Returns a gatherer for speedtest_up of the last result, with the time of gathering.
+// Gathers nothing while a speedtest is running or before the first result, never runs a speedtest.
+func (c *Collector) UpGatherer() prometheus.Gatherer {
+	return newCollectorFuncGatherer(func(ch chan<- prometheus.Metric) {
+		result, _ := c.cache.Read()
+		if result == nil || c.Status().Running {
+			return
+		}
+		var up float64
+		if result.Success() {
+			up = 1
+		}
+		_, descs := c.currentLabels()
+		ch <- prometheus.MustNewConstMetric(descs.up, prometheus.GaugeValue, up)
+	})
+}
+
+// Create a gatherer for the metrics sent by the function, using a new registry on every call
+func newCollectorFuncGatherer(collect prometheus.CollectorFunc) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		reg := prometheus.NewRegistry()
+		err := reg.Register(collect)
+		if err != nil {
+			return nil, err
+		}
+		return reg.Gather()
+	})
+}
+
+// Label of the exemplars linking metrics to the run in the history
+const exemplarRunIDLabel = "run_id"
+
+// Return the exemplar labels for the result, nil if the result has no run ID
+func runExemplarLabels(result *speedtest.SpeedtestResult) prometheus.Labels {
+	if result.RunID() == "" {
+		return nil
+	}
+	return prometheus.Labels{exemplarRunIDLabel: result.RunID()}
+}
+
+// Attach the run ID of the result as exemplar to the metric.
+// Exemplars are only exposed when the scrape negotiates OpenMetrics.
+func withRunExemplar(m prometheus.Metric, result *speedtest.SpeedtestResult) prometheus.Metric {
+	labels := runExemplarLabels(result)
+	if labels == nil {
+		return m
+	}
+	res, err := prometheus.NewMetricWithExemplars(m, prometheus.Exemplar{
+		Value:     1,
+		Labels:    labels,
+		Timestamp: result.TimestampAsTime(),
+	})
+	if err != nil {
+		slog.Debug("Failed to add exemplar to metric", "err", err)
+		return m
+	}
+	return res
+}
+
+// Convert the time to a unix timestamp in seconds, returns 0 for the zero time
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixMilli()) / 1000
+}
+
+// Stop running new speedtests and wait for a running speedtest to finish.
+// If ctx expires before the speedtest is finished, it will be cancelled.
+func (c *Collector) Shutdown(ctx context.Context) {
+	if speedtestMutex.TryLock() {
+		c.cancel()
+		speedtestMutex.Unlock()
+		slog.Info("Stopped collector, no speedtest was running")
+		return
+	}
+
+	slog.Info("Waiting for running speedtest to finish")
+	done := make(chan struct{})
+	go func() {
+		speedtestMutex.Lock()
+		defer speedtestMutex.Unlock()
+		c.cancel()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Stopped collector after running speedtest finished")
+	case <-ctx.Done():
+		slog.Warn("Running speedtest did not finish in time, cancelling it")
+		c.cancel()
+		<-done
+		slog.Info("Stopped collector after cancelling running speedtest")
+	}
 }
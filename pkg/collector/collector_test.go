@@ -1,12 +1,16 @@
 package collector
 
 import (
+	"context"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
+	"github.com/heathcliff26/speedtest-exporter/pkg/history"
 	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,23 +26,29 @@ func NewMockSpeedtest() *speedtest.MockSpeedtest {
 func TestNewCollector(t *testing.T) {
 	s := NewMockSpeedtest()
 	c := cache.NewCache(false, "", defaultCacheTime)
-	expectedCollector := &Collector{
-		cache:     c,
-		speedtest: s,
-		instance:  "testinstance",
-	}
-
-	actualCollector, err := NewCollector(c, s, "testinstance")
+	actualCollector, err := NewCollector(c, nil, s, "testinstance")
 	require.NoError(t, err, "Should create new Collector")
 
 	assert := assert.New(t)
 
-	assert.Equal(expectedCollector, actualCollector)
+	assert.Equal(c, actualCollector.cache)
+	assert.Equal(s, actualCollector.speedtest)
+	assert.Equal("testinstance", actualCollector.instance)
+	assert.NoError(actualCollector.ctx.Err(), "Context should not be cancelled")
 
-	_, err = NewCollector(nil, nil, "testinstance")
+	_, err = NewCollector(nil, nil, nil, "testinstance")
 	assert.Equal(ErrNoSpeedtest{}, err)
 }
 
+func TestSetInstance(t *testing.T) {
+	c, err := NewCollector(nil, nil, NewMockSpeedtest(), "testinstance")
+	require.NoError(t, err, "Should create new Collector")
+
+	c.SetInstance("newinstance")
+
+	assert.Equal(t, "newinstance", c.Instance(), "Should update the instance label")
+}
+
 func TestResultFromCache(t *testing.T) {
 	speedtestRan := false
 	s := NewMockSpeedtest()
@@ -46,7 +56,7 @@ func TestResultFromCache(t *testing.T) {
 		speedtestRan = true
 	}
 
-	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), s, "testinstance")
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
 	require.NoError(t, err, "Should create new Collector")
 
 	expectedResult := speedtest.NewFailedSpeedtestResult()
@@ -68,7 +78,7 @@ func TestRunSpeedtestWhenCacheExpired(t *testing.T) {
 		speedtestRan = true
 	}
 
-	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), s, "testinstance")
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
 	require.NoError(t, err, "Should create new Collector")
 	result := c.getSpeedtestResult()
 
@@ -82,6 +92,27 @@ func TestRunSpeedtestWhenCacheExpired(t *testing.T) {
 	assert.True(speedtestRan, "Should have called the mock speedtest")
 }
 
+func TestOnResult(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, NewMockSpeedtest(), "testinstance")
+	require.NoError(t, err, "Should create new Collector")
+
+	var first, second []*speedtest.SpeedtestResult
+	c.OnResult(func(result *speedtest.SpeedtestResult) {
+		first = append(first, result)
+	})
+	c.OnResult(func(result *speedtest.SpeedtestResult) {
+		second = append(second, result)
+	})
+
+	c.getSpeedtestResult()
+	c.getSpeedtestResult()
+
+	assert.Equal([]*speedtest.SpeedtestResult{mockSpeedtestResult}, first, "Should pass the result of the speedtest to the handler")
+	assert.Equal(first, second, "Should call all handlers")
+}
+
 func TestSpeedtestIsNotRunConcurrently(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -96,7 +127,7 @@ func TestSpeedtestIsNotRunConcurrently(t *testing.T) {
 		time.Sleep(10 * time.Second)
 	}
 
-	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), s, "testinstance")
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
 	require.NoError(t, err, "Should create new Collector")
 
 	assert := assert.New(t)
@@ -118,9 +149,114 @@ func TestSpeedtestIsNotRunConcurrently(t *testing.T) {
 	assert.Equal(1, i)
 }
 
+func TestStatus(t *testing.T) {
+	t.Run("FromCache", func(t *testing.T) {
+		resultCache := cache.NewCache(false, "", defaultCacheTime)
+		resultCache.Save(mockSpeedtestResult)
+
+		c, err := NewCollector(resultCache, nil, NewMockSpeedtest(), "testinstance")
+		require.NoError(t, err, "Should create new Collector")
+
+		assert.Equal(t, Status{LastSuccess: mockSpeedtestResult.TimestampAsTime()}, c.Status(), "Should initialize last success from cache")
+	})
+	t.Run("Runs", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s := NewMockSpeedtest()
+		c, err := NewCollector(nil, nil, s, "testinstance")
+		require.NoError(t, err, "Should create new Collector")
+
+		var running bool
+		s.Callback = func() {
+			running = c.Status().Running
+		}
+
+		s.Fail = true
+		c.getSpeedtestResult()
+		c.getSpeedtestResult()
+
+		status := c.Status()
+		assert.True(running, "Should be running during speedtest")
+		assert.False(status.Running, "Should not be running after speedtest")
+		assert.Equal(2, status.ConsecutiveFailures)
+		assert.True(status.LastSuccess.IsZero(), "Should not have a successful run")
+		assert.False(status.LastAttempt.IsZero(), "Should record the last attempt")
+
+		s.Fail = false
+		c.getSpeedtestResult()
+
+		status = c.Status()
+		assert.Equal(0, status.ConsecutiveFailures, "Should reset failures after success")
+		assert.Equal(mockSpeedtestResult.TimestampAsTime(), status.LastSuccess)
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("Idle", func(t *testing.T) {
+		assert := assert.New(t)
+
+		speedtestRan := false
+		s := NewMockSpeedtest()
+		s.Callback = func() {
+			speedtestRan = true
+		}
+		c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
+		require.NoError(t, err, "Should create new Collector")
+
+		c.Shutdown(t.Context())
+
+		assert.Error(c.ctx.Err(), "Context should be cancelled")
+		assert.True(c.Stopped(), "Should report as stopped")
+		result := c.getSpeedtestResult()
+		assert.False(result.Success(), "Should return a failed result")
+		assert.False(speedtestRan, "Should not run a new speedtest after shutdown")
+	})
+	t.Run("WaitForSpeedtest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		running := make(chan struct{})
+		s := NewMockSpeedtest()
+		s.Callback = func() {
+			close(running)
+			time.Sleep(100 * time.Millisecond)
+		}
+		c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
+		require.NoError(t, err, "Should create new Collector")
+
+		go c.getSpeedtestResult()
+		<-running
+		c.Shutdown(t.Context())
+
+		result, _ := c.cache.Read()
+		assert.Equal(mockSpeedtestResult, result, "Should have saved the finished result")
+	})
+	t.Run("CancelSpeedtest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		running := make(chan struct{})
+		s := NewMockSpeedtest()
+		s.Callback = func() {
+			close(running)
+			time.Sleep(100 * time.Millisecond)
+		}
+		c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
+		require.NoError(t, err, "Should create new Collector")
+
+		go c.getSpeedtestResult()
+		<-running
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		c.Shutdown(ctx)
+
+		result, _ := c.cache.Read()
+		assert.Nil(result, "Should not save the result of a cancelled speedtest")
+	})
+}
+
 func TestCollect(t *testing.T) {
 	s := NewMockSpeedtest()
-	c, err := NewCollector(nil, s, "testinstance")
+	c, err := NewCollector(nil, nil, s, "testinstance")
 	require.NoError(t, err, "Should create new Collector")
 
 	t.Run("Success", func(t *testing.T) {
@@ -130,31 +266,65 @@ func TestCollect(t *testing.T) {
 		actualLabelValues := []string{mockSpeedtestResult.ClientIP(), mockSpeedtestResult.ClientISP(), "testinstance"}
 
 		actualMetric := <-ch
-		expectedMetric := prometheus.MustNewConstMetric(jitterLatencyDesc, prometheus.GaugeValue, mockSpeedtestResult.JitterLatency(), actualLabelValues...)
+		expectedMetric := prometheus.MustNewConstMetric(c.descs.jitterLatency, prometheus.GaugeValue, mockSpeedtestResult.JitterLatency(), actualLabelValues...)
+		assert.Equal(t, expectedMetric, actualMetric)
+
+		actualMetric = <-ch
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.ping, prometheus.GaugeValue, mockSpeedtestResult.Ping(), actualLabelValues...)
+		assert.Equal(t, expectedMetric, actualMetric)
+
+		actualMetric = <-ch
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.downloadSpeed, prometheus.GaugeValue, mockSpeedtestResult.DownloadSpeed(), actualLabelValues...)
+		assert.Equal(t, expectedMetric, actualMetric)
+
+		actualMetric = <-ch
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.uploadSpeed, prometheus.GaugeValue, mockSpeedtestResult.UploadSpeed(), actualLabelValues...)
 		assert.Equal(t, expectedMetric, actualMetric)
 
 		actualMetric = <-ch
-		expectedMetric = prometheus.MustNewConstMetric(pingDesc, prometheus.GaugeValue, mockSpeedtestResult.Ping(), actualLabelValues...)
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.dataUsed, prometheus.GaugeValue, mockSpeedtestResult.DataUsed(), actualLabelValues...)
 		assert.Equal(t, expectedMetric, actualMetric)
 
 		actualMetric = <-ch
-		expectedMetric = prometheus.MustNewConstMetric(downloadSpeedDesc, prometheus.GaugeValue, mockSpeedtestResult.DownloadSpeed(), actualLabelValues...)
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.duration, prometheus.GaugeValue, float64(mockSpeedtestResult.Duration()), actualLabelValues...)
 		assert.Equal(t, expectedMetric, actualMetric)
 
 		actualMetric = <-ch
-		expectedMetric = prometheus.MustNewConstMetric(uploadSpeedDesc, prometheus.GaugeValue, mockSpeedtestResult.UploadSpeed(), actualLabelValues...)
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.up, prometheus.GaugeValue, 1)
 		assert.Equal(t, expectedMetric, actualMetric)
 
+		status := c.Status()
+
 		actualMetric = <-ch
-		expectedMetric = prometheus.MustNewConstMetric(dataUsedDesc, prometheus.GaugeValue, mockSpeedtestResult.DataUsed(), actualLabelValues...)
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.lastSuccess, prometheus.GaugeValue, float64(mockSpeedtestResult.TimestampAsTime().UnixMilli())/1000)
 		assert.Equal(t, expectedMetric, actualMetric)
 
 		actualMetric = <-ch
-		expectedMetric = prometheus.MustNewConstMetric(durationDesc, prometheus.GaugeValue, float64(mockSpeedtestResult.Duration()), actualLabelValues...)
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.lastAttempt, prometheus.GaugeValue, unixSeconds(status.LastAttempt))
 		assert.Equal(t, expectedMetric, actualMetric)
 
 		actualMetric = <-ch
-		expectedMetric = prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.consecutiveFailures, prometheus.GaugeValue, 0)
+		assert.Equal(t, expectedMetric, actualMetric)
+
+		actualMetric = <-ch
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.cacheExpires, prometheus.GaugeValue, 0)
+		assert.Equal(t, expectedMetric, actualMetric, "Should be 0 without cache")
+
+		actualMetric = <-ch
+		assert.Equal(t, c.descs.runs, actualMetric.Desc())
+		m := &dto.Metric{}
+		require.NoError(t, actualMetric.Write(m), "Should write metric")
+		assert.Equal(t, 1.0, m.GetCounter().GetValue())
+		assert.Equal(t, "success", m.GetLabel()[0].GetValue())
+		exemplarLabels := m.GetCounter().GetExemplar().GetLabel()
+		if assert.Len(t, exemplarLabels, 1, "Should link the run via exemplar") {
+			assert.Equal(t, "run_id", exemplarLabels[0].GetName())
+			assert.Equal(t, mockSpeedtestResult.RunID(), exemplarLabels[0].GetValue())
+		}
+
+		actualMetric = <-ch
+		expectedMetric = prometheus.MustNewConstMetric(c.descs.runs, prometheus.CounterValue, 0, "failure")
 		assert.Equal(t, expectedMetric, actualMetric)
 	})
 
@@ -163,20 +333,150 @@ func TestCollect(t *testing.T) {
 		s.Fail = true
 		go c.Collect(ch)
 		actualMetric := <-ch
-		expectedMetric := prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0)
+		expectedMetric := prometheus.MustNewConstMetric(c.descs.up, prometheus.GaugeValue, 0)
 		assert.Equal(t, expectedMetric, actualMetric)
 	})
 }
 
+func TestCollectWithTimestamps(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := NewCollector(nil, nil, NewMockSpeedtest(), "testinstance")
+	require.NoError(err, "Should create new Collector")
+	c.SetTimestamps(true)
+	assert.True(c.Timestamps())
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	require.NoError(err, "Should gather metrics")
+
+	expectedTimestamp := mockSpeedtestResult.Timestamp()
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch family.GetName() {
+			case "speedtest_download_megabits_per_second", "speedtest_up":
+				assert.Equal(expectedTimestamp, m.GetTimestampMs(), "%s should have the timestamp of the result", family.GetName())
+			case "speedtest_runs_total", "speedtest_last_success_timestamp_seconds":
+				assert.Nil(m.TimestampMs, "%s should not have a timestamp", family.GetName())
+			}
+		}
+	}
+}
+
+func TestResultGatherer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	runs := 0
+	s := NewMockSpeedtest()
+	s.Callback = func() { runs++ }
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
+	require.NoError(err, "Should create new Collector")
+	require.NoError(c.SetSLA(SLAOptions{Download: 1000, Threshold: 0.8, Window: time.Hour}))
+
+	families, err := c.ResultGatherer(mockSpeedtestResult).Gather()
+	require.NoError(err, "Should gather metrics")
+
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		names = append(names, family.GetName())
+		for _, m := range family.GetMetric() {
+			assert.Equal(mockSpeedtestResult.Timestamp(), m.GetTimestampMs(), "%s should have the timestamp of the result", family.GetName())
+		}
+	}
+	assert.Equal([]string{
+		"speedtest_data_used_megabytes",
+		"speedtest_download_megabits_per_second",
+		"speedtest_download_ratio_of_contracted",
+		"speedtest_duration_milliseconds",
+		"speedtest_jitter_latency_milliseconds",
+		"speedtest_ping_latency_milliseconds",
+		"speedtest_up",
+		"speedtest_upload_megabits_per_second",
+	}, names, "Should only contain the metrics of the result")
+	assert.Zero(runs, "Should not run a speedtest")
+
+	t.Run("Failed", func(t *testing.T) {
+		families, err := c.ResultGatherer(speedtest.NewFailedSpeedtestResult()).Gather()
+		require.NoError(err, "Should gather metrics")
+		require.Len(families, 1, "Should only contain speedtest_up")
+		assert.Equal(0.0, families[0].GetMetric()[0].GetGauge().GetValue())
+	})
+}
+
+func TestUpGatherer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	runs := 0
+	s := NewMockSpeedtest()
+	s.Callback = func() { runs++ }
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
+	require.NoError(err, "Should create new Collector")
+
+	families, err := c.UpGatherer().Gather()
+	require.NoError(err, "Should gather metrics")
+	assert.Empty(families, "Should not gather anything before the first result")
+
+	c.getSpeedtestResult()
+
+	families, err = c.UpGatherer().Gather()
+	require.NoError(err, "Should gather metrics")
+	require.Len(families, 1, "Should only contain speedtest_up")
+	assert.Equal("speedtest_up", families[0].GetName())
+	assert.Equal(1.0, families[0].GetMetric()[0].GetGauge().GetValue())
+	assert.Nil(families[0].GetMetric()[0].TimestampMs, "Should use the time of gathering")
+	assert.Equal(1, runs, "Should not run another speedtest")
+}
+
+func TestSetLabels(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := NewCollector(nil, nil, NewMockSpeedtest(), "testinstance")
+	require.NoError(err, "Should create new Collector")
+
+	assert.Equal(&ErrUnknownLabel{Label: "foo"}, c.SetLabels(LabelOptions{Labels: []string{"foo"}}), "Should reject invalid labels")
+	labels, _ := c.currentLabels()
+	assert.Equal(DefaultLabelOptions(), labels, "Should keep the previous labels")
+
+	require.NoError(c.SetLabels(LabelOptions{
+		Labels:      []string{LabelIP, LabelServerID},
+		IPMode:      IPModeDropped,
+		ExtraLabels: map[string]string{"site": "home"},
+	}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	require.NoError(err, "Should gather metrics")
+
+	for _, family := range families {
+		labels := make(map[string]string)
+		for _, l := range family.GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		switch family.GetName() {
+		case "speedtest_download_megabits_per_second":
+			assert.Equal(map[string]string{"server_id": "1234", "instance": "testinstance", "site": "home"}, labels)
+		case "speedtest_up":
+			assert.Equal(map[string]string{"site": "home"}, labels, "Should add extra labels to all metrics")
+		}
+	}
+}
+
 func TestDescribe(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
 
 	s := NewMockSpeedtest()
-	c, err := NewCollector(nil, s, "testinstance")
+	c, err := NewCollector(nil, history.NewHistory(false, "", time.Hour), s, "testinstance")
 	require.NoError(err, "Should create new Collector")
+	require.NoError(c.SetSLA(SLAOptions{Download: 1000, Upload: 10, Latency: 20, Threshold: 0.8, Window: time.Hour}))
 
-	expectedDescCount := 7
+	expectedDescCount := 23
 
 	ch := make(chan *prometheus.Desc)
 
@@ -187,7 +487,10 @@ func TestDescribe(t *testing.T) {
 	}()
 
 	for desc := range ch {
-		expectedDescs = append(expectedDescs, desc)
+		// Metrics with multiple label values share the same desc
+		if !slices.Contains(expectedDescs, desc) {
+			expectedDescs = append(expectedDescs, desc)
+		}
 	}
 
 	ch = make(chan *prometheus.Desc)
@@ -205,3 +508,106 @@ func TestDescribe(t *testing.T) {
 	assert.Len(result, expectedDescCount, "Should have correct number of described metrics")
 	assert.Equal(expectedDescs, result, "Described metrics should match collected metrics")
 }
+
+func TestCollectSLA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := history.NewHistory(false, "", time.Hour)
+	h.Add(speedtest.MockSpeedtestResult(time.Now().Add(-30 * time.Minute).UnixMilli()))
+	h.Add(speedtest.NewFailedSpeedtestResult())
+
+	c, err := NewCollector(nil, h, NewMockSpeedtest(), "testinstance")
+	require.NoError(err, "Should create new Collector")
+
+	assert.Equal(&ErrInvalidSLA{Reason: "window needs to be greater than 0"}, c.SetSLA(SLAOptions{Download: 1000, Threshold: 0.8}), "Should reject invalid sla")
+	assert.Equal(DefaultSLAOptions(), c.SLA(), "Should keep the previous sla")
+
+	require.NoError(c.SetSLA(SLAOptions{Download: 1000, Latency: 20, Threshold: 0.8, Window: time.Hour}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	require.NoError(err, "Should gather metrics")
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			name := family.GetName()
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "target" {
+					name += "/" + l.GetValue()
+				}
+			}
+			values[name] = m.GetGauge().GetValue()
+		}
+	}
+
+	assert.Equal(1000.0, values["speedtest_contracted_download_megabits_per_second"])
+	assert.Equal(20.0, values["speedtest_contracted_latency_milliseconds"])
+	assert.InDelta(0.87653, values["speedtest_download_ratio_of_contracted"], 0.00001)
+	assert.NotContains(values, "speedtest_contracted_upload_megabits_per_second", "Should not export disabled targets")
+	assert.NotContains(values, "speedtest_upload_ratio_of_contracted", "Should not export disabled targets")
+
+	// The collected result is added to the 2 results already in the history
+	assert.Equal(3.0, values["speedtest_sla_window_tests/download"])
+	assert.Equal(2.0, values["speedtest_sla_window_compliant_tests/download"])
+	assert.InDelta(2.0/3.0, values["speedtest_sla_compliance_ratio/download"], 0.00001)
+	assert.Equal(3.0, values["speedtest_sla_window_tests/latency"])
+	assert.Equal(2.0, values["speedtest_sla_window_compliant_tests/latency"])
+	assert.NotContains(values, "speedtest_sla_window_tests/upload", "Should not export disabled targets")
+}
+
+func TestCollectHistograms(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := NewMockSpeedtest()
+	resultCache := cache.NewCache(false, "", time.Hour)
+	c, err := NewCollector(resultCache, nil, s, "testinstance")
+	require.NoError(err, "Should create new Collector")
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	sampleCounts := func() map[string]uint64 {
+		families, err := reg.Gather()
+		require.NoError(err, "Should gather metrics")
+		counts := make(map[string]uint64)
+		for _, family := range families {
+			if family.GetMetric()[0].GetHistogram() != nil {
+				counts[family.GetName()] = family.GetMetric()[0].GetHistogram().GetSampleCount()
+			}
+		}
+		return counts
+	}
+
+	expected := map[string]uint64{
+		"speedtest_download_megabits_per_second_histogram": 1,
+		"speedtest_upload_megabits_per_second_histogram":   1,
+		"speedtest_ping_latency_milliseconds_histogram":    1,
+	}
+	assert.Equal(expected, sampleCounts(), "Should observe the new result")
+	assert.Equal(expected, sampleCounts(), "Should not observe cached results again")
+
+	resultCache.SetCacheTime(0)
+	s.Fail = true
+	assert.Equal(expected, sampleCounts(), "Should not observe failed results")
+
+	assert.Equal(&ErrInvalidBuckets{Histogram: "upload", Reason: "buckets need to be in strictly increasing order"}, c.SetHistograms(HistogramOptions{
+		DownloadBuckets: DefaultSpeedBuckets,
+		UploadBuckets:   []float64{10, 5},
+		PingBuckets:     DefaultPingBuckets,
+	}), "Should reject invalid buckets")
+	assert.Equal(expected, sampleCounts(), "Should keep the histograms when the options are invalid")
+
+	require.NoError(c.SetHistograms(DefaultHistogramOptions()))
+	assert.Equal(expected, sampleCounts(), "Should keep the histograms when the options did not change")
+
+	require.NoError(c.SetHistograms(HistogramOptions{Native: true}))
+	assert.Equal(map[string]uint64{
+		"speedtest_download_megabits_per_second_histogram": 0,
+		"speedtest_upload_megabits_per_second_histogram":   0,
+		"speedtest_ping_latency_milliseconds_histogram":    0,
+	}, sampleCounts(), "Should reset the histograms when the options change")
+}
@@ -1,7 +1,70 @@
 package collector
 
+import "strings"
+
 type ErrNoSpeedtest struct{}
 
 func (e ErrNoSpeedtest) Error() string {
 	return "No valid speedtest provided"
 }
+
+type ErrUnknownLabel struct {
+	Label string
+}
+
+func (e *ErrUnknownLabel) Error() string {
+	return "Unknown label \"" + e.Label + "\", available labels are: " + strings.Join(AvailableLabels, ", ")
+}
+
+type ErrDuplicateLabel struct {
+	Label string
+}
+
+func (e *ErrDuplicateLabel) Error() string {
+	return "Label \"" + e.Label + "\" is configured more than once"
+}
+
+type ErrUnknownIPMode struct {
+	Mode string
+}
+
+func (e *ErrUnknownIPMode) Error() string {
+	return "Unknown ip label mode \"" + e.Mode + "\", available modes are: " + strings.Join(IPModes, ", ")
+}
+
+type ErrInvalidExtraLabel struct {
+	Label string
+}
+
+func (e *ErrInvalidExtraLabel) Error() string {
+	return "Invalid extra label \"" + e.Label + "\", needs to be a valid label name that is not used by the exporter"
+}
+
+type ErrInvalidSLA struct {
+	Reason string
+}
+
+func (e *ErrInvalidSLA) Error() string {
+	return "Invalid sla config: " + e.Reason
+}
+
+type ErrInvalidBuckets struct {
+	Histogram string
+	Reason    string
+}
+
+func (e *ErrInvalidBuckets) Error() string {
+	return "Invalid buckets for " + e.Histogram + " histogram: " + e.Reason
+}
+
+type ErrNoCollector struct{}
+
+func (e ErrNoCollector) Error() string {
+	return "No collector provided"
+}
+
+type ErrSchedulerAlreadyRunning struct{}
+
+func (e ErrSchedulerAlreadyRunning) Error() string {
+	return "Only a single instance of the scheduler can run at a time"
+}
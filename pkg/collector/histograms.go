@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"slices"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	DefaultSpeedBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	DefaultPingBuckets  = []float64{1, 2.5, 5, 10, 20, 30, 50, 75, 100, 250, 500, 1000}
+)
+
+const (
+	// Growth factor between native histogram buckets, each bucket is at most 10% wider than the previous one
+	nativeHistogramBucketFactor = 1.1
+	// Limit the number of native buckets, the results are not expected to be spread that widely
+	nativeHistogramMaxBucketNumber = 160
+)
+
+// Configure the histograms of the speedtest results
+type HistogramOptions struct {
+	// Upper bounds of the classic buckets for the download speed in Mbit/s
+	DownloadBuckets []float64
+	// Upper bounds of the classic buckets for the upload speed in Mbit/s
+	UploadBuckets []float64
+	// Upper bounds of the classic buckets for the ping in ms
+	PingBuckets []float64
+	// Additionally export native histograms, they are only exposed with the protobuf format
+	Native bool
+}
+
+// Returns the default histogram options, native histograms are disabled
+func DefaultHistogramOptions() HistogramOptions {
+	return HistogramOptions{
+		DownloadBuckets: slices.Clone(DefaultSpeedBuckets),
+		UploadBuckets:   slices.Clone(DefaultSpeedBuckets),
+		PingBuckets:     slices.Clone(DefaultPingBuckets),
+	}
+}
+
+// Verify that the buckets are strictly increasing.
+// Empty buckets are only allowed when native histograms are enabled.
+func (o HistogramOptions) Validate() error {
+	for _, h := range []struct {
+		name    string
+		buckets []float64
+	}{
+		{"download", o.DownloadBuckets},
+		{"upload", o.UploadBuckets},
+		{"ping", o.PingBuckets},
+	} {
+		if len(h.buckets) == 0 && !o.Native {
+			return &ErrInvalidBuckets{Histogram: h.name, Reason: "needs buckets when native histograms are disabled"}
+		}
+		for i := 1; i < len(h.buckets); i++ {
+			if h.buckets[i] <= h.buckets[i-1] {
+				return &ErrInvalidBuckets{Histogram: h.name, Reason: "buckets need to be in strictly increasing order"}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if both options produce the same histograms
+func (o HistogramOptions) equal(other HistogramOptions) bool {
+	return o.Native == other.Native &&
+		slices.Equal(o.DownloadBuckets, other.DownloadBuckets) &&
+		slices.Equal(o.UploadBuckets, other.UploadBuckets) &&
+		slices.Equal(o.PingBuckets, other.PingBuckets)
+}
+
+// Histograms accumulating all completed speedtests
+type histograms struct {
+	downloadSpeed prometheus.Histogram
+	uploadSpeed   prometheus.Histogram
+	ping          prometheus.Histogram
+}
+
+// Create new, empty histograms. Assumes the options have been validated.
+func newHistograms(opts HistogramOptions, constLabels prometheus.Labels) *histograms {
+	newHistogram := func(name, help string, buckets []float64) prometheus.Histogram {
+		histOpts := prometheus.HistogramOpts{
+			Name:        name,
+			Help:        help,
+			ConstLabels: constLabels,
+			Buckets:     buckets,
+		}
+		if opts.Native {
+			histOpts.NativeHistogramBucketFactor = nativeHistogramBucketFactor
+			histOpts.NativeHistogramMaxBucketNumber = nativeHistogramMaxBucketNumber
+		}
+		return prometheus.NewHistogram(histOpts)
+	}
+
+	return &histograms{
+		downloadSpeed: newHistogram("speedtest_download_megabits_per_second_histogram", "Distribution of the Download Speed of all speedtests in Mbit/s", opts.DownloadBuckets),
+		uploadSpeed:   newHistogram("speedtest_upload_megabits_per_second_histogram", "Distribution of the Upload Speed of all speedtests in Mbit/s", opts.UploadBuckets),
+		ping:          newHistogram("speedtest_ping_latency_milliseconds_histogram", "Distribution of the Ping of all speedtests in ms", opts.PingBuckets),
+	}
+}
+
+// Add the values of a successful result to the histograms, the run ID is attached as exemplar
+func (h *histograms) observe(result *speedtest.SpeedtestResult) {
+	if !result.Success() {
+		return
+	}
+	exemplar := runExemplarLabels(result)
+	observe := func(histogram prometheus.Histogram, value float64) {
+		if exemplar == nil {
+			histogram.Observe(value)
+			return
+		}
+		histogram.(prometheus.ExemplarObserver).ObserveWithExemplar(value, exemplar)
+	}
+	observe(h.downloadSpeed, result.DownloadSpeed())
+	observe(h.uploadSpeed, result.UploadSpeed())
+	observe(h.ping, result.Ping())
+}
+
+func (h *histograms) describe(ch chan<- *prometheus.Desc) {
+	ch <- h.downloadSpeed.Desc()
+	ch <- h.uploadSpeed.Desc()
+	ch <- h.ping.Desc()
+}
+
+func (h *histograms) collect(ch chan<- prometheus.Metric) {
+	ch <- h.downloadSpeed
+	ch <- h.uploadSpeed
+	ch <- h.ping
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramOptionsValidate(t *testing.T) {
+	tMatrix := []struct {
+		Name    string
+		Options HistogramOptions
+		Error   error
+	}{
+		{
+			Name:    "Default",
+			Options: DefaultHistogramOptions(),
+		},
+		{
+			Name:    "NativeOnly",
+			Options: HistogramOptions{Native: true},
+		},
+		{
+			Name:    "MissingBuckets",
+			Options: HistogramOptions{DownloadBuckets: DefaultSpeedBuckets, UploadBuckets: DefaultSpeedBuckets},
+			Error:   &ErrInvalidBuckets{Histogram: "ping", Reason: "needs buckets when native histograms are disabled"},
+		},
+		{
+			Name:    "DuplicateBucket",
+			Options: HistogramOptions{DownloadBuckets: []float64{10, 10}, UploadBuckets: DefaultSpeedBuckets, PingBuckets: DefaultPingBuckets},
+			Error:   &ErrInvalidBuckets{Histogram: "download", Reason: "buckets need to be in strictly increasing order"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, tCase.Options.Validate())
+		})
+	}
+}
+
+func TestHistogramOptionsEqual(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(DefaultHistogramOptions().equal(DefaultHistogramOptions()))
+	native := DefaultHistogramOptions()
+	native.Native = true
+	assert.False(DefaultHistogramOptions().equal(native), "Should compare native setting")
+	buckets := DefaultHistogramOptions()
+	buckets.PingBuckets = []float64{1, 2}
+	assert.False(DefaultHistogramOptions().equal(buckets), "Should compare buckets")
+}
+
+func TestHistogramsObserve(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := newHistograms(HistogramOptions{
+		DownloadBuckets: []float64{100, 1000},
+		UploadBuckets:   []float64{10, 100},
+		PingBuckets:     []float64{10, 20},
+		Native:          true,
+	}, prometheus.Labels{"site": "home"})
+
+	result := speedtest.NewSpeedtestResult(1, 15, 876.53, 12.34, 100, "1", "example.org", "Foo Corp.", "127.0.0.1", time.Second)
+	h.observe(result)
+	h.observe(speedtest.NewFailedSpeedtestResult())
+
+	m := &dto.Metric{}
+	require.NoError(h.downloadSpeed.Write(m))
+	assert.Equal(uint64(1), m.GetHistogram().GetSampleCount(), "Should only observe successful results")
+	assert.Equal(876.53, m.GetHistogram().GetSampleSum())
+	assert.Equal(uint64(0), m.GetHistogram().GetBucket()[0].GetCumulativeCount())
+	assert.Equal(uint64(1), m.GetHistogram().GetBucket()[1].GetCumulativeCount())
+	assert.NotEmpty(m.GetHistogram().GetPositiveSpan(), "Should have native buckets")
+	exemplar := m.GetHistogram().GetBucket()[1].GetExemplar()
+	if assert.NotNil(exemplar, "Should add the run ID as exemplar") {
+		assert.Equal("run_id", exemplar.GetLabel()[0].GetName())
+		assert.Equal(result.RunID(), exemplar.GetLabel()[0].GetValue())
+	}
+	assert.Equal("site", m.GetLabel()[0].GetName(), "Should add const labels")
+
+	require.NoError(h.ping.Write(m))
+	assert.Equal(uint64(1), m.GetHistogram().GetBucket()[1].GetCumulativeCount(), "Should observe the ping")
+}
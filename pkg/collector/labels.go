@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/prometheus/common/model"
+)
+
+// Labels that can be added to the speedtest metrics, filled from the result
+const (
+	LabelIP             = "ip"
+	LabelISP            = "isp"
+	LabelServerID       = "server_id"
+	LabelServerHost     = "server_host"
+	LabelServerLocation = "server_location"
+	LabelBackend        = "backend"
+	LabelInterface      = "interface"
+)
+
+// Label containing the name of the instance, always added to the speedtest metrics
+const labelInstance = "instance"
+
+var AvailableLabels = []string{LabelIP, LabelISP, LabelServerID, LabelServerHost, LabelServerLocation, LabelBackend, LabelInterface}
+
+// How the client IP is exported in the ip label
+const (
+	// Export the IP unchanged
+	IPModeRaw = "raw"
+	// Export a keyed hash of the IP, allows to see when the IP changes without revealing it
+	IPModeHashed = "hashed"
+	// Export the network of the IP, /24 for IPv4 and /48 for IPv6
+	IPModeTruncated = "truncated"
+	// Do not export the ip label at all
+	IPModeDropped = "dropped"
+)
+
+var IPModes = []string{IPModeRaw, IPModeHashed, IPModeTruncated, IPModeDropped}
+
+// Length of the hex encoded hash used for the ip label
+const ipHashLength = 16
+
+// Length of the random key generated for hashing the ip label
+const IPHashKeyLength = 32
+
+// Configure which labels are added to the speedtest metrics
+type LabelOptions struct {
+	// Labels filled from the speedtest result, see AvailableLabels
+	Labels []string
+	// How the ip label is exported, see IPModes. Defaults to IPModeRaw when empty
+	IPMode string
+	// Static labels added to all metrics of the collector
+	ExtraLabels map[string]string
+	// Secret key for the HMAC of the ip label in IPModeHashed.
+	// Without a key, the hash can be reversed by hashing every possible IP.
+	// The collector uses a random key when empty, which changes the hash on every restart.
+	IPHashKey []byte
+}
+
+// Returns the default labels, matching the labels exported by previous versions
+func DefaultLabelOptions() LabelOptions {
+	return LabelOptions{
+		Labels: []string{LabelIP, LabelISP},
+		IPMode: IPModeRaw,
+	}
+}
+
+// Verify that only known labels and modes are used and that extra labels do not clash with other labels
+func (o LabelOptions) Validate() error {
+	for i, label := range o.Labels {
+		if !slices.Contains(AvailableLabels, label) {
+			return &ErrUnknownLabel{Label: label}
+		}
+		if slices.Contains(o.Labels[:i], label) {
+			return &ErrDuplicateLabel{Label: label}
+		}
+	}
+
+	if o.IPMode != "" && !slices.Contains(IPModes, o.IPMode) {
+		return &ErrUnknownIPMode{Mode: o.IPMode}
+	}
+
+	for name := range o.ExtraLabels {
+		if !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, "__") {
+			return &ErrInvalidExtraLabel{Label: name}
+		}
+		if name == labelInstance || slices.Contains(AvailableLabels, name) {
+			return &ErrInvalidExtraLabel{Label: name}
+		}
+	}
+	return nil
+}
+
+// Return the names of the variable labels of the speedtest metrics
+func (o LabelOptions) variableLabels() []string {
+	labels := make([]string, 0, len(o.Labels)+1)
+	for _, label := range o.Labels {
+		if label == LabelIP && o.IPMode == IPModeDropped {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	return append(labels, labelInstance)
+}
+
+// Return the values for the variable labels of the speedtest metrics
+func (o LabelOptions) labelValues(result *speedtest.SpeedtestResult, instance string) []string {
+	labels := o.variableLabels()
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		switch label {
+		case LabelIP:
+			values[i] = anonymizeIP(result.ClientIP(), o.IPMode, o.IPHashKey)
+		case LabelISP:
+			values[i] = result.ClientISP()
+		case LabelServerID:
+			values[i] = result.ServerID()
+		case LabelServerHost:
+			values[i] = result.ServerHost()
+		case LabelServerLocation:
+			values[i] = result.ServerLocation()
+		case LabelBackend:
+			values[i] = result.Backend()
+		case LabelInterface:
+			values[i] = result.Interface()
+		case labelInstance:
+			values[i] = instance
+		}
+	}
+	return values
+}
+
+// Convert the IP according to the given mode, key is used for the HMAC in IPModeHashed
+func anonymizeIP(ip, mode string, key []byte) string {
+	switch mode {
+	case IPModeHashed:
+		if ip == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil))[:ipHashLength]
+	case IPModeTruncated:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+		}
+		return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+	case IPModeDropped:
+		return ""
+	default:
+		return ip
+	}
+}
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelOptionsValidate(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Opts  LabelOptions
+		Error error
+	}{
+		{"Default", DefaultLabelOptions(), nil},
+		{"AllLabels", LabelOptions{Labels: AvailableLabels, IPMode: IPModeHashed, ExtraLabels: map[string]string{"site": "home", "circuit_id": "1234"}}, nil},
+		{"NoLabels", LabelOptions{}, nil},
+		{"UnknownLabel", LabelOptions{Labels: []string{"ip", "foo"}}, &ErrUnknownLabel{Label: "foo"}},
+		{"DuplicateLabel", LabelOptions{Labels: []string{"ip", "isp", "ip"}}, &ErrDuplicateLabel{Label: "ip"}},
+		{"UnknownIPMode", LabelOptions{IPMode: "encrypted"}, &ErrUnknownIPMode{Mode: "encrypted"}},
+		{"InvalidExtraLabelName", LabelOptions{ExtraLabels: map[string]string{"circuit-id": "1234"}}, &ErrInvalidExtraLabel{Label: "circuit-id"}},
+		{"ReservedExtraLabelName", LabelOptions{ExtraLabels: map[string]string{"__name__": "foo"}}, &ErrInvalidExtraLabel{Label: "__name__"}},
+		{"ExtraLabelClashesWithInstance", LabelOptions{ExtraLabels: map[string]string{"instance": "foo"}}, &ErrInvalidExtraLabel{Label: "instance"}},
+		{"ExtraLabelClashesWithResultLabel", LabelOptions{ExtraLabels: map[string]string{"isp": "foo"}}, &ErrInvalidExtraLabel{Label: "isp"}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, tCase.Opts.Validate())
+		})
+	}
+}
+
+func TestLabelValues(t *testing.T) {
+	result := speedtest.MockSpeedtestResult(0)
+
+	tMatrix := []struct {
+		Name   string
+		Opts   LabelOptions
+		Labels []string
+		Values []string
+	}{
+		{
+			Name:   "Default",
+			Opts:   DefaultLabelOptions(),
+			Labels: []string{"ip", "isp", "instance"},
+			Values: []string{"127.0.0.1", "Foo Corp.", "test"},
+		},
+		{
+			Name:   "AllLabels",
+			Opts:   LabelOptions{Labels: AvailableLabels, IPMode: IPModeTruncated},
+			Labels: []string{"ip", "isp", "server_id", "server_host", "server_location", "backend", "interface", "instance"},
+			Values: []string{"127.0.0.0/24", "Foo Corp.", "1234", "example.org", "Frankfurt, Germany", "mock", "eth0", "test"},
+		},
+		{
+			Name:   "DroppedIP",
+			Opts:   LabelOptions{Labels: []string{"server_id", "ip"}, IPMode: IPModeDropped},
+			Labels: []string{"server_id", "instance"},
+			Values: []string{"1234", "test"},
+		},
+		{
+			Name:   "InstanceOnly",
+			Opts:   LabelOptions{},
+			Labels: []string{"instance"},
+			Values: []string{"test"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			assert.Equal(tCase.Labels, tCase.Opts.variableLabels())
+			assert.Equal(tCase.Values, tCase.Opts.labelValues(result, "test"))
+		})
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tMatrix := []struct {
+		Name, IP, Mode, Result string
+	}{
+		{"Raw", "192.0.2.123", IPModeRaw, "192.0.2.123"},
+		{"Hashed", "192.0.2.123", IPModeHashed, "0278b9e59f652c65"},
+		{"HashedEmpty", "", IPModeHashed, ""},
+		{"TruncatedIPv4", "192.0.2.123", IPModeTruncated, "192.0.2.0/24"},
+		{"TruncatedIPv6", "2001:db8:1234:5678::1", IPModeTruncated, "2001:db8:1234::/48"},
+		{"TruncatedInvalid", "not-an-ip", IPModeTruncated, ""},
+		{"Dropped", "192.0.2.123", IPModeDropped, ""},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Result, anonymizeIP(tCase.IP, tCase.Mode, []byte("test-key")))
+		})
+	}
+}
+
+func TestAnonymizeIPHashKey(t *testing.T) {
+	assert := assert.New(t)
+
+	hash := anonymizeIP("192.0.2.123", IPModeHashed, []byte("test-key"))
+	assert.Equal(hash, anonymizeIP("192.0.2.123", IPModeHashed, []byte("test-key")), "Should be stable for the same key")
+	assert.NotEqual(hash, anonymizeIP("192.0.2.123", IPModeHashed, []byte("other-key")), "Should depend on the key")
+
+	sum := sha256.Sum256([]byte("192.0.2.123"))
+	assert.NotEqual(hex.EncodeToString(sum[:])[:ipHashLength], hash, "Should not be a plain hash of the IP")
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Bounds for the time the scheduler waits until it checks the cache again.
+// The upper bound ensures a changed cache time is picked up without restarting the scheduler,
+// the lower bound prevents running speedtests back to back when results are not cached.
+const (
+	minimumScheduleWait = 30 * time.Second
+	maximumScheduleWait = time.Minute
+)
+
+// Runs a speedtest whenever the cached result expires, so push based outputs receive results without the exporter being scraped.
+// Scrapes and the scheduler share the cache, so they do not cause additional speedtests.
+type Scheduler struct {
+	collector *Collector
+
+	cancel context.CancelFunc
+	lock   sync.Mutex
+}
+
+// Create a new scheduler running the speedtests of the given collector
+func NewScheduler(c *Collector) (*Scheduler, error) {
+	if c == nil {
+		return nil, ErrNoCollector{}
+	}
+	return &Scheduler{collector: c}, nil
+}
+
+// Start running speedtests in the background.
+// Returns an error if the scheduler is already running.
+func (s *Scheduler) Run() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cancel != nil {
+		return ErrSchedulerAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go s.run(ctx)
+	return nil
+}
+
+// Run a speedtest every time the cache expires, until ctx is cancelled or the collector is shut down
+func (s *Scheduler) run(ctx context.Context) {
+	slog.Debug("Starting speedtest scheduler")
+	for {
+		s.collector.getSpeedtestResult()
+
+		wait := time.Until(s.collector.cache.ExpiresAt())
+		wait = min(max(wait, minimumScheduleWait), maximumScheduleWait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.collector.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Returns true if the scheduler is currently running
+func (s *Scheduler) IsRunning() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.cancel != nil
+}
+
+// Stop scheduling new speedtests.
+// Does not wait for a running speedtest, it is aborted by shutting down the collector instead.
+// Does nothing if the scheduler is not running.
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	s.cancel = nil
+	slog.Info("Stopped speedtest scheduler")
+}
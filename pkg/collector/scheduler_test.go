@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/cache"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScheduler(t *testing.T) {
+	_, err := NewScheduler(nil)
+	assert.Equal(t, ErrNoCollector{}, err)
+}
+
+func TestScheduler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var runs atomic.Int32
+	s := &speedtest.MockSpeedtest{
+		Result:   speedtest.MockSpeedtestResult(time.Now().UnixMilli()),
+		Callback: func() { runs.Add(1) },
+	}
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, s, "testinstance")
+	require.NoError(err, "Should create collector")
+	var results atomic.Int32
+	c.OnResult(func(_ *speedtest.SpeedtestResult) {
+		results.Add(1)
+	})
+
+	scheduler, err := NewScheduler(c)
+	require.NoError(err, "Should create scheduler")
+	require.NoError(scheduler.Run(), "Should start scheduler")
+	t.Cleanup(scheduler.Stop)
+
+	assert.True(scheduler.IsRunning())
+	assert.Equal(ErrSchedulerAlreadyRunning{}, scheduler.Run(), "Should not start twice")
+
+	require.Eventually(func() bool {
+		return results.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should run a speedtest without being collected")
+
+	// Scrapes share the cache with the scheduler
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	_, err = reg.Gather()
+	require.NoError(err, "Should gather metrics")
+	assert.Equal(int32(1), runs.Load(), "Should not run another speedtest while the result is cached")
+
+	scheduler.Stop()
+	assert.False(scheduler.IsRunning())
+	assert.NotPanics(scheduler.Stop, "Should ignore stopping twice")
+}
+
+func TestSchedulerStopsOnShutdown(t *testing.T) {
+	c, err := NewCollector(cache.NewCache(false, "", defaultCacheTime), nil, NewMockSpeedtest(), "testinstance")
+	require.NoError(t, err, "Should create collector")
+	c.Shutdown(t.Context())
+
+	scheduler, err := NewScheduler(c)
+	require.NoError(t, err, "Should create scheduler")
+	require.NoError(t, scheduler.Run(), "Should start scheduler")
+	t.Cleanup(scheduler.Stop)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, c.Status().LastAttempt, "Should not run speedtests after shutdown")
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Targets used for the compliance metrics
+const (
+	SLATargetDownload = "download"
+	SLATargetUpload   = "upload"
+	SLATargetLatency  = "latency"
+)
+
+const (
+	DefaultSLAThreshold = 0.8
+	DefaultSLAWindow    = 7 * 24 * time.Hour
+)
+
+// Contracted speeds of the connection, used to calculate the compliance of the results.
+// A value of 0 disables the respective target.
+type SLAOptions struct {
+	// Contracted download speed in Mbit/s
+	Download float64
+	// Contracted upload speed in Mbit/s
+	Upload float64
+	// Maximum contracted ping latency in ms
+	Latency float64
+	// Share of the contracted speed a test needs to reach to be compliant, e.g. 0.8 for 80%
+	Threshold float64
+	// Duration over which the compliance is calculated
+	Window time.Duration
+}
+
+// Returns the default SLA options, no targets are enabled
+func DefaultSLAOptions() SLAOptions {
+	return SLAOptions{
+		Threshold: DefaultSLAThreshold,
+		Window:    DefaultSLAWindow,
+	}
+}
+
+// Returns true if at least one target is configured
+func (o SLAOptions) Enabled() bool {
+	return o.Download > 0 || o.Upload > 0 || o.Latency > 0
+}
+
+// Verify that the contracted values are not negative and the threshold and window are usable
+func (o SLAOptions) Validate() error {
+	if o.Download < 0 || o.Upload < 0 || o.Latency < 0 {
+		return &ErrInvalidSLA{Reason: "contracted values can not be negative"}
+	}
+	if o.Threshold <= 0 || o.Threshold > 1 {
+		return &ErrInvalidSLA{Reason: "threshold needs to be greater than 0 and at most 1"}
+	}
+	if o.Window <= 0 {
+		return &ErrInvalidSLA{Reason: "window needs to be greater than 0"}
+	}
+	return nil
+}
+
+// Return the configured targets with their contracted values
+func (o SLAOptions) targets() []slaTarget {
+	targets := make([]slaTarget, 0, 3)
+	if o.Download > 0 {
+		targets = append(targets, slaTarget{SLATargetDownload, o.Download})
+	}
+	if o.Upload > 0 {
+		targets = append(targets, slaTarget{SLATargetUpload, o.Upload})
+	}
+	if o.Latency > 0 {
+		targets = append(targets, slaTarget{SLATargetLatency, o.Latency})
+	}
+	return targets
+}
+
+type slaTarget struct {
+	name       string
+	contracted float64
+}
+
+// Check if the result meets the target.
+// Speeds need to reach the threshold share of the contracted speed, the ping may not exceed the contracted latency.
+// Failed tests are never compliant.
+func (t slaTarget) compliant(result *speedtest.SpeedtestResult, threshold float64) bool {
+	if !result.Success() {
+		return false
+	}
+	switch t.name {
+	case SLATargetDownload:
+		return result.DownloadSpeed() >= t.contracted*threshold
+	case SLATargetUpload:
+		return result.UploadSpeed() >= t.contracted*threshold
+	case SLATargetLatency:
+		return result.Ping() <= t.contracted
+	default:
+		return false
+	}
+}
+
+// Compliance of the results for a single target
+type SLACompliance struct {
+	// Name of the target, one of SLATargetDownload, SLATargetUpload or SLATargetLatency
+	Target string
+	// Contracted value of the target
+	Contracted float64
+	// Number of results, including failed tests
+	Tests int
+	// Number of results meeting the target
+	Compliant int
+}
+
+// Calculate the compliance of the given results for all configured targets
+func (o SLAOptions) Compliance(results []*speedtest.SpeedtestResult) []SLACompliance {
+	targets := o.targets()
+	compliance := make([]SLACompliance, 0, len(targets))
+	for _, target := range targets {
+		c := SLACompliance{Target: target.name, Contracted: target.contracted, Tests: len(results)}
+		for _, result := range results {
+			if target.compliant(result, o.Threshold) {
+				c.Compliant++
+			}
+		}
+		compliance = append(compliance, c)
+	}
+	return compliance
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLAOptionsValidate(t *testing.T) {
+	tMatrix := []struct {
+		Name    string
+		Options SLAOptions
+		Error   error
+	}{
+		{
+			Name:    "Default",
+			Options: DefaultSLAOptions(),
+		},
+		{
+			Name:    "AllTargets",
+			Options: SLAOptions{Download: 100, Upload: 20, Latency: 30, Threshold: 1, Window: time.Hour},
+		},
+		{
+			Name:    "NegativeValue",
+			Options: SLAOptions{Download: -100, Threshold: 0.8, Window: time.Hour},
+			Error:   &ErrInvalidSLA{Reason: "contracted values can not be negative"},
+		},
+		{
+			Name:    "ThresholdTooHigh",
+			Options: SLAOptions{Download: 100, Threshold: 1.1, Window: time.Hour},
+			Error:   &ErrInvalidSLA{Reason: "threshold needs to be greater than 0 and at most 1"},
+		},
+		{
+			Name:    "NoThreshold",
+			Options: SLAOptions{Download: 100, Window: time.Hour},
+			Error:   &ErrInvalidSLA{Reason: "threshold needs to be greater than 0 and at most 1"},
+		},
+		{
+			Name:    "NoWindow",
+			Options: SLAOptions{Download: 100, Threshold: 0.8},
+			Error:   &ErrInvalidSLA{Reason: "window needs to be greater than 0"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, tCase.Options.Validate())
+		})
+	}
+}
+
+func TestSLAOptionsEnabled(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(DefaultSLAOptions().Enabled(), "Should be disabled by default")
+	assert.True(SLAOptions{Upload: 10}.Enabled(), "Should be enabled with a single target")
+}
+
+func TestSLACompliance(t *testing.T) {
+	results := []*speedtest.SpeedtestResult{
+		speedtest.NewSpeedtestResult(1, 10, 100, 20, 100, "1", "example.org", "Foo Corp.", "127.0.0.1", time.Second),
+		speedtest.NewSpeedtestResult(1, 35, 79, 16, 100, "1", "example.org", "Foo Corp.", "127.0.0.1", time.Second),
+		speedtest.NewSpeedtestResult(1, 30, 80, 15, 100, "1", "example.org", "Foo Corp.", "127.0.0.1", time.Second),
+		speedtest.NewFailedSpeedtestResult(),
+	}
+	opts := SLAOptions{Download: 100, Upload: 20, Latency: 30, Threshold: 0.8, Window: time.Hour}
+
+	expected := []SLACompliance{
+		{Target: SLATargetDownload, Contracted: 100, Tests: 4, Compliant: 2},
+		{Target: SLATargetUpload, Contracted: 20, Tests: 4, Compliant: 2},
+		{Target: SLATargetLatency, Contracted: 30, Tests: 4, Compliant: 2},
+	}
+	assert.Equal(t, expected, opts.Compliance(results))
+	assert.Empty(t, DefaultSLAOptions().Compliance(results), "Should not calculate compliance without targets")
+}
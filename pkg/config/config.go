@@ -1,25 +1,96 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/fs"
 	"log/slog"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/heathcliff26/promremote/v2/promremote"
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/history"
+	"github.com/heathcliff26/speedtest-exporter/pkg/influx"
+	"github.com/heathcliff26/speedtest-exporter/pkg/mqtt"
+	"github.com/heathcliff26/speedtest-exporter/pkg/notify"
+	"github.com/heathcliff26/speedtest-exporter/pkg/otlp"
+	"github.com/heathcliff26/speedtest-exporter/pkg/pushgateway"
+	"github.com/heathcliff26/speedtest-exporter/pkg/remote"
+	"github.com/heathcliff26/speedtest-exporter/pkg/report"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/tracing"
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+	"github.com/heathcliff26/speedtest-exporter/pkg/web"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.yaml.in/yaml/v3"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	DEFAULT_LOG_LEVEL       = "info"
-	DEFAULT_PORT            = 8080
-	DEFAULT_CACHE           = 5 * time.Minute
-	DEFAULT_PERSIST_CACHE   = true
-	DEFAULT_REMOTE_JOB_NAME = "speedtest-exporter"
+	DEFAULT_LOG_LEVEL        = "info"
+	DEFAULT_PORT             = 8080
+	DEFAULT_CACHE            = 5 * time.Minute
+	DEFAULT_PERSIST_CACHE    = true
+	DEFAULT_REMOTE_NAME      = "default"
+	DEFAULT_REMOTE_JOB_NAME  = "speedtest-exporter"
+	DEFAULT_REMOTE_QUEUE_MB  = remote.DefaultQueueMaxSize >> 20
+	DEFAULT_REMOTE_BACKOFF   = remote.DefaultMaxBackoff
+	DEFAULT_REMOTE_PUSH      = PUSH_INTERVAL
+	DEFAULT_REMOTE_HEARTBEAT = 15 * time.Minute
+	DEFAULT_REMOTE_TIMEOUT   = remote.DefaultTimeout
+	DEFAULT_UNIX_SOCKET_MODE = "0660"
+	DEFAULT_TRACING_RATIO    = 1
+	DEFAULT_OTLP_PUSH        = PUSH_INTERVAL
+	DEFAULT_SPEEDTEST_CLI    = "speedtest"
+
+	DEFAULT_IPERF3_EXECUTABLE = "iperf3"
+	DEFAULT_IPERF3_PORT       = speedtest.DefaultIperf3Port
+	DEFAULT_IPERF3_DURATION   = speedtest.DefaultIperf3Duration
+	DEFAULT_IPERF3_STREAMS    = speedtest.DefaultIperf3Streams
+
+	DEFAULT_LIBRESPEED_DURATION = speedtest.DefaultLibreSpeedDuration
+	DEFAULT_LIBRESPEED_STREAMS  = speedtest.DefaultLibreSpeedStreams
+
+	DEFAULT_INFLUX_MEASUREMENT    = influx.DefaultMeasurement
+	DEFAULT_INFLUX_BATCH_SIZE     = influx.DefaultBatchSize
+	DEFAULT_INFLUX_FLUSH_INTERVAL = influx.DefaultFlushInterval
+	DEFAULT_INFLUX_MAX_RETRIES    = influx.DefaultMaxRetries
+
+	DEFAULT_MQTT_RETAIN           = true
+	DEFAULT_MQTT_DISCOVERY        = true
+	DEFAULT_MQTT_DISCOVERY_PREFIX = mqtt.DefaultDiscoveryPrefix
+
+	DEFAULT_PUSHGATEWAY_JOB_NAME = "speedtest-exporter"
+
+	DEFAULT_NOTIFY_COOLDOWN = notify.DefaultCooldown
+	DEFAULT_WEBHOOK_TIMEOUT = notify.DefaultTimeout
+	DEFAULT_WEBHOOK_RETRIES = notify.DefaultRetries
+	DEFAULT_NTFY_URL        = notify.DefaultNtfyURL
+
+	DEFAULT_REPORT_SCHEDULE = report.DefaultSchedule
+	DEFAULT_REPORT_WEEKDAY  = "monday"
+	DEFAULT_REPORT_TIME     = "08:00"
+	DEFAULT_SMTP_PORT       = report.DefaultPort
+	DEFAULT_SMTP_SECURITY   = report.DefaultSecurity
+	DEFAULT_SMTP_TIMEOUT    = report.DefaultTimeout
+)
+
+// Modes for pushing metrics via OTLP and remote_write
+const (
+	PUSH_INTERVAL   = "interval"
+	PUSH_COMPLETION = "completion"
 )
 
 var logLevel *slog.LevelVar
 
+// Names of remote_write targets, they are used as directory name for the queue
+var remoteTargetNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*$`)
+
 // Initialize the logger
 func init() {
 	logLevel = &slog.LevelVar{}
@@ -31,39 +102,873 @@ func init() {
 }
 
 type Config struct {
-	LogLevel     string        `yaml:"logLevel,omitempty"`
-	Port         int           `yaml:"port,omitempty"`
-	Instance     string        `yaml:"instance,omitempty"`
-	Cache        time.Duration `yaml:"cache,omitempty"`
-	PersistCache bool          `yaml:"persistCache,omitempty"`
-	SpeedtestCLI string        `yaml:"speedtestCLI,omitempty"`
-	Remote       RemoteConfig  `yaml:"remote,omitempty"`
+	LogLevel      string            `yaml:"logLevel,omitempty"`
+	Port          int               `yaml:"port,omitempty"`
+	ListenAddress ListenAddresses   `yaml:"listenAddress,omitempty"`
+	Instance      string            `yaml:"instance,omitempty"`
+	Cache         time.Duration     `yaml:"cache,omitempty"`
+	PersistCache  bool              `yaml:"persistCache,omitempty"`
+	SpeedtestCLI  string            `yaml:"speedtestCLI,omitempty"`
+	Backend       string            `yaml:"backend,omitempty"`
+	Iperf3        Iperf3Config      `yaml:"iperf3,omitempty"`
+	LibreSpeed    LibreSpeedConfig  `yaml:"librespeed,omitempty"`
+	Metrics       MetricsConfig     `yaml:"metrics,omitempty"`
+	SLA           SLAConfig         `yaml:"sla,omitempty"`
+	Remote        RemoteTargets     `yaml:"remote,omitempty"`
+	OTLP          OTLPConfig        `yaml:"otlp,omitempty"`
+	Influx        InfluxConfig      `yaml:"influx,omitempty"`
+	MQTT          MQTTConfig        `yaml:"mqtt,omitempty"`
+	Pushgateway   PushgatewayConfig `yaml:"pushgateway,omitempty"`
+	Notify        NotifyConfig      `yaml:"notify,omitempty"`
+	Report        ReportConfig      `yaml:"report,omitempty"`
+	Tracing       TracingConfig     `yaml:"tracing,omitempty"`
+	Web           WebConfig         `yaml:"web,omitempty"`
+}
+
+type Iperf3Config struct {
+	Server     string        `yaml:"server"`
+	Port       int           `yaml:"port,omitempty"`
+	Duration   time.Duration `yaml:"duration,omitempty"`
+	Streams    int           `yaml:"streams,omitempty"`
+	UDP        bool          `yaml:"udp,omitempty"`
+	Bitrate    string        `yaml:"bitrate,omitempty"`
+	Executable string        `yaml:"executable,omitempty"`
+}
+
+type LibreSpeedConfig struct {
+	Servers    []string      `yaml:"servers,omitempty"`
+	ServerList string        `yaml:"serverList,omitempty"`
+	Duration   time.Duration `yaml:"duration,omitempty"`
+	Streams    int           `yaml:"streams,omitempty"`
+}
+
+// Returns the speedtest backend, when not set explicitly it is speedtest-cli if a path is configured in speedtestCLI
+func (c Config) SpeedtestBackend() string {
+	if c.Backend != "" {
+		return c.Backend
+	}
+	if c.SpeedtestCLI != "" {
+		return speedtest.BackendSpeedtestCLI
+	}
+	return speedtest.BackendSpeedtestGo
+}
+
+// Check that the backend is known and its options are valid
+func (c Config) validateBackend() error {
+	switch c.SpeedtestBackend() {
+	case speedtest.BackendSpeedtestGo, speedtest.BackendSpeedtestCLI:
+		return nil
+	case speedtest.BackendIperf3:
+		return c.Iperf3.validate()
+	case speedtest.BackendLibreSpeed:
+		_, err := speedtest.NewLibreSpeed(c.LibreSpeed.LibreSpeedOptions()...)
+		return err
+	default:
+		return &ErrUnknownBackend{Backend: c.Backend}
+	}
+}
+
+// Returns the options for the iperf3 backend
+func (c Iperf3Config) Iperf3Options() []speedtest.Iperf3Option {
+	opts := []speedtest.Iperf3Option{
+		speedtest.WithIperf3Port(c.Port),
+		speedtest.WithIperf3Duration(c.Duration),
+		speedtest.WithIperf3Streams(c.Streams),
+	}
+	if c.UDP {
+		opts = append(opts, speedtest.WithIperf3UDP(c.Bitrate))
+	}
+	return opts
+}
+
+// Validate the options without looking up the iperf3 binary, it only needs to exist on the host running the exporter
+func (c Iperf3Config) validate() error {
+	if c.Server == "" {
+		return speedtest.ErrMissingServer{}
+	}
+	for _, opt := range c.Iperf3Options() {
+		err := opt(&speedtest.Iperf3{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the options for the LibreSpeed backend
+func (c LibreSpeedConfig) LibreSpeedOptions() []speedtest.LibreSpeedOption {
+	opts := []speedtest.LibreSpeedOption{
+		speedtest.WithLibreSpeedServers(c.Servers...),
+		speedtest.WithLibreSpeedDuration(c.Duration),
+		speedtest.WithLibreSpeedStreams(c.Streams),
+	}
+	if c.ServerList != "" {
+		opts = append(opts, speedtest.WithLibreSpeedServerList(c.ServerList))
+	}
+	return opts
+}
+
+type MetricsConfig struct {
+	Timestamps  bool              `yaml:"timestamps,omitempty"`
+	Labels      []string          `yaml:"labels"`
+	IPLabel     string            `yaml:"ipLabel,omitempty"`
+	IPHashKey   string            `yaml:"ipHashKey,omitempty"`
+	ExtraLabels map[string]string `yaml:"extraLabels,omitempty"`
+	Histograms  HistogramConfig   `yaml:"histograms,omitempty"`
+}
+
+type HistogramConfig struct {
+	DownloadBuckets []float64 `yaml:"downloadBuckets"`
+	UploadBuckets   []float64 `yaml:"uploadBuckets"`
+	PingBuckets     []float64 `yaml:"pingBuckets"`
+	Native          bool      `yaml:"native,omitempty"`
+}
+
+// Returns the histogram options for the collector
+func (c HistogramConfig) HistogramOptions() collector.HistogramOptions {
+	return collector.HistogramOptions{
+		DownloadBuckets: c.DownloadBuckets,
+		UploadBuckets:   c.UploadBuckets,
+		PingBuckets:     c.PingBuckets,
+		Native:          c.Native,
+	}
+}
+
+// Returns the label options for the collector
+func (c MetricsConfig) LabelOptions() collector.LabelOptions {
+	return collector.LabelOptions{
+		Labels:      c.Labels,
+		IPMode:      c.IPLabel,
+		ExtraLabels: c.ExtraLabels,
+		IPHashKey:   []byte(c.IPHashKey),
+	}
+}
+
+type SLAConfig struct {
+	Download  float64       `yaml:"download,omitempty"`
+	Upload    float64       `yaml:"upload,omitempty"`
+	Latency   float64       `yaml:"latency,omitempty"`
+	Threshold float64       `yaml:"threshold,omitempty"`
+	Window    time.Duration `yaml:"window,omitempty"`
+}
+
+// Returns the sla options for the collector
+func (c SLAConfig) SLAOptions() collector.SLAOptions {
+	return collector.SLAOptions{
+		Download:  c.Download,
+		Upload:    c.Upload,
+		Latency:   c.Latency,
+		Threshold: c.Threshold,
+		Window:    c.Window,
+	}
 }
 
 type RemoteConfig struct {
-	Enable   bool   `yaml:"enable"`
-	URL      string `yaml:"url"`
-	Instance string `yaml:"instance,omitempty"`
-	JobName  string `yaml:"jobName,omitempty"`
-	Username string `yaml:"username,omitempty"`
-	Password string `yaml:"password,omitempty"`
+	Enable      bool              `yaml:"enable"`
+	Name        string            `yaml:"name,omitempty"`
+	URL         string            `yaml:"url"`
+	Instance    string            `yaml:"instance,omitempty"`
+	JobName     string            `yaml:"jobName,omitempty"`
+	Interval    time.Duration     `yaml:"interval,omitempty"`
+	Username    string            `yaml:"username,omitempty"`
+	Password    string            `yaml:"password,omitempty"`
+	BearerToken string            `yaml:"bearerToken,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	TLS         ClientTLSConfig   `yaml:"tls,omitempty"`
+	ProxyURL    string            `yaml:"proxyURL,omitempty"`
+	Timeout     time.Duration     `yaml:"timeout,omitempty"`
+	Relabel     []RelabelConfig   `yaml:"relabel,omitempty"`
+	Queue       RemoteQueueConfig `yaml:"queue,omitempty"`
+	// Push on every interval or after every completed speedtest
+	Push string `yaml:"push,omitempty"`
+	// Interval for pushing speedtest_up when pushing on completion, 0 disables it
+	Heartbeat time.Duration `yaml:"heartbeat,omitempty"`
 }
 
-// Returns a Config with default values set
-func DefaultConfig() Config {
-	hostname, err := os.Hostname()
+// Returns the options for the labels, authentication and transport of the remote_write client.
+// Fails when the certificates can not be loaded.
+func (c RemoteConfig) ClientOptions() ([]remote.ClientOption, error) {
+	opts := []remote.ClientOption{
+		remote.WithName(c.Name),
+		remote.WithRelabel(c.RelabelRules()),
+		remote.WithInstanceLabel(c.Instance),
+		remote.WithJobLabel(c.JobName),
+		remote.WithHeaders(c.Headers),
+		remote.WithTimeout(c.Timeout),
+	}
+	if c.Username != "" {
+		opts = append(opts, remote.WithBasicAuth(c.Username, c.Password))
+	}
+	if c.BearerToken != "" {
+		opts = append(opts, remote.WithBearerToken(c.BearerToken))
+	}
+	if c.TLS != (ClientTLSConfig{}) {
+		tlsCfg, err := c.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, remote.WithTLSConfig(tlsCfg))
+	}
+	if c.ProxyURL != "" {
+		opts = append(opts, remote.WithProxy(c.ProxyURL))
+	}
+	return opts, nil
+}
+
+// Returns the relabel rules of the target
+func (c RemoteConfig) RelabelRules() []remote.RelabelRule {
+	rules := make([]remote.RelabelRule, 0, len(c.Relabel))
+	for _, r := range c.Relabel {
+		rules = append(rules, remote.RelabelRule(r))
+	}
+	return rules
+}
+
+// Returns a RemoteConfig with default values set
+func DefaultRemoteConfig() RemoteConfig {
+	return RemoteConfig{
+		Name:    DEFAULT_REMOTE_NAME,
+		JobName: DEFAULT_REMOTE_JOB_NAME,
+		Timeout: DEFAULT_REMOTE_TIMEOUT,
+		Queue: RemoteQueueConfig{
+			MaxSizeMB:  DEFAULT_REMOTE_QUEUE_MB,
+			MaxBackoff: DEFAULT_REMOTE_BACKOFF,
+		},
+		Push:      DEFAULT_REMOTE_PUSH,
+		Heartbeat: DEFAULT_REMOTE_HEARTBEAT,
+	}
+}
+
+// List of remote_write targets, can be given as a single target or a list in yaml.
+// Every target starts from the defaults of DefaultRemoteConfig.
+type RemoteTargets []RemoteConfig
+
+func (r *RemoteTargets) UnmarshalYAML(value *yaml.Node) error {
+	return decodeList(value, (*[]RemoteConfig)(r), DefaultRemoteConfig)
+}
+
+// Rule for changing the labels of the series sent to a remote_write target, see remote.RelabelRule
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"sourceLabels,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"targetLabel,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
+}
+
+// Buffer for pushes that failed, e.g. while the uplink is down
+type RemoteQueueConfig struct {
+	MaxSizeMB  int           `yaml:"maxSizeMB,omitempty"`
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+}
+
+type OTLPConfig struct {
+	Enable             bool              `yaml:"enable"`
+	Endpoint           string            `yaml:"endpoint"`
+	Instance           string            `yaml:"instance,omitempty"`
+	ResourceAttributes map[string]string `yaml:"resourceAttributes,omitempty"`
+	Headers            map[string]string `yaml:"headers,omitempty"`
+	TLS                ClientTLSConfig   `yaml:"tls,omitempty"`
+	Gzip               bool              `yaml:"gzip,omitempty"`
+	Push               string            `yaml:"push,omitempty"`
+	Interval           time.Duration     `yaml:"interval,omitempty"`
+}
+
+// Returns the options for the OTLP metrics client.
+// Fails when the certificates can not be loaded.
+func (c OTLPConfig) ClientOptions() ([]otlp.ClientOption, error) {
+	opts := []otlp.ClientOption{
+		otlp.WithInstance(c.Instance),
+		otlp.WithResourceAttributes(c.ResourceAttributes),
+		otlp.WithHeaders(c.Headers),
+	}
+	if c.TLS != (ClientTLSConfig{}) {
+		tlsCfg, err := c.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlp.WithTLSConfig(tlsCfg))
+	}
+	if c.Gzip {
+		opts = append(opts, otlp.WithGzip())
+	}
+	return opts, nil
+}
+
+// TLS settings for connections to a remote endpoint
+type ClientTLSConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`
+	CertFile           string `yaml:"certFile,omitempty"`
+	KeyFile            string `yaml:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// Load the CA and client certificate and create the tls config for the connection
+func (c ClientTLSConfig) TLSConfig() (*tls.Config, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, &ErrIncompleteTLSConfig{}
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, // #nosec G402 -- Explicitly requested by the user
+	}
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, &ErrInvalidCAFile{Path: c.CAFile}
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+type InfluxConfig struct {
+	Enable        bool          `yaml:"enable"`
+	URL           string        `yaml:"url"`
+	Org           string        `yaml:"org,omitempty"`
+	Bucket        string        `yaml:"bucket,omitempty"`
+	Token         string        `yaml:"token,omitempty"`
+	Measurement   string        `yaml:"measurement,omitempty"`
+	Instance      string        `yaml:"instance,omitempty"`
+	BatchSize     int           `yaml:"batchSize,omitempty"`
+	FlushInterval time.Duration `yaml:"flushInterval,omitempty"`
+	MaxRetries    int           `yaml:"maxRetries"`
+}
+
+// Returns the options for the influx client
+func (c InfluxConfig) Options() influx.Options {
+	return influx.Options{
+		URL:           c.URL,
+		Org:           c.Org,
+		Bucket:        c.Bucket,
+		Token:         c.Token,
+		Measurement:   c.Measurement,
+		Instance:      c.Instance,
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		MaxRetries:    c.MaxRetries,
+	}
+}
+
+type MQTTConfig struct {
+	Enable    bool                `yaml:"enable"`
+	Broker    string              `yaml:"broker"`
+	ClientID  string              `yaml:"clientID,omitempty"`
+	Username  string              `yaml:"username,omitempty"`
+	Password  string              `yaml:"password,omitempty"`
+	TLS       ClientTLSConfig     `yaml:"tls,omitempty"`
+	Topic     string              `yaml:"topic,omitempty"`
+	QoS       byte                `yaml:"qos,omitempty"`
+	Retain    bool                `yaml:"retain"`
+	Discovery MQTTDiscoveryConfig `yaml:"discovery,omitempty"`
+}
+
+type MQTTDiscoveryConfig struct {
+	Enable bool   `yaml:"enable"`
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// Returns the options for the MQTT client.
+// Fails when the certificates can not be loaded.
+func (c MQTTConfig) ClientOptions(instance string) ([]mqtt.ClientOption, error) {
+	opts := []mqtt.ClientOption{
+		mqtt.WithInstance(instance),
+		mqtt.WithClientID(c.ClientID),
+		mqtt.WithQoS(c.QoS),
+		mqtt.WithRetain(c.Retain),
+	}
+	if c.Topic != "" {
+		opts = append(opts, mqtt.WithTopic(c.Topic))
+	}
+	if c.Username != "" {
+		opts = append(opts, mqtt.WithCredentials(c.Username, c.Password))
+	}
+	if c.TLS != (ClientTLSConfig{}) {
+		tlsCfg, err := c.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mqtt.WithTLSConfig(tlsCfg))
+	}
+	if c.Discovery.Enable {
+		opts = append(opts, mqtt.WithDiscovery(c.Discovery.Prefix))
+	}
+	return opts, nil
+}
+
+type PushgatewayConfig struct {
+	Enable           bool              `yaml:"enable"`
+	URL              string            `yaml:"url"`
+	JobName          string            `yaml:"jobName,omitempty"`
+	Instance         string            `yaml:"instance,omitempty"`
+	Grouping         map[string]string `yaml:"grouping,omitempty"`
+	Username         string            `yaml:"username,omitempty"`
+	Password         string            `yaml:"password,omitempty"`
+	TLS              ClientTLSConfig   `yaml:"tls,omitempty"`
+	DeleteOnShutdown bool              `yaml:"deleteOnShutdown,omitempty"`
+}
+
+// Returns the options for the pushgateway client.
+// Fails when the certificates can not be loaded.
+func (c PushgatewayConfig) ClientOptions() ([]pushgateway.ClientOption, error) {
+	opts := []pushgateway.ClientOption{
+		pushgateway.WithInstance(c.Instance),
+		pushgateway.WithGrouping(c.Grouping),
+	}
+	if c.Username != "" {
+		opts = append(opts, pushgateway.WithBasicAuth(c.Username, c.Password))
+	}
+	if c.TLS != (ClientTLSConfig{}) {
+		tlsCfg, err := c.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pushgateway.WithTLSConfig(tlsCfg))
+	}
+	return opts, nil
+}
+
+type NotifyConfig struct {
+	Enable     bool                   `yaml:"enable"`
+	Thresholds NotifyThresholdsConfig `yaml:"thresholds,omitempty"`
+	Cooldown   time.Duration          `yaml:"cooldown,omitempty"`
+	Webhooks   Webhooks               `yaml:"webhooks,omitempty"`
+	Ntfy       NtfyTopics             `yaml:"ntfy,omitempty"`
+	Gotify     GotifyServers          `yaml:"gotify,omitempty"`
+	Slack      ChatWebhooks           `yaml:"slack,omitempty"`
+	Discord    ChatWebhooks           `yaml:"discord,omitempty"`
+}
+
+type NotifyThresholdsConfig struct {
+	Download   float64 `yaml:"download,omitempty"`
+	Upload     float64 `yaml:"upload,omitempty"`
+	Latency    float64 `yaml:"latency,omitempty"`
+	Failures   int     `yaml:"failures,omitempty"`
+	Hysteresis float64 `yaml:"hysteresis,omitempty"`
+}
+
+// Settings shared by all notification channels
+type ChannelConfig struct {
+	Name     string            `yaml:"name,omitempty"`
+	Events   []string          `yaml:"events,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Template string            `yaml:"template,omitempty"`
+	Timeout  time.Duration     `yaml:"timeout,omitempty"`
+	Retries  int               `yaml:"retries"`
+}
+
+// Returns a ChannelConfig with default values set
+func DefaultChannelConfig() ChannelConfig {
+	return ChannelConfig{
+		Timeout: DEFAULT_WEBHOOK_TIMEOUT,
+		Retries: DEFAULT_WEBHOOK_RETRIES,
+	}
+}
+
+// Returns the options shared by all channels
+func (c ChannelConfig) WebhookOptions() []notify.WebhookOption {
+	return []notify.WebhookOption{
+		notify.WithName(c.Name),
+		notify.WithEvents(c.Events),
+		notify.WithHeaders(c.Headers),
+		notify.WithTemplate(c.Template),
+		notify.WithTimeout(c.Timeout),
+		notify.WithRetries(c.Retries),
+	}
+}
+
+type WebhookConfig struct {
+	URL           string `yaml:"url"`
+	Secret        string `yaml:"secret,omitempty"`
+	ChannelConfig `yaml:",inline"`
+}
+
+// Returns a WebhookConfig with default values set
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		ChannelConfig: DefaultChannelConfig(),
+	}
+}
+
+// Returns the options for the webhook
+func (c WebhookConfig) WebhookOptions() []notify.WebhookOption {
+	return append(c.ChannelConfig.WebhookOptions(), notify.WithSecret(c.Secret))
+}
+
+type NtfyConfig struct {
+	URL           string `yaml:"url"`
+	Topic         string `yaml:"topic"`
+	Token         string `yaml:"token,omitempty"`
+	Priority      int    `yaml:"priority,omitempty"`
+	ChannelConfig `yaml:",inline"`
+}
+
+// Returns a NtfyConfig with default values set
+func DefaultNtfyConfig() NtfyConfig {
+	return NtfyConfig{
+		URL:           DEFAULT_NTFY_URL,
+		ChannelConfig: DefaultChannelConfig(),
+	}
+}
+
+// Returns the options for the ntfy channel
+func (c NtfyConfig) WebhookOptions() []notify.WebhookOption {
+	return append(c.ChannelConfig.WebhookOptions(), notify.WithBearerToken(c.Token), notify.WithPriority(c.Priority))
+}
+
+type GotifyConfig struct {
+	URL           string `yaml:"url"`
+	Token         string `yaml:"token"`
+	Priority      int    `yaml:"priority,omitempty"`
+	ChannelConfig `yaml:",inline"`
+}
+
+// Returns a GotifyConfig with default values set
+func DefaultGotifyConfig() GotifyConfig {
+	return GotifyConfig{
+		ChannelConfig: DefaultChannelConfig(),
+	}
+}
+
+// Returns the options for the gotify channel
+func (c GotifyConfig) WebhookOptions() []notify.WebhookOption {
+	return append(c.ChannelConfig.WebhookOptions(), notify.WithPriority(c.Priority))
+}
+
+// Slack- or Discord-compatible incoming webhook
+type ChatConfig struct {
+	URL           string `yaml:"url"`
+	ChannelConfig `yaml:",inline"`
+}
+
+// Returns a ChatConfig with default values set
+func DefaultChatConfig() ChatConfig {
+	return ChatConfig{
+		ChannelConfig: DefaultChannelConfig(),
+	}
+}
+
+// List of webhooks, can be given as a single webhook or a list in yaml.
+// Every webhook starts from the defaults of DefaultWebhookConfig.
+type Webhooks []WebhookConfig
+
+func (w *Webhooks) UnmarshalYAML(value *yaml.Node) error {
+	return decodeList(value, (*[]WebhookConfig)(w), DefaultWebhookConfig)
+}
+
+// List of ntfy topics, can be given as a single topic or a list in yaml.
+// Every topic starts from the defaults of DefaultNtfyConfig.
+type NtfyTopics []NtfyConfig
+
+func (n *NtfyTopics) UnmarshalYAML(value *yaml.Node) error {
+	return decodeList(value, (*[]NtfyConfig)(n), DefaultNtfyConfig)
+}
+
+// List of gotify servers, can be given as a single server or a list in yaml.
+// Every server starts from the defaults of DefaultGotifyConfig.
+type GotifyServers []GotifyConfig
+
+func (g *GotifyServers) UnmarshalYAML(value *yaml.Node) error {
+	return decodeList(value, (*[]GotifyConfig)(g), DefaultGotifyConfig)
+}
+
+// List of chat webhooks, can be given as a single webhook or a list in yaml.
+// Every webhook starts from the defaults of DefaultChatConfig.
+type ChatWebhooks []ChatConfig
+
+func (c *ChatWebhooks) UnmarshalYAML(value *yaml.Node) error {
+	return decodeList(value, (*[]ChatConfig)(c), DefaultChatConfig)
+}
+
+// Decode a single mapping or a sequence into list, every element starts from defaults
+func decodeList[T any](value *yaml.Node, list *[]T, defaults func() T) error {
+	nodes := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		nodes = value.Content
+	}
+	res := make([]T, 0, len(nodes))
+	for _, node := range nodes {
+		item := defaults()
+		err := node.Decode(&item)
+		if err != nil {
+			return err
+		}
+		res = append(res, item)
+	}
+	*list = res
+	return nil
+}
+
+// Returns the options for the notifier, including a channel for every configured webhook, topic and server.
+// The contract of the sla is added to the messages.
+// Fails when a channel is invalid.
+func (c NotifyConfig) NotifierOptions(instance string, sla SLAConfig) ([]notify.NotifierOption, error) {
+	opts := []notify.NotifierOption{
+		notify.WithInstance(instance),
+		notify.WithThresholds(notify.Thresholds(c.Thresholds)),
+		notify.WithCooldown(c.Cooldown),
+		notify.WithContract(notify.Contract{
+			Download: sla.Download,
+			Upload:   sla.Upload,
+			Latency:  sla.Latency,
+		}),
+	}
+	for _, webhook := range c.Webhooks {
+		w, err := notify.NewWebhook(webhook.URL, webhook.WebhookOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notify.WithChannel(w))
+	}
+	for _, ntfy := range c.Ntfy {
+		w, err := notify.NewNtfy(ntfy.URL, ntfy.Topic, ntfy.WebhookOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notify.WithChannel(w))
+	}
+	for _, gotify := range c.Gotify {
+		w, err := notify.NewGotify(gotify.URL, gotify.Token, gotify.WebhookOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notify.WithChannel(w))
+	}
+	for _, slack := range c.Slack {
+		w, err := notify.NewSlack(slack.URL, slack.WebhookOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notify.WithChannel(w))
+	}
+	for _, discord := range c.Discord {
+		w, err := notify.NewDiscord(discord.URL, discord.WebhookOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notify.WithChannel(w))
+	}
+	return opts, nil
+}
+
+// Returns the number of configured channels
+func (c NotifyConfig) Channels() int {
+	return len(c.Webhooks) + len(c.Ntfy) + len(c.Gotify) + len(c.Slack) + len(c.Discord)
+}
+
+type ReportConfig struct {
+	Enable   bool       `yaml:"enable"`
+	Schedule string     `yaml:"schedule,omitempty"`
+	Weekday  string     `yaml:"weekday,omitempty"`
+	Time     string     `yaml:"time,omitempty"`
+	From     string     `yaml:"from"`
+	To       []string   `yaml:"to"`
+	SMTP     SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string          `yaml:"host"`
+	Port     int             `yaml:"port,omitempty"`
+	Security string          `yaml:"security,omitempty"`
+	Username string          `yaml:"username,omitempty"`
+	Password string          `yaml:"password,omitempty"`
+	TLS      ClientTLSConfig `yaml:"tls,omitempty"`
+	Timeout  time.Duration   `yaml:"timeout,omitempty"`
+}
+
+// Returns the options for the reporter, the contract of the sla is used for the compliance in the report.
+// Fails when the tls config can not be loaded.
+func (c ReportConfig) ReporterOptions(instance string, sla SLAConfig) ([]report.ReporterOption, error) {
+	tlsCfg, err := c.SMTP.TLS.TLSConfig()
 	if err != nil {
-		slog.Error("Failed to retrieve hostname, using localhost instead", "err", err)
-		hostname = "localhost"
+		return nil, err
+	}
+	return []report.ReporterOption{
+		report.WithPort(c.SMTP.Port),
+		report.WithSecurity(c.SMTP.Security, tlsCfg),
+		report.WithAuth(c.SMTP.Username, c.SMTP.Password),
+		report.WithTimeout(c.SMTP.Timeout),
+		report.WithInstance(instance),
+		report.WithSLA(sla.SLAOptions()),
+		report.WithSchedule(c.Schedule, c.Weekday, c.Time),
+	}, nil
+}
+
+type TracingConfig struct {
+	Enable      bool              `yaml:"enable"`
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	SampleRatio float64           `yaml:"sampleRatio"`
+}
+
+// Returns the options for the trace provider
+func (c TracingConfig) Options(instance string) tracing.Options {
+	return tracing.Options{
+		Endpoint:    c.Endpoint,
+		Headers:     c.Headers,
+		SampleRatio: c.SampleRatio,
+		Instance:    instance,
 	}
+}
+
+type WebConfig struct {
+	TLS            TLSConfig         `yaml:"tls,omitempty"`
+	BasicAuthUsers map[string]string `yaml:"basicAuthUsers,omitempty"`
+	UnixSocket     UnixSocketConfig  `yaml:"unixSocket,omitempty"`
+}
+
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile,omitempty"`
+	KeyFile      string `yaml:"keyFile,omitempty"`
+	ClientCAFile string `yaml:"clientCAFile,omitempty"`
+}
+
+// Returns true if TLS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+type UnixSocketConfig struct {
+	Mode  string `yaml:"mode,omitempty"`
+	Group string `yaml:"group,omitempty"`
+}
+
+// Returns the configured permissions of the socket.
+// Assumes the config has been validated.
+func (c UnixSocketConfig) FileMode() fs.FileMode {
+	mode, _ := strconv.ParseUint(c.Mode, 8, 32)
+	return fs.FileMode(mode)
+}
+
+// List of addresses to listen on, can be given as a single string or a list in yaml
+type ListenAddresses []string
+
+func (l *ListenAddresses) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = ListenAddresses{value.Value}
+		return nil
+	}
+	var addresses []string
+	err := value.Decode(&addresses)
+	if err != nil {
+		return err
+	}
+	*l = addresses
+	return nil
+}
+
+// Returns the addresses the server should listen on.
+// Falls back to all interfaces on the configured port when no listenAddress is set.
+func (c Config) ListenAddresses() []string {
+	if len(c.ListenAddress) > 0 {
+		return c.ListenAddress
+	}
+	return []string{":" + strconv.Itoa(c.Port)}
+}
+
+// Returns how long results are kept in the history.
+// Covers the window of the sla and, when enabled, the period of the report.
+func (c Config) HistoryRetention() time.Duration {
+	if c.Report.Enable {
+		return max(c.SLA.Window, report.Period(c.Report.Schedule))
+	}
+	return c.SLA.Window
+}
+
+// Returns true if an output is enabled that depends on speedtests being run without the exporter being scraped.
+// In this case the exporter runs a speedtest every time the cache expires.
+func (c Config) ScheduleSpeedtests() bool {
+	return c.Influx.Enable || c.MQTT.Enable || c.Pushgateway.Enable || c.Notify.Enable || c.Report.Enable ||
+		(c.OTLP.Enable && c.OTLP.Push == PUSH_COMPLETION)
+}
+
+// Returns a Config with default values set
+func DefaultConfig() Config {
+	hostname := utils.Hostname()
+	defaultLabels := collector.DefaultLabelOptions()
+	defaultSLA := collector.DefaultSLAOptions()
+	defaultHistograms := collector.DefaultHistogramOptions()
 	return Config{
 		LogLevel:     DEFAULT_LOG_LEVEL,
 		Port:         DEFAULT_PORT,
 		Instance:     hostname,
 		Cache:        DEFAULT_CACHE,
 		PersistCache: DEFAULT_PERSIST_CACHE,
-		Remote: RemoteConfig{
-			JobName: DEFAULT_REMOTE_JOB_NAME,
+		Iperf3: Iperf3Config{
+			Port:       DEFAULT_IPERF3_PORT,
+			Duration:   DEFAULT_IPERF3_DURATION,
+			Streams:    DEFAULT_IPERF3_STREAMS,
+			Executable: DEFAULT_IPERF3_EXECUTABLE,
+		},
+		LibreSpeed: LibreSpeedConfig{
+			Duration: DEFAULT_LIBRESPEED_DURATION,
+			Streams:  DEFAULT_LIBRESPEED_STREAMS,
+		},
+		Metrics: MetricsConfig{
+			Labels:  defaultLabels.Labels,
+			IPLabel: defaultLabels.IPMode,
+			Histograms: HistogramConfig{
+				DownloadBuckets: defaultHistograms.DownloadBuckets,
+				UploadBuckets:   defaultHistograms.UploadBuckets,
+				PingBuckets:     defaultHistograms.PingBuckets,
+			},
+		},
+		SLA: SLAConfig{
+			Threshold: defaultSLA.Threshold,
+			Window:    defaultSLA.Window,
+		},
+		OTLP: OTLPConfig{
+			Push: DEFAULT_OTLP_PUSH,
+		},
+		Influx: InfluxConfig{
+			Measurement:   DEFAULT_INFLUX_MEASUREMENT,
+			BatchSize:     DEFAULT_INFLUX_BATCH_SIZE,
+			FlushInterval: DEFAULT_INFLUX_FLUSH_INTERVAL,
+			MaxRetries:    DEFAULT_INFLUX_MAX_RETRIES,
+		},
+		MQTT: MQTTConfig{
+			Retain: DEFAULT_MQTT_RETAIN,
+			Discovery: MQTTDiscoveryConfig{
+				Enable: DEFAULT_MQTT_DISCOVERY,
+				Prefix: DEFAULT_MQTT_DISCOVERY_PREFIX,
+			},
+		},
+		Pushgateway: PushgatewayConfig{
+			JobName: DEFAULT_PUSHGATEWAY_JOB_NAME,
+		},
+		Notify: NotifyConfig{
+			Cooldown: DEFAULT_NOTIFY_COOLDOWN,
+		},
+		Report: ReportConfig{
+			Schedule: DEFAULT_REPORT_SCHEDULE,
+			Weekday:  DEFAULT_REPORT_WEEKDAY,
+			Time:     DEFAULT_REPORT_TIME,
+			SMTP: SMTPConfig{
+				Port:     DEFAULT_SMTP_PORT,
+				Security: DEFAULT_SMTP_SECURITY,
+				Timeout:  DEFAULT_SMTP_TIMEOUT,
+			},
+		},
+		Tracing: TracingConfig{
+			SampleRatio: DEFAULT_TRACING_RATIO,
+		},
+		Web: WebConfig{
+			UnixSocket: UnixSocketConfig{
+				Mode: DEFAULT_UNIX_SOCKET_MODE,
+			},
 		},
 	}
 }
@@ -75,10 +980,79 @@ func DefaultConfig() Config {
 //	mode: Mode used, determines how the config will be validated and which values will be processed
 //	env: Determines if enviroment variables in the file will be expanded before decoding
 func LoadConfig(path string, env bool) (Config, error) {
+	c, err := parseConfig(path, env)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = setLogLevel(c.LogLevel)
+	if err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// Reloads the config from file and verifies that it can be applied to the running application.
+// Returns ErrRestartRequired if options have been changed that can only be applied with a restart.
+// The log level is returned instead of being applied, so the caller can set it with SetLogLevel once the reload succeeded.
+// Arguments:
+//
+//	current: The config the application is currently running with
+//	path: Path to config file
+//	env: Determines if enviroment variables in the file will be expanded before decoding
+func ReloadConfig(current Config, path string, env bool) (Config, slog.Level, error) {
+	c, err := parseConfig(path, env)
+	if err != nil {
+		return Config{}, 0, err
+	}
+
+	options := make([]string, 0, 4)
+	if c.Port != current.Port {
+		options = append(options, "port")
+	}
+	if !slices.Equal(c.ListenAddress, current.ListenAddress) {
+		options = append(options, "listenAddress")
+	}
+	if c.PersistCache != current.PersistCache {
+		options = append(options, "persistCache")
+	}
+	if c.SpeedtestCLI != current.SpeedtestCLI {
+		options = append(options, "speedtestCLI")
+	}
+	if c.Backend != current.Backend {
+		options = append(options, "backend")
+	}
+	if c.Iperf3 != current.Iperf3 {
+		options = append(options, "iperf3")
+	}
+	if !reflect.DeepEqual(c.LibreSpeed, current.LibreSpeed) {
+		options = append(options, "librespeed")
+	}
+	if !reflect.DeepEqual(c.Tracing, current.Tracing) {
+		options = append(options, "tracing")
+	}
+	if c.Web.TLS != current.Web.TLS {
+		options = append(options, "web.tls")
+	}
+	if c.Web.UnixSocket != current.Web.UnixSocket {
+		options = append(options, "web.unixSocket")
+	}
+	if len(options) > 0 {
+		return Config{}, 0, &ErrRestartRequired{options}
+	}
+
+	level, err := parseLogLevel(c.LogLevel)
+	if err != nil {
+		return Config{}, 0, err
+	}
+	return c, level, nil
+}
+
+// Read the config from file and validate it, without applying any of the settings
+func parseConfig(path string, env bool) (Config, error) {
 	c := DefaultConfig()
 
 	if path == "" {
-		_ = setLogLevel(DEFAULT_LOG_LEVEL)
 		return c, nil
 	}
 
@@ -97,40 +1071,317 @@ func LoadConfig(path string, env bool) (Config, error) {
 		return Config{}, err
 	}
 
-	err = setLogLevel(c.LogLevel)
+	_, err = parseLogLevel(c.LogLevel)
 	if err != nil {
 		return Config{}, err
 	}
 
-	if c.Remote.Instance == "" {
-		c.Remote.Instance = c.Instance
+	err = c.validateBackend()
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = c.Remote.setDefaults(c.Instance, c.Cache)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if c.OTLP.Instance == "" {
+		c.OTLP.Instance = c.Instance
+	}
+	if c.OTLP.Interval == 0 {
+		c.OTLP.Interval = c.Cache
+	}
+
+	if c.OTLP.Enable {
+		err = c.OTLP.validate()
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if c.Influx.Instance == "" {
+		c.Influx.Instance = c.Instance
+	}
+	if c.Influx.Enable {
+		err = c.Influx.Options().Validate()
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if c.MQTT.Enable {
+		err = c.MQTT.validate()
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if c.Pushgateway.Instance == "" {
+		c.Pushgateway.Instance = c.Instance
+	}
+	if c.Pushgateway.Enable {
+		err = c.Pushgateway.validate()
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if c.Notify.Enable {
+		err = c.Notify.validate(c.Instance, c.SLA)
+		if err != nil {
+			return Config{}, err
+		}
 	}
 
-	if c.Remote.Enable {
-		if c.Remote.URL == "" {
-			return Config{}, promremote.ErrMissingEndpoint{}
+	if c.Report.Enable {
+		err = c.Report.validate(c.Instance, c.SLA)
+		if err != nil {
+			return Config{}, err
 		}
-		if c.Remote.Username != c.Remote.Password && (c.Remote.Username == "" || c.Remote.Password == "") {
-			return Config{}, promremote.ErrMissingAuthCredentials{}
+	}
+
+	for _, target := range c.Remote {
+		if target.Enable {
+			err = target.validate()
+			if err != nil {
+				return Config{}, err
+			}
 		}
 	}
 
+	err = c.Metrics.LabelOptions().Validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	if c.Tracing.Enable {
+		err = c.Tracing.Options(c.Instance).Validate()
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	err = c.Metrics.Histograms.HistogramOptions().Validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = c.SLA.SLAOptions().Validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, address := range c.ListenAddress {
+		_, _, err = web.ParseListenAddress(address)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	err = c.Web.validate()
+	if err != nil {
+		return Config{}, err
+	}
+
 	return c, nil
 }
 
 // Parse a given string and set the resulting log level
 func setLogLevel(level string) error {
+	l, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	SetLogLevel(l)
+	return nil
+}
+
+// Change the level of the default logger
+func SetLogLevel(level slog.Level) {
+	logLevel.Set(level)
+}
+
+// Parse a given string into a log level
+func parseLogLevel(level string) (slog.Level, error) {
 	switch strings.ToLower(level) {
 	case "debug":
-		logLevel.Set(slog.LevelDebug)
+		return slog.LevelDebug, nil
 	case "info":
-		logLevel.Set(slog.LevelInfo)
+		return slog.LevelInfo, nil
 	case "warn":
-		logLevel.Set(slog.LevelWarn)
+		return slog.LevelWarn, nil
 	case "error":
-		logLevel.Set(slog.LevelError)
+		return slog.LevelError, nil
 	default:
-		return &ErrUnknownLogLevel{level}
+		return 0, &ErrUnknownLogLevel{level}
+	}
+}
+
+// Validate the web config, ensures that TLS is complete and all passwords are valid bcrypt hashes
+func (c WebConfig) validate() error {
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return &ErrIncompleteTLSConfig{}
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		return &ErrIncompleteTLSConfig{}
+	}
+
+	mode, err := strconv.ParseUint(c.UnixSocket.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return &ErrInvalidSocketMode{Mode: c.UnixSocket.Mode}
+	}
+
+	for user, hash := range c.BasicAuthUsers {
+		_, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return &ErrInvalidPasswordHash{User: user}
+		}
+	}
+	return nil
+}
+
+// Returns the enabled remote_write targets
+func (r RemoteTargets) Enabled() []RemoteConfig {
+	var res []RemoteConfig
+	for _, target := range r {
+		if target.Enable {
+			res = append(res, target)
+		}
+	}
+	return res
+}
+
+// Initialize the instance and interval of the targets and ensure every target has a unique name.
+// The name is used for the directory of the queue, so it needs to be usable as a path.
+func (r RemoteTargets) setDefaults(instance string, interval time.Duration) error {
+	names := make(map[string]bool, len(r))
+	for i := range r {
+		if !remoteTargetNameRegex.MatchString(r[i].Name) {
+			return &ErrInvalidRemoteTargetName{Name: r[i].Name}
+		}
+		if names[r[i].Name] {
+			return &ErrDuplicateRemoteTarget{Name: r[i].Name}
+		}
+		names[r[i].Name] = true
+
+		if r[i].Instance == "" {
+			r[i].Instance = instance
+		}
+		if r[i].Interval == 0 {
+			r[i].Interval = interval
+		}
+	}
+	return nil
+}
+
+// Verify the endpoint, authentication, transport, queue and push mode of the remote_write client.
+// The certificates are loaded, to ensure they are valid.
+func (c RemoteConfig) validate() error {
+	if c.URL == "" {
+		return remote.ErrMissingEndpoint{}
+	}
+	if c.Username != c.Password && (c.Username == "" || c.Password == "") {
+		return remote.ErrMissingAuthCredentials{}
+	}
+	if c.Username != "" && c.BearerToken != "" {
+		return remote.ErrConflictingAuth{}
+	}
+	// Creating the client checks the remaining options, without sending anything
+	opts, err := c.ClientOptions()
+	if err != nil {
+		return err
+	}
+	_, err = remote.NewClient(c.URL, prometheus.NewRegistry(), opts...)
+	if err != nil {
+		return err
+	}
+	if c.Queue.MaxSizeMB <= 0 {
+		return &remote.ErrInvalidQueueSize{Size: int64(c.Queue.MaxSizeMB)}
+	}
+	if c.Queue.MaxBackoff <= 0 {
+		return &remote.ErrInvalidBackoff{Backoff: c.Queue.MaxBackoff}
+	}
+	if c.Push != PUSH_INTERVAL && c.Push != PUSH_COMPLETION {
+		return &ErrInvalidPushMode{Mode: c.Push}
+	}
+	if c.Interval < 0 {
+		return &remote.ErrInvalidInterval{Interval: c.Interval}
+	}
+	return nil
+}
+
+// Verify the endpoint, push mode and client certificate of the OTLP client
+func (c OTLPConfig) validate() error {
+	err := otlp.ValidateEndpoint(c.Endpoint)
+	if err != nil {
+		return err
+	}
+	if c.Push != PUSH_INTERVAL && c.Push != PUSH_COMPLETION {
+		return &ErrInvalidPushMode{Mode: c.Push}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return &ErrIncompleteTLSConfig{}
 	}
 	return nil
 }
+
+// Verify the broker, QoS and client certificate of the MQTT client
+func (c MQTTConfig) validate() error {
+	err := mqtt.ValidateBroker(c.Broker)
+	if err != nil {
+		return err
+	}
+	if c.QoS > 2 {
+		return &mqtt.ErrInvalidQoS{QoS: c.QoS}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return &ErrIncompleteTLSConfig{}
+	}
+	if c.Discovery.Enable && c.Discovery.Prefix == "" {
+		return mqtt.ErrMissingTopic{}
+	}
+	return nil
+}
+
+// Verify the url, job, grouping labels and client certificate of the pushgateway client
+func (c PushgatewayConfig) validate() error {
+	err := pushgateway.ValidateURL(c.URL)
+	if err != nil {
+		return err
+	}
+	if c.JobName == "" {
+		return pushgateway.ErrMissingJob{}
+	}
+	for label := range c.Grouping {
+		if label == "job" || label == "instance" {
+			return &pushgateway.ErrInvalidGroupingLabel{Label: label}
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return &ErrIncompleteTLSConfig{}
+	}
+	return nil
+}
+
+// Verify the smtp server, addresses and schedule of the reporter by creating it.
+// The history is safe to use when nil, the results are not needed for the validation.
+func (c ReportConfig) validate(instance string, sla SLAConfig) error {
+	opts, err := c.ReporterOptions(instance, sla)
+	if err != nil {
+		return err
+	}
+	_, err = report.NewReporter(c.SMTP.Host, c.From, c.To, (*history.History)(nil), opts...)
+	return err
+}
+
+// Verify the thresholds and channels of the notifier.
+// The channels are created, to ensure their templates can be parsed.
+func (c NotifyConfig) validate(instance string, sla SLAConfig) error {
+	opts, err := c.NotifierOptions(instance, sla)
+	if err != nil {
+		return err
+	}
+	_, err = notify.NewNotifier(opts...)
+	return err
+}
@@ -2,41 +2,364 @@ package config
 
 import (
 	"log/slog"
+	"os"
 	"reflect"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestValidConfigs(t *testing.T) {
+	defaultHistograms := HistogramConfig{
+		DownloadBuckets: collector.DefaultSpeedBuckets,
+		UploadBuckets:   collector.DefaultSpeedBuckets,
+		PingBuckets:     collector.DefaultPingBuckets,
+	}
+	defaultIperf3 := Iperf3Config{
+		Port:       DEFAULT_IPERF3_PORT,
+		Duration:   DEFAULT_IPERF3_DURATION,
+		Streams:    DEFAULT_IPERF3_STREAMS,
+		Executable: DEFAULT_IPERF3_EXECUTABLE,
+	}
+	defaultLibreSpeed := LibreSpeedConfig{
+		Duration: DEFAULT_LIBRESPEED_DURATION,
+		Streams:  DEFAULT_LIBRESPEED_STREAMS,
+	}
+	defaultReport := ReportConfig{
+		Schedule: DEFAULT_REPORT_SCHEDULE,
+		Weekday:  DEFAULT_REPORT_WEEKDAY,
+		Time:     DEFAULT_REPORT_TIME,
+		SMTP: SMTPConfig{
+			Port:     DEFAULT_SMTP_PORT,
+			Security: DEFAULT_SMTP_SECURITY,
+			Timeout:  DEFAULT_SMTP_TIMEOUT,
+		},
+	}
 	c1 := Config{
-		LogLevel:     "warn",
-		Port:         80,
+		LogLevel: "warn",
+		Port:     80,
+		ListenAddress: ListenAddresses{
+			"192.168.1.10:80",
+			"[::1]:80",
+			"unix:/run/speedtest-exporter.sock",
+		},
 		Instance:     "test",
 		Cache:        time.Minute,
 		PersistCache: false,
 		SpeedtestCLI: "/path/to/speedtest",
-		Remote: RemoteConfig{
-			JobName:  DEFAULT_REMOTE_JOB_NAME,
+		Iperf3:       defaultIperf3,
+		LibreSpeed:   defaultLibreSpeed,
+		Metrics: MetricsConfig{
+			Labels:     []string{"ip", "isp"},
+			IPLabel:    "raw",
+			Histograms: defaultHistograms,
+		},
+		SLA: SLAConfig{
+			Threshold: 0.8,
+			Window:    7 * 24 * time.Hour,
+		},
+		OTLP: OTLPConfig{
+			Instance: "test",
+			Push:     PUSH_INTERVAL,
+			Interval: time.Minute,
+		},
+		Influx: InfluxConfig{
+			Measurement:   DEFAULT_INFLUX_MEASUREMENT,
+			Instance:      "test",
+			BatchSize:     DEFAULT_INFLUX_BATCH_SIZE,
+			FlushInterval: DEFAULT_INFLUX_FLUSH_INTERVAL,
+			MaxRetries:    DEFAULT_INFLUX_MAX_RETRIES,
+		},
+		MQTT: MQTTConfig{
+			Retain: DEFAULT_MQTT_RETAIN,
+			Discovery: MQTTDiscoveryConfig{
+				Enable: DEFAULT_MQTT_DISCOVERY,
+				Prefix: DEFAULT_MQTT_DISCOVERY_PREFIX,
+			},
+		},
+		Pushgateway: PushgatewayConfig{
+			JobName:  DEFAULT_PUSHGATEWAY_JOB_NAME,
 			Instance: "test",
 		},
+		Notify: NotifyConfig{
+			Cooldown: DEFAULT_NOTIFY_COOLDOWN,
+		},
+		Report: defaultReport,
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+
+		Web: WebConfig{
+			UnixSocket: UnixSocketConfig{
+				Mode:  "0600",
+				Group: "nginx",
+			},
+		},
 	}
 	c2 := Config{
-		LogLevel:     "debug",
-		Port:         2080,
-		Instance:     "test",
-		Cache:        30 * time.Minute,
-		PersistCache: true,
-		Remote: RemoteConfig{
+		LogLevel:      "debug",
+		Port:          2080,
+		ListenAddress: ListenAddresses{"localhost:2080"},
+		Instance:      "test",
+		Cache:         30 * time.Minute,
+		PersistCache:  true,
+		Backend:       "iperf3",
+		Iperf3: Iperf3Config{
+			Server:     "iperf.example.org",
+			Port:       5202,
+			Duration:   30 * time.Second,
+			Streams:    4,
+			UDP:        true,
+			Bitrate:    "500M",
+			Executable: "/usr/local/bin/iperf3",
+		},
+		LibreSpeed: LibreSpeedConfig{
+			Servers:    []string{"https://speedtest.example.org/backend"},
+			ServerList: "https://speedtest.example.org/servers.json",
+			Duration:   15 * time.Second,
+			Streams:    6,
+		},
+		Metrics: MetricsConfig{
+			Timestamps: true,
+			Labels:     []string{"ip", "server_location"},
+			IPLabel:    "hashed",
+			IPHashKey:  "not-a-real-key",
+			ExtraLabels: map[string]string{
+				"site":       "home",
+				"circuit_id": "1234",
+			},
+			Histograms: HistogramConfig{
+				DownloadBuckets: []float64{100, 250, 500},
+				UploadBuckets:   []float64{10, 25, 50},
+				PingBuckets:     []float64{10, 20},
+				Native:          true,
+			},
+		},
+		SLA: SLAConfig{
+			Download:  250,
+			Upload:    40,
+			Latency:   20,
+			Threshold: 0.9,
+			Window:    720 * time.Hour,
+		},
+		Remote: RemoteTargets{
+			{
+				Enable:   true,
+				Name:     "mimir",
+				URL:      "https://example.org/",
+				Instance: "test",
+				JobName:  "testjob",
+				Interval: 30 * time.Minute,
+				Username: "somebody",
+				Password: "somebody's password",
+				Headers:  map[string]string{"X-Scope-OrgID": "tenant-1"},
+				TLS: ClientTLSConfig{
+					InsecureSkipVerify: true,
+				},
+				ProxyURL: "http://proxy.example.org:3128",
+				Timeout:  30 * time.Second,
+				Queue: RemoteQueueConfig{
+					MaxSizeMB:  64,
+					MaxBackoff: time.Minute,
+				},
+				Push:      PUSH_COMPLETION,
+				Heartbeat: 5 * time.Minute,
+			},
+			{
+				Enable:      true,
+				Name:        "grafana-cloud",
+				URL:         "https://prometheus.grafana.example.org/api/prom/push",
+				Instance:    "test",
+				JobName:     DEFAULT_REMOTE_JOB_NAME,
+				Interval:    time.Hour,
+				BearerToken: "token",
+				Timeout:     DEFAULT_REMOTE_TIMEOUT,
+				Relabel: []RelabelConfig{
+					{SourceLabels: []string{"__name__"}, Regex: "speedtest_exporter_.*", Action: "drop"},
+					{TargetLabel: "site", Replacement: "home"},
+				},
+				Queue: RemoteQueueConfig{
+					MaxSizeMB:  DEFAULT_REMOTE_QUEUE_MB,
+					MaxBackoff: DEFAULT_REMOTE_BACKOFF,
+				},
+				Push:      DEFAULT_REMOTE_PUSH,
+				Heartbeat: DEFAULT_REMOTE_HEARTBEAT,
+			},
+		},
+		OTLP: OTLPConfig{
+			Enable:   true,
+			Endpoint: "https://otel.example.org/v1/metrics",
+			Instance: "otlp-instance",
+			ResourceAttributes: map[string]string{
+				"site": "home",
+			},
+			Headers: map[string]string{
+				"Authorization": "Bearer token",
+			},
+			TLS: ClientTLSConfig{
+				CAFile:             "/path/to/ca.crt",
+				InsecureSkipVerify: true,
+			},
+			Gzip:     true,
+			Push:     PUSH_COMPLETION,
+			Interval: 30 * time.Minute,
+		},
+		Influx: InfluxConfig{
+			Enable:        true,
+			URL:           "https://influx.example.org:8086",
+			Org:           "home",
+			Bucket:        "network",
+			Token:         "secret",
+			Measurement:   "internet",
+			Instance:      "test",
+			BatchSize:     10,
+			FlushInterval: time.Minute,
+			MaxRetries:    5,
+		},
+		MQTT: MQTTConfig{
+			Enable:   true,
+			Broker:   "ssl://mqtt.example.org:8883",
+			ClientID: "speedtest",
+			Username: "somebody",
+			Password: "somebody's password",
+			TLS: ClientTLSConfig{
+				CAFile: "/path/to/ca.crt",
+			},
+			Topic:  "home/speedtest",
+			QoS:    1,
+			Retain: false,
+			Discovery: MQTTDiscoveryConfig{
+				Enable: true,
+				Prefix: "ha",
+			},
+		},
+		Pushgateway: PushgatewayConfig{
 			Enable:   true,
-			URL:      "https://example.org/",
+			URL:      "https://pushgateway.example.org",
+			JobName:  "speedtest",
 			Instance: "test",
-			JobName:  "testjob",
+			Grouping: map[string]string{
+				"site": "home",
+			},
 			Username: "somebody",
 			Password: "somebody's password",
+			TLS: ClientTLSConfig{
+				CertFile: "/path/to/client.crt",
+				KeyFile:  "/path/to/client.key",
+			},
+			DeleteOnShutdown: true,
+		},
+		Notify: NotifyConfig{
+			Enable: true,
+			Thresholds: NotifyThresholdsConfig{
+				Download:   100,
+				Upload:     20,
+				Latency:    30,
+				Failures:   3,
+				Hysteresis: 10,
+			},
+			Cooldown: 30 * time.Minute,
+			Webhooks: Webhooks{
+				{
+					URL:    "https://ha.example.org/api/webhook/speedtest",
+					Secret: "secret",
+					ChannelConfig: ChannelConfig{
+						Name:   "home-assistant",
+						Events: []string{"breach", "recovery"},
+						Headers: map[string]string{
+							"Authorization": "Bearer token",
+						},
+						Template: `{"text": {{ json .Message }}}`,
+						Timeout:  5 * time.Second,
+						Retries:  0,
+					},
+				},
+				{
+					URL:           "http://localhost:8080/hook",
+					ChannelConfig: DefaultChannelConfig(),
+				},
+			},
+			Ntfy: NtfyTopics{
+				{
+					URL:      "https://ntfy.example.org",
+					Topic:    "speedtest",
+					Token:    "tk_token",
+					Priority: 4,
+					ChannelConfig: ChannelConfig{
+						Events:  []string{"breach", "recovery"},
+						Timeout: DEFAULT_WEBHOOK_TIMEOUT,
+						Retries: DEFAULT_WEBHOOK_RETRIES,
+					},
+				},
+			},
+			Gotify: GotifyServers{
+				{
+					URL:           "https://gotify.example.org",
+					Token:         "token",
+					ChannelConfig: DefaultChannelConfig(),
+				},
+			},
+			Slack: ChatWebhooks{
+				{
+					URL:           "https://hooks.slack.com/services/T000/B000/XXXX",
+					ChannelConfig: DefaultChannelConfig(),
+				},
+			},
+			Discord: ChatWebhooks{
+				{
+					URL: "https://discord.com/api/webhooks/1/token",
+					ChannelConfig: ChannelConfig{
+						Name:    "discord",
+						Timeout: DEFAULT_WEBHOOK_TIMEOUT,
+						Retries: 1,
+					},
+				},
+			},
+		},
+		Report: ReportConfig{
+			Enable:   true,
+			Schedule: "daily",
+			Weekday:  DEFAULT_REPORT_WEEKDAY,
+			Time:     "06:30",
+			From:     "Speedtest <speedtest@example.org>",
+			To:       []string{"management@example.org", "ops@example.org"},
+			SMTP: SMTPConfig{
+				Host:     "smtp.example.org",
+				Port:     465,
+				Security: "tls",
+				Username: "speedtest",
+				Password: "smtp password",
+				TLS: ClientTLSConfig{
+					InsecureSkipVerify: true,
+				},
+				Timeout: time.Minute,
+			},
+		},
+		Tracing: TracingConfig{
+			Enable:   true,
+			Endpoint: "https://otel.example.org/v1/traces",
+			Headers: map[string]string{
+				"Authorization": "Bearer token",
+			},
+			SampleRatio: 0.5,
+		},
+		Web: WebConfig{
+			TLS: TLSConfig{
+				CertFile:     "/path/to/tls.crt",
+				KeyFile:      "/path/to/tls.key",
+				ClientCAFile: "/path/to/ca.crt",
+			},
+			BasicAuthUsers: map[string]string{
+				"somebody": "$2a$10$K1H1Cu6SHY8CdV600KAYAe81MpQrK.fadY4Op1qzGQJsZYtoq01si",
+			},
+			UnixSocket: UnixSocketConfig{
+				Mode: DEFAULT_UNIX_SOCKET_MODE,
+			},
 		},
 	}
 	c3 := Config{
@@ -45,11 +368,82 @@ func TestValidConfigs(t *testing.T) {
 		Instance:     "another-instance",
 		Cache:        DEFAULT_CACHE,
 		PersistCache: DEFAULT_PERSIST_CACHE,
-		Remote: RemoteConfig{
+		Iperf3:       defaultIperf3,
+		LibreSpeed:   defaultLibreSpeed,
+		Metrics: MetricsConfig{
+			Labels:     []string{"ip", "isp"},
+			IPLabel:    "raw",
+			Histograms: defaultHistograms,
+		},
+		SLA: SLAConfig{
+			Threshold: 0.8,
+			Window:    7 * 24 * time.Hour,
+		},
+		OTLP: OTLPConfig{
+			Instance: "another-instance",
+			Push:     PUSH_INTERVAL,
+			Interval: DEFAULT_CACHE,
+		},
+		Influx: InfluxConfig{
+			Measurement:   DEFAULT_INFLUX_MEASUREMENT,
+			Instance:      "another-instance",
+			BatchSize:     DEFAULT_INFLUX_BATCH_SIZE,
+			FlushInterval: DEFAULT_INFLUX_FLUSH_INTERVAL,
+			MaxRetries:    DEFAULT_INFLUX_MAX_RETRIES,
+		},
+		MQTT: MQTTConfig{
+			Retain: DEFAULT_MQTT_RETAIN,
+			Discovery: MQTTDiscoveryConfig{
+				Enable: DEFAULT_MQTT_DISCOVERY,
+				Prefix: DEFAULT_MQTT_DISCOVERY_PREFIX,
+			},
+		},
+		Pushgateway: PushgatewayConfig{
+			JobName:  DEFAULT_PUSHGATEWAY_JOB_NAME,
+			Instance: "another-instance",
+		},
+		Notify: NotifyConfig{
 			Enable:   true,
-			URL:      "https://example.org/",
-			Instance: "test",
-			JobName:  DEFAULT_REMOTE_JOB_NAME,
+			Cooldown: DEFAULT_NOTIFY_COOLDOWN,
+			Webhooks: Webhooks{
+				{
+					URL:           "https://hooks.example.org/speedtest",
+					ChannelConfig: DefaultChannelConfig(),
+				},
+			},
+			Ntfy: NtfyTopics{
+				{
+					URL:           DEFAULT_NTFY_URL,
+					Topic:         "speedtest",
+					ChannelConfig: DefaultChannelConfig(),
+				},
+			},
+		},
+		Report: defaultReport,
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		Remote: RemoteTargets{
+			{
+				Enable:   true,
+				Name:     DEFAULT_REMOTE_NAME,
+				URL:      "https://example.org/",
+				Instance: "test",
+				JobName:  DEFAULT_REMOTE_JOB_NAME,
+				Interval: DEFAULT_CACHE,
+				Timeout:  DEFAULT_REMOTE_TIMEOUT,
+				Queue: RemoteQueueConfig{
+					MaxSizeMB:  DEFAULT_REMOTE_QUEUE_MB,
+					MaxBackoff: DEFAULT_REMOTE_BACKOFF,
+				},
+				Push:      DEFAULT_REMOTE_PUSH,
+				Heartbeat: DEFAULT_REMOTE_HEARTBEAT,
+			},
+		},
+		Web: WebConfig{
+			UnixSocket: UnixSocketConfig{
+				Mode: DEFAULT_UNIX_SOCKET_MODE,
+			},
 		},
 	}
 	tMatrix := []struct {
@@ -111,12 +505,177 @@ func TestInvalidConfig(t *testing.T) {
 		{
 			Name:  "MissingRemoteEndpoint",
 			Path:  "testdata/invalid-config-2.yaml",
-			Error: "promremote.ErrMissingEndpoint",
+			Error: "remote.ErrMissingEndpoint",
 		},
 		{
 			Name:  "IncompleteRemoteCredentials",
 			Path:  "testdata/invalid-config-3.yaml",
-			Error: "promremote.ErrMissingAuthCredentials",
+			Error: "remote.ErrMissingAuthCredentials",
+		},
+		{
+			Name:  "IncompleteTLSConfig",
+			Path:  "testdata/invalid-config-4.yaml",
+			Error: "*config.ErrIncompleteTLSConfig",
+		},
+		{
+			Name:  "InvalidPasswordHash",
+			Path:  "testdata/invalid-config-5.yaml",
+			Error: "*config.ErrInvalidPasswordHash",
+		},
+		{
+			Name:  "InvalidListenAddress",
+			Path:  "testdata/invalid-config-6.yaml",
+			Error: "*web.ErrInvalidListenAddress",
+		},
+		{
+			Name:  "InvalidSocketMode",
+			Path:  "testdata/invalid-config-7.yaml",
+			Error: "*config.ErrInvalidSocketMode",
+		},
+		{
+			Name:  "UnknownLabel",
+			Path:  "testdata/invalid-config-8.yaml",
+			Error: "*collector.ErrUnknownLabel",
+		},
+		{
+			Name:  "InvalidSLA",
+			Path:  "testdata/invalid-config-9.yaml",
+			Error: "*collector.ErrInvalidSLA",
+		},
+		{
+			Name:  "InvalidBuckets",
+			Path:  "testdata/invalid-config-10.yaml",
+			Error: "*collector.ErrInvalidBuckets",
+		},
+		{
+			Name:  "InvalidTracingEndpoint",
+			Path:  "testdata/invalid-config-11.yaml",
+			Error: "*tracing.ErrInvalidEndpoint",
+		},
+		{
+			Name:  "InvalidOTLPPushMode",
+			Path:  "testdata/invalid-config-12.yaml",
+			Error: "*config.ErrInvalidPushMode",
+		},
+		{
+			Name:  "IncompleteOTLPClientCert",
+			Path:  "testdata/invalid-config-13.yaml",
+			Error: "*config.ErrIncompleteTLSConfig",
+		},
+		{
+			Name:  "MissingInfluxBucket",
+			Path:  "testdata/invalid-config-14.yaml",
+			Error: "influx.ErrMissingBucket",
+		},
+		{
+			Name:  "InvalidMQTTQoS",
+			Path:  "testdata/invalid-config-15.yaml",
+			Error: "*mqtt.ErrInvalidQoS",
+		},
+		{
+			Name:  "InvalidPushgatewayGrouping",
+			Path:  "testdata/invalid-config-16.yaml",
+			Error: "*pushgateway.ErrInvalidGroupingLabel",
+		},
+		{
+			Name:  "InvalidRemoteQueueSize",
+			Path:  "testdata/invalid-config-17.yaml",
+			Error: "*remote.ErrInvalidQueueSize",
+		},
+		{
+			Name:  "InvalidRemotePushMode",
+			Path:  "testdata/invalid-config-18.yaml",
+			Error: "*config.ErrInvalidPushMode",
+		},
+		{
+			Name:  "ConflictingRemoteAuth",
+			Path:  "testdata/invalid-config-19.yaml",
+			Error: "remote.ErrConflictingAuth",
+		},
+		{
+			Name:  "InvalidRemoteCAFile",
+			Path:  "testdata/invalid-config-20.yaml",
+			Error: "*config.ErrInvalidCAFile",
+		},
+		{
+			Name:  "InvalidRemoteProxyURL",
+			Path:  "testdata/invalid-config-21.yaml",
+			Error: "*remote.ErrInvalidProxyURL",
+		},
+		{
+			Name:  "DuplicateRemoteTarget",
+			Path:  "testdata/invalid-config-22.yaml",
+			Error: "*config.ErrDuplicateRemoteTarget",
+		},
+		{
+			Name:  "InvalidRemoteTargetName",
+			Path:  "testdata/invalid-config-23.yaml",
+			Error: "*config.ErrInvalidRemoteTargetName",
+		},
+		{
+			Name:  "InvalidRemoteRelabelRule",
+			Path:  "testdata/invalid-config-24.yaml",
+			Error: "*remote.ErrInvalidRelabelAction",
+		},
+		{
+			Name:  "InvalidNotifyEvent",
+			Path:  "testdata/invalid-config-25.yaml",
+			Error: "*notify.ErrInvalidEvent",
+		},
+		{
+			Name:  "InvalidNotifyHysteresis",
+			Path:  "testdata/invalid-config-26.yaml",
+			Error: "*notify.ErrInvalidHysteresis",
+		},
+		{
+			Name:  "InvalidWebhookTemplate",
+			Path:  "testdata/invalid-config-27.yaml",
+			Error: "*notify.ErrInvalidTemplate",
+		},
+		{
+			Name:  "MissingNtfyTopic",
+			Path:  "testdata/invalid-config-28.yaml",
+			Error: "notify.ErrMissingTopic",
+		},
+		{
+			Name:  "InvalidGotifyPriority",
+			Path:  "testdata/invalid-config-29.yaml",
+			Error: "*notify.ErrInvalidPriority",
+		},
+		{
+			Name:  "MissingReportRecipients",
+			Path:  "testdata/invalid-config-30.yaml",
+			Error: "report.ErrMissingRecipients",
+		},
+		{
+			Name:  "InvalidReportSchedule",
+			Path:  "testdata/invalid-config-31.yaml",
+			Error: "*report.ErrInvalidSchedule",
+		},
+		{
+			Name:  "UnknownBackend",
+			Path:  "testdata/invalid-config-32.yaml",
+			Error: "*config.ErrUnknownBackend",
+		},
+		{
+			Name:  "MissingIperf3Server",
+			Path:  "testdata/invalid-config-33.yaml",
+			Error: "speedtest.ErrMissingServer",
+		},
+		{
+			Name:  "InvalidIperf3Streams",
+			Path:  "testdata/invalid-config-34.yaml",
+			Error: "*speedtest.ErrInvalidStreams",
+		},
+		{
+			Name:  "MissingLibreSpeedServer",
+			Path:  "testdata/invalid-config-35.yaml",
+			Error: "speedtest.ErrMissingLibreSpeedServer",
+		},
+		{
+			Name:  "InvalidLibreSpeedServer",
+			Path:  "testdata/invalid-config-36.yaml",
+			Error: "*speedtest.ErrInvalidURL",
 		},
 	}
 
@@ -132,13 +691,57 @@ func TestInvalidConfig(t *testing.T) {
 	}
 }
 
+func TestReloadConfig(t *testing.T) {
+	t.Cleanup(func() {
+		err := setLogLevel(DEFAULT_LOG_LEVEL)
+		if err != nil {
+			t.Logf("Failed to cleanup after test: %v", err)
+		}
+	})
+
+	current, err := LoadConfig("testdata/valid-config-3.yaml", false)
+	require.NoError(t, err, "Should load config")
+
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+
+		require.NoError(t, setLogLevel("error"))
+
+		c, level, err := ReloadConfig(current, "testdata/reload-config.yaml", false)
+
+		require.NoError(t, err, "Should reload config")
+		assert.Equal("reloaded-instance", c.Instance)
+		assert.Equal(10*time.Minute, c.Cache)
+		assert.Equal(slog.LevelDebug, level, "Should return the new log level")
+		assert.Equal(slog.LevelError, logLevel.Level(), "Should leave applying the log level to the caller")
+	})
+	t.Run("RestartRequired", func(t *testing.T) {
+		assert := assert.New(t)
+
+		require.NoError(t, setLogLevel("error"))
+
+		_, _, err := ReloadConfig(current, "testdata/valid-config-1.yaml", false)
+
+		assert.Equal(&ErrRestartRequired{[]string{"port", "listenAddress", "persistCache", "speedtestCLI", "web.unixSocket"}}, err, "Should reject options that require a restart")
+		assert.Equal(slog.LevelError, logLevel.Level(), "Should not change the log level")
+	})
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, _, err := ReloadConfig(current, "testdata/invalid-config-2.yaml", false)
+
+		assert.Error(t, err, "Should return an error")
+	})
+}
+
 func TestEnvSubstitution(t *testing.T) {
 	c := DefaultConfig()
 	c.LogLevel = "debug"
 	c.Port = 2080
 	c.Cache = time.Minute
 	c.PersistCache = DEFAULT_PERSIST_CACHE
-	c.Remote.Instance = c.Instance
+	c.OTLP.Instance = c.Instance
+	c.OTLP.Interval = c.Cache
+	c.Influx.Instance = c.Instance
+	c.Pushgateway.Instance = c.Instance
 
 	t.Setenv("SPEEDTEST_TEST_LOG_LEVEL", c.LogLevel)
 	t.Setenv("SPEEDTEST_TEST_PORT", strconv.Itoa(c.Port))
@@ -149,7 +752,6 @@ func TestEnvSubstitution(t *testing.T) {
 	assert := assert.New(t)
 
 	assert.NotEmpty(res.Instance, "Should initialize instance from hostname")
-	assert.Equal(res.Instance, res.Remote.Instance, "Should initialize remote instance from instance")
 
 	assert.NoError(err)
 	assert.Equal(c, res)
@@ -189,3 +791,137 @@ func TestSetLogLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestListenAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	c := DefaultConfig()
+	c.Port = 9090
+	assert.Equal([]string{":9090"}, c.ListenAddresses(), "Should fall back to port")
+
+	c.ListenAddress = ListenAddresses{"[::1]:8080", "unix:/run/test.sock"}
+	assert.Equal([]string{"[::1]:8080", "unix:/run/test.sock"}, c.ListenAddresses(), "Should prefer listenAddress")
+}
+
+func TestSpeedtestBackend(t *testing.T) {
+	tMatrix := []struct {
+		Name         string
+		Backend      string
+		SpeedtestCLI string
+		Result       string
+	}{
+		{"Default", "", "", speedtest.BackendSpeedtestGo},
+		{"SpeedtestCLIPath", "", "/path/to/speedtest", speedtest.BackendSpeedtestCLI},
+		{"Explicit", speedtest.BackendIperf3, "/path/to/speedtest", speedtest.BackendIperf3},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			c := DefaultConfig()
+			c.Backend = tCase.Backend
+			c.SpeedtestCLI = tCase.SpeedtestCLI
+
+			assert.Equal(t, tCase.Result, c.SpeedtestBackend())
+		})
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	c := DefaultConfig()
+	c.SLA.Window = 24 * time.Hour
+	assert.Equal(24*time.Hour, c.HistoryRetention(), "Should use the sla window")
+
+	c.Report.Enable = true
+	assert.Equal(7*24*time.Hour, c.HistoryRetention(), "Should cover a weekly report")
+
+	c.SLA.Window = 30 * 24 * time.Hour
+	assert.Equal(30*24*time.Hour, c.HistoryRetention(), "Should not shorten the sla window")
+}
+
+func TestScheduleSpeedtests(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Modify func(c *Config)
+		Result bool
+	}{
+		{
+			Name:   "Default",
+			Modify: func(_ *Config) {},
+			Result: false,
+		},
+		{
+			Name:   "Pushgateway",
+			Modify: func(c *Config) { c.Pushgateway.Enable = true },
+			Result: true,
+		},
+		{
+			Name:   "MQTT",
+			Modify: func(c *Config) { c.MQTT.Enable = true },
+			Result: true,
+		},
+		{
+			Name:   "Influx",
+			Modify: func(c *Config) { c.Influx.Enable = true },
+			Result: true,
+		},
+		{
+			Name:   "Notify",
+			Modify: func(c *Config) { c.Notify.Enable = true },
+			Result: true,
+		},
+		{
+			Name:   "Report",
+			Modify: func(c *Config) { c.Report.Enable = true },
+			Result: true,
+		},
+		{
+			Name:   "OTLPInterval",
+			Modify: func(c *Config) { c.OTLP.Enable = true },
+			Result: false,
+		},
+		{
+			Name: "OTLPCompletion",
+			Modify: func(c *Config) {
+				c.OTLP.Enable = true
+				c.OTLP.Push = PUSH_COMPLETION
+			},
+			Result: true,
+		},
+		{
+			Name:   "OTLPCompletionDisabled",
+			Modify: func(c *Config) { c.OTLP.Push = PUSH_COMPLETION },
+			Result: false,
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			c := DefaultConfig()
+			tCase.Modify(&c)
+			assert.Equal(t, tCase.Result, c.ScheduleSpeedtests())
+		})
+	}
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	t.Run("InsecureSkipVerify", func(t *testing.T) {
+		tlsCfg, err := ClientTLSConfig{InsecureSkipVerify: true}.TLSConfig()
+		require.NoError(t, err, "Should create tls config")
+		assert.True(t, tlsCfg.InsecureSkipVerify)
+		assert.Nil(t, tlsCfg.RootCAs, "Should use the system pool")
+	})
+	t.Run("IncompleteClientCert", func(t *testing.T) {
+		_, err := ClientTLSConfig{CertFile: "/path/to/client.crt"}.TLSConfig()
+		assert.Equal(t, &ErrIncompleteTLSConfig{}, err)
+	})
+	t.Run("InvalidCAFile", func(t *testing.T) {
+		_, err := ClientTLSConfig{CAFile: "testdata/not-a-config.txt"}.TLSConfig()
+		assert.Equal(t, &ErrInvalidCAFile{Path: "testdata/not-a-config.txt"}, err)
+	})
+	t.Run("MissingCAFile", func(t *testing.T) {
+		_, err := ClientTLSConfig{CAFile: "testdata/missing.crt"}.TLSConfig()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -1,6 +1,11 @@
 package config
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
 
 type ErrUnknownLogLevel struct {
 	Level string
@@ -10,6 +15,14 @@ func (e *ErrUnknownLogLevel) Error() string {
 	return "Unknown log level " + e.Level
 }
 
+type ErrUnknownBackend struct {
+	Backend string
+}
+
+func (e *ErrUnknownBackend) Error() string {
+	return "Unknown speedtest backend \"" + e.Backend + "\", expected one of " + speedtest.BackendSpeedtestGo + ", " + speedtest.BackendSpeedtestCLI + ", " + speedtest.BackendIperf3 + " or " + speedtest.BackendLibreSpeed
+}
+
 type ErrInvalidInterval struct {
 	Interval time.Duration
 }
@@ -17,3 +30,65 @@ type ErrInvalidInterval struct {
 func (e *ErrInvalidInterval) Error() string {
 	return "Interval is to short, needs to be at least 30s, current " + e.Interval.String()
 }
+
+type ErrRestartRequired struct {
+	Options []string
+}
+
+func (e *ErrRestartRequired) Error() string {
+	return "Changing the following options requires a restart: " + strings.Join(e.Options, ", ")
+}
+
+type ErrIncompleteTLSConfig struct{}
+
+func (e *ErrIncompleteTLSConfig) Error() string {
+	return "TLS needs both a certificate and a key"
+}
+
+type ErrInvalidCAFile struct {
+	Path string
+}
+
+func (e *ErrInvalidCAFile) Error() string {
+	return "No valid certificates found in CA file " + e.Path
+}
+
+type ErrInvalidPasswordHash struct {
+	User string
+}
+
+func (e *ErrInvalidPasswordHash) Error() string {
+	return "Password of user " + e.User + " is not a valid bcrypt hash"
+}
+
+type ErrInvalidSocketMode struct {
+	Mode string
+}
+
+func (e *ErrInvalidSocketMode) Error() string {
+	return "Invalid unix socket mode \"" + e.Mode + "\", expected octal permissions like 0660"
+}
+
+type ErrInvalidPushMode struct {
+	Mode string
+}
+
+func (e *ErrInvalidPushMode) Error() string {
+	return "Invalid push mode \"" + e.Mode + "\", expected \"" + PUSH_INTERVAL + "\" or \"" + PUSH_COMPLETION + "\""
+}
+
+type ErrInvalidRemoteTargetName struct {
+	Name string
+}
+
+func (e *ErrInvalidRemoteTargetName) Error() string {
+	return "Invalid remote_write target name \"" + e.Name + "\", may only contain letters, digits, \"_\", \"-\" and \".\""
+}
+
+type ErrDuplicateRemoteTarget struct {
+	Name string
+}
+
+func (e *ErrDuplicateRemoteTarget) Error() string {
+	return "Remote_write target name \"" + e.Name + "\" is used more than once, every target needs a unique name"
+}
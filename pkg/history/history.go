@@ -0,0 +1,195 @@
+package history
+
+import (
+	"cmp"
+	"encoding/json/v2"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Upper limit for the number of results kept, regardless of the retention.
+// Prevents the history from growing without bounds when tests are run very frequently.
+const maxResults = 100000
+
+// The results contain the raw client IP, so the file is only readable by the exporter
+const historyFileMode = 0600
+
+// Keeps the results of past speedtests for the configured retention
+type History struct {
+	persist   bool
+	path      string
+	retention time.Duration
+	results   []*speedtest.SpeedtestResult
+
+	sync.RWMutex
+}
+
+// Create a new History instance and try to initialize it from disk if persist is true.
+// If the path is not writable, the history will not persist to disk.
+// This function does not fail if it cannot read from disk, it will just log the error.
+func NewHistory(persist bool, path string, retention time.Duration) *History {
+	h := &History{
+		persist:   persist,
+		path:      path,
+		retention: retention,
+	}
+
+	if path == "" {
+		h.persist = false
+	}
+	if !h.persist {
+		return h
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_RDWR, historyFileMode)
+	if err != nil {
+		slog.Info("Failed to open history file, will not persist history to disk", slog.String("file", h.path), slog.Any("error", err))
+		h.persist = false
+		return h
+	}
+	defer f.Close()
+
+	// Restrict files created by older versions with world readable permissions
+	err = f.Chmod(historyFileMode)
+	if err != nil {
+		slog.Warn("Failed to restrict permissions of history file", slog.String("file", h.path), slog.Any("error", err))
+	}
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return h
+	}
+
+	var results []*speedtest.SpeedtestResult
+	err = json.UnmarshalRead(f, &results)
+	if err != nil {
+		slog.Info("Could not initialize history from disk", slog.String("file", h.path), slog.Any("error", err))
+		return h
+	}
+	h.results = slices.DeleteFunc(results, func(r *speedtest.SpeedtestResult) bool { return r == nil })
+	h.prune(time.Now())
+	slog.Info("Initialized history from disk", slog.String("path", h.path), slog.Int("results", len(h.results)))
+	return h
+}
+
+// Add the result to the history and remove results older than the retention.
+// Attempt to persist to disk if enabled, but do not fail if it fails.
+// This method is safe to call even if the History instance is nil.
+func (h *History) Add(result *speedtest.SpeedtestResult) {
+	if h == nil || result == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+
+	h.results = append(h.results, result)
+	h.prune(time.Now())
+	h.save()
+}
+
+// Return all results that were run at or after since, ordered from oldest to newest.
+// This method is safe to call even if the History instance is nil.
+func (h *History) Results(since time.Time) []*speedtest.SpeedtestResult {
+	if h == nil {
+		return nil
+	}
+	h.RLock()
+	defer h.RUnlock()
+
+	i, _ := slices.BinarySearchFunc(h.results, since.UnixMilli(), func(r *speedtest.SpeedtestResult, t int64) int {
+		return cmp.Compare(r.Timestamp(), t)
+	})
+	return slices.Clone(h.results[i:])
+}
+
+// Return the result of the run with the given ID, nil if it is not in the history.
+// This method is safe to call even if the History instance is nil.
+func (h *History) Get(runID string) *speedtest.SpeedtestResult {
+	if h == nil || runID == "" {
+		return nil
+	}
+	h.RLock()
+	defer h.RUnlock()
+
+	i := slices.IndexFunc(h.results, func(r *speedtest.SpeedtestResult) bool {
+		return r.RunID() == runID
+	})
+	if i < 0 {
+		return nil
+	}
+	return h.results[i]
+}
+
+// Change how long results are kept.
+// This method is safe to call even if the History instance is nil.
+func (h *History) SetRetention(retention time.Duration) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+
+	h.retention = retention
+	h.prune(time.Now())
+}
+
+// Return how long results are kept
+func (h *History) Retention() time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.retention
+}
+
+// Returns true if the history is persisted to disk.
+// This can be false even if persistence was requested, when the history file is not writable.
+func (h *History) Persistent() bool {
+	if h == nil {
+		return false
+	}
+	return h.persist
+}
+
+// Sort the results and remove those older than the retention.
+// Assumes the caller holds the lock.
+func (h *History) prune(now time.Time) {
+	slices.SortStableFunc(h.results, func(a, b *speedtest.SpeedtestResult) int {
+		return cmp.Compare(a.Timestamp(), b.Timestamp())
+	})
+
+	cutoff := now.Add(-h.retention).UnixMilli()
+	i := 0
+	for i < len(h.results) && h.results[i].Timestamp() < cutoff {
+		i++
+	}
+	if len(h.results)-i > maxResults {
+		i = len(h.results) - maxResults
+	}
+	h.results = slices.Delete(h.results, 0, i)
+}
+
+// Write the history to disk if enabled.
+// Assumes the caller holds the lock.
+func (h *History) save() {
+	if !h.persist {
+		return
+	}
+
+	data, err := json.Marshal(h.results)
+	if err != nil {
+		slog.Error("Could not marshal history to JSON", slog.Any("error", err))
+		return
+	}
+	err = os.WriteFile(h.path, data, historyFileMode)
+	if err != nil {
+		slog.Error("Could not write history to disk", slog.String("file", h.path), slog.Any("error", err))
+	}
+}
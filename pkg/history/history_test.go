@@ -0,0 +1,180 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resultAt(t time.Time) *speedtest.SpeedtestResult {
+	return speedtest.MockSpeedtestResult(t.UnixMilli())
+}
+
+func TestNewHistory(t *testing.T) {
+	tMatrix := []struct {
+		Name            string
+		Persist         bool
+		Path            string
+		ExpectedPersist bool
+	}{
+		{
+			Name:            "EmptyPath",
+			Persist:         true,
+			Path:            "",
+			ExpectedPersist: false,
+		},
+		{
+			Name:            "NoPersist",
+			Persist:         false,
+			Path:            "testdata/history.json",
+			ExpectedPersist: false,
+		},
+		{
+			Name:            "PathDoesNotExist",
+			Persist:         true,
+			Path:            "/nonexistent/path/history.json",
+			ExpectedPersist: false,
+		},
+		{
+			Name:            "InvalidJSON",
+			Persist:         true,
+			Path:            "testdata/not-json.txt",
+			ExpectedPersist: true,
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			h := NewHistory(tCase.Persist, tCase.Path, time.Hour)
+
+			assert.Equal(tCase.ExpectedPersist, h.Persistent(), "Should report if the history is persisted")
+			assert.Equal(time.Hour, h.Retention(), "Retention should be set correctly")
+			assert.Empty(h.results, "Should not have any results")
+		})
+	}
+}
+
+func TestPersistHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "history.json")
+	now := time.Now()
+
+	h := NewHistory(true, path, time.Hour)
+	require.True(h.Persistent(), "Should persist history")
+	h.Add(resultAt(now.Add(-time.Minute)))
+	h.Add(speedtest.NewFailedSpeedtestResult())
+
+	// Simulate an old entry written by a previous run
+	expired := resultAt(now.Add(-2 * time.Hour))
+	h.results = append(h.results, expired)
+	h.save()
+
+	h2 := NewHistory(true, path, time.Hour)
+	assert.Len(h2.results, 2, "Should load results from disk and drop expired ones")
+	assert.Equal(h.results[0], h2.results[0], "Should restore the results")
+	assert.False(h2.results[1].Success(), "Should restore failed results")
+
+	info, err := os.Stat(path)
+	require.NoError(err, "Should stat history file")
+	assert.Equal(os.FileMode(0600), info.Mode().Perm(), "Should only be readable by the exporter")
+}
+
+func TestHistoryRestrictsPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	require.NoError(t, os.WriteFile(path, []byte("[]"), 0644), "Should write history file")
+
+	h := NewHistory(true, path, time.Hour)
+	require.True(t, h.Persistent(), "Should persist history")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err, "Should stat history file")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Should restrict the permissions of existing files")
+}
+
+func TestHistoryResults(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	h := NewHistory(false, "", 24*time.Hour)
+
+	h.Add(resultAt(now.Add(-time.Minute)))
+	h.Add(resultAt(now.Add(-3 * time.Hour)))
+	h.Add(resultAt(now.Add(-25 * time.Hour)))
+	h.Add(nil)
+
+	results := h.Results(time.Time{})
+	if assert.Len(results, 2, "Should drop results older than the retention") {
+		assert.Equal(now.Add(-3*time.Hour).UnixMilli(), results[0].Timestamp(), "Should sort results from oldest to newest")
+		assert.Equal(now.Add(-time.Minute).UnixMilli(), results[1].Timestamp(), "Should sort results from oldest to newest")
+	}
+
+	results = h.Results(now.Add(-time.Hour))
+	assert.Len(results, 1, "Should only return results after since")
+
+	h.SetRetention(time.Hour)
+	assert.Len(h.Results(time.Time{}), 1, "Should prune results when the retention is reduced")
+}
+
+func TestHistoryMaxResults(t *testing.T) {
+	now := time.Now()
+	h := NewHistory(false, "", time.Hour)
+	for i := range maxResults + 10 {
+		h.results = append(h.results, resultAt(now.Add(time.Duration(i)*time.Millisecond-time.Minute)))
+	}
+	h.prune(now)
+
+	assert.Len(t, h.results, maxResults, "Should limit the number of results")
+	assert.Equal(t, now.Add(10*time.Millisecond-time.Minute).UnixMilli(), h.results[0].Timestamp(), "Should drop the oldest results")
+}
+
+func TestHistoryGet(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewHistory(false, "", time.Hour)
+	first := resultAt(time.Now().Add(-time.Minute))
+	second := speedtest.NewFailedSpeedtestResult()
+	h.Add(first)
+	h.Add(second)
+
+	assert.Same(first, h.Get(first.RunID()), "Should find the first result")
+	assert.Same(second, h.Get(second.RunID()), "Should find failed results")
+	assert.Nil(h.Get("unknown"), "Should return nil for unknown run IDs")
+	assert.Nil(h.Get(""), "Should return nil for an empty run ID")
+}
+
+func TestNilHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	var h *History
+	assert.NotPanics(func() {
+		h.Add(resultAt(time.Now()))
+		h.SetRetention(time.Hour)
+	}, "Should not panic on nil history")
+	assert.Nil(h.Get("id"))
+	assert.Nil(h.Results(time.Time{}))
+	assert.Zero(h.Retention())
+	assert.False(h.Persistent())
+}
+
+func TestHistoryWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.json")
+
+	h := NewHistory(true, path, time.Hour)
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0755))
+
+	assert.NotPanics(t, func() {
+		h.Add(resultAt(time.Now()))
+	}, "Should not fail when the history can not be written")
+	assert.Len(t, h.Results(time.Time{}), 1, "Should keep the result in memory")
+}
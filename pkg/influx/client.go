@@ -0,0 +1,321 @@
+package influx
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 10 * time.Second
+	DefaultMaxRetries    = 3
+
+	// Points kept while the destination is unavailable, the oldest points are dropped first
+	maxQueueSize = 10000
+)
+
+// Wait time before the first retry of a failed write, doubled for every further retry
+var retryBackoff = time.Second
+
+// Configure the destination and batching of the influx output
+type Options struct {
+	// Destination of the points, http(s) for the InfluxDB v2 write api, udp or tcp for a plain line protocol listener
+	URL string
+	// Organization, bucket and api token, only used for http
+	Org    string
+	Bucket string
+	Token  string
+	// Name of the measurement, defaults to "speedtest"
+	Measurement string
+	// Added as instance tag to all points
+	Instance string
+	// Maximum number of points per write, a write is triggered early once enough points are queued
+	BatchSize int
+	// Interval in which queued points are written
+	FlushInterval time.Duration
+	// Number of retries of a failed write, before the points are kept for the next flush
+	MaxRetries int
+}
+
+// Verify that the url can be used and the http options are complete
+func (o Options) Validate() error {
+	_, err := o.newWriter()
+	if err != nil {
+		return err
+	}
+	if o.Instance == "" {
+		return ErrMissingInstance{}
+	}
+	return nil
+}
+
+// Create the writer matching the scheme of the url
+func (o Options) newWriter() (writer, error) {
+	if o.URL == "" {
+		return nil, ErrMissingURL{}
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil || u.Host == "" {
+		return nil, &ErrUnsupportedScheme{URL: o.URL}
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if o.Org == "" || o.Bucket == "" {
+			return nil, ErrMissingBucket{}
+		}
+		return newHTTPWriter(u, o.Org, o.Bucket, o.Token), nil
+	case "udp", "tcp":
+		return &socketWriter{network: u.Scheme, address: u.Host}, nil
+	default:
+		return nil, &ErrUnsupportedScheme{URL: o.URL}
+	}
+}
+
+// Client writes completed speedtest results as line protocol points in batches
+type Client struct {
+	opts   Options
+	writer writer
+
+	queue     []string
+	dropped   int
+	queueLock sync.Mutex
+	// Serializes writes of the background goroutine and Flush
+	flushLock sync.Mutex
+	// Buffered channel used to request an early flush once a batch is full
+	flush chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+
+	lastSuccess time.Time
+	lastError   error
+	statusLock  sync.RWMutex
+}
+
+// Status of the client, used for health reporting
+type Status struct {
+	// True while the background flush is running
+	Running bool
+	// Time of the last successful write, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last write, empty if it was successful
+	LastError string
+	// Number of points waiting to be written
+	Queued int
+	// Number of points dropped because the queue was full
+	Dropped int
+}
+
+// Create a new client, unset batching options are replaced with their defaults
+func NewClient(opts Options) (*Client, error) {
+	w, err := opts.newWriter()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Instance == "" {
+		return nil, ErrMissingInstance{}
+	}
+	if opts.Measurement == "" {
+		opts.Measurement = DefaultMeasurement
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+
+	return &Client{
+		opts:   opts,
+		writer: w,
+		flush:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Queue the result for the next write.
+// Does not block, so it can be called while the speedtest lock is held.
+func (c *Client) Add(result *speedtest.SpeedtestResult) {
+	if result == nil {
+		return
+	}
+	line := FormatResult(c.opts.Measurement, c.opts.Instance, result)
+
+	c.queueLock.Lock()
+	c.enqueue(line)
+	full := len(c.queue) >= c.opts.BatchSize
+	c.queueLock.Unlock()
+
+	if full {
+		select {
+		case c.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Append the lines to the queue and drop the oldest ones when it is full.
+// Assumes the caller holds the queue lock.
+func (c *Client) enqueue(lines ...string) {
+	c.queue = append(c.queue, lines...)
+	if over := len(c.queue) - maxQueueSize; over > 0 {
+		c.queue = c.queue[over:]
+		c.dropped += over
+		slog.Warn("Influx queue is full, dropped oldest points", slog.Int("count", over))
+	}
+}
+
+// Write all queued points in batches.
+// A failed write is retried, if it still fails the remaining points are kept for the next flush.
+func (c *Client) Flush(ctx context.Context) error {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+
+	err := c.flushQueue(ctx)
+
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.lastError = err
+	if err == nil {
+		c.lastSuccess = time.Now()
+	}
+	return err
+}
+
+func (c *Client) flushQueue(ctx context.Context) error {
+	for {
+		c.queueLock.Lock()
+		n := min(len(c.queue), c.opts.BatchSize)
+		batch := c.queue[:n:n]
+		c.queue = c.queue[n:]
+		c.queueLock.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := c.writeWithRetry(ctx, batch)
+		if err != nil {
+			// Put the batch back in front of the points queued in the meantime
+			c.queueLock.Lock()
+			queued := c.queue
+			c.queue = nil
+			c.enqueue(append(batch, queued...)...)
+			c.queueLock.Unlock()
+			return err
+		}
+		slog.Debug("Successfully wrote points to influx", slog.Int("count", len(batch)))
+	}
+}
+
+// Write the batch, retrying with exponential backoff on failure
+func (c *Client) writeWithRetry(ctx context.Context, batch []string) error {
+	backoff := retryBackoff
+	var err error
+	for attempt := 0; attempt <= c.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			slog.Debug("Retrying influx write", slog.Int("attempt", attempt), "err", err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		err = c.writer.Write(ctx, batch)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Periodically write the queued points, or earlier once a batch is full.
+// Runs as a background goroutine and does not block the calling thread.
+func (c *Client) Run() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel != nil {
+		return ErrClientAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(c.opts.FlushInterval)
+		defer ticker.Stop()
+
+		slog.Debug("Starting influx client")
+		for {
+			select {
+			case <-ticker.C:
+			case <-c.flush:
+			case <-ctx.Done():
+				return
+			}
+			err := c.Flush(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Failed to write points to influx", "err", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Returns true if the client is currently running
+func (c *Client) IsRunning() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cancel != nil
+}
+
+// Return the current status of the client
+func (c *Client) Status() Status {
+	status := Status{Running: c.IsRunning()}
+
+	c.queueLock.Lock()
+	status.Queued = len(c.queue)
+	status.Dropped = c.dropped
+	c.queueLock.Unlock()
+
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	status.LastSuccess = c.lastSuccess
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	return status
+}
+
+// Stop the background flush and wait for the goroutine to exit.
+// Queued points are kept, call Flush to write them.
+// Does nothing if the client is not running.
+func (c *Client) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	slog.Info("Stopped influx client")
+}
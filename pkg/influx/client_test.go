@@ -0,0 +1,325 @@
+package influx
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	retryBackoff = time.Millisecond
+}
+
+// Stores all writes received via the v2 write api
+type mockInflux struct {
+	bodies   []string
+	requests []*http.Request
+	// Number of writes that should be rejected before accepting them
+	failures int
+	lock     sync.Mutex
+}
+
+func (m *mockInflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests = append(m.requests, r)
+
+	if m.failures > 0 {
+		m.failures--
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	m.bodies = append(m.bodies, string(body))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *mockInflux) Bodies() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]string{}, m.bodies...)
+}
+
+func (m *mockInflux) Attempts() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.requests)
+}
+
+func newTestInflux(t *testing.T) (*mockInflux, *httptest.Server) {
+	influx := &mockInflux{}
+	server := httptest.NewServer(influx)
+	t.Cleanup(server.Close)
+	return influx, server
+}
+
+func newHTTPTestClient(t *testing.T, url string, batchSize int) *Client {
+	t.Helper()
+	c, err := NewClient(Options{
+		URL:        url,
+		Org:        "home",
+		Bucket:     "network",
+		Token:      "secret",
+		Instance:   "testhost",
+		BatchSize:  batchSize,
+		MaxRetries: 2,
+	})
+	require.NoError(t, err, "Should create client")
+	return c
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Opts  Options
+		Error error
+	}{
+		{
+			Name: "HTTP",
+			Opts: Options{URL: "http://localhost:8086", Org: "home", Bucket: "network", Instance: "testhost"},
+		},
+		{
+			Name: "UDP",
+			Opts: Options{URL: "udp://localhost:8094", Instance: "testhost"},
+		},
+		{
+			Name: "TCP",
+			Opts: Options{URL: "tcp://localhost:8094", Instance: "testhost"},
+		},
+		{
+			Name:  "MissingURL",
+			Opts:  Options{Instance: "testhost"},
+			Error: ErrMissingURL{},
+		},
+		{
+			Name:  "UnsupportedScheme",
+			Opts:  Options{URL: "ftp://localhost", Instance: "testhost"},
+			Error: &ErrUnsupportedScheme{URL: "ftp://localhost"},
+		},
+		{
+			Name:  "NoHost",
+			Opts:  Options{URL: "localhost:8086", Instance: "testhost"},
+			Error: &ErrUnsupportedScheme{URL: "localhost:8086"},
+		},
+		{
+			Name:  "MissingBucket",
+			Opts:  Options{URL: "https://localhost:8086", Org: "home", Instance: "testhost"},
+			Error: ErrMissingBucket{},
+		},
+		{
+			Name:  "MissingInstance",
+			Opts:  Options{URL: "udp://localhost:8094"},
+			Error: ErrMissingInstance{},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, tCase.Opts.Validate())
+		})
+	}
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	c, err := NewClient(Options{URL: "udp://localhost:8094", Instance: "testhost", MaxRetries: -1})
+	require.NoError(t, err, "Should create client")
+
+	assert := assert.New(t)
+
+	assert.Equal(DefaultMeasurement, c.opts.Measurement)
+	assert.Equal(DefaultBatchSize, c.opts.BatchSize)
+	assert.Equal(DefaultFlushInterval, c.opts.FlushInterval)
+	assert.Equal(0, c.opts.MaxRetries)
+}
+
+func TestHTTPWrite(t *testing.T) {
+	influx, server := newTestInflux(t)
+	c := newHTTPTestClient(t, server.URL, 10)
+
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	c.Add(speedtest.NewSpeedtestResult(0.5, 15, 876.53, 12.34, 950.3, "1234", "example.org", "Foo Corp.", "127.0.0.1", time.Second))
+	c.Add(nil)
+
+	require.NoError(t, c.Flush(context.Background()), "Should write points")
+
+	assert := assert.New(t)
+
+	bodies := influx.Bodies()
+	require.Len(t, bodies, 1, "Should write all points in a single batch")
+	lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+	require.Len(t, lines, 2, "Should write a line per result")
+	assert.True(strings.HasPrefix(lines[0], "speedtest,instance=testhost success=false,"))
+	assert.Contains(lines[1], "download_mbps=876.53")
+
+	req := influx.requests[0]
+	assert.Equal("/api/v2/write", req.URL.Path)
+	assert.Equal("home", req.URL.Query().Get("org"))
+	assert.Equal("network", req.URL.Query().Get("bucket"))
+	assert.Equal("ns", req.URL.Query().Get("precision"))
+	assert.Equal("Token secret", req.Header.Get("Authorization"))
+
+	status := c.Status()
+	assert.Empty(status.LastError)
+	assert.False(status.LastSuccess.IsZero(), "Should record the successful write")
+	assert.Equal(0, status.Queued)
+}
+
+func TestHTTPRetry(t *testing.T) {
+	t.Run("RecoversAfterRetry", func(t *testing.T) {
+		influx, server := newTestInflux(t)
+		influx.failures = 2
+		c := newHTTPTestClient(t, server.URL, 10)
+
+		c.Add(speedtest.NewFailedSpeedtestResult())
+		require.NoError(t, c.Flush(context.Background()), "Should succeed on the last retry")
+
+		assert.Equal(t, 3, influx.Attempts())
+		assert.Len(t, influx.Bodies(), 1)
+	})
+	t.Run("KeepsPointsOnFailure", func(t *testing.T) {
+		influx, server := newTestInflux(t)
+		influx.failures = 3
+		c := newHTTPTestClient(t, server.URL, 10)
+
+		c.Add(speedtest.NewFailedSpeedtestResult())
+		err := c.Flush(context.Background())
+
+		assert := assert.New(t)
+
+		require.Error(t, err, "Should fail after all retries")
+		assert.Equal(&ErrWriteFailed{StatusCode: http.StatusServiceUnavailable, Body: "database unavailable"}, err)
+		assert.Equal(3, influx.Attempts())
+
+		status := c.Status()
+		assert.Equal(err.Error(), status.LastError)
+		assert.Equal(1, status.Queued, "Should keep the point for the next flush")
+
+		c.Add(speedtest.NewFailedSpeedtestResult())
+		assert.NoError(c.Flush(context.Background()), "Should write the kept points")
+		bodies := influx.Bodies()
+		require.Len(t, bodies, 1)
+		assert.Equal(2, strings.Count(bodies[0], "\n"), "Should write the kept and the new point")
+		assert.Equal(0, c.Status().Queued)
+	})
+}
+
+func TestQueueDropsOldest(t *testing.T) {
+	c, err := NewClient(Options{URL: "udp://localhost:8094", Instance: "testhost"})
+	require.NoError(t, err, "Should create client")
+
+	c.queue = make([]string, maxQueueSize)
+	c.Add(speedtest.NewFailedSpeedtestResult())
+
+	status := c.Status()
+	assert.Equal(t, maxQueueSize, status.Queued)
+	assert.Equal(t, 1, status.Dropped)
+	assert.NotEmpty(t, c.queue[maxQueueSize-1], "Should keep the newest point")
+}
+
+func TestBatching(t *testing.T) {
+	influx, server := newTestInflux(t)
+	c := newHTTPTestClient(t, server.URL, 2)
+
+	for range 5 {
+		c.Add(speedtest.NewFailedSpeedtestResult())
+	}
+	require.NoError(t, c.Flush(context.Background()), "Should write points")
+
+	bodies := influx.Bodies()
+	require.Len(t, bodies, 3, "Should split the points into batches")
+	assert.Equal(t, 2, strings.Count(bodies[0], "\n"))
+	assert.Equal(t, 1, strings.Count(bodies[2], "\n"))
+}
+
+func TestRunFlushesFullBatch(t *testing.T) {
+	influx, server := newTestInflux(t)
+	c := newHTTPTestClient(t, server.URL, 2)
+	c.opts.FlushInterval = time.Hour
+
+	require.NoError(t, c.Run(), "Should start client")
+	t.Cleanup(c.Stop)
+	assert.Equal(t, ErrClientAlreadyRunning{}, c.Run(), "Should not start twice")
+
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, influx.Bodies(), "Should wait until the batch is full")
+
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	assert.Eventually(t, func() bool {
+		return len(influx.Bodies()) == 1
+	}, time.Second, 10*time.Millisecond, "Should flush once the batch is full")
+
+	c.Stop()
+	assert.False(t, c.IsRunning(), "Should be stopped")
+}
+
+func TestUDPWrite(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Should listen on udp")
+	t.Cleanup(func() { _ = conn.Close() })
+
+	c, err := NewClient(Options{URL: "udp://" + conn.LocalAddr().String(), Instance: "testhost"})
+	require.NoError(t, err, "Should create client")
+
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	require.NoError(t, c.Flush(context.Background()), "Should write points")
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 2048)
+	for range 2 {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err, "Should receive a datagram per point")
+		assert.True(t, strings.HasPrefix(string(buf[:n]), "speedtest,instance=testhost "))
+		assert.Equal(t, 1, strings.Count(string(buf[:n]), "\n"))
+	}
+}
+
+func TestTCPWrite(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Should listen on tcp")
+	t.Cleanup(func() { _ = listener.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	c, err := NewClient(Options{URL: "tcp://" + listener.Addr().String(), Instance: "testhost", Measurement: "net"})
+	require.NoError(t, err, "Should create client")
+
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	c.Add(speedtest.NewFailedSpeedtestResult())
+	require.NoError(t, c.Flush(context.Background()), "Should write points")
+
+	select {
+	case lines := <-received:
+		require.Len(t, lines, 2, "Should receive all points")
+		assert.True(t, strings.HasPrefix(lines[0], "net,instance=testhost "))
+	case <-time.After(time.Second):
+		t.Fatal("Did not receive points")
+	}
+}
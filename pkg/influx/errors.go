@@ -0,0 +1,44 @@
+package influx
+
+import "strconv"
+
+type ErrMissingURL struct{}
+
+func (e ErrMissingURL) Error() string {
+	return "No url for the influx output provided"
+}
+
+type ErrUnsupportedScheme struct {
+	URL string
+}
+
+func (e *ErrUnsupportedScheme) Error() string {
+	return "Unsupported url \"" + e.URL + "\", expected a http, https, udp or tcp url"
+}
+
+type ErrMissingBucket struct{}
+
+func (e ErrMissingBucket) Error() string {
+	return "Writing to InfluxDB via http needs both org and bucket"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrClientAlreadyRunning struct{}
+
+func (e ErrClientAlreadyRunning) Error() string {
+	return "Only a single instance of the client can run at a time"
+}
+
+type ErrWriteFailed struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ErrWriteFailed) Error() string {
+	return "InfluxDB rejected the write with status " + strconv.Itoa(e.StatusCode) + ": " + e.Body
+}
@@ -0,0 +1,68 @@
+package influx
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+const DefaultMeasurement = "speedtest"
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// Format the result as a single point in line protocol.
+// The timestamp uses nanosecond precision, as it is the default of InfluxDB and Telegraf.
+// Tags with empty values are omitted, failed results only contain the success, duration and run_id fields.
+func FormatResult(measurement, instance string, result *speedtest.SpeedtestResult) string {
+	var b strings.Builder
+
+	b.WriteString(measurementEscaper.Replace(measurement))
+	for _, tag := range [][2]string{
+		{"backend", result.Backend()},
+		{"instance", instance},
+		{"isp", result.ClientISP()},
+		{"server_host", result.ServerHost()},
+		{"server_id", result.ServerID()},
+		{"server_location", result.ServerLocation()},
+	} {
+		if tag[1] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(tag[0])
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tag[1]))
+	}
+
+	b.WriteString(" success=")
+	b.WriteString(strconv.FormatBool(result.Success()))
+	writeFloatField(&b, "duration_seconds", float64(result.Duration())/1000)
+	if result.Success() {
+		writeFloatField(&b, "ping_ms", result.Ping())
+		writeFloatField(&b, "jitter_ms", result.JitterLatency())
+		writeFloatField(&b, "download_mbps", result.DownloadSpeed())
+		writeFloatField(&b, "upload_mbps", result.UploadSpeed())
+		writeFloatField(&b, "data_used_mb", result.DataUsed())
+	}
+	if result.RunID() != "" {
+		b.WriteString(`,run_id="`)
+		b.WriteString(stringEscaper.Replace(result.RunID()))
+		b.WriteByte('"')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(result.TimestampAsTime().UnixNano(), 10))
+	return b.String()
+}
+
+func writeFloatField(b *strings.Builder, key string, value float64) {
+	b.WriteByte(',')
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+}
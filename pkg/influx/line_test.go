@@ -0,0 +1,60 @@
+package influx
+
+import (
+	"encoding/json/v2"
+	"testing"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Decode a result from json, to control the timestamp and run id
+func newTestResult(t *testing.T, data string) *speedtest.SpeedtestResult {
+	t.Helper()
+	result := &speedtest.SpeedtestResult{}
+	require.NoError(t, json.Unmarshal([]byte(data), result), "Should decode test result")
+	return result
+}
+
+func TestFormatResult(t *testing.T) {
+	tMatrix := []struct {
+		Name, Measurement, Instance, Result, Expected string
+	}{
+		{
+			Name:        "Success",
+			Measurement: "speedtest",
+			Instance:    "testhost",
+			Result:      `{"run_id":"abc","jitter_latency_ms":0.5,"ping_ms":15,"download_mbps":876.53,"upload_mbps":12.34,"data_used_mb":950.3,"server_id":"1234","server_host":"example.org","server_location":"Berlin","client_isp":"Foo Corp.","backend":"speedtest-go","success":true,"timestamp":1700000000123,"duration_ms":30500}`,
+			Expected:    `speedtest,backend=speedtest-go,instance=testhost,isp=Foo\ Corp.,server_host=example.org,server_id=1234,server_location=Berlin success=true,duration_seconds=30.5,ping_ms=15,jitter_ms=0.5,download_mbps=876.53,upload_mbps=12.34,data_used_mb=950.3,run_id="abc" 1700000000123000000`,
+		},
+		{
+			Name:        "Failed",
+			Measurement: "speedtest",
+			Instance:    "testhost",
+			Result:      `{"run_id":"def","success":false,"timestamp":1700000000000,"duration_ms":1000}`,
+			Expected:    `speedtest,instance=testhost success=false,duration_seconds=1,run_id="def" 1700000000000000000`,
+		},
+		{
+			Name:        "Escaping",
+			Measurement: "speed test,home",
+			Instance:    "a=b",
+			Result:      `{"run_id":"x\"y","client_isp":"Foo, Inc.","success":false,"timestamp":1}`,
+			Expected:    `speed\ test\,home,instance=a\=b,isp=Foo\,\ Inc. success=false,duration_seconds=0,run_id="x\"y" 1000000`,
+		},
+		{
+			Name:        "NoRunID",
+			Measurement: "speedtest",
+			Instance:    "testhost",
+			Result:      `{"success":false,"timestamp":1}`,
+			Expected:    `speedtest,instance=testhost success=false,duration_seconds=0 1000000`,
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			result := newTestResult(t, tCase.Result)
+			assert.Equal(t, tCase.Expected, FormatResult(tCase.Measurement, tCase.Instance, result))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	writeTimeout    = 10 * time.Second
+	maxErrorBodyLen = 512
+)
+
+// Sends a batch of points in line protocol to the destination
+type writer interface {
+	Write(ctx context.Context, lines []string) error
+}
+
+// Writes points to the InfluxDB v2 HTTP write api
+type httpWriter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// Create a writer for the InfluxDB v2 write api of the server at baseURL
+func newHTTPWriter(baseURL *url.URL, org, bucket, token string) *httpWriter {
+	u := baseURL.JoinPath("api", "v2", "write")
+	q := u.Query()
+	q.Set("org", org)
+	q.Set("bucket", bucket)
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+
+	return &httpWriter{
+		url:    u.String(),
+		token:  token,
+		client: &http.Client{Timeout: writeTimeout},
+	}
+}
+
+func (w *httpWriter) Write(ctx context.Context, lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodyLen))
+		return &ErrWriteFailed{StatusCode: res.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	}
+	return nil
+}
+
+// Writes points to a plain UDP or TCP line protocol listener, e.g. the socket_listener of Telegraf.
+// A new connection is opened for every batch, as results are only written every few minutes.
+type socketWriter struct {
+	network string
+	address string
+}
+
+func (w *socketWriter) Write(ctx context.Context, lines []string) error {
+	dialer := net.Dialer{Timeout: writeTimeout}
+	conn, err := dialer.DialContext(ctx, w.network, w.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err != nil {
+		return err
+	}
+
+	// Send each point as a separate datagram over UDP, to stay below the maximum packet size
+	if w.network == "udp" {
+		for _, line := range lines {
+			_, err = conn.Write([]byte(line + "\n"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err = conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	return err
+}
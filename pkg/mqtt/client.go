@@ -0,0 +1,396 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+)
+
+const (
+	DefaultTopicPrefix = "speedtest-exporter"
+
+	publishTimeout = 10 * time.Second
+	// Results waiting to be published, newer results are dropped when the queue is full
+	queueSize = 16
+	// Time in ms to wait for pending work when disconnecting
+	disconnectQuiesce = 250
+)
+
+// Client publishes completed speedtest results to a MQTT broker,
+// optionally with Home Assistant discovery configs for the sensors.
+type Client struct {
+	instance string
+	clientID string
+	// Base topic of all state topics
+	topic string
+	// Home Assistant discovery is disabled when empty
+	discoveryPrefix string
+	qos             byte
+	retain          bool
+	// Converts the client IP of the published results, they are published unchanged when nil
+	anonymizeIP func(ip string) string
+	// Options passed to the paho client, collected by the ClientOptions
+	mqttOpts *paho.ClientOptions
+	client   paho.Client
+
+	results chan *speedtest.SpeedtestResult
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+
+	lastSuccess time.Time
+	lastError   error
+	statusLock  sync.RWMutex
+}
+
+// Status of the client, used for health reporting
+type Status struct {
+	// True while the client is running in the background
+	Running bool
+	// True while the client is connected to the broker
+	Connected bool
+	// Time of the last successful publish, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last publish, empty if it was successful
+	LastError string
+}
+
+type ClientOption func(*Client) error
+
+// WithInstance sets the name of the device in Home Assistant and the default topic.
+// By default the hostname of the machine is used.
+func WithInstance(instance string) ClientOption {
+	return func(c *Client) error {
+		if instance == "" {
+			return ErrMissingInstance{}
+		}
+		c.instance = instance
+		return nil
+	}
+}
+
+// WithClientID sets the id used to connect to the broker.
+// Defaults to speedtest-exporter-<instance>.
+func WithClientID(clientID string) ClientOption {
+	return func(c *Client) error {
+		c.clientID = clientID
+		return nil
+	}
+}
+
+// WithTopic sets the base topic the results are published under.
+// Defaults to speedtest-exporter/<instance>.
+func WithTopic(topic string) ClientOption {
+	return func(c *Client) error {
+		if topic == "" {
+			return ErrMissingTopic{}
+		}
+		c.topic = topic
+		return nil
+	}
+}
+
+// WithCredentials sets the username and password used to connect to the broker.
+func WithCredentials(username, password string) ClientOption {
+	return func(c *Client) error {
+		c.mqttOpts.SetUsername(username)
+		c.mqttOpts.SetPassword(password)
+		return nil
+	}
+}
+
+// WithQoS sets the quality of service of all published messages.
+func WithQoS(qos byte) ClientOption {
+	return func(c *Client) error {
+		if qos > 2 {
+			return &ErrInvalidQoS{QoS: qos}
+		}
+		c.qos = qos
+		return nil
+	}
+}
+
+// WithRetain marks the published results as retained,
+// so new subscribers receive the last result immediately.
+func WithRetain(retain bool) ClientOption {
+	return func(c *Client) error {
+		c.retain = retain
+		return nil
+	}
+}
+
+// WithIPAnonymizer converts the client IP in the published results with the given function,
+// e.g. to hash or drop it like the ip label of the metrics. An empty IP is omitted from the result.
+func WithIPAnonymizer(anonymize func(ip string) string) ClientOption {
+	return func(c *Client) error {
+		c.anonymizeIP = anonymize
+		return nil
+	}
+}
+
+// WithDiscovery publishes Home Assistant discovery configs under the given prefix,
+// which creates the sensors automatically.
+func WithDiscovery(prefix string) ClientOption {
+	return func(c *Client) error {
+		if prefix == "" {
+			return ErrMissingTopic{}
+		}
+		c.discoveryPrefix = prefix
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls config for the connection to the broker, used with ssl, mqtts and wss urls.
+// E.g. to trust a custom CA or send a client certificate.
+func WithTLSConfig(tlsCfg *tls.Config) ClientOption {
+	return func(c *Client) error {
+		c.mqttOpts.SetTLSConfig(tlsCfg)
+		return nil
+	}
+}
+
+// NewClient creates a new MQTT client.
+// Parameters:
+//   - broker: Url of the broker, e.g. tcp://localhost:1883 or ssl://localhost:8883
+//   - opts: optional client options
+func NewClient(broker string, opts ...ClientOption) (*Client, error) {
+	err := ValidateBroker(broker)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		instance: utils.Hostname(),
+		mqttOpts: paho.NewClientOptions(),
+		results:  make(chan *speedtest.SpeedtestResult, queueSize),
+	}
+	for _, opt := range opts {
+		err = opt(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.topic == "" {
+		c.topic = DefaultTopicPrefix + "/" + c.instance
+	}
+	if c.clientID == "" {
+		c.clientID = DefaultTopicPrefix + "-" + c.instance
+	}
+
+	c.mqttOpts.AddBroker(broker).
+		SetClientID(c.clientID).
+		SetWill(c.availabilityTopic(), payloadOffline, c.qos, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetWriteTimeout(publishTimeout).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			slog.Warn("Lost connection to MQTT broker, reconnecting", "err", err)
+		})
+	c.client = paho.NewClient(c.mqttOpts)
+
+	return c, nil
+}
+
+// Verify that the broker is a url supported by the client
+func ValidateBroker(broker string) error {
+	if broker == "" {
+		return ErrMissingBroker{}
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return &ErrInvalidBroker{Broker: broker}
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+		return nil
+	default:
+		return &ErrInvalidBroker{Broker: broker}
+	}
+}
+
+// Called by paho after every (re)connect.
+// Marks the exporter as available and publishes the discovery configs,
+// so they are restored when the broker lost its retained messages.
+func (c *Client) onConnect(_ paho.Client) {
+	slog.Info("Connected to MQTT broker", slog.String("topic", c.topic))
+
+	msgs := []message{{topic: c.availabilityTopic(), payload: []byte(payloadOnline), retain: true}}
+	if c.discoveryPrefix != "" {
+		discovery, err := c.discoveryMessages()
+		if err != nil {
+			c.setStatus(err)
+			slog.Error("Failed to create Home Assistant discovery configs", "err", err)
+			return
+		}
+		msgs = append(msgs, discovery...)
+	}
+	err := c.publish(msgs)
+	c.setStatus(err)
+	if err != nil {
+		slog.Error("Failed to publish availability to MQTT", "err", err)
+	}
+}
+
+// Queue the result for publishing.
+// Does not block, so it can be called while the speedtest lock is held.
+func (c *Client) Publish(result *speedtest.SpeedtestResult) {
+	if result == nil {
+		return
+	}
+	select {
+	case c.results <- result:
+	default:
+		slog.Warn("MQTT queue is full, dropping result", slog.String("runID", result.RunID()))
+	}
+}
+
+// Publish the messages and wait for them to be sent
+func (c *Client) publish(msgs []message) error {
+	for _, msg := range msgs {
+		token := c.client.Publish(msg.topic, c.qos, msg.retain, msg.payload)
+		if !token.WaitTimeout(publishTimeout) {
+			return &ErrPublishTimeout{Topic: msg.topic}
+		}
+		err := token.Error()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish the result, it is dropped when the client is not connected,
+// as waiting for the reconnect would delay the following results.
+func (c *Client) publishResult(result *speedtest.SpeedtestResult) error {
+	if !c.client.IsConnectionOpen() {
+		return ErrNotConnected{}
+	}
+	msgs, err := c.resultMessages(result)
+	if err != nil {
+		return err
+	}
+	err = c.publish(msgs)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Published result to MQTT", slog.String("runID", result.RunID()))
+	return nil
+}
+
+func (c *Client) handleResult(result *speedtest.SpeedtestResult) {
+	err := c.publishResult(result)
+	c.setStatus(err)
+	if err != nil {
+		slog.Error("Failed to publish result to MQTT", "err", err)
+	}
+}
+
+// Record the outcome of a publish for health reporting
+func (c *Client) setStatus(err error) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	c.lastError = err
+	if err == nil {
+		c.lastSuccess = time.Now()
+	}
+}
+
+// Connect to the broker and publish the queued results.
+// The connection is retried in the background until it succeeds.
+// Runs as a background goroutine and does not block the calling thread.
+func (c *Client) Run() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel != nil {
+		return ErrClientAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	// Returns immediately, as the connection is retried in the background
+	c.client.Connect()
+
+	go func() {
+		defer close(c.done)
+
+		slog.Debug("Starting MQTT client")
+		for {
+			select {
+			case result := <-c.results:
+				c.handleResult(result)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Returns true if the client is currently running
+func (c *Client) IsRunning() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cancel != nil
+}
+
+// Return the current status of the client
+func (c *Client) Status() Status {
+	status := Status{
+		Running:   c.IsRunning(),
+		Connected: c.client.IsConnectionOpen(),
+	}
+
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	status.LastSuccess = c.lastSuccess
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	return status
+}
+
+// Publish the remaining queued results, mark the exporter as offline and disconnect from the broker.
+// Does nothing if the client is not running.
+func (c *Client) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+
+	for len(c.results) > 0 {
+		c.handleResult(<-c.results)
+	}
+
+	// The last will is only sent by the broker on unexpected disconnects
+	if c.client.IsConnectionOpen() {
+		err := c.publish([]message{{topic: c.availabilityTopic(), payload: []byte(payloadOffline), retain: true}})
+		if err != nil {
+			slog.Error("Failed to publish availability to MQTT", "err", err)
+		}
+	}
+	c.client.Disconnect(disconnectQuiesce)
+	slog.Info("Stopped MQTT client")
+}
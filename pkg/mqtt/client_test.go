@@ -0,0 +1,324 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Minimal embedded MQTT 3.1.1 broker, records all connects and published messages
+type mockBroker struct {
+	listener net.Listener
+	// Reject connections with other credentials when set
+	username, password string
+
+	connects  []*packets.ConnectPacket
+	publishes []*packets.PublishPacket
+	lock      sync.Mutex
+}
+
+// Start a broker on the listener, it is closed when the test finishes
+func newMockBroker(t *testing.T, listener net.Listener) *mockBroker {
+	b := &mockBroker{listener: listener}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.handle(conn)
+		}
+	}()
+	return b
+}
+
+func (b *mockBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		pkt, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var res packets.ControlPacket
+		switch p := pkt.(type) {
+		case *packets.ConnectPacket:
+			b.lock.Lock()
+			b.connects = append(b.connects, p)
+			b.lock.Unlock()
+
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			if b.username != "" && (p.Username != b.username || string(p.Password) != b.password) {
+				connack.ReturnCode = packets.ErrRefusedNotAuthorised
+			}
+			res = connack
+		case *packets.PublishPacket:
+			b.lock.Lock()
+			b.publishes = append(b.publishes, p)
+			b.lock.Unlock()
+
+			if p.Qos == 1 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				res = puback
+			}
+		case *packets.PingreqPacket:
+			res = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+
+		if res != nil && res.Write(conn) != nil {
+			return
+		}
+	}
+}
+
+func (b *mockBroker) URL(scheme string) string {
+	return scheme + "://" + b.listener.Addr().String()
+}
+
+func (b *mockBroker) Connects() []*packets.ConnectPacket {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]*packets.ConnectPacket{}, b.connects...)
+}
+
+// Return the last message published to the topic, nil if there was none
+func (b *mockBroker) Last(topic string) *packets.PublishPacket {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i := len(b.publishes) - 1; i >= 0; i-- {
+		if b.publishes[i].TopicName == topic {
+			return b.publishes[i]
+		}
+	}
+	return nil
+}
+
+// Wait until the payload was published to the topic
+func (b *mockBroker) WaitFor(t *testing.T, topic, payload string) *packets.PublishPacket {
+	t.Helper()
+	var msg *packets.PublishPacket
+	require.Eventually(t, func() bool {
+		msg = b.Last(topic)
+		return msg != nil && string(msg.Payload) == payload
+	}, 5*time.Second, 10*time.Millisecond, "Should publish %s to %s", payload, topic)
+	return msg
+}
+
+func newTestBroker(t *testing.T) *mockBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Should listen on tcp")
+	return newMockBroker(t, listener)
+}
+
+func TestValidateBroker(t *testing.T) {
+	tMatrix := []struct {
+		Broker string
+		Error  error
+	}{
+		{"tcp://localhost:1883", nil},
+		{"mqtt://localhost:1883", nil},
+		{"ssl://localhost:8883", nil},
+		{"mqtts://localhost:8883", nil},
+		{"wss://localhost/mqtt", nil},
+		{"", ErrMissingBroker{}},
+		{"localhost:1883", &ErrInvalidBroker{Broker: "localhost:1883"}},
+		{"http://localhost:1883", &ErrInvalidBroker{Broker: "http://localhost:1883"}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Broker, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, ValidateBroker(tCase.Broker))
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		c, err := NewClient("tcp://localhost:1883", WithInstance("testhost"))
+		require.NoError(t, err, "Should create client")
+
+		assert := assert.New(t)
+
+		assert.Equal("speedtest-exporter/testhost", c.topic)
+		assert.Equal("speedtest-exporter-testhost", c.clientID)
+		assert.Empty(c.discoveryPrefix, "Discovery should be disabled by default")
+		assert.Equal(byte(0), c.qos)
+		assert.False(c.retain)
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		tMatrix := []struct {
+			Name   string
+			Option ClientOption
+			Error  error
+		}{
+			{"Instance", WithInstance(""), ErrMissingInstance{}},
+			{"Topic", WithTopic(""), ErrMissingTopic{}},
+			{"Discovery", WithDiscovery(""), ErrMissingTopic{}},
+			{"QoS", WithQoS(3), &ErrInvalidQoS{QoS: 3}},
+		}
+		for _, tCase := range tMatrix {
+			t.Run(tCase.Name, func(t *testing.T) {
+				_, err := NewClient("tcp://localhost:1883", tCase.Option)
+				assert.Equal(t, tCase.Error, err)
+			})
+		}
+	})
+	t.Run("InvalidBroker", func(t *testing.T) {
+		_, err := NewClient("localhost:1883")
+		assert.Equal(t, &ErrInvalidBroker{Broker: "localhost:1883"}, err)
+	})
+}
+
+func TestPublish(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.username = "somebody"
+	broker.password = "secret"
+
+	c, err := NewClient(broker.URL("tcp"),
+		WithInstance("test host"),
+		WithCredentials("somebody", "secret"),
+		WithDiscovery(DefaultDiscoveryPrefix),
+		WithQoS(1),
+		WithRetain(true),
+	)
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.Run(), "Should start client")
+	t.Cleanup(c.Stop)
+	assert.Equal(t, ErrClientAlreadyRunning{}, c.Run(), "Should not start twice")
+
+	availability := "speedtest-exporter/test host/availability"
+
+	t.Run("Connect", func(t *testing.T) {
+		assert := assert.New(t)
+
+		msg := broker.WaitFor(t, availability, payloadOnline)
+		assert.True(msg.Retain, "Availability should be retained")
+
+		connects := broker.Connects()
+		require.Len(t, connects, 1)
+		assert.Equal("speedtest-exporter-test host", connects[0].ClientIdentifier)
+		assert.Equal("somebody", connects[0].Username)
+		assert.Equal("secret", string(connects[0].Password))
+		assert.True(connects[0].WillFlag, "Should set a last will")
+		assert.True(connects[0].WillRetain, "Last will should be retained")
+		assert.Equal(availability, connects[0].WillTopic)
+		assert.Equal(payloadOffline, string(connects[0].WillMessage))
+	})
+	t.Run("Discovery", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, topic := range []string{
+			"homeassistant/sensor/speedtest_test_host/download_mbps/config",
+			"homeassistant/sensor/speedtest_test_host/upload_mbps/config",
+			"homeassistant/sensor/speedtest_test_host/ping_ms/config",
+			"homeassistant/sensor/speedtest_test_host/jitter_ms/config",
+			"homeassistant/sensor/speedtest_test_host/packet_loss_percent/config",
+			"homeassistant/binary_sensor/speedtest_test_host/up/config",
+		} {
+			msg := broker.Last(topic)
+			if !assert.NotNil(msg, "Should publish discovery config to %s", topic) {
+				continue
+			}
+			assert.True(msg.Retain, "Discovery config should be retained")
+			assert.Equal(byte(1), msg.Qos)
+		}
+	})
+	t.Run("Result", func(t *testing.T) {
+		assert := assert.New(t)
+
+		result := speedtest.MockSpeedtestResult(time.Now().UnixMilli())
+		c.Publish(result)
+
+		msg := broker.WaitFor(t, "speedtest-exporter/test host/up", "1")
+		assert.True(msg.Retain, "Results should be retained")
+		for topic, payload := range map[string]string{
+			"download_mbps":       "876.53",
+			"upload_mbps":         "12.34",
+			"ping_ms":             "15",
+			"jitter_ms":           "0.5",
+			"packet_loss_percent": "0.25",
+			"data_used_mb":        "950.3079",
+		} {
+			broker.WaitFor(t, "speedtest-exporter/test host/"+topic, payload)
+		}
+		expected, err := result.MarshalJSON()
+		require.NoError(t, err)
+		broker.WaitFor(t, "speedtest-exporter/test host/result", string(expected))
+
+		c.Publish(speedtest.NewFailedSpeedtestResult())
+		broker.WaitFor(t, "speedtest-exporter/test host/up", "0")
+		assert.Equal("876.53", string(broker.Last("speedtest-exporter/test host/download_mbps").Payload), "Should keep the last measured values")
+
+		status := c.Status()
+		assert.True(status.Running)
+		assert.True(status.Connected)
+		assert.Empty(status.LastError)
+		assert.False(status.LastSuccess.IsZero())
+	})
+	t.Run("Stop", func(t *testing.T) {
+		c.Stop()
+
+		msg := broker.WaitFor(t, availability, payloadOffline)
+		assert.True(t, msg.Retain, "Availability should be retained")
+		assert.False(t, c.IsRunning(), "Should be stopped")
+	})
+}
+
+func TestPublishTLS(t *testing.T) {
+	// Reuse the certificate of httptest, which is valid for 127.0.0.1
+	server := httptest.NewUnstartedServer(nil)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: server.TLS.Certificates,
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err, "Should listen with tls")
+	broker := newMockBroker(t, listener)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	c, err := NewClient(broker.URL("ssl"), WithInstance("testhost"), WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.Run(), "Should start client")
+	t.Cleanup(c.Stop)
+
+	broker.WaitFor(t, "speedtest-exporter/testhost/availability", payloadOnline)
+	assert.Nil(t, broker.Last("homeassistant/binary_sensor/speedtest_testhost/up/config"), "Should not publish discovery when disabled")
+}
+
+func TestStatusWithoutBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Should listen on tcp")
+	url := "tcp://" + listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	c, err := NewClient(url, WithInstance("testhost"))
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.Run(), "Should start client")
+	t.Cleanup(c.Stop)
+
+	c.Publish(speedtest.NewFailedSpeedtestResult())
+
+	assert.Eventually(t, func() bool {
+		return c.Status().LastError == ErrNotConnected{}.Error()
+	}, 5*time.Second, 10*time.Millisecond, "Should report the failed publish")
+	assert.False(t, c.Status().Connected)
+}
@@ -0,0 +1,159 @@
+package mqtt
+
+import (
+	"encoding/json/v2"
+	"regexp"
+	"strconv"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/version"
+)
+
+const (
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	// Payloads of the availability topic, matching the defaults of Home Assistant
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// Home Assistant only allows these characters in node and object ids
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Entity created in Home Assistant for a state topic
+type sensor struct {
+	// Either sensor or binary_sensor
+	component   string
+	field       string
+	name        string
+	deviceClass string
+	unit        string
+	icon        string
+}
+
+var sensors = []sensor{
+	{component: "sensor", field: "download_mbps", name: "Download", deviceClass: "data_rate", unit: "Mbit/s", icon: "mdi:download"},
+	{component: "sensor", field: "upload_mbps", name: "Upload", deviceClass: "data_rate", unit: "Mbit/s", icon: "mdi:upload"},
+	{component: "sensor", field: "ping_ms", name: "Ping", deviceClass: "duration", unit: "ms", icon: "mdi:speedometer"},
+	{component: "sensor", field: "jitter_ms", name: "Jitter", deviceClass: "duration", unit: "ms", icon: "mdi:pulse"},
+	{component: "sensor", field: "packet_loss_percent", name: "Packet loss", unit: "%", icon: "mdi:close-network"},
+	{component: "binary_sensor", field: "up", name: "Up", deviceClass: "connectivity"},
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+// Payload of a Home Assistant discovery message
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	ObjectID          string          `json:"object_id"`
+	StateTopic        string          `json:"state_topic"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	Unit              string          `json:"unit_of_measurement,omitempty"`
+	Icon              string          `json:"icon,omitempty"`
+	PayloadOn         string          `json:"payload_on,omitempty"`
+	PayloadOff        string          `json:"payload_off,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+// A single MQTT message
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// Topic publishing the availability of the exporter, also used as last will
+func (c *Client) availabilityTopic() string {
+	return c.topic + "/availability"
+}
+
+// Create the discovery messages for all sensors.
+// They are always retained, so Home Assistant picks them up after a restart.
+func (c *Client) discoveryMessages() ([]message, error) {
+	nodeID := "speedtest_" + invalidIDChars.ReplaceAllString(c.instance, "_")
+	device := discoveryDevice{
+		Identifiers:  []string{nodeID},
+		Name:         "Speedtest " + c.instance,
+		Manufacturer: "speedtest-exporter",
+		Model:        "speedtest-exporter",
+		SWVersion:    version.BuildInfo().Version,
+	}
+
+	msgs := make([]message, 0, len(sensors))
+	for _, s := range sensors {
+		objectID := invalidIDChars.ReplaceAllString(s.field, "_")
+		cfg := discoveryConfig{
+			Name:              s.name,
+			UniqueID:          nodeID + "_" + objectID,
+			ObjectID:          nodeID + "_" + objectID,
+			StateTopic:        c.topic + "/" + s.field,
+			AvailabilityTopic: c.availabilityTopic(),
+			DeviceClass:       s.deviceClass,
+			Unit:              s.unit,
+			Icon:              s.icon,
+			Device:            device,
+		}
+		if s.component == "binary_sensor" {
+			cfg.PayloadOn = "1"
+			cfg.PayloadOff = "0"
+		} else {
+			cfg.StateClass = "measurement"
+		}
+
+		payload, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, message{
+			topic:   c.discoveryPrefix + "/" + s.component + "/" + nodeID + "/" + objectID + "/config",
+			payload: payload,
+			retain:  true,
+		})
+	}
+	return msgs, nil
+}
+
+// Create the messages for a result, the full result as json and a topic per field.
+// Failed results only update the result and up topics, so the sensors keep the last measured values.
+func (c *Client) resultMessages(result *speedtest.SpeedtestResult) ([]message, error) {
+	if c.anonymizeIP != nil {
+		result = result.WithClientIP(c.anonymizeIP(result.ClientIP()))
+	}
+	payload, err := result.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	msgs := []message{{topic: c.topic + "/result", payload: payload, retain: c.retain}}
+
+	fields := [][2]string{{"up", "0"}}
+	if result.Success() {
+		fields = [][2]string{
+			{"up", "1"},
+			{"download_mbps", formatFloat(result.DownloadSpeed())},
+			{"upload_mbps", formatFloat(result.UploadSpeed())},
+			{"ping_ms", formatFloat(result.Ping())},
+			{"jitter_ms", formatFloat(result.JitterLatency())},
+			{"data_used_mb", formatFloat(result.DataUsed())},
+		}
+		if packetLoss, ok := result.PacketLoss(); ok {
+			fields = append(fields, [2]string{"packet_loss_percent", formatFloat(packetLoss)})
+		}
+	}
+	for _, field := range fields {
+		msgs = append(msgs, message{topic: c.topic + "/" + field[0], payload: []byte(field[1]), retain: c.retain})
+	}
+	return msgs, nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,117 @@
+package mqtt
+
+import (
+	"encoding/json/v2"
+	"testing"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoveryMessages(t *testing.T) {
+	c, err := NewClient("tcp://localhost:1883", WithInstance("home.example"), WithTopic("home/speedtest"), WithDiscovery("ha"))
+	require.NoError(t, err, "Should create client")
+
+	msgs, err := c.discoveryMessages()
+	require.NoError(t, err, "Should create discovery messages")
+	require.Len(t, msgs, len(sensors), "Should create a message per sensor")
+
+	configs := make(map[string]discoveryConfig, len(msgs))
+	for _, msg := range msgs {
+		assert.True(t, msg.retain, "Discovery configs should be retained")
+		var cfg discoveryConfig
+		require.NoError(t, json.Unmarshal(msg.payload, &cfg), "Should be valid json")
+		configs[msg.topic] = cfg
+	}
+
+	t.Run("Sensor", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg, ok := configs["ha/sensor/speedtest_home_example/download_mbps/config"]
+		require.True(t, ok, "Should publish the download sensor")
+		assert.Equal("Download", cfg.Name)
+		assert.Equal("speedtest_home_example_download_mbps", cfg.UniqueID)
+		assert.Equal("home/speedtest/download_mbps", cfg.StateTopic)
+		assert.Equal("home/speedtest/availability", cfg.AvailabilityTopic)
+		assert.Equal("data_rate", cfg.DeviceClass)
+		assert.Equal("measurement", cfg.StateClass)
+		assert.Equal("Mbit/s", cfg.Unit)
+		assert.Equal([]string{"speedtest_home_example"}, cfg.Device.Identifiers)
+		assert.Equal("Speedtest home.example", cfg.Device.Name)
+	})
+	t.Run("BinarySensor", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg, ok := configs["ha/binary_sensor/speedtest_home_example/up/config"]
+		require.True(t, ok, "Should publish the up sensor")
+		assert.Equal("connectivity", cfg.DeviceClass)
+		assert.Equal("home/speedtest/up", cfg.StateTopic)
+		assert.Equal("1", cfg.PayloadOn)
+		assert.Equal("0", cfg.PayloadOff)
+		assert.Empty(cfg.StateClass, "Binary sensors have no state class")
+	})
+}
+
+func TestResultMessages(t *testing.T) {
+	c, err := NewClient("tcp://localhost:1883", WithInstance("testhost"))
+	require.NoError(t, err, "Should create client")
+
+	topics := func(msgs []message) []string {
+		res := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			res = append(res, msg.topic)
+		}
+		return res
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		// Created without a backend measuring packet loss
+		result := speedtest.NewSpeedtestResult(0.5, 15, 876.53, 12.34, 950.3, "1234", "example.org", "Foo Corp.", "127.0.0.1", 0)
+
+		msgs, err := c.resultMessages(result)
+		require.NoError(t, err, "Should create messages")
+
+		assert.Equal(t, []string{
+			"speedtest-exporter/testhost/result",
+			"speedtest-exporter/testhost/up",
+			"speedtest-exporter/testhost/download_mbps",
+			"speedtest-exporter/testhost/upload_mbps",
+			"speedtest-exporter/testhost/ping_ms",
+			"speedtest-exporter/testhost/jitter_ms",
+			"speedtest-exporter/testhost/data_used_mb",
+		}, topics(msgs), "Should omit packet loss when it was not measured")
+		assert.False(t, msgs[0].retain, "Should not retain by default")
+	})
+	t.Run("AnonymizeIP", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c, err := NewClient("tcp://localhost:1883", WithInstance("testhost"), WithIPAnonymizer(func(ip string) string {
+			return "anonymized-" + ip
+		}))
+		require.NoError(t, err, "Should create client")
+		result := speedtest.MockSpeedtestResult(1000)
+
+		msgs, err := c.resultMessages(result)
+		require.NoError(t, err, "Should create messages")
+
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(msgs[0].payload, &payload), "Should be valid json")
+		assert.Equal("anonymized-127.0.0.1", payload["client_ip"], "Should publish the converted IP")
+		assert.Equal("127.0.0.1", result.ClientIP(), "Should not modify the result")
+
+		c.anonymizeIP = func(string) string { return "" }
+		msgs, err = c.resultMessages(result)
+		require.NoError(t, err, "Should create messages")
+		payload = nil
+		require.NoError(t, json.Unmarshal(msgs[0].payload, &payload), "Should be valid json")
+		assert.NotContains(payload, "client_ip", "Should omit a dropped IP")
+	})
+	t.Run("Failed", func(t *testing.T) {
+		msgs, err := c.resultMessages(speedtest.NewFailedSpeedtestResult())
+		require.NoError(t, err, "Should create messages")
+
+		assert.Equal(t, []string{"speedtest-exporter/testhost/result", "speedtest-exporter/testhost/up"}, topics(msgs))
+		assert.Equal(t, "0", string(msgs[1].payload))
+	})
+}
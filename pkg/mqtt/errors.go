@@ -0,0 +1,57 @@
+package mqtt
+
+import "strconv"
+
+type ErrMissingBroker struct{}
+
+func (e ErrMissingBroker) Error() string {
+	return "No broker for the MQTT output provided"
+}
+
+type ErrInvalidBroker struct {
+	Broker string
+}
+
+func (e *ErrInvalidBroker) Error() string {
+	return "Invalid MQTT broker \"" + e.Broker + "\", needs to be a tcp, mqtt, ssl, tls, mqtts, ws or wss url"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrMissingTopic struct{}
+
+func (e ErrMissingTopic) Error() string {
+	return "The MQTT topic can't be empty"
+}
+
+type ErrInvalidQoS struct {
+	QoS byte
+}
+
+func (e *ErrInvalidQoS) Error() string {
+	return "Invalid MQTT QoS " + strconv.Itoa(int(e.QoS)) + ", needs to be 0, 1 or 2"
+}
+
+type ErrClientAlreadyRunning struct{}
+
+func (e ErrClientAlreadyRunning) Error() string {
+	return "Only a single instance of the client can run at a time"
+}
+
+type ErrNotConnected struct{}
+
+func (e ErrNotConnected) Error() string {
+	return "Not connected to the MQTT broker"
+}
+
+type ErrPublishTimeout struct {
+	Topic string
+}
+
+func (e *ErrPublishTimeout) Error() string {
+	return "Timed out publishing to " + e.Topic
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"time"
+)
+
+// Colors of the messages, by type of the event
+const (
+	colorBreach   = 0xE01E5A
+	colorRecovery = 0x2EB67D
+	colorTest     = 0x36C5F0
+)
+
+// Message for Slack-compatible incoming webhooks, see https://api.slack.com/messaging/webhooks
+type slackMessage struct {
+	// Shown in notifications, the attachment is shown in the channel
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color string `json:"color"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// Unix timestamp shown in the footer
+	Timestamp int64 `json:"ts"`
+}
+
+// Message for Discord webhooks, see https://discord.com/developers/docs/resources/webhook#execute-webhook
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// NewSlack creates a channel sending the events to a Slack-compatible incoming webhook,
+// e.g. Slack, Mattermost or Rocket.Chat.
+// Parameters:
+//   - webhookURL: Url of the incoming webhook
+//   - opts: optional webhook options
+func NewSlack(webhookURL string, opts ...WebhookOption) (*Webhook, error) {
+	w, err := newWebhook(webhookURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	w.format = func(event Event) ([]byte, error) {
+		return json.Marshal(slackMessage{
+			Text: formatTitle(event),
+			Attachments: []slackAttachment{{
+				Color:     fmt.Sprintf("#%06X", eventColor(event)),
+				Title:     formatTitle(event),
+				Text:      formatText(event),
+				Timestamp: event.Time.Unix(),
+			}},
+		})
+	}
+	return w, nil
+}
+
+// NewDiscord creates a channel sending the events to a Discord webhook.
+// Parameters:
+//   - webhookURL: Url of the webhook
+//   - opts: optional webhook options
+func NewDiscord(webhookURL string, opts ...WebhookOption) (*Webhook, error) {
+	w, err := newWebhook(webhookURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	w.format = func(event Event) ([]byte, error) {
+		return json.Marshal(discordMessage{
+			Embeds: []discordEmbed{{
+				Title:       formatTitle(event),
+				Description: formatText(event),
+				Color:       eventColor(event),
+				Timestamp:   event.Time.UTC().Format(time.RFC3339),
+			}},
+		})
+	}
+	return w, nil
+}
+
+// Color of the message, failed speedtests are shown like breaches
+func eventColor(event Event) int {
+	switch event.Type {
+	case EventBreach:
+		return colorBreach
+	case EventRecovery:
+		return colorRecovery
+	default:
+		if event.Result != nil && !event.Result.Success() {
+			return colorBreach
+		}
+		return colorTest
+	}
+}
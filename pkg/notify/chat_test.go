@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"encoding/json/v2"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackSend(t *testing.T) {
+	m := newMockWebhook(t)
+	w, err := NewSlack(m.server.URL)
+	require.NoError(t, err)
+
+	event := newTestEvent()
+	require.NoError(t, w.Send(context.Background(), event))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+
+	var msg slackMessage
+	require.NoError(t, json.Unmarshal(requests[0].Body, &msg))
+
+	assert := assert.New(t)
+	assert.Equal("Download speed breached on testhost", msg.Text)
+	require.Len(t, msg.Attachments, 1)
+	assert.Equal("#E01E5A", msg.Attachments[0].Color)
+	assert.Equal(msg.Text, msg.Attachments[0].Title)
+	assert.Equal(formatText(event), msg.Attachments[0].Text)
+	assert.Equal(event.Time.Unix(), msg.Attachments[0].Timestamp)
+}
+
+func TestDiscordSend(t *testing.T) {
+	m := newMockWebhook(t)
+	w, err := NewDiscord(m.server.URL)
+	require.NoError(t, err)
+
+	event := newTestEvent()
+	event.Type = EventTest
+	require.NoError(t, w.Send(context.Background(), event))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+
+	var msg discordMessage
+	require.NoError(t, json.Unmarshal(requests[0].Body, &msg))
+
+	assert := assert.New(t)
+	require.Len(t, msg.Embeds, 1)
+	assert.Equal("Speedtest on testhost", msg.Embeds[0].Title)
+	assert.Equal(formatText(event), msg.Embeds[0].Description)
+	assert.Equal(colorTest, msg.Embeds[0].Color)
+	assert.Equal(event.Time.UTC().Format(time.RFC3339), msg.Embeds[0].Timestamp)
+
+	t.Run("InvalidURL", func(t *testing.T) {
+		_, err := NewDiscord("discord.com/api/webhooks/1/token")
+		assert.Equal(&ErrInvalidURL{URL: "discord.com/api/webhooks/1/token"}, err)
+	})
+}
+
+func TestEventColor(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(colorBreach, eventColor(Event{Type: EventBreach}))
+	assert.Equal(colorRecovery, eventColor(Event{Type: EventRecovery}))
+	assert.Equal(colorTest, eventColor(Event{Type: EventTest, Result: newTestResult(100, 10)}))
+	assert.Equal(colorBreach, eventColor(Event{Type: EventTest, Result: speedtest.NewFailedSpeedtestResult()}), "Should show failed tests like breaches")
+}
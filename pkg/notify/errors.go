@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"strconv"
+	"time"
+)
+
+type ErrMissingURL struct{}
+
+func (e ErrMissingURL) Error() string {
+	return "No url for the webhook provided"
+}
+
+type ErrInvalidURL struct {
+	URL string
+}
+
+func (e *ErrInvalidURL) Error() string {
+	return "Invalid webhook url \"" + e.URL + "\", needs to be a http or https url"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrMissingChannel struct{}
+
+func (e ErrMissingChannel) Error() string {
+	return "No notification channel provided"
+}
+
+type ErrInvalidEvent struct {
+	Event string
+}
+
+func (e *ErrInvalidEvent) Error() string {
+	return "Invalid event \"" + e.Event + "\", needs to be one of test, breach or recovery"
+}
+
+type ErrInvalidThreshold struct {
+	Name  string
+	Value float64
+}
+
+func (e *ErrInvalidThreshold) Error() string {
+	return "Invalid threshold for " + e.Name + ": " + strconv.FormatFloat(e.Value, 'f', -1, 64) + ", can't be negative"
+}
+
+type ErrInvalidHysteresis struct {
+	Hysteresis float64
+}
+
+func (e *ErrInvalidHysteresis) Error() string {
+	return "Invalid hysteresis " + strconv.FormatFloat(e.Hysteresis, 'f', -1, 64) + "%, needs to be between 0 and 100"
+}
+
+type ErrInvalidCooldown struct {
+	Cooldown time.Duration
+}
+
+func (e *ErrInvalidCooldown) Error() string {
+	return "Invalid cooldown " + e.Cooldown.String() + ", can't be negative"
+}
+
+type ErrInvalidTimeout struct {
+	Timeout time.Duration
+}
+
+func (e *ErrInvalidTimeout) Error() string {
+	return "Invalid timeout " + e.Timeout.String() + ", needs to be greater than 0"
+}
+
+type ErrInvalidRetries struct {
+	Retries int
+}
+
+func (e *ErrInvalidRetries) Error() string {
+	return "Invalid number of retries " + strconv.Itoa(e.Retries) + ", can't be negative"
+}
+
+type ErrMissingTopic struct{}
+
+func (e ErrMissingTopic) Error() string {
+	return "No ntfy topic provided"
+}
+
+type ErrMissingToken struct{}
+
+func (e ErrMissingToken) Error() string {
+	return "No Gotify application token provided"
+}
+
+type ErrInvalidPriority struct {
+	Priority int
+	Max      int
+}
+
+func (e *ErrInvalidPriority) Error() string {
+	if e.Max > 0 {
+		return "Invalid priority " + strconv.Itoa(e.Priority) + ", needs to be between 1 and " + strconv.Itoa(e.Max)
+	}
+	return "Invalid priority " + strconv.Itoa(e.Priority) + ", can't be negative"
+}
+
+type ErrReservedHeader struct {
+	Name string
+}
+
+func (e *ErrReservedHeader) Error() string {
+	return "Header \"" + e.Name + "\" is set by the webhook and can't be overwritten"
+}
+
+type ErrInvalidTemplate struct {
+	Err error
+}
+
+func (e *ErrInvalidTemplate) Error() string {
+	return "Invalid payload template: " + e.Err.Error()
+}
+
+func (e *ErrInvalidTemplate) Unwrap() error {
+	return e.Err
+}
+
+type ErrInvalidPayload struct{}
+
+func (e ErrInvalidPayload) Error() string {
+	return "The payload template did not produce valid json"
+}
+
+type ErrUnexpectedStatus struct {
+	Status int
+}
+
+func (e *ErrUnexpectedStatus) Error() string {
+	return "Webhook responded with unexpected status " + strconv.Itoa(e.Status)
+}
+
+type ErrNotifierAlreadyRunning struct{}
+
+func (e ErrNotifierAlreadyRunning) Error() string {
+	return "Only a single instance of the notifier can run at a time"
+}
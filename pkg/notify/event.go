@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"slices"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Types of events a notification is sent for
+const (
+	// Sent after every completed speedtest, successful or not
+	EventTest = "test"
+	// Sent when a threshold is breached
+	EventBreach = "breach"
+	// Sent when a breached threshold is met again
+	EventRecovery = "recovery"
+)
+
+// Conditions that can be breached, see Thresholds
+const (
+	ConditionDownload = "download"
+	ConditionUpload   = "upload"
+	ConditionLatency  = "latency"
+	ConditionFailures = "failures"
+)
+
+// All event types, in the order they are documented
+var Events = []string{EventTest, EventBreach, EventRecovery}
+
+// Event that triggers a notification
+type Event struct {
+	// One of test, breach or recovery
+	Type string
+	// The breached or recovered condition, empty for test events
+	Condition string
+	// Name of the exporter instance that sent the event
+	Instance string
+	// Time of the speedtest that caused the event
+	Time time.Time
+	// Measured value of the condition, e.g. the download speed in Mbit/s or the number of failed tests
+	Value float64
+	// Threshold of the condition
+	Threshold float64
+	// Human readable description of the event
+	Message string
+	// Result of the speedtest that caused the event
+	Result *speedtest.SpeedtestResult
+	// Contracted speeds of the connection
+	Contract Contract
+}
+
+// Verify that all given events are known
+func ValidateEvents(events []string) error {
+	for _, event := range events {
+		if !slices.Contains(Events, event) {
+			return &ErrInvalidEvent{Event: event}
+		}
+	}
+	return nil
+}
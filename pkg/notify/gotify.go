@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"encoding/json/v2"
+	"net/url"
+)
+
+const (
+	gotifyMaxPriority = 10
+	gotifyTokenHeader = "X-Gotify-Key"
+)
+
+// Message created via the Gotify api, see https://gotify.net/docs/pushmsg
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// NewGotify creates a channel sending the events as messages to a Gotify server.
+// Parameters:
+//   - serverURL: Url of the Gotify server, e.g. https://gotify.example.org
+//   - token: Token of the application the messages are sent as
+//   - opts: optional webhook options, the priority needs to be between 1 and 10
+func NewGotify(serverURL, token string, opts ...WebhookOption) (*Webhook, error) {
+	if token == "" {
+		return nil, ErrMissingToken{}
+	}
+	err := ValidateURL(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	messageURL, err := url.JoinPath(serverURL, "message")
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWebhook(messageURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if w.priority > gotifyMaxPriority {
+		return nil, &ErrInvalidPriority{Priority: w.priority, Max: gotifyMaxPriority}
+	}
+
+	w.typeHeaders = map[string]string{gotifyTokenHeader: token}
+	w.format = func(event Event) ([]byte, error) {
+		return json.Marshal(gotifyMessage{
+			Title:    formatTitle(event),
+			Message:  formatText(event),
+			Priority: w.eventPriority(event, 2, 8, 5),
+		})
+	}
+	return w, nil
+}
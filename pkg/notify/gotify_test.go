@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"encoding/json/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGotify(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		URL   string
+		Token string
+		Opts  []WebhookOption
+		Error error
+	}{
+		{"Minimal", "https://gotify.example.org", "token", nil, nil},
+		{"Priority", "https://gotify.example.org", "token", []WebhookOption{WithPriority(10)}, nil},
+		{"MissingToken", "https://gotify.example.org", "", nil, ErrMissingToken{}},
+		{"MissingURL", "", "token", nil, ErrMissingURL{}},
+		{"PriorityTooHigh", "https://gotify.example.org", "token", []WebhookOption{WithPriority(11)}, &ErrInvalidPriority{Priority: 11, Max: 10}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			_, err := NewGotify(tCase.URL, tCase.Token, tCase.Opts...)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+}
+
+func TestGotifySend(t *testing.T) {
+	m := newMockWebhook(t)
+	w, err := NewGotify(m.server.URL+"/gotify/", "token", WithHeaders(map[string]string{"X-Gotify-Key": "overwritten"}))
+	require.NoError(t, err)
+	assert.Equal(t, m.server.URL+"/gotify/message", w.url, "Should post to the message api")
+
+	event := newTestEvent()
+	event.Type = EventRecovery
+	require.NoError(t, w.Send(context.Background(), event))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+
+	assert := assert.New(t)
+	assert.Equal("token", requests[0].Header.Get("X-Gotify-Key"), "Should authenticate with the application token")
+
+	var msg gotifyMessage
+	require.NoError(t, json.Unmarshal(requests[0].Body, &msg))
+	assert.Equal("Download speed recovered on testhost", msg.Title)
+	assert.Contains(msg.Message, "Server: speedtest.example.org")
+	assert.Equal(5, msg.Priority)
+}
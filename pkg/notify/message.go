@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Contracted speeds of the connection, the messages compare the results against them.
+// A value of 0 omits the comparison.
+type Contract struct {
+	// Contracted download speed in Mbit/s
+	Download float64
+	// Contracted upload speed in Mbit/s
+	Upload float64
+	// Maximum contracted ping in ms
+	Latency float64
+}
+
+// Short summary of the event, used as title of the message
+func formatTitle(event Event) string {
+	switch event.Type {
+	case EventBreach:
+		return fmt.Sprintf("%s breached on %s", conditionName(event.Condition), event.Instance)
+	case EventRecovery:
+		return fmt.Sprintf("%s recovered on %s", conditionName(event.Condition), event.Instance)
+	default:
+		if event.Result != nil && !event.Result.Success() {
+			return "Speedtest failed on " + event.Instance
+		}
+		return "Speedtest on " + event.Instance
+	}
+}
+
+// Human readable message of the event.
+// Contains the download and upload speed compared to the contract, the ping, the server and the ISP,
+// unless the speedtest failed.
+func formatText(event Event) string {
+	result := event.Result
+	if result == nil || !result.Success() {
+		return event.Message
+	}
+
+	lines := []string{
+		event.Message,
+		"Download: " + formatSpeed(result.DownloadSpeed(), event.Contract.Download),
+		"Upload: " + formatSpeed(result.UploadSpeed(), event.Contract.Upload),
+	}
+	ping := fmt.Sprintf("Ping: %.2f ms", result.Ping())
+	if event.Contract.Latency > 0 {
+		ping += fmt.Sprintf(" (contracted %.2f ms)", event.Contract.Latency)
+	}
+	lines = append(lines, ping)
+
+	server := result.ServerHost()
+	if location := result.ServerLocation(); location != "" {
+		server += " (" + location + ")"
+	}
+	if server != "" {
+		lines = append(lines, "Server: "+server)
+	}
+	if isp := result.ClientISP(); isp != "" {
+		lines = append(lines, "ISP: "+isp)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Format the speed, including the share of the contracted speed if known
+func formatSpeed(speed, contracted float64) string {
+	if contracted <= 0 {
+		return fmt.Sprintf("%.2f Mbit/s", speed)
+	}
+	return fmt.Sprintf("%.2f Mbit/s (%.0f%% of %.2f Mbit/s contracted)", speed, speed/contracted*100, contracted)
+}
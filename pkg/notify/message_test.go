@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatTitle(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Event Event
+		Title string
+	}{
+		{"Test", Event{Type: EventTest, Instance: "testhost", Result: newTestResult(100, 10)}, "Speedtest on testhost"},
+		{"FailedTest", Event{Type: EventTest, Instance: "testhost", Result: speedtest.NewFailedSpeedtestResult()}, "Speedtest failed on testhost"},
+		{"Breach", Event{Type: EventBreach, Condition: ConditionDownload, Instance: "testhost"}, "Download speed breached on testhost"},
+		{"Recovery", Event{Type: EventRecovery, Condition: ConditionLatency, Instance: "testhost"}, "Latency recovered on testhost"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Title, formatTitle(tCase.Event))
+		})
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	event := Event{
+		Message: "Download speed on testhost breached the threshold",
+		Result:  newTestResult(80, 12.5),
+	}
+
+	t.Run("WithoutContract", func(t *testing.T) {
+		assert.Equal(t, "Download speed on testhost breached the threshold\n"+
+			"Download: 80.00 Mbit/s\n"+
+			"Upload: 50.00 Mbit/s\n"+
+			"Ping: 12.50 ms\n"+
+			"Server: speedtest.example.org\n"+
+			"ISP: ISP", formatText(event))
+	})
+	t.Run("WithContract", func(t *testing.T) {
+		event := event
+		event.Contract = Contract{Download: 100, Upload: 40, Latency: 20}
+
+		assert.Equal(t, "Download speed on testhost breached the threshold\n"+
+			"Download: 80.00 Mbit/s (80% of 100.00 Mbit/s contracted)\n"+
+			"Upload: 50.00 Mbit/s (125% of 40.00 Mbit/s contracted)\n"+
+			"Ping: 12.50 ms (contracted 20.00 ms)\n"+
+			"Server: speedtest.example.org\n"+
+			"ISP: ISP", formatText(event))
+	})
+	t.Run("FailedTest", func(t *testing.T) {
+		event := Event{Message: "Speedtest on testhost failed", Result: speedtest.NewFailedSpeedtestResult()}
+		assert.Equal(t, "Speedtest on testhost failed", formatText(event), "Should only contain the message")
+	})
+}
@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+)
+
+const (
+	DefaultCooldown = time.Hour
+
+	// Results waiting to be evaluated, newer results are dropped when the queue is full
+	queueSize = 16
+)
+
+// Channel delivers events to a notification service
+type Channel interface {
+	// Name of the channel, used in logs and the health status
+	Name() string
+	// Returns true if events of the given type should be sent to the channel
+	Accepts(eventType string) bool
+	// Send the event, retries are handled by the channel
+	Send(ctx context.Context, event Event) error
+}
+
+// Notifier evaluates completed speedtests against the thresholds and sends the resulting events to the channels
+type Notifier struct {
+	instance string
+	contract Contract
+	channels []Channel
+	tracker  *tracker
+
+	results chan *speedtest.SpeedtestResult
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+
+	// Status of the channels, same order as channels
+	status     []ChannelStatus
+	statusLock sync.RWMutex
+}
+
+// Status of the notifier, used for health reporting
+type Status struct {
+	// True while the notifier is running in the background
+	Running bool
+	// Status of every channel, in the order they were added
+	Channels []ChannelStatus
+}
+
+// Status of a single channel
+type ChannelStatus struct {
+	Name string
+	// Time of the last successful notification, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last notification, empty if it was successful
+	LastError string
+}
+
+type NotifierOption func(*Notifier) error
+
+// WithInstance sets the instance included in the events.
+// By default the hostname of the machine is used.
+func WithInstance(instance string) NotifierOption {
+	return func(n *Notifier) error {
+		if instance == "" {
+			return ErrMissingInstance{}
+		}
+		n.instance = instance
+		return nil
+	}
+}
+
+// WithContract sets the contracted speeds, which the results in the messages are compared to.
+func WithContract(contract Contract) NotifierOption {
+	return func(n *Notifier) error {
+		n.contract = contract
+		return nil
+	}
+}
+
+// WithThresholds sets the thresholds that cause breach and recovery events.
+// By default only test events are sent.
+func WithThresholds(thresholds Thresholds) NotifierOption {
+	return func(n *Notifier) error {
+		err := thresholds.Validate()
+		if err != nil {
+			return err
+		}
+		n.tracker.thresholds = thresholds
+		return nil
+	}
+}
+
+// WithCooldown sets the minimum time between two breach events of the same condition, defaults to DefaultCooldown.
+// Breaches during the cooldown are not notified and neither is their recovery.
+func WithCooldown(cooldown time.Duration) NotifierOption {
+	return func(n *Notifier) error {
+		if cooldown < 0 {
+			return &ErrInvalidCooldown{Cooldown: cooldown}
+		}
+		n.tracker.cooldown = cooldown
+		return nil
+	}
+}
+
+// WithChannel adds a channel the events are sent to.
+func WithChannel(channel Channel) NotifierOption {
+	return func(n *Notifier) error {
+		if channel == nil {
+			return ErrMissingChannel{}
+		}
+		n.channels = append(n.channels, channel)
+		return nil
+	}
+}
+
+// NewNotifier creates a new notifier, it needs at least one channel.
+func NewNotifier(opts ...NotifierOption) (*Notifier, error) {
+	n := &Notifier{
+		instance: utils.Hostname(),
+		tracker:  newTracker(Thresholds{}, DefaultCooldown),
+		results:  make(chan *speedtest.SpeedtestResult, queueSize),
+	}
+	for _, opt := range opts {
+		err := opt(n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(n.channels) == 0 {
+		return nil, ErrMissingChannel{}
+	}
+	n.status = make([]ChannelStatus, len(n.channels))
+	for i, channel := range n.channels {
+		n.status[i].Name = channel.Name()
+	}
+	return n, nil
+}
+
+// Queue the result for evaluation.
+// Does not block, so it can be called while the speedtest lock is held.
+func (n *Notifier) Notify(result *speedtest.SpeedtestResult) {
+	if result == nil {
+		return
+	}
+	select {
+	case n.results <- result:
+	default:
+		slog.Warn("Notification queue is full, dropping result", slog.String("runID", result.RunID()))
+	}
+}
+
+// Evaluate the result and send the events to the channels accepting them.
+// The channels are notified in parallel, so a slow channel does not delay the others.
+func (n *Notifier) handleResult(ctx context.Context, result *speedtest.SpeedtestResult) {
+	events := n.tracker.evaluate(result, n.instance, time.Now())
+	for i := range events {
+		events[i].Contract = n.contract
+	}
+
+	var wg sync.WaitGroup
+	for i, channel := range n.channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, event := range events {
+				if !channel.Accepts(event.Type) {
+					continue
+				}
+				err := channel.Send(ctx, event)
+				n.setStatus(i, err)
+				if err != nil {
+					slog.Error("Failed to send notification", slog.String("channel", channel.Name()), slog.String("event", event.Type), "err", err)
+				} else {
+					slog.Debug("Sent notification", slog.String("channel", channel.Name()), slog.String("event", event.Type), slog.String("condition", event.Condition))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Record the outcome of a notification for health reporting
+func (n *Notifier) setStatus(channel int, err error) {
+	n.statusLock.Lock()
+	defer n.statusLock.Unlock()
+
+	status := &n.status[channel]
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	} else {
+		status.LastSuccess = time.Now()
+	}
+}
+
+// Evaluate the queued results and send the notifications.
+// Runs as a background goroutine and does not block the calling thread.
+func (n *Notifier) Run() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.cancel != nil {
+		return ErrNotifierAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.done = make(chan struct{})
+
+	go func() {
+		defer close(n.done)
+
+		slog.Debug("Starting notifier")
+		for {
+			select {
+			case result := <-n.results:
+				n.handleResult(ctx, result)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Returns true if the notifier is currently running
+func (n *Notifier) IsRunning() bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.cancel != nil
+}
+
+// Return the current status of the notifier
+func (n *Notifier) Status() Status {
+	status := Status{Running: n.IsRunning()}
+
+	n.statusLock.RLock()
+	defer n.statusLock.RUnlock()
+	status.Channels = append([]ChannelStatus(nil), n.status...)
+	return status
+}
+
+// Stop the notifier and wait for the background goroutine to exit.
+// Notifications in progress are cancelled, queued results are kept for Flush.
+// Does nothing if the notifier is not running.
+func (n *Notifier) Stop() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.cancel == nil {
+		return
+	}
+
+	n.cancel()
+	<-n.done
+	n.cancel = nil
+	slog.Info("Stopped notifier")
+}
+
+// Send the notifications for the queued results, e.g. the final result before shutting down.
+// Should only be called when the notifier is not running.
+func (n *Notifier) Flush(ctx context.Context) {
+	for len(n.results) > 0 && ctx.Err() == nil {
+		n.handleResult(ctx, <-n.results)
+	}
+}
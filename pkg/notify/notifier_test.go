@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Channel recording all events it receives
+type mockChannel struct {
+	name   string
+	events []string
+	err    error
+
+	received []Event
+	lock     sync.Mutex
+}
+
+func (m *mockChannel) Name() string {
+	return m.name
+}
+
+func (m *mockChannel) Accepts(eventType string) bool {
+	return len(m.events) == 0 || eventType == m.events[0]
+}
+
+func (m *mockChannel) Send(_ context.Context, event Event) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.received = append(m.received, event)
+	return m.err
+}
+
+func (m *mockChannel) Received() []Event {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Event(nil), m.received...)
+}
+
+func TestNewNotifier(t *testing.T) {
+	channel := &mockChannel{name: "mock"}
+
+	tMatrix := []struct {
+		Name  string
+		Opts  []NotifierOption
+		Error error
+	}{
+		{"Minimal", []NotifierOption{WithChannel(channel)}, nil},
+		{"AllOptions", []NotifierOption{WithChannel(channel), WithInstance("testhost"), WithThresholds(Thresholds{Download: 100}), WithCooldown(0), WithContract(Contract{Download: 100})}, nil},
+		{"MissingChannel", nil, ErrMissingChannel{}},
+		{"NilChannel", []NotifierOption{WithChannel(nil)}, ErrMissingChannel{}},
+		{"MissingInstance", []NotifierOption{WithChannel(channel), WithInstance("")}, ErrMissingInstance{}},
+		{"InvalidThresholds", []NotifierOption{WithChannel(channel), WithThresholds(Thresholds{Hysteresis: 200})}, &ErrInvalidHysteresis{Hysteresis: 200}},
+		{"InvalidCooldown", []NotifierOption{WithChannel(channel), WithCooldown(-time.Second)}, &ErrInvalidCooldown{Cooldown: -time.Second}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			_, err := NewNotifier(tCase.Opts...)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	all := &mockChannel{name: "all"}
+	breaches := &mockChannel{name: "breaches", events: []string{EventBreach}, err: errors.New("failed")}
+
+	contract := Contract{Download: 100, Upload: 40, Latency: 20}
+	n, err := NewNotifier(WithChannel(all), WithChannel(breaches), WithInstance("testhost"), WithThresholds(Thresholds{Download: 100}), WithContract(contract))
+	require.NoError(t, err)
+
+	require.NoError(t, n.Run())
+	t.Cleanup(n.Stop)
+	assert.Equal(ErrNotifierAlreadyRunning{}, n.Run())
+	assert.True(n.IsRunning())
+
+	n.Notify(nil)
+	n.Notify(newTestResult(50, 10))
+
+	assert.Eventually(func() bool {
+		return len(all.Received()) == 2 && len(breaches.Received()) == 1
+	}, time.Second, 10*time.Millisecond, "Should send the events to the channels accepting them")
+
+	received := all.Received()
+	assert.Equal(EventTest, received[0].Type)
+	assert.Equal(EventBreach, received[1].Type)
+	assert.Equal("testhost", received[1].Instance)
+	assert.Equal(contract, received[1].Contract, "Should add the contract to the events")
+
+	status := n.Status()
+	assert.True(status.Running)
+	require.Len(t, status.Channels, 2)
+	assert.Equal("all", status.Channels[0].Name)
+	assert.False(status.Channels[0].LastSuccess.IsZero())
+	assert.Empty(status.Channels[0].LastError)
+	assert.Equal("breaches", status.Channels[1].Name)
+	assert.True(status.Channels[1].LastSuccess.IsZero())
+	assert.Equal("failed", status.Channels[1].LastError)
+
+	n.Stop()
+	assert.False(n.IsRunning())
+	assert.False(n.Status().Running)
+}
+
+func TestNotifierFlush(t *testing.T) {
+	channel := &mockChannel{name: "mock"}
+	n, err := NewNotifier(WithChannel(channel))
+	require.NoError(t, err)
+
+	n.Notify(newTestResult(50, 10))
+	n.Notify(speedtest.NewFailedSpeedtestResult())
+	assert.Empty(t, channel.Received(), "Should not send while not running")
+
+	n.Flush(context.Background())
+	assert.Len(t, channel.Received(), 2, "Should send the queued results")
+}
+
+func TestNotifierQueueFull(t *testing.T) {
+	channel := &mockChannel{name: "mock"}
+	n, err := NewNotifier(WithChannel(channel))
+	require.NoError(t, err)
+
+	for range queueSize + 1 {
+		n.Notify(newTestResult(50, 10))
+	}
+	n.Flush(context.Background())
+	assert.Len(t, channel.Received(), queueSize, "Should drop results when the queue is full")
+}
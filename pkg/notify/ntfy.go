@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"encoding/json/v2"
+)
+
+const (
+	DefaultNtfyURL = "https://ntfy.sh"
+
+	ntfyMaxPriority = 5
+)
+
+// Message published via the ntfy json api, see https://docs.ntfy.sh/publish/#publish-as-json
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// NewNtfy creates a channel publishing the events to a ntfy topic.
+// Use WithBearerToken for servers that require an access token.
+// Parameters:
+//   - serverURL: Url of the ntfy server, e.g. https://ntfy.sh
+//   - topic: Topic the messages are published to
+//   - opts: optional webhook options, the priority needs to be between 1 and 5
+func NewNtfy(serverURL, topic string, opts ...WebhookOption) (*Webhook, error) {
+	if topic == "" {
+		return nil, ErrMissingTopic{}
+	}
+	w, err := newWebhook(serverURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if w.priority > ntfyMaxPriority {
+		return nil, &ErrInvalidPriority{Priority: w.priority, Max: ntfyMaxPriority}
+	}
+
+	w.format = func(event Event) ([]byte, error) {
+		return json.Marshal(ntfyMessage{
+			Topic:    topic,
+			Title:    formatTitle(event),
+			Message:  formatText(event),
+			Priority: w.eventPriority(event, 2, 4, 3),
+			Tags:     []string{ntfyTag(event)},
+		})
+	}
+	return w, nil
+}
+
+// Returns the configured priority, or the default for the type of the event
+func (w *Webhook) eventPriority(event Event, test, breach, recovery int) int {
+	if w.priority > 0 {
+		return w.priority
+	}
+	switch event.Type {
+	case EventBreach:
+		return breach
+	case EventRecovery:
+		return recovery
+	default:
+		if event.Result != nil && !event.Result.Success() {
+			return breach
+		}
+		return test
+	}
+}
+
+// Emoji shown in front of the title
+func ntfyTag(event Event) string {
+	switch event.Type {
+	case EventBreach:
+		return "warning"
+	case EventRecovery:
+		return "white_check_mark"
+	default:
+		if event.Result != nil && !event.Result.Success() {
+			return "x"
+		}
+		return "signal_strength"
+	}
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"encoding/json/v2"
+	"testing"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNtfy(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		URL   string
+		Topic string
+		Opts  []WebhookOption
+		Error error
+	}{
+		{"Minimal", DefaultNtfyURL, "speedtest", nil, nil},
+		{"Priority", DefaultNtfyURL, "speedtest", []WebhookOption{WithPriority(5)}, nil},
+		{"MissingTopic", DefaultNtfyURL, "", nil, ErrMissingTopic{}},
+		{"InvalidURL", "ntfy.sh", "speedtest", nil, &ErrInvalidURL{URL: "ntfy.sh"}},
+		{"PriorityTooHigh", DefaultNtfyURL, "speedtest", []WebhookOption{WithPriority(6)}, &ErrInvalidPriority{Priority: 6, Max: 5}},
+		{"NegativePriority", DefaultNtfyURL, "speedtest", []WebhookOption{WithPriority(-1)}, &ErrInvalidPriority{Priority: -1}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			_, err := NewNtfy(tCase.URL, tCase.Topic, tCase.Opts...)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+}
+
+func TestNtfySend(t *testing.T) {
+	m := newMockWebhook(t)
+	w, err := NewNtfy(m.server.URL, "speedtest", WithBearerToken("tk_token"))
+	require.NoError(t, err)
+
+	event := newTestEvent()
+	event.Contract = Contract{Download: 100}
+	require.NoError(t, w.Send(context.Background(), event))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+
+	assert := assert.New(t)
+	assert.Equal("Bearer tk_token", requests[0].Header.Get("Authorization"))
+
+	var msg ntfyMessage
+	require.NoError(t, json.Unmarshal(requests[0].Body, &msg))
+	assert.Equal("speedtest", msg.Topic)
+	assert.Equal("Download speed breached on testhost", msg.Title)
+	assert.Contains(msg.Message, "Download: 80.00 Mbit/s (80% of 100.00 Mbit/s contracted)")
+	assert.Equal(4, msg.Priority, "Should use a high priority for breaches")
+	assert.Equal([]string{"warning"}, msg.Tags)
+}
+
+func TestNtfyPriority(t *testing.T) {
+	w, err := NewNtfy(DefaultNtfyURL, "speedtest")
+	require.NoError(t, err)
+
+	assert := assert.New(t)
+	assert.Equal(2, w.eventPriority(Event{Type: EventTest, Result: newTestResult(100, 10)}, 2, 4, 3))
+	assert.Equal(4, w.eventPriority(Event{Type: EventTest, Result: speedtest.NewFailedSpeedtestResult()}, 2, 4, 3), "Should treat failed tests like breaches")
+	assert.Equal(3, w.eventPriority(Event{Type: EventRecovery}, 2, 4, 3))
+
+	w, err = NewNtfy(DefaultNtfyURL, "speedtest", WithPriority(1))
+	require.NoError(t, err)
+	assert.Equal(1, w.eventPriority(Event{Type: EventBreach}, 2, 4, 3), "Should use the configured priority")
+}
@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Thresholds that cause a breach event when they are not met.
+// A value of 0 disables the threshold.
+type Thresholds struct {
+	// Minimum download speed in Mbit/s
+	Download float64
+	// Minimum upload speed in Mbit/s
+	Upload float64
+	// Maximum ping in ms
+	Latency float64
+	// Number of consecutive failed speedtests
+	Failures int
+	// Margin in percent by which a breached speed or latency threshold needs to be exceeded to recover.
+	// Prevents a flood of notifications when the measurements fluctuate around the threshold.
+	Hysteresis float64
+}
+
+// Verify that the thresholds are not negative and the hysteresis is a percentage
+func (t Thresholds) Validate() error {
+	for name, value := range map[string]float64{
+		ConditionDownload: t.Download,
+		ConditionUpload:   t.Upload,
+		ConditionLatency:  t.Latency,
+		ConditionFailures: float64(t.Failures),
+	} {
+		if value < 0 {
+			return &ErrInvalidThreshold{Name: name, Value: value}
+		}
+	}
+	if t.Hysteresis < 0 || t.Hysteresis > 100 {
+		return &ErrInvalidHysteresis{Hysteresis: t.Hysteresis}
+	}
+	return nil
+}
+
+// State of a single condition
+type conditionState struct {
+	breached bool
+	// Only breaches that were notified are followed by a recovery
+	notified bool
+	// Time of the last breach notification, used for the cooldown
+	lastNotified time.Time
+}
+
+// Tracks the state of the thresholds across speedtests and creates the breach and recovery events.
+// Not safe for concurrent use.
+type tracker struct {
+	thresholds Thresholds
+	cooldown   time.Duration
+	failures   int
+	conditions map[string]*conditionState
+}
+
+func newTracker(thresholds Thresholds, cooldown time.Duration) *tracker {
+	return &tracker{
+		thresholds: thresholds,
+		cooldown:   cooldown,
+		conditions: make(map[string]*conditionState),
+	}
+}
+
+// Evaluate the result and return the events it caused, starting with the test event.
+// The speed and latency thresholds are only evaluated for successful speedtests.
+func (t *tracker) evaluate(result *speedtest.SpeedtestResult, instance string, now time.Time) []Event {
+	base := Event{
+		Instance: instance,
+		Time:     result.TimestampAsTime(),
+		Result:   result,
+	}
+
+	test := base
+	test.Type = EventTest
+	if result.Success() {
+		test.Message = fmt.Sprintf("Speedtest on %s finished with %.2f Mbit/s download, %.2f Mbit/s upload and %.2f ms ping", instance, result.DownloadSpeed(), result.UploadSpeed(), result.Ping())
+	} else {
+		test.Message = fmt.Sprintf("Speedtest on %s failed", instance)
+	}
+	events := []Event{test}
+
+	if result.Success() {
+		t.failures = 0
+	} else {
+		t.failures++
+	}
+
+	if t.thresholds.Failures > 0 {
+		threshold := float64(t.thresholds.Failures)
+		breached := t.failures >= t.thresholds.Failures
+		events = t.update(events, base, ConditionFailures, float64(t.failures), threshold, breached, !breached, now)
+	}
+
+	if !result.Success() {
+		return events
+	}
+
+	margin := t.thresholds.Hysteresis / 100
+	if t.thresholds.Download > 0 {
+		value, threshold := result.DownloadSpeed(), t.thresholds.Download
+		events = t.update(events, base, ConditionDownload, value, threshold, value < threshold, value >= threshold*(1+margin), now)
+	}
+	if t.thresholds.Upload > 0 {
+		value, threshold := result.UploadSpeed(), t.thresholds.Upload
+		events = t.update(events, base, ConditionUpload, value, threshold, value < threshold, value >= threshold*(1+margin), now)
+	}
+	if t.thresholds.Latency > 0 {
+		value, threshold := result.Ping(), t.thresholds.Latency
+		events = t.update(events, base, ConditionLatency, value, threshold, value > threshold, value <= threshold*(1-margin), now)
+	}
+	return events
+}
+
+// Update the state of the condition and append the breach or recovery event, if any.
+// Between breached and recovered the state is kept, which implements the hysteresis.
+func (t *tracker) update(events []Event, base Event, condition string, value, threshold float64, breached, recovered bool, now time.Time) []Event {
+	state := t.conditions[condition]
+	if state == nil {
+		state = &conditionState{}
+		t.conditions[condition] = state
+	}
+
+	event := base
+	event.Condition = condition
+	event.Value = value
+	event.Threshold = threshold
+
+	switch {
+	case !state.breached && breached:
+		state.breached = true
+		state.notified = state.lastNotified.IsZero() || now.Sub(state.lastNotified) >= t.cooldown
+		if !state.notified {
+			return events
+		}
+		state.lastNotified = now
+		event.Type = EventBreach
+		event.Message = fmt.Sprintf("%s on %s breached the threshold: %s", conditionName(condition), base.Instance, formatValue(condition, value, threshold))
+		return append(events, event)
+	case state.breached && recovered:
+		state.breached = false
+		if !state.notified {
+			return events
+		}
+		state.notified = false
+		event.Type = EventRecovery
+		event.Message = fmt.Sprintf("%s on %s recovered: %s", conditionName(condition), base.Instance, formatValue(condition, value, threshold))
+		return append(events, event)
+	}
+	return events
+}
+
+func conditionName(condition string) string {
+	switch condition {
+	case ConditionDownload:
+		return "Download speed"
+	case ConditionUpload:
+		return "Upload speed"
+	case ConditionLatency:
+		return "Latency"
+	default:
+		return "Speedtest"
+	}
+}
+
+func formatValue(condition string, value, threshold float64) string {
+	switch condition {
+	case ConditionDownload, ConditionUpload:
+		return fmt.Sprintf("%.2f Mbit/s (threshold %.2f Mbit/s)", value, threshold)
+	case ConditionLatency:
+		return fmt.Sprintf("%.2f ms (threshold %.2f ms)", value, threshold)
+	default:
+		return fmt.Sprintf("%d consecutive failures (threshold %d)", int(value), int(threshold))
+	}
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a successful result with the given download speed in Mbit/s and ping in ms
+func newTestResult(download, ping float64) *speedtest.SpeedtestResult {
+	return speedtest.NewSpeedtestResult(1, ping, download, 50, 100, "1234", "speedtest.example.org", "ISP", "127.0.0.1", time.Second)
+}
+
+// Return the type and condition of the events, skipping the test event
+func eventSummary(events []Event) []string {
+	var res []string
+	for _, event := range events {
+		if event.Type != EventTest {
+			res = append(res, event.Type+":"+event.Condition)
+		}
+	}
+	return res
+}
+
+func TestThresholdsValidate(t *testing.T) {
+	tMatrix := []struct {
+		Name       string
+		Thresholds Thresholds
+		Error      error
+	}{
+		{"Empty", Thresholds{}, nil},
+		{"Complete", Thresholds{Download: 100, Upload: 20, Latency: 50, Failures: 3, Hysteresis: 10}, nil},
+		{"NegativeDownload", Thresholds{Download: -1}, &ErrInvalidThreshold{Name: ConditionDownload, Value: -1}},
+		{"NegativeFailures", Thresholds{Failures: -2}, &ErrInvalidThreshold{Name: ConditionFailures, Value: -2}},
+		{"NegativeHysteresis", Thresholds{Hysteresis: -1}, &ErrInvalidHysteresis{Hysteresis: -1}},
+		{"HysteresisAbove100", Thresholds{Hysteresis: 101}, &ErrInvalidHysteresis{Hysteresis: 101}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, tCase.Thresholds.Validate())
+		})
+	}
+}
+
+func TestTrackerTestEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := newTracker(Thresholds{}, 0)
+
+	result := newTestResult(100, 10)
+	events := tr.evaluate(result, "testhost", time.Now())
+	require.Len(t, events, 1, "Should only send the test event without thresholds")
+	assert.Equal(EventTest, events[0].Type)
+	assert.Equal("testhost", events[0].Instance)
+	assert.Equal(result, events[0].Result)
+	assert.Equal(result.TimestampAsTime(), events[0].Time)
+	assert.Contains(events[0].Message, "100.00 Mbit/s download")
+
+	events = tr.evaluate(speedtest.NewFailedSpeedtestResult(), "testhost", time.Now())
+	require.Len(t, events, 1)
+	assert.Equal("Speedtest on testhost failed", events[0].Message)
+}
+
+func TestTrackerBreachAndRecovery(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := newTracker(Thresholds{Download: 100, Latency: 20}, 0)
+	now := time.Now()
+
+	assert.Empty(eventSummary(tr.evaluate(newTestResult(150, 10), "testhost", now)), "Should not send events while the thresholds are met")
+
+	events := tr.evaluate(newTestResult(80, 30), "testhost", now)
+	assert.Equal([]string{"breach:download", "breach:latency"}, eventSummary(events))
+	assert.Equal(80.0, events[1].Value)
+	assert.Equal(100.0, events[1].Threshold)
+	assert.Equal("Download speed on testhost breached the threshold: 80.00 Mbit/s (threshold 100.00 Mbit/s)", events[1].Message)
+
+	assert.Empty(eventSummary(tr.evaluate(newTestResult(70, 40), "testhost", now)), "Should only notify the breach once")
+
+	assert.Equal([]string{"recovery:latency"}, eventSummary(tr.evaluate(newTestResult(90, 10), "testhost", now)))
+	assert.Equal([]string{"recovery:download"}, eventSummary(tr.evaluate(newTestResult(100, 10), "testhost", now)))
+}
+
+func TestTrackerHysteresis(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := newTracker(Thresholds{Download: 100, Latency: 20, Hysteresis: 10}, 0)
+	now := time.Now()
+
+	assert.Equal([]string{"breach:download", "breach:latency"}, eventSummary(tr.evaluate(newTestResult(95, 25), "testhost", now)))
+	assert.Empty(eventSummary(tr.evaluate(newTestResult(105, 19), "testhost", now)), "Should not recover within the hysteresis")
+	assert.Empty(eventSummary(tr.evaluate(newTestResult(98, 21), "testhost", now)), "Should not breach again while breached")
+	assert.Equal([]string{"recovery:download", "recovery:latency"}, eventSummary(tr.evaluate(newTestResult(111, 18), "testhost", now)))
+}
+
+func TestTrackerCooldown(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := newTracker(Thresholds{Download: 100}, time.Hour)
+	now := time.Now()
+
+	assert.Equal([]string{"breach:download"}, eventSummary(tr.evaluate(newTestResult(50, 10), "testhost", now)))
+	assert.Equal([]string{"recovery:download"}, eventSummary(tr.evaluate(newTestResult(150, 10), "testhost", now.Add(time.Minute))))
+
+	assert.Empty(eventSummary(tr.evaluate(newTestResult(50, 10), "testhost", now.Add(2*time.Minute))), "Should not notify a breach during the cooldown")
+	assert.Empty(eventSummary(tr.evaluate(newTestResult(150, 10), "testhost", now.Add(3*time.Minute))), "Should not notify the recovery of a suppressed breach")
+
+	assert.Equal([]string{"breach:download"}, eventSummary(tr.evaluate(newTestResult(50, 10), "testhost", now.Add(2*time.Hour))), "Should notify again after the cooldown")
+}
+
+func TestTrackerFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := newTracker(Thresholds{Download: 100, Failures: 2}, 0)
+	now := time.Now()
+
+	assert.Equal([]string{"breach:download"}, eventSummary(tr.evaluate(newTestResult(50, 10), "testhost", now)))
+	assert.Empty(eventSummary(tr.evaluate(speedtest.NewFailedSpeedtestResult(), "testhost", now)), "Should not evaluate speeds of failed tests")
+
+	events := tr.evaluate(speedtest.NewFailedSpeedtestResult(), "testhost", now)
+	assert.Equal([]string{"breach:failures"}, eventSummary(events))
+	assert.Equal(2.0, events[1].Value)
+	assert.Equal("Speedtest on testhost breached the threshold: 2 consecutive failures (threshold 2)", events[1].Message)
+
+	assert.Empty(eventSummary(tr.evaluate(speedtest.NewFailedSpeedtestResult(), "testhost", now)))
+	assert.Equal([]string{"recovery:failures", "recovery:download"}, eventSummary(tr.evaluate(newTestResult(150, 10), "testhost", now)))
+}
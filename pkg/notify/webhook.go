@@ -0,0 +1,348 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 3
+
+	// Header containing the HMAC-SHA256 of the body, when a secret is set
+	SignatureHeader = "X-Speedtest-Signature"
+	// Header containing the type of the event
+	EventHeader = "X-Speedtest-Event"
+)
+
+// Wait time before the first retry of a failed request, doubled for every further retry
+var retryBackoff = time.Second
+
+// Webhook sends events as json via POST to an url.
+// It is the base of all channels, which only differ in the url, the headers and the default payload.
+type Webhook struct {
+	name        string
+	url         string
+	events      []string
+	secret      []byte
+	headers     map[string]string
+	bearerToken string
+	template    *template.Template
+	priority    int
+	retries     int
+	client      *http.Client
+
+	// Headers required by the type of the channel, e.g. for authentication
+	typeHeaders map[string]string
+	// Creates the default payload, used when no template is set
+	format func(event Event) ([]byte, error)
+}
+
+type WebhookOption func(*Webhook) error
+
+// WithName sets the name used in logs and the health status.
+// Defaults to the host of the url.
+func WithName(name string) WebhookOption {
+	return func(w *Webhook) error {
+		if name != "" {
+			w.name = name
+		}
+		return nil
+	}
+}
+
+// WithEvents sets the types of events sent to the webhook.
+// By default all events are sent.
+func WithEvents(events []string) WebhookOption {
+	return func(w *Webhook) error {
+		err := ValidateEvents(events)
+		if err != nil {
+			return err
+		}
+		if len(events) > 0 {
+			w.events = events
+		}
+		return nil
+	}
+}
+
+// WithSecret signs every payload with HMAC-SHA256 using the secret.
+// The signature is sent hex encoded as "sha256=<signature>" in the X-Speedtest-Signature header.
+func WithSecret(secret string) WebhookOption {
+	return func(w *Webhook) error {
+		if secret != "" {
+			w.secret = []byte(secret)
+		}
+		return nil
+	}
+}
+
+// WithHeaders adds custom headers to every request, e.g. for authentication.
+// The headers set by the webhook itself can't be overwritten.
+func WithHeaders(headers map[string]string) WebhookOption {
+	return func(w *Webhook) error {
+		for name := range headers {
+			switch textproto.CanonicalMIMEHeaderKey(name) {
+			case "Content-Type", "Content-Length", SignatureHeader, EventHeader:
+				return &ErrReservedHeader{Name: name}
+			}
+		}
+		w.headers = headers
+		return nil
+	}
+}
+
+// WithBearerToken authenticates every request with the token.
+func WithBearerToken(token string) WebhookOption {
+	return func(w *Webhook) error {
+		w.bearerToken = token
+		return nil
+	}
+}
+
+// WithPriority sets the priority of the messages for channels that support it, e.g. ntfy and Gotify.
+// By default the priority depends on the type of the event.
+func WithPriority(priority int) WebhookOption {
+	return func(w *Webhook) error {
+		if priority < 0 {
+			return &ErrInvalidPriority{Priority: priority}
+		}
+		w.priority = priority
+		return nil
+	}
+}
+
+// WithTemplate replaces the default payload with the result of the go template.
+// The template is executed with the Event and needs to produce valid json.
+// The function "json" encodes a value as json, e.g. {{ json .Message }}.
+func WithTemplate(text string) WebhookOption {
+	return func(w *Webhook) error {
+		if text == "" {
+			return nil
+		}
+		tmpl, err := template.New("payload").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return &ErrInvalidTemplate{Err: err}
+		}
+		w.template = tmpl
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of a single request, defaults to DefaultTimeout.
+func WithTimeout(timeout time.Duration) WebhookOption {
+	return func(w *Webhook) error {
+		if timeout <= 0 {
+			return &ErrInvalidTimeout{Timeout: timeout}
+		}
+		w.client.Timeout = timeout
+		return nil
+	}
+}
+
+// WithRetries sets how often a failed request is retried with exponential backoff, defaults to DefaultRetries.
+// Requests are only retried on network errors and when the server responds with 429 or 5xx.
+func WithRetries(retries int) WebhookOption {
+	return func(w *Webhook) error {
+		if retries < 0 {
+			return &ErrInvalidRetries{Retries: retries}
+		}
+		w.retries = retries
+		return nil
+	}
+}
+
+// NewWebhook creates a new webhook channel, sending the events as generic json payload.
+// Parameters:
+//   - webhookURL: Url the events are posted to
+//   - opts: optional webhook options
+func NewWebhook(webhookURL string, opts ...WebhookOption) (*Webhook, error) {
+	w, err := newWebhook(webhookURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	w.format = func(event Event) ([]byte, error) {
+		return json.Marshal(newPayload(event))
+	}
+	return w, nil
+}
+
+// Create the base of a channel, the caller needs to set the format
+func newWebhook(webhookURL string, opts ...WebhookOption) (*Webhook, error) {
+	err := ValidateURL(webhookURL)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(webhookURL)
+
+	w := &Webhook{
+		name:    u.Host,
+		url:     webhookURL,
+		events:  Events,
+		retries: DefaultRetries,
+		client:  &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		err = opt(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Verify that the url can be used for a webhook
+func ValidateURL(webhookURL string) error {
+	if webhookURL == "" {
+		return ErrMissingURL{}
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrInvalidURL{URL: webhookURL}
+	}
+	return nil
+}
+
+// Name of the webhook
+func (w *Webhook) Name() string {
+	return w.name
+}
+
+// Returns true if events of the given type should be sent to the webhook
+func (w *Webhook) Accepts(eventType string) bool {
+	return slices.Contains(w.events, eventType)
+}
+
+// Send the event to the webhook, retrying with exponential backoff on failure
+func (w *Webhook) Send(ctx context.Context, event Event) error {
+	body, err := w.payload(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.post(ctx, event.Type, body)
+		if err == nil || !retry || attempt >= w.retries {
+			return err
+		}
+		slog.Debug("Retrying webhook", slog.String("webhook", w.name), slog.Int("attempt", attempt+1), "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// Post the body once, returns true if a failed request should be retried
+func (w *Webhook) post(ctx context.Context, eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+	if w.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	}
+	for name, value := range w.typeHeaders {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if w.secret != nil {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.secret, body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, &ErrUnexpectedStatus{Status: res.StatusCode}
+}
+
+// Create the body for the event, either from the template or the default payload
+func (w *Webhook) payload(event Event) ([]byte, error) {
+	if w.template == nil {
+		return w.format(event)
+	}
+
+	var buf bytes.Buffer
+	err := w.template.Execute(&buf, event)
+	if err != nil {
+		return nil, &ErrInvalidTemplate{Err: err}
+	}
+	if !jsontext.Value(buf.Bytes()).IsValid() {
+		return nil, ErrInvalidPayload{}
+	}
+	return buf.Bytes(), nil
+}
+
+// Compute the hex encoded HMAC-SHA256 of the body, used by receivers to verify the payload
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Functions available in payload templates
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Default payload of a webhook
+type payload struct {
+	Event     string                     `json:"event"`
+	Condition string                     `json:"condition,omitempty"`
+	Instance  string                     `json:"instance"`
+	Timestamp time.Time                  `json:"timestamp"`
+	Value     *float64                   `json:"value,omitzero"`
+	Threshold *float64                   `json:"threshold,omitzero"`
+	Message   string                     `json:"message"`
+	Result    *speedtest.SpeedtestResult `json:"result"`
+}
+
+func newPayload(event Event) payload {
+	p := payload{
+		Event:     event.Type,
+		Condition: event.Condition,
+		Instance:  event.Instance,
+		Timestamp: event.Time,
+		Message:   event.Message,
+		Result:    event.Result,
+	}
+	if event.Condition != "" {
+		p.Value = &event.Value
+		p.Threshold = &event.Threshold
+	}
+	return p
+}
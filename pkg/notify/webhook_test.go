@@ -0,0 +1,257 @@
+package notify
+
+import (
+	"context"
+	"encoding/json/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	retryBackoff = time.Millisecond
+}
+
+// Request received by the mockWebhook
+type webhookRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// Minimal webhook receiver, records all requests and responds with the given status codes in order
+type mockWebhook struct {
+	server   *httptest.Server
+	status   []int
+	requests []webhookRequest
+	lock     sync.Mutex
+}
+
+func newMockWebhook(t *testing.T, status ...int) *mockWebhook {
+	m := &mockWebhook{status: status}
+	m.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		m.lock.Lock()
+		m.requests = append(m.requests, webhookRequest{Header: req.Header, Body: body})
+		code := http.StatusOK
+		if len(m.status) > 0 {
+			code = m.status[0]
+			m.status = m.status[1:]
+		}
+		m.lock.Unlock()
+
+		rw.WriteHeader(code)
+	}))
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockWebhook) Requests() []webhookRequest {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]webhookRequest(nil), m.requests...)
+}
+
+func newTestEvent() Event {
+	result := newTestResult(80, 10)
+	return Event{
+		Type:      EventBreach,
+		Condition: ConditionDownload,
+		Instance:  "testhost",
+		Time:      result.TimestampAsTime(),
+		Value:     80,
+		Threshold: 100,
+		Message:   "Download speed on testhost breached the threshold",
+		Result:    result,
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		URL   string
+		Opts  []WebhookOption
+		Error error
+	}{
+		{"Minimal", "https://hooks.example.org/speedtest", nil, nil},
+		{"AllOptions", "http://localhost:8080", []WebhookOption{
+			WithName("home"),
+			WithEvents([]string{EventBreach, EventRecovery}),
+			WithSecret("secret"),
+			WithHeaders(map[string]string{"Authorization": "Bearer token"}),
+			WithTemplate(`{"text": {{ json .Message }}}`),
+			WithTimeout(time.Second),
+			WithRetries(0),
+			WithBearerToken("token"),
+			WithPriority(3),
+		}, nil},
+		{"MissingURL", "", nil, ErrMissingURL{}},
+		{"InvalidURL", "ftp://example.org", nil, &ErrInvalidURL{URL: "ftp://example.org"}},
+		{"InvalidEvent", "http://localhost", []WebhookOption{WithEvents([]string{"breach", "foo"})}, &ErrInvalidEvent{Event: "foo"}},
+		{"ReservedHeader", "http://localhost", []WebhookOption{WithHeaders(map[string]string{"x-speedtest-signature": "foo"})}, &ErrReservedHeader{Name: "x-speedtest-signature"}},
+		{"InvalidTimeout", "http://localhost", []WebhookOption{WithTimeout(0)}, &ErrInvalidTimeout{}},
+		{"InvalidRetries", "http://localhost", []WebhookOption{WithRetries(-1)}, &ErrInvalidRetries{Retries: -1}},
+		{"InvalidPriority", "http://localhost", []WebhookOption{WithPriority(-1)}, &ErrInvalidPriority{Priority: -1}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			_, err := NewWebhook(tCase.URL, tCase.Opts...)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		_, err := NewWebhook("http://localhost", WithTemplate("{{ .Message"))
+		assert.IsType(t, &ErrInvalidTemplate{}, err)
+	})
+	t.Run("Defaults", func(t *testing.T) {
+		w, err := NewWebhook("https://hooks.example.org:8443/speedtest")
+		require.NoError(t, err)
+
+		assert := assert.New(t)
+		assert.Equal("hooks.example.org:8443", w.Name(), "Should use the host as name")
+		assert.Equal(Events, w.events, "Should send all events")
+		assert.Equal(DefaultRetries, w.retries)
+		assert.Equal(DefaultTimeout, w.client.Timeout)
+	})
+}
+
+func TestWebhookSend(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newMockWebhook(t)
+	w, err := NewWebhook(m.server.URL, WithHeaders(map[string]string{"Authorization": "Bearer token"}))
+	require.NoError(t, err)
+
+	event := newTestEvent()
+	require.NoError(t, w.Send(context.Background(), event))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal("application/json", requests[0].Header.Get("Content-Type"))
+	assert.Equal("Bearer token", requests[0].Header.Get("Authorization"))
+	assert.Equal(EventBreach, requests[0].Header.Get(EventHeader))
+	assert.Empty(requests[0].Header.Get(SignatureHeader), "Should not sign without a secret")
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(requests[0].Body, &body))
+	assert.Equal("breach", body["event"])
+	assert.Equal("download", body["condition"])
+	assert.Equal("testhost", body["instance"])
+	assert.Equal(80.0, body["value"])
+	assert.Equal(100.0, body["threshold"])
+	assert.Equal(event.Message, body["message"])
+	assert.Equal(event.Time.Format(time.RFC3339Nano), body["timestamp"])
+	require.IsType(t, map[string]any{}, body["result"])
+	assert.Equal(80.0, body["result"].(map[string]any)["download_mbps"])
+
+	t.Run("TestEvent", func(t *testing.T) {
+		event := newTestEvent()
+		event.Type = EventTest
+		event.Condition = ""
+		require.NoError(t, w.Send(context.Background(), event))
+
+		requests := m.Requests()
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(requests[len(requests)-1].Body, &body))
+		assert.NotContains(body, "value", "Should omit value and threshold without a condition")
+		assert.NotContains(body, "threshold")
+	})
+}
+
+func TestWebhookBearerToken(t *testing.T) {
+	m := newMockWebhook(t)
+	w, err := NewWebhook(m.server.URL, WithHeaders(map[string]string{"Authorization": "Basic foo"}), WithBearerToken("token"))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Send(context.Background(), newTestEvent()))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "Bearer token", requests[0].Header.Get("Authorization"), "Should take precedence over custom headers")
+}
+
+func TestWebhookSignature(t *testing.T) {
+	m := newMockWebhook(t)
+	w, err := NewWebhook(m.server.URL, WithSecret("secret"))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Send(context.Background(), newTestEvent()))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "sha256="+Sign([]byte("secret"), requests[0].Body), requests[0].Header.Get(SignatureHeader))
+	// Known signature, to ensure receivers can verify it with any HMAC-SHA256 implementation
+	assert.Equal(t, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", Sign([]byte("key"), []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newMockWebhook(t)
+	w, err := NewWebhook(m.server.URL, WithTemplate(`{"text": {{ json .Message }}, "download": {{ .Result.DownloadSpeed }}, "host": {{ json .Instance }}}`))
+	require.NoError(t, err)
+
+	event := newTestEvent()
+	require.NoError(t, w.Send(context.Background(), event))
+
+	requests := m.Requests()
+	require.Len(t, requests, 1)
+	assert.JSONEq(`{"text": "Download speed on testhost breached the threshold", "download": 80, "host": "testhost"}`, string(requests[0].Body))
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		w, err := NewWebhook(m.server.URL, WithTemplate(`{"text": {{ .Message }}}`))
+		require.NoError(t, err)
+
+		assert.Equal(ErrInvalidPayload{}, w.Send(context.Background(), event))
+		assert.Len(m.Requests(), 1, "Should not send invalid payloads")
+	})
+	t.Run("ExecutionError", func(t *testing.T) {
+		w, err := NewWebhook(m.server.URL, WithTemplate(`{{ .Foo }}`))
+		require.NoError(t, err)
+
+		assert.IsType(&ErrInvalidTemplate{}, w.Send(context.Background(), event))
+	})
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tMatrix := []struct {
+		Name     string
+		Status   []int
+		Retries  int
+		Requests int
+		Error    error
+	}{
+		{"SuccessAfterRetry", []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent}, 3, 3, nil},
+		{"RetriesExhausted", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, 2, 3, &ErrUnexpectedStatus{Status: http.StatusBadGateway}},
+		{"NoRetryOnClientError", []int{http.StatusBadRequest}, 3, 1, &ErrUnexpectedStatus{Status: http.StatusBadRequest}},
+		{"RetriesDisabled", []int{http.StatusServiceUnavailable}, 0, 1, &ErrUnexpectedStatus{Status: http.StatusServiceUnavailable}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			m := newMockWebhook(t, tCase.Status...)
+			w, err := NewWebhook(m.server.URL, WithRetries(tCase.Retries))
+			require.NoError(t, err)
+
+			assert.Equal(t, tCase.Error, w.Send(context.Background(), newTestEvent()))
+			assert.Len(t, m.Requests(), tCase.Requests)
+		})
+	}
+
+	t.Run("Unreachable", func(t *testing.T) {
+		m := newMockWebhook(t)
+		m.server.Close()
+
+		w, err := NewWebhook(m.server.URL, WithRetries(1))
+		require.NoError(t, err)
+		assert.Error(t, w.Send(context.Background(), newTestEvent()))
+	})
+}
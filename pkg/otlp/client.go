@@ -0,0 +1,298 @@
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+	"github.com/heathcliff26/speedtest-exporter/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	httpClientTimeout = 10 * time.Second
+	serviceName       = "speedtest-exporter"
+)
+
+// Client pushes the metrics of a prometheus.Gatherer to an OTLP/HTTP metrics endpoint
+type Client struct {
+	instance   string
+	attributes map[string]string
+	gatherer   prometheus.Gatherer
+	exporter   *otlpmetrichttp.Exporter
+	// Options passed to the exporter, collected by the ClientOptions
+	exporterOpts []otlpmetrichttp.Option
+	resource     *resource.Resource
+	// Start time of the cumulative metrics, if they do not provide their own
+	startTime time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+	// Buffered channel used to request a push, see Trigger
+	trigger chan struct{}
+
+	lastSuccess time.Time
+	lastError   error
+	statusLock  sync.RWMutex
+}
+
+// Status of the client, used for health reporting
+type Status struct {
+	// True while the client is running in the background
+	Running bool
+	// Time of the last successful push, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last push, empty if it was successful
+	LastError string
+}
+
+type ClientOption func(*Client) error
+
+// WithInstance sets the service.instance.id resource attribute.
+// By default the hostname of the machine is used.
+func WithInstance(instance string) ClientOption {
+	return func(c *Client) error {
+		if instance == "" {
+			return ErrMissingInstance{}
+		}
+		c.instance = instance
+		return nil
+	}
+}
+
+// WithResourceAttributes adds the given attributes to the resource of the metrics, e.g. the site.
+// The attributes service.name and service.instance.id are always set by the client.
+func WithResourceAttributes(attributes map[string]string) ClientOption {
+	return func(c *Client) error {
+		c.attributes = attributes
+		return nil
+	}
+}
+
+// WithHeaders adds the given headers to every request, e.g. for authentication.
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) error {
+		c.exporterOpts = append(c.exporterOpts, otlpmetrichttp.WithHeaders(headers))
+		return nil
+	}
+}
+
+// WithGzip compresses the requests with gzip.
+func WithGzip() ClientOption {
+	return func(c *Client) error {
+		c.exporterOpts = append(c.exporterOpts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls config for the connection to the endpoint, e.g. to trust a custom CA or send a client certificate
+func WithTLSConfig(tlsCfg *tls.Config) ClientOption {
+	return func(c *Client) error {
+		c.exporterOpts = append(c.exporterOpts, otlpmetrichttp.WithTLSClientConfig(tlsCfg))
+		return nil
+	}
+}
+
+// NewClient creates a new OTLP metrics client.
+// Parameters:
+//   - endpoint: Full url of the OTLP/HTTP metrics endpoint, e.g. http://localhost:4318/v1/metrics
+//   - gatherer: Source of the metrics that will be pushed
+//   - opts: optional client options
+func NewClient(endpoint string, gatherer prometheus.Gatherer, opts ...ClientOption) (*Client, error) {
+	err := ValidateEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if gatherer == nil {
+		return nil, ErrMissingGatherer{}
+	}
+
+	c := &Client{
+		instance:  utils.Hostname(),
+		gatherer:  gatherer,
+		startTime: time.Now(),
+		trigger:   make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		err := opt(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Disable retries, a failed push is repeated with fresh metrics on the next run.
+	exporterOpts := append([]otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpointURL(endpoint),
+		otlpmetrichttp.WithTimeout(httpClientTimeout),
+		otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{Enabled: false}),
+	}, c.exporterOpts...)
+	c.exporter, err = otlpmetrichttp.New(context.Background(), exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	c.resource = c.newResource()
+
+	return c, nil
+}
+
+// Verify that the endpoint is a valid http(s) url
+func ValidateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return ErrMissingEndpoint{}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrInvalidEndpoint{Endpoint: endpoint}
+	}
+	return nil
+}
+
+// Create the resource describing this exporter
+func (c *Client) newResource() *resource.Resource {
+	attrs := make([]attribute.KeyValue, 0, len(c.attributes)+3)
+	for key, value := range c.attributes {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	attrs = append(attrs,
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version.BuildInfo().Version),
+		attribute.String("service.instance.id", c.instance),
+	)
+	return resource.NewSchemaless(attrs...)
+}
+
+// Collect the current metrics and send them to the endpoint
+func (c *Client) Push(ctx context.Context) error {
+	err := c.push(ctx)
+
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.lastError = err
+	if err == nil {
+		c.lastSuccess = time.Now()
+	}
+	return err
+}
+
+func (c *Client) push(ctx context.Context) error {
+	rm, err := c.collect()
+	if err != nil {
+		return err
+	}
+
+	err = c.exporter.Export(ctx, rm)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Successfully sent metrics via OTLP", slog.Int("count", len(rm.ScopeMetrics[0].Metrics)))
+	return nil
+}
+
+// Push metrics to the endpoint in the background.
+// With an interval, metrics are pushed periodically, starting immediately.
+// Without an interval, metrics are only pushed when requested with Trigger.
+// Does not block the calling thread.
+func (c *Client) Run(interval time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel != nil {
+		return ErrClientAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		slog.Debug("Starting OTLP metrics client")
+
+		// Only one of the channels is set, the other one blocks forever
+		var tick <-chan time.Time
+		trigger := c.trigger
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+			trigger = nil
+
+			c.pushAndLog(ctx)
+		}
+
+		for {
+			select {
+			case <-tick:
+			case <-trigger:
+			case <-ctx.Done():
+				return
+			}
+			c.pushAndLog(ctx)
+		}
+	}()
+
+	return nil
+}
+
+func (c *Client) pushAndLog(ctx context.Context) {
+	err := c.Push(ctx)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("Failed to send metrics via OTLP", "err", err)
+	}
+}
+
+// Request a push from the background goroutine, when the client runs without an interval.
+// Does not block and is safe to call while metrics are collected,
+// multiple requests while a push is pending are merged.
+func (c *Client) Trigger() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Returns true if the client is currently running
+func (c *Client) IsRunning() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cancel != nil
+}
+
+// Return the current status of the client
+func (c *Client) Status() Status {
+	status := Status{Running: c.IsRunning()}
+
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	status.LastSuccess = c.lastSuccess
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	return status
+}
+
+// Stop pushing in the background and wait for the goroutine to exit.
+// Does nothing if the client is not running.
+func (c *Client) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	slog.Info("Stopped OTLP metrics client")
+}
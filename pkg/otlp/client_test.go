@@ -0,0 +1,433 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Stores all received OTLP requests
+type mockCollector struct {
+	requests []*colmetricspb.ExportMetricsServiceRequest
+	headers  []http.Header
+	status   int
+	lock     sync.Mutex
+}
+
+func (m *mockCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	err = proto.Unmarshal(buf, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests = append(m.requests, req)
+	m.headers = append(m.headers, r.Header.Clone())
+
+	if m.status != 0 {
+		http.Error(w, "rejected", m.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *mockCollector) Requests() []*colmetricspb.ExportMetricsServiceRequest {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.requests
+}
+
+// Create an OTLP/HTTP collector for testing
+func newTestCollector(t *testing.T) (*mockCollector, *httptest.Server) {
+	collector := &mockCollector{}
+	server := httptest.NewServer(collector)
+	t.Cleanup(server.Close)
+	return collector, server
+}
+
+// Return the metrics of the request by name
+func metricsByName(req *colmetricspb.ExportMetricsServiceRequest) map[string]*metricspb.Metric {
+	res := make(map[string]*metricspb.Metric)
+	for _, rm := range req.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				res[m.GetName()] = m
+			}
+		}
+	}
+	return res
+}
+
+// Return the resource attributes of the request
+func resourceAttributes(req *colmetricspb.ExportMetricsServiceRequest) map[string]string {
+	res := make(map[string]string)
+	for _, kv := range req.GetResourceMetrics()[0].GetResource().GetAttributes() {
+		res[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return res
+}
+
+func TestNewClient(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	tMatrix := []struct {
+		Name     string
+		Endpoint string
+		Gatherer prometheus.Gatherer
+		Opts     []ClientOption
+		Error    error
+	}{
+		{"MissingEndpoint", "", reg, nil, ErrMissingEndpoint{}},
+		{"InvalidEndpoint", "localhost:4318", reg, nil, &ErrInvalidEndpoint{Endpoint: "localhost:4318"}},
+		{"MissingGatherer", "http://localhost:4318/v1/metrics", nil, nil, ErrMissingGatherer{}},
+		{"MissingInstance", "http://localhost:4318/v1/metrics", reg, []ClientOption{WithInstance("")}, ErrMissingInstance{}},
+		{"Success", "https://localhost:4318/v1/metrics", reg, []ClientOption{WithInstance("test"), WithHeaders(map[string]string{"foo": "bar"}), WithGzip(), WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})}, nil},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			c, err := NewClient(tCase.Endpoint, tCase.Gatherer, tCase.Opts...)
+
+			assert.Equal(t, tCase.Error, err)
+			if tCase.Error == nil {
+				assert.Equal(t, "test", c.instance)
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}, []string{"foo", "instance"})
+	gauge.WithLabelValues("bar", "dropped").Set(1.5)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter"})
+	counter.Add(3)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_histogram", Help: "Test histogram", Buckets: []float64{1, 10}})
+	histogram.Observe(5)
+	histogram.Observe(50)
+	reg.MustRegister(gauge, counter, histogram)
+
+	collector, server := newTestCollector(t)
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg,
+		WithInstance("test"),
+		WithResourceAttributes(map[string]string{"site": "home"}),
+		WithHeaders(map[string]string{"Authorization": "Bearer token"}),
+		WithGzip(),
+	)
+	require.NoError(err, "Should create client")
+
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := collector.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+	assert.Equal("Bearer token", collector.headers[0].Get("Authorization"), "Should send the headers")
+	assert.Equal("gzip", collector.headers[0].Get("Content-Encoding"), "Should compress the request")
+
+	resource := resourceAttributes(requests[0])
+	assert.Equal("test", resource["service.instance.id"])
+	assert.Equal(serviceName, resource["service.name"])
+	assert.Equal("home", resource["site"])
+
+	metrics := metricsByName(requests[0])
+	require.Len(metrics, 3, "Should send all metrics")
+
+	gaugeData := metrics["test_gauge"].GetGauge()
+	require.NotNil(gaugeData, "Should send gauges as gauge")
+	require.Len(gaugeData.GetDataPoints(), 1)
+	assert.Equal(1.5, gaugeData.GetDataPoints()[0].GetAsDouble())
+	attrs := gaugeData.GetDataPoints()[0].GetAttributes()
+	require.Len(attrs, 1, "Should drop the instance label")
+	assert.Equal("foo", attrs[0].GetKey())
+	assert.Equal("bar", attrs[0].GetValue().GetStringValue())
+
+	sum := metrics["test_total"].GetSum()
+	require.NotNil(sum, "Should send counters as sum")
+	assert.True(sum.GetIsMonotonic())
+	assert.Equal(metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.GetAggregationTemporality())
+	assert.Equal(3.0, sum.GetDataPoints()[0].GetAsDouble())
+	assert.NotZero(sum.GetDataPoints()[0].GetStartTimeUnixNano(), "Should set the start time")
+
+	hist := metrics["test_histogram"].GetHistogram()
+	require.NotNil(hist, "Should send classic histograms as histogram")
+	dp := hist.GetDataPoints()[0]
+	assert.Equal(uint64(2), dp.GetCount())
+	assert.Equal(55.0, dp.GetSum())
+	assert.Equal([]float64{1, 10}, dp.GetExplicitBounds())
+	assert.Equal([]uint64{0, 1, 1}, dp.GetBucketCounts(), "Should convert the cumulative buckets")
+
+	status := c.Status()
+	assert.False(status.LastSuccess.IsZero(), "Should record the successful push")
+	assert.Empty(status.LastError, "Should not have an error")
+}
+
+func TestPushKeepsTimestamps(t *testing.T) {
+	require := require.New(t)
+
+	timestamp := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	desc := prometheus.NewDesc("test_gauge", "Test gauge", nil, nil)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.CollectorFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.NewMetricWithTimestamp(timestamp, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1))
+	}))
+
+	collector, server := newTestCollector(t)
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg)
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := collector.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+	dp := metricsByName(requests[0])["test_gauge"].GetGauge().GetDataPoints()[0]
+	assert.Equal(t, uint64(timestamp.UnixNano()), dp.GetTimeUnixNano(), "Should use the timestamp of the metric")
+}
+
+func TestPushExemplars(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	desc := prometheus.NewDesc("test_total", "Test counter", nil, nil)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.CollectorFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewMetricWithExemplars(
+			prometheus.MustNewConstMetric(desc, prometheus.CounterValue, 1),
+			prometheus.Exemplar{Value: 1, Labels: prometheus.Labels{"run_id": "abc"}},
+		)
+	}))
+
+	collector, server := newTestCollector(t)
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg)
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := collector.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+	exemplars := metricsByName(requests[0])["test_total"].GetSum().GetDataPoints()[0].GetExemplars()
+	require.Len(exemplars, 1, "Should send the exemplar")
+	assert.Equal("run_id", exemplars[0].GetFilteredAttributes()[0].GetKey())
+	assert.Equal("abc", exemplars[0].GetFilteredAttributes()[0].GetValue().GetStringValue())
+}
+
+func TestPushExponentialHistogram(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:                        "test_histogram",
+		Help:                        "Test histogram",
+		Buckets:                     []float64{1, 10},
+		NativeHistogramBucketFactor: 1.1,
+	})
+	histogram.Observe(5)
+	histogram.Observe(7)
+	reg.MustRegister(histogram)
+
+	collector, server := newTestCollector(t)
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg)
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := collector.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+
+	hist := metricsByName(requests[0])["test_histogram"].GetExponentialHistogram()
+	require.NotNil(hist, "Should send native histograms as exponential histogram")
+	dp := hist.GetDataPoints()[0]
+	assert.Equal(uint64(2), dp.GetCount())
+	assert.Equal(12.0, dp.GetSum())
+	assert.Equal(int32(3), dp.GetScale())
+
+	var total uint64
+	for _, count := range dp.GetPositive().GetBucketCounts() {
+		total += count
+	}
+	assert.Equal(uint64(2), total, "Should convert the bucket counts")
+}
+
+func TestConvertExponentialBuckets(t *testing.T) {
+	span := func(offset int32, length uint32) *dto.BucketSpan {
+		return &dto.BucketSpan{Offset: &offset, Length: &length}
+	}
+
+	tMatrix := []struct {
+		Name           string
+		Spans          []*dto.BucketSpan
+		Deltas         []int64
+		ExpectedOffset int32
+		ExpectedCounts []uint64
+	}{
+		{
+			Name: "Empty",
+		},
+		{
+			Name:           "SingleSpan",
+			Spans:          []*dto.BucketSpan{span(5, 3)},
+			Deltas:         []int64{1, 1, -2},
+			ExpectedOffset: 4,
+			ExpectedCounts: []uint64{1, 2, 0},
+		},
+		{
+			Name:           "Gap",
+			Spans:          []*dto.BucketSpan{span(-2, 1), span(2, 2)},
+			Deltas:         []int64{3, -1, 2},
+			ExpectedOffset: -3,
+			ExpectedCounts: []uint64{3, 0, 0, 2, 4},
+		},
+		{
+			Name:           "MissingDeltas",
+			Spans:          []*dto.BucketSpan{span(0, 3)},
+			Deltas:         []int64{1},
+			ExpectedOffset: -1,
+			ExpectedCounts: []uint64{1},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			bucket := convertExponentialBuckets(tCase.Spans, tCase.Deltas)
+
+			assert.Equal(t, tCase.ExpectedOffset, bucket.Offset)
+			assert.Equal(t, tCase.ExpectedCounts, bucket.Counts)
+		})
+	}
+}
+
+func TestPushTLS(t *testing.T) {
+	require := require.New(t)
+
+	collector := &mockCollector{}
+	server := httptest.NewTLSServer(collector)
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg)
+	require.NoError(err, "Should create client")
+	assert.Error(t, c.Push(t.Context()), "Should not trust the server without the CA")
+
+	c, err = NewClient(server.URL+"/v1/metrics", reg, WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should trust the server with the CA")
+	assert.Len(t, collector.Requests(), 1, "Should have received a single request")
+}
+
+func TestPushFailure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	collector, server := newTestCollector(t)
+	collector.status = http.StatusBadRequest
+
+	c, err := NewClient(server.URL+"/v1/metrics", prometheus.NewRegistry())
+	require.NoError(err, "Should create client")
+
+	assert.Error(c.Push(t.Context()), "Should fail to push metrics")
+
+	status := c.Status()
+	assert.True(status.LastSuccess.IsZero(), "Should not have a successful push")
+	assert.NotEmpty(status.LastError, "Should record the error")
+	assert.False(status.Running, "Should not be running")
+}
+
+func TestRunAndStop(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	collector, server := newTestCollector(t)
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg)
+	require.NoError(err, "Should create client")
+
+	require.NoError(c.Run(time.Hour), "Should start client")
+	assert.True(c.IsRunning(), "Client should be running")
+	assert.True(c.Status().Running, "Status should show the client as running")
+	assert.Equal(ErrClientAlreadyRunning{}, c.Run(time.Hour), "Should not start a second time")
+
+	assert.Eventually(func() bool {
+		return len(collector.Requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push immediately after start")
+
+	c.Trigger()
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(collector.Requests(), 1, "Should ignore triggers when running with an interval")
+
+	c.Stop()
+	assert.False(c.IsRunning(), "Client should be stopped")
+	assert.NotPanics(c.Stop, "Stopping twice should not panic")
+}
+
+func TestRunOnTrigger(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	collector, server := newTestCollector(t)
+
+	c, err := NewClient(server.URL+"/v1/metrics", reg)
+	require.NoError(err, "Should create client")
+
+	require.NoError(c.Run(0), "Should start client")
+	t.Cleanup(c.Stop)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(collector.Requests(), "Should not push without a trigger")
+
+	c.Trigger()
+	assert.Eventually(func() bool {
+		return len(collector.Requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push after a trigger")
+
+	assert.NotPanics(func() {
+		for range 10 {
+			c.Trigger()
+		}
+	}, "Should not block on multiple triggers")
+}
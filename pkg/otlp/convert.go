@@ -0,0 +1,257 @@
+package otlp
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/version"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const scopeName = "github.com/heathcliff26/speedtest-exporter"
+
+// Labels that are part of the resource and will be dropped from the collected metrics
+var reservedLabels = []string{"instance", "job"}
+
+// Gather the metrics and convert them to OTLP metrics
+func (c *Client) collect() (*metricdata.ResourceMetrics, error) {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	metrics := make([]metricdata.Metrics, 0, len(families))
+	for _, family := range families {
+		data, err := c.convertFamily(family, now)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metricdata.Metrics{
+			Name:        family.GetName(),
+			Description: family.GetHelp(),
+			Unit:        family.GetUnit(),
+			Data:        data,
+		})
+	}
+
+	return &metricdata.ResourceMetrics{
+		Resource: c.resource,
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{
+				Scope: instrumentation.Scope{
+					Name:    scopeName,
+					Version: version.BuildInfo().Version,
+				},
+				Metrics: metrics,
+			},
+		},
+	}, nil
+}
+
+// Convert a metric family into the matching OTLP aggregation.
+// Counters become monotonic cumulative sums and histograms with a native schema become exponential histograms.
+func (c *Client) convertFamily(family *dto.MetricFamily, now time.Time) (metricdata.Aggregation, error) {
+	switch family.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		gauge := metricdata.Gauge[float64]{}
+		for _, m := range family.GetMetric() {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: convertLabels(m.GetLabel()),
+				Time:       timestamp(m, now),
+				Value:      value,
+			})
+		}
+		return gauge, nil
+	case dto.MetricType_COUNTER:
+		sum := metricdata.Sum[float64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+		}
+		for _, m := range family.GetMetric() {
+			counter := m.GetCounter()
+			sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: convertLabels(m.GetLabel()),
+				StartTime:  c.startTimeOf(counter.GetCreatedTimestamp()),
+				Time:       timestamp(m, now),
+				Value:      counter.GetValue(),
+				Exemplars:  convertExemplars(counter.GetExemplar()),
+			})
+		}
+		return sum, nil
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		if isNativeHistogram(family) {
+			return c.convertExponentialHistogram(family, now), nil
+		}
+		return c.convertHistogram(family, now), nil
+	case dto.MetricType_SUMMARY:
+		summary := metricdata.Summary{}
+		for _, m := range family.GetMetric() {
+			s := m.GetSummary()
+			dp := metricdata.SummaryDataPoint{
+				Attributes: convertLabels(m.GetLabel()),
+				StartTime:  c.startTimeOf(s.GetCreatedTimestamp()),
+				Time:       timestamp(m, now),
+				Count:      s.GetSampleCount(),
+				Sum:        s.GetSampleSum(),
+			}
+			for _, q := range s.GetQuantile() {
+				dp.QuantileValues = append(dp.QuantileValues, metricdata.QuantileValue{
+					Quantile: q.GetQuantile(),
+					Value:    q.GetValue(),
+				})
+			}
+			summary.DataPoints = append(summary.DataPoints, dp)
+		}
+		return summary, nil
+	default:
+		return nil, &ErrUnknownMetricType{Name: family.GetName()}
+	}
+}
+
+// Convert the classic buckets of a histogram, OTLP expects the count of each bucket instead of the cumulative count
+func (c *Client) convertHistogram(family *dto.MetricFamily, now time.Time) metricdata.Histogram[float64] {
+	histogram := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+	for _, m := range family.GetMetric() {
+		h := m.GetHistogram()
+		dp := metricdata.HistogramDataPoint[float64]{
+			Attributes: convertLabels(m.GetLabel()),
+			StartTime:  c.startTimeOf(h.GetCreatedTimestamp()),
+			Time:       timestamp(m, now),
+			Count:      h.GetSampleCount(),
+			Sum:        h.GetSampleSum(),
+		}
+		var previous uint64
+		for _, b := range h.GetBucket() {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				continue
+			}
+			dp.Bounds = append(dp.Bounds, b.GetUpperBound())
+			dp.BucketCounts = append(dp.BucketCounts, b.GetCumulativeCount()-previous)
+			previous = b.GetCumulativeCount()
+			if e := b.GetExemplar(); e != nil {
+				dp.Exemplars = append(dp.Exemplars, convertExemplars(e)...)
+			}
+		}
+		// Overflow bucket for all observations above the highest bound
+		dp.BucketCounts = append(dp.BucketCounts, h.GetSampleCount()-previous)
+		histogram.DataPoints = append(histogram.DataPoints, dp)
+	}
+	return histogram
+}
+
+// Convert the native buckets of a histogram into an exponential histogram.
+// The schema of a native histogram matches the scale of an exponential histogram,
+// but the bucket indices of OTLP are lower by one.
+func (c *Client) convertExponentialHistogram(family *dto.MetricFamily, now time.Time) metricdata.ExponentialHistogram[float64] {
+	histogram := metricdata.ExponentialHistogram[float64]{Temporality: metricdata.CumulativeTemporality}
+	for _, m := range family.GetMetric() {
+		h := m.GetHistogram()
+		dp := metricdata.ExponentialHistogramDataPoint[float64]{
+			Attributes:     convertLabels(m.GetLabel()),
+			StartTime:      c.startTimeOf(h.GetCreatedTimestamp()),
+			Time:           timestamp(m, now),
+			Count:          h.GetSampleCount(),
+			Sum:            h.GetSampleSum(),
+			Scale:          h.GetSchema(),
+			ZeroCount:      h.GetZeroCount(),
+			ZeroThreshold:  h.GetZeroThreshold(),
+			PositiveBucket: convertExponentialBuckets(h.GetPositiveSpan(), h.GetPositiveDelta()),
+			NegativeBucket: convertExponentialBuckets(h.GetNegativeSpan(), h.GetNegativeDelta()),
+			Exemplars:      convertExemplars(h.GetExemplars()...),
+		}
+		histogram.DataPoints = append(histogram.DataPoints, dp)
+	}
+	return histogram
+}
+
+// Convert the delta encoded native buckets into the dense bucket counts of OTLP.
+// Gaps between the spans are filled with empty buckets.
+func convertExponentialBuckets(spans []*dto.BucketSpan, deltas []int64) metricdata.ExponentialBucket {
+	var bucket metricdata.ExponentialBucket
+	var count int64
+	d := 0
+	for i, span := range spans {
+		if i == 0 {
+			bucket.Offset = span.GetOffset() - 1
+		} else {
+			for range span.GetOffset() {
+				bucket.Counts = append(bucket.Counts, 0)
+			}
+		}
+		for range span.GetLength() {
+			if d >= len(deltas) {
+				return bucket
+			}
+			count += deltas[d]
+			d++
+			bucket.Counts = append(bucket.Counts, uint64(count))
+		}
+	}
+	return bucket
+}
+
+// Returns true if the histograms of the family use native buckets
+func isNativeHistogram(family *dto.MetricFamily) bool {
+	for _, m := range family.GetMetric() {
+		if m.GetHistogram().Schema != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert the labels of a metric to attributes, dropping the reserved labels
+func convertLabels(labels []*dto.LabelPair) attribute.Set {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for _, l := range labels {
+		if !slices.Contains(reservedLabels, l.GetName()) {
+			attrs = append(attrs, attribute.String(l.GetName(), l.GetValue()))
+		}
+	}
+	return attribute.NewSet(attrs...)
+}
+
+// Convert the exemplars of a metric, the labels like the run ID become filtered attributes
+func convertExemplars(exemplars ...*dto.Exemplar) []metricdata.Exemplar[float64] {
+	var res []metricdata.Exemplar[float64]
+	for _, e := range exemplars {
+		if e == nil {
+			continue
+		}
+		exemplar := metricdata.Exemplar[float64]{Value: e.GetValue()}
+		if e.Timestamp != nil {
+			exemplar.Time = e.GetTimestamp().AsTime()
+		}
+		for _, l := range e.GetLabel() {
+			exemplar.FilteredAttributes = append(exemplar.FilteredAttributes, attribute.String(l.GetName(), l.GetValue()))
+		}
+		res = append(res, exemplar)
+	}
+	return res
+}
+
+// Return the timestamp of the metric, or now if it has none
+func timestamp(m *dto.Metric, now time.Time) time.Time {
+	if m.TimestampMs != nil {
+		return time.UnixMilli(m.GetTimestampMs())
+	}
+	return now
+}
+
+// Return the created timestamp if it is set, otherwise the start of the client
+func (c *Client) startTimeOf(created *timestamppb.Timestamp) time.Time {
+	if created != nil {
+		return created.AsTime()
+	}
+	return c.startTime
+}
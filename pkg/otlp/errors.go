@@ -0,0 +1,41 @@
+package otlp
+
+type ErrMissingEndpoint struct{}
+
+func (e ErrMissingEndpoint) Error() string {
+	return "No endpoint for the OTLP metrics exporter provided"
+}
+
+type ErrInvalidEndpoint struct {
+	Endpoint string
+}
+
+func (e *ErrInvalidEndpoint) Error() string {
+	return "Invalid OTLP endpoint \"" + e.Endpoint + "\", needs to be a http or https url"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrMissingGatherer struct{}
+
+func (e ErrMissingGatherer) Error() string {
+	return "No prometheus gatherer provided"
+}
+
+type ErrClientAlreadyRunning struct{}
+
+func (e ErrClientAlreadyRunning) Error() string {
+	return "Only a single instance of the client can run at a time"
+}
+
+type ErrUnknownMetricType struct {
+	Name string
+}
+
+func (e *ErrUnknownMetricType) Error() string {
+	return "Metric " + e.Name + " has an unknown type"
+}
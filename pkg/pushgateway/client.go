@@ -0,0 +1,281 @@
+package pushgateway
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const httpClientTimeout = 10 * time.Second
+
+// Client pushes the metrics of a prometheus.Gatherer to a Pushgateway, grouped by job and instance
+type Client struct {
+	url      string
+	job      string
+	instance string
+	grouping map[string]string
+	username string
+	password string
+	gatherer prometheus.Gatherer
+	client   *http.Client
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+	// Buffered channel used to request a push, see Trigger
+	trigger chan struct{}
+
+	lastSuccess time.Time
+	lastError   error
+	statusLock  sync.RWMutex
+}
+
+// Status of the client, used for health reporting
+type Status struct {
+	// True while the client is running in the background
+	Running bool
+	// Time of the last successful push, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last push, empty if it was successful
+	LastError string
+}
+
+type ClientOption func(*Client) error
+
+// WithInstance sets the instance of the grouping key.
+// By default the hostname of the machine is used.
+func WithInstance(instance string) ClientOption {
+	return func(c *Client) error {
+		if instance == "" {
+			return ErrMissingInstance{}
+		}
+		c.instance = instance
+		return nil
+	}
+}
+
+// WithGrouping adds further labels to the grouping key, e.g. the site.
+// The labels are removed from the pushed metrics, as the Pushgateway adds them itself.
+func WithGrouping(grouping map[string]string) ClientOption {
+	return func(c *Client) error {
+		for label := range grouping {
+			if label == "job" || label == "instance" {
+				return &ErrInvalidGroupingLabel{Label: label}
+			}
+		}
+		c.grouping = grouping
+		return nil
+	}
+}
+
+// WithBasicAuth sets the credentials for the Pushgateway.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(c *Client) error {
+		c.username = username
+		c.password = password
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls config for the connection to the Pushgateway, e.g. to trust a custom CA or send a client certificate
+func WithTLSConfig(tlsCfg *tls.Config) ClientOption {
+	return func(c *Client) error {
+		c.client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsCfg,
+		}
+		return nil
+	}
+}
+
+// NewClient creates a new Pushgateway client.
+// Parameters:
+//   - pushgatewayURL: Url of the Pushgateway, e.g. http://localhost:9091
+//   - job: Job of the grouping key
+//   - gatherer: Source of the metrics that will be pushed
+//   - opts: optional client options
+func NewClient(pushgatewayURL, job string, gatherer prometheus.Gatherer, opts ...ClientOption) (*Client, error) {
+	err := ValidateURL(pushgatewayURL)
+	if err != nil {
+		return nil, err
+	}
+	if job == "" {
+		return nil, ErrMissingJob{}
+	}
+	if gatherer == nil {
+		return nil, ErrMissingGatherer{}
+	}
+
+	c := &Client{
+		url:      pushgatewayURL,
+		job:      job,
+		instance: utils.Hostname(),
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: httpClientTimeout},
+		trigger:  make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		err = opt(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Verify that the url can be used for the Pushgateway
+func ValidateURL(pushgatewayURL string) error {
+	if pushgatewayURL == "" {
+		return ErrMissingURL{}
+	}
+	u, err := url.Parse(pushgatewayURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrInvalidURL{URL: pushgatewayURL}
+	}
+	return nil
+}
+
+// Create a pusher for the group of this client
+func (c *Client) newPusher() *push.Pusher {
+	pusher := push.New(c.url, c.job).
+		Gatherer(prometheus.GathererFunc(c.gather)).
+		Client(c.client).
+		Grouping("instance", c.instance)
+	for label, value := range c.grouping {
+		pusher = pusher.Grouping(label, value)
+	}
+	if c.username != "" {
+		pusher = pusher.BasicAuth(c.username, c.password)
+	}
+	return pusher
+}
+
+// Gather the metrics and prepare them for the Pushgateway.
+// Removes the labels that are part of the grouping key, as the Pushgateway rejects them,
+// and the timestamps, as the Pushgateway does not accept them either.
+func (c *Client) gather() ([]*dto.MetricFamily, error) {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			m.Label = slices.DeleteFunc(m.Label, func(l *dto.LabelPair) bool {
+				_, grouping := c.grouping[l.GetName()]
+				return grouping || l.GetName() == "job" || l.GetName() == "instance"
+			})
+			m.TimestampMs = nil
+		}
+	}
+	return families, nil
+}
+
+// Collect the current metrics and replace the group in the Pushgateway with them
+func (c *Client) Push(ctx context.Context) error {
+	err := c.newPusher().PushContext(ctx)
+
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.lastError = err
+	if err == nil {
+		c.lastSuccess = time.Now()
+	}
+	return err
+}
+
+// Delete the group of the client from the Pushgateway
+func (c *Client) Delete() error {
+	return c.newPusher().Delete()
+}
+
+// Request a push, e.g. after a speedtest completed.
+// Does not block, requests are merged while a push is pending.
+func (c *Client) Trigger() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Push the metrics whenever Trigger is called.
+// Runs as a background goroutine and does not block the calling thread.
+func (c *Client) Run() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel != nil {
+		return ErrClientAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		slog.Debug("Starting pushgateway client")
+		for {
+			select {
+			case <-c.trigger:
+			case <-ctx.Done():
+				return
+			}
+			err := c.Push(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Failed to push metrics to pushgateway", "err", err)
+			} else if err == nil {
+				slog.Debug("Successfully pushed metrics to pushgateway")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Returns true if the client is currently running
+func (c *Client) IsRunning() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cancel != nil
+}
+
+// Return the current status of the client
+func (c *Client) Status() Status {
+	status := Status{Running: c.IsRunning()}
+
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	status.LastSuccess = c.lastSuccess
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	return status
+}
+
+// Stop the client and wait for the background goroutine to exit.
+// Does nothing if the client is not running.
+func (c *Client) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	slog.Info("Stopped pushgateway client")
+}
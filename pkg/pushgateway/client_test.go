@@ -0,0 +1,267 @@
+package pushgateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Request received by the mockPushgateway
+type pushRequest struct {
+	Method   string
+	Path     string
+	Username string
+	Password string
+	Families []*dto.MetricFamily
+}
+
+// Minimal Pushgateway, records all requests
+type mockPushgateway struct {
+	server   *httptest.Server
+	requests []pushRequest
+	lock     sync.Mutex
+}
+
+func newMockPushgateway(t *testing.T, tlsServer bool) *mockPushgateway {
+	p := &mockPushgateway{}
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		username, password, _ := req.BasicAuth()
+		r := pushRequest{
+			Method:   req.Method,
+			Path:     req.URL.Path,
+			Username: username,
+			Password: password,
+		}
+		if req.Method == http.MethodPut {
+			dec := expfmt.NewDecoder(req.Body, expfmt.ResponseFormat(req.Header))
+			for {
+				mf := &dto.MetricFamily{}
+				err := dec.Decode(mf)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				r.Families = append(r.Families, mf)
+			}
+		}
+
+		p.lock.Lock()
+		p.requests = append(p.requests, r)
+		p.lock.Unlock()
+
+		if req.Method == http.MethodDelete {
+			rw.WriteHeader(http.StatusAccepted)
+		} else {
+			rw.WriteHeader(http.StatusOK)
+		}
+	})
+
+	if tlsServer {
+		p.server = httptest.NewTLSServer(handler)
+	} else {
+		p.server = httptest.NewServer(handler)
+	}
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockPushgateway) Requests() []pushRequest {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]pushRequest(nil), p.requests...)
+}
+
+// Registry with a metric carrying the labels that need to be removed before pushing
+func newTestGatherer() prometheus.Gatherer {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_download_megabits_per_second",
+		Help: "Test metric",
+	}, []string{"instance", "site", "server"})
+	gauge.WithLabelValues("testhost", "home", "1234").Set(876.53)
+	reg.MustRegister(gauge)
+	return reg
+}
+
+func TestValidateURL(t *testing.T) {
+	tMatrix := []struct {
+		URL   string
+		Error error
+	}{
+		{"http://localhost:9091", nil},
+		{"https://pushgateway.example.org/prefix", nil},
+		{"", ErrMissingURL{}},
+		{"localhost:9091", &ErrInvalidURL{URL: "localhost:9091"}},
+		{"tcp://localhost:9091", &ErrInvalidURL{URL: "tcp://localhost:9091"}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.URL, func(t *testing.T) {
+			assert.Equal(t, tCase.Error, ValidateURL(tCase.URL))
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		c, err := NewClient("http://localhost:9091", "speedtest-exporter", newTestGatherer())
+		require.NoError(t, err, "Should create client")
+
+		assert := assert.New(t)
+
+		assert.Equal(utils.Hostname(), c.instance)
+		assert.Empty(c.grouping)
+		assert.Empty(c.username)
+		assert.False(c.IsRunning())
+	})
+	t.Run("InvalidArguments", func(t *testing.T) {
+		_, err := NewClient("http://localhost:9091", "", newTestGatherer())
+		assert.Equal(t, ErrMissingJob{}, err)
+
+		_, err = NewClient("http://localhost:9091", "speedtest-exporter", nil)
+		assert.Equal(t, ErrMissingGatherer{}, err)
+
+		_, err = NewClient("localhost:9091", "speedtest-exporter", newTestGatherer())
+		assert.Equal(t, &ErrInvalidURL{URL: "localhost:9091"}, err)
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		tMatrix := []struct {
+			Name   string
+			Option ClientOption
+			Error  error
+		}{
+			{"Instance", WithInstance(""), ErrMissingInstance{}},
+			{"GroupingJob", WithGrouping(map[string]string{"job": "foo"}), &ErrInvalidGroupingLabel{Label: "job"}},
+			{"GroupingInstance", WithGrouping(map[string]string{"instance": "foo"}), &ErrInvalidGroupingLabel{Label: "instance"}},
+		}
+		for _, tCase := range tMatrix {
+			t.Run(tCase.Name, func(t *testing.T) {
+				_, err := NewClient("http://localhost:9091", "speedtest-exporter", newTestGatherer(), tCase.Option)
+				assert.Equal(t, tCase.Error, err)
+			})
+		}
+	})
+}
+
+func TestPush(t *testing.T) {
+	pg := newMockPushgateway(t, false)
+
+	c, err := NewClient(pg.server.URL, "speedtest-exporter", newTestGatherer(),
+		WithInstance("testhost"),
+		WithGrouping(map[string]string{"site": "home"}),
+		WithBasicAuth("somebody", "secret"),
+	)
+	require.NoError(t, err, "Should create client")
+
+	require.NoError(t, c.Push(context.Background()), "Should push metrics")
+
+	requests := pg.Requests()
+	require.Len(t, requests, 1, "Should send a single request")
+
+	assert := assert.New(t)
+
+	req := requests[0]
+	assert.Equal(http.MethodPut, req.Method, "Should replace the group")
+	assert.Equal("/metrics/job/speedtest-exporter/instance/testhost/site/home", req.Path)
+	assert.Equal("somebody", req.Username)
+	assert.Equal("secret", req.Password)
+
+	require.Len(t, req.Families, 1, "Should push the metric")
+	m := req.Families[0].GetMetric()[0]
+	require.Len(t, m.GetLabel(), 1, "Should remove the grouping labels")
+	assert.Equal("server", m.GetLabel()[0].GetName())
+	assert.Nil(m.TimestampMs, "Should not send timestamps")
+	assert.Equal(876.53, m.GetGauge().GetValue())
+
+	status := c.Status()
+	assert.Empty(status.LastError)
+	assert.False(status.LastSuccess.IsZero(), "Should record the successful push")
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, c.Delete(), "Should delete the group")
+
+		requests := pg.Requests()
+		require.Len(t, requests, 2)
+		assert.Equal(http.MethodDelete, requests[1].Method)
+		assert.Equal("/metrics/job/speedtest-exporter/instance/testhost/site/home", requests[1].Path)
+	})
+}
+
+func TestRun(t *testing.T) {
+	pg := newMockPushgateway(t, false)
+
+	c, err := NewClient(pg.server.URL, "speedtest-exporter", newTestGatherer(), WithInstance("testhost"))
+	require.NoError(t, err, "Should create client")
+
+	require.NoError(t, c.Run(), "Should start client")
+	assert.Equal(t, ErrClientAlreadyRunning{}, c.Run(), "Should not start twice")
+	assert.True(t, c.IsRunning())
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, pg.Requests(), "Should only push when triggered")
+
+	c.Trigger()
+	assert.Eventually(t, func() bool {
+		return len(pg.Requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push after the trigger")
+
+	c.Stop()
+	assert.False(t, c.IsRunning(), "Should be stopped")
+	assert.True(t, c.Status().LastError == "", "Should report the successful push")
+}
+
+func TestPushFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(server.URL, "speedtest-exporter", newTestGatherer(), WithInstance("testhost"))
+	require.NoError(t, err, "Should create client")
+
+	assert.Error(t, c.Push(context.Background()), "Should fail to push")
+	status := c.Status()
+	assert.NotEmpty(t, status.LastError, "Should report the error")
+	assert.True(t, status.LastSuccess.IsZero())
+}
+
+func TestPushTLS(t *testing.T) {
+	pg := newMockPushgateway(t, true)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(pg.server.Certificate())
+
+	t.Run("UnknownCA", func(t *testing.T) {
+		c, err := NewClient(pg.server.URL, "speedtest-exporter", newTestGatherer(), WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+		require.NoError(t, err, "Should create client")
+		assert.Error(t, c.Push(context.Background()), "Should not trust the server")
+	})
+	t.Run("CA", func(t *testing.T) {
+		c, err := NewClient(pg.server.URL, "speedtest-exporter", newTestGatherer(), WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+		require.NoError(t, err, "Should create client")
+		assert.NoError(t, c.Push(context.Background()), "Should push metrics")
+	})
+	t.Run("InsecureSkipVerify", func(t *testing.T) {
+		// #nosec G402: The server certificate is self-signed in tests.
+		c, err := NewClient(pg.server.URL, "speedtest-exporter", newTestGatherer(), WithTLSConfig(&tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12}))
+		require.NoError(t, err, "Should create client")
+		assert.NoError(t, c.Push(context.Background()), "Should push metrics")
+	})
+}
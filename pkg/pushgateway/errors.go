@@ -0,0 +1,47 @@
+package pushgateway
+
+type ErrMissingURL struct{}
+
+func (e ErrMissingURL) Error() string {
+	return "No url for the pushgateway provided"
+}
+
+type ErrInvalidURL struct {
+	URL string
+}
+
+func (e *ErrInvalidURL) Error() string {
+	return "Invalid pushgateway url \"" + e.URL + "\", needs to be a http or https url"
+}
+
+type ErrMissingJob struct{}
+
+func (e ErrMissingJob) Error() string {
+	return "No job name provided"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrMissingGatherer struct{}
+
+func (e ErrMissingGatherer) Error() string {
+	return "No prometheus gatherer provided"
+}
+
+type ErrInvalidGroupingLabel struct {
+	Label string
+}
+
+func (e *ErrInvalidGroupingLabel) Error() string {
+	return "Invalid grouping label \"" + e.Label + "\", job and instance are set by the client"
+}
+
+type ErrClientAlreadyRunning struct{}
+
+func (e ErrClientAlreadyRunning) Error() string {
+	return "Only a single instance of the client can run at a time"
+}
@@ -0,0 +1,610 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+	"github.com/prometheus/client_golang/exp/api/remote"
+	writev2 "github.com/prometheus/client_golang/exp/api/remote/genproto/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Same default as the promremote library the client replaced
+	defaultJobName = "promremote"
+
+	DefaultTimeout      = 10 * time.Second
+	DefaultQueueMaxSize = 16 << 20
+	DefaultMaxBackoff   = 5 * time.Minute
+
+	// Metrics passed to Enqueue that wait to be sent, newer metrics are dropped when it is full
+	pendingSize = 16
+)
+
+// Delay before the first retry of a failed push, doubled after every further failure
+var retryBackoff = time.Second
+
+// Client pushes the metrics of a prometheus.Gatherer to a remote_write endpoint
+type Client struct {
+	// Name of the target, added as label to the metrics of the client
+	name     string
+	instance string
+	job      string
+	relabel  []relabelRule
+	metrics  clientMetrics
+	client   *http.Client
+	// Base transport, configured by WithTLSConfig and WithProxy
+	transport *http.Transport
+	// Added to every request, see requestRoundTripper
+	username    string
+	password    string
+	bearerToken string
+	headers     map[string]string
+	gatherer    prometheus.Gatherer
+	api         *remote.API
+	queue       *queue
+	// Upper limit of the delay between retries
+	maxBackoff time.Duration
+	// Status code of the last response, used to tell permanent from temporary errors
+	lastStatusCode atomic.Int32
+	// Metrics passed to Enqueue, waiting to be sent
+	pending chan prometheus.Gatherer
+	// Set while running with RunOnCompletion, read without the lock by Enqueue
+	onCompletion atomic.Bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+
+	lastSuccess time.Time
+	lastError   error
+	failures    int
+	statusLock  sync.RWMutex
+}
+
+// Status of the client, used for health reporting
+type Status struct {
+	// True while the periodic push is running
+	Running bool
+	// Time of the last successful push, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last push, empty if it was successful
+	LastError string
+	// Number of requests waiting to be sent
+	Queued int
+	// Number of samples dropped, because the queue was full or the endpoint rejected them
+	Dropped int
+}
+
+type ClientOption func(*Client) error
+
+// WithBasicAuth configures basic authentication when sending metrics.
+// Returns an error if username or password are empty.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(c *Client) error {
+		if username == "" || password == "" {
+			return ErrMissingAuthCredentials{}
+		}
+		c.username = username
+		c.password = password
+		return nil
+	}
+}
+
+// WithBearerToken sends the token in the Authorization header of every request.
+// Can not be combined with WithBasicAuth.
+func WithBearerToken(token string) ClientOption {
+	return func(c *Client) error {
+		if token == "" {
+			return ErrMissingBearerToken{}
+		}
+		c.bearerToken = token
+		return nil
+	}
+}
+
+// WithHeaders adds custom headers to every request, e.g. X-Scope-OrgID for multi-tenancy.
+// The headers required by the remote_write protocol and the Authorization header can not be overwritten.
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) error {
+		for name := range headers {
+			if isReservedHeader(name) {
+				return &ErrReservedHeader{Name: name}
+			}
+		}
+		c.headers = headers
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls config for the connection to the endpoint, e.g. to trust a custom CA or send a client certificate
+func WithTLSConfig(tlsCfg *tls.Config) ClientOption {
+	return func(c *Client) error {
+		c.transport.TLSClientConfig = tlsCfg
+		return nil
+	}
+}
+
+// WithProxy sends all requests via the given HTTP proxy.
+// By default the proxy is read from the environment, e.g. HTTPS_PROXY.
+func WithProxy(proxyURL string) ClientOption {
+	return func(c *Client) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			return &ErrInvalidProxyURL{URL: proxyURL}
+		}
+		c.transport.Proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for a single request to the endpoint.
+// Defaults to 10 seconds.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout <= 0 {
+			return &ErrInvalidTimeout{Timeout: timeout}
+		}
+		c.client.Timeout = timeout
+		return nil
+	}
+}
+
+// WithName sets the name of the target, to tell the metrics of multiple clients apart.
+// The name is added as target label to the queue and status metrics of the client.
+func WithName(name string) ClientOption {
+	return func(c *Client) error {
+		if name == "" {
+			return ErrMissingName{}
+		}
+		c.name = name
+		return nil
+	}
+}
+
+// WithRelabel applies the relabel rules to every series before it is sent.
+// Series can be dropped, or their labels changed, e.g. to add a cluster label for a single target.
+func WithRelabel(rules []RelabelRule) ClientOption {
+	return func(c *Client) error {
+		relabel, err := newRelabelRules(rules)
+		if err != nil {
+			return err
+		}
+		c.relabel = relabel
+		return nil
+	}
+}
+
+// WithInstanceLabel sets the instance label for the metrics.
+// By default the hostname of the machine is used.
+func WithInstanceLabel(instance string) ClientOption {
+	return func(c *Client) error {
+		if instance == "" {
+			return ErrMissingInstance{}
+		}
+		c.instance = instance
+		return nil
+	}
+}
+
+// WithJobLabel sets the job label for the metrics.
+// By default "promremote" is used.
+func WithJobLabel(job string) ClientOption {
+	return func(c *Client) error {
+		if job == "" {
+			return ErrMissingJob{}
+		}
+		c.job = job
+		return nil
+	}
+}
+
+// WithQueue persists requests that could not be sent in dir, so they are sent after a restart.
+// The queue keeps at most maxSize bytes, the oldest requests are dropped when it is full.
+// Without a dir the queue is only kept in memory.
+func WithQueue(dir string, maxSize int64) ClientOption {
+	return func(c *Client) error {
+		if maxSize <= 0 {
+			return &ErrInvalidQueueSize{Size: maxSize}
+		}
+		c.queue = newQueue(dir, maxSize)
+		return nil
+	}
+}
+
+// WithMaxBackoff sets the upper limit of the exponential backoff between retries of failed pushes.
+// Defaults to 5 minutes.
+func WithMaxBackoff(maxBackoff time.Duration) ClientOption {
+	return func(c *Client) error {
+		if maxBackoff <= 0 {
+			return &ErrInvalidBackoff{Backoff: maxBackoff}
+		}
+		c.maxBackoff = maxBackoff
+		return nil
+	}
+}
+
+// NewClient creates a new remote_write client.
+// Parameters:
+//   - endpoint: URL of the remote_write endpoint
+//   - gatherer: Source of the metrics that will be pushed
+//   - opts: optional client options
+func NewClient(endpoint string, gatherer prometheus.Gatherer, opts ...ClientOption) (*Client, error) {
+	if endpoint == "" {
+		return nil, ErrMissingEndpoint{}
+	}
+	if gatherer == nil {
+		return nil, ErrMissingGatherer{}
+	}
+
+	c := &Client{
+		instance:   utils.Hostname(),
+		job:        defaultJobName,
+		client:     &http.Client{Timeout: DefaultTimeout},
+		transport:  http.DefaultTransport.(*http.Transport).Clone(),
+		gatherer:   gatherer,
+		queue:      newQueue("", DefaultQueueMaxSize),
+		maxBackoff: DefaultMaxBackoff,
+		pending:    make(chan prometheus.Gatherer, pendingSize),
+	}
+	for _, opt := range opts {
+		err := opt(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.username != "" && c.bearerToken != "" {
+		return nil, ErrConflictingAuth{}
+	}
+	c.metrics = newClientMetrics(c.name)
+	c.client.Transport = &statusCodeRoundTripper{
+		statusCode: &c.lastStatusCode,
+		next: &requestRoundTripper{
+			username:    c.username,
+			password:    c.password,
+			bearerToken: c.bearerToken,
+			headers:     c.headers,
+			next:        c.transport,
+		},
+	}
+
+	// Set an empty path to ensure that our own path is not overridden with the default path.
+	// Disable retries by setting MaxRetries to -1.
+	api, err := remote.NewAPI(endpoint, remote.WithAPIPath(""), remote.WithAPIHTTPClient(c.client), remote.WithAPIBackoff(remote.BackoffConfig{MaxRetries: -1}))
+	if err != nil {
+		return nil, err
+	}
+	c.api = api
+
+	return c, nil
+}
+
+// Collect the current metrics and send them to the remote endpoint.
+// The request is queued behind older requests that could not be sent yet,
+// which are sent first to keep the order of the samples.
+// When sending fails, the request stays in the queue for the next attempt.
+func (c *Client) Push(ctx context.Context) error {
+	err := c.push(ctx)
+	c.setStatus(err)
+	return err
+}
+
+// Same as Push, but without updating the status
+func (c *Client) push(ctx context.Context) error {
+	req, err := c.collect(c.gatherer)
+	if err != nil {
+		return err
+	}
+	err = c.queue.push(req)
+	if err != nil {
+		return err
+	}
+	return c.flush(ctx)
+}
+
+// Queue the metrics of the gatherer for sending, e.g. the metrics of a completed speedtest.
+// Only used when running with RunOnCompletion, the metrics are gathered and sent in the background.
+// Does not block, so it can be called while the speedtest lock is held.
+func (c *Client) Enqueue(gatherer prometheus.Gatherer) {
+	if !c.onCompletion.Load() {
+		return
+	}
+	select {
+	case c.pending <- gatherer:
+	default:
+		slog.Warn("Too many pending remote_write pushes, dropping metrics", slog.String("target", c.name))
+	}
+}
+
+// Send the remaining metrics before shutting down.
+// When running with RunOnCompletion these are the pending results and the queue, otherwise the current metrics are pushed.
+// Metrics that could not be sent stay in the queue.
+func (c *Client) Flush(ctx context.Context) error {
+	if !c.onCompletion.Load() {
+		return c.Push(ctx)
+	}
+
+	var err error
+	for len(c.pending) > 0 && err == nil {
+		err = c.send(ctx, <-c.pending)
+	}
+	if err == nil {
+		err = c.flush(ctx)
+	}
+	c.setStatus(err)
+	return err
+}
+
+// Collect the metrics of the gatherer, queue them and send the queue.
+// Nothing is queued when the gatherer has no metrics, e.g. the heartbeat while a speedtest is running.
+func (c *Client) send(ctx context.Context, gatherer prometheus.Gatherer) error {
+	req, err := c.collect(gatherer)
+	if err != nil {
+		return err
+	}
+	if len(req.Timeseries) > 0 {
+		err = c.queue.push(req)
+		if err != nil {
+			return err
+		}
+	}
+	return c.flush(ctx)
+}
+
+// Send the queued requests, oldest first.
+// Stops at the first temporary error, requests rejected permanently by the endpoint are dropped.
+func (c *Client) flush(ctx context.Context) error {
+	var rejected error
+	for {
+		req, ok, err := c.queue.peek()
+		if err != nil {
+			// Can only fail on corrupt data, which would block the queue forever
+			c.queue.drop()
+			return err
+		}
+		if !ok {
+			return rejected
+		}
+
+		err = c.write(ctx, req)
+		switch {
+		case err == nil:
+			c.queue.pop()
+		case c.isPermanentError():
+			slog.Error("Remote endpoint rejected metrics, dropping them", slog.String("target", c.name), slog.Int("samples", countSamples(req)), "err", err)
+			c.queue.drop()
+			rejected = err
+		default:
+			return err
+		}
+	}
+}
+
+func (c *Client) write(ctx context.Context, req *writev2.Request) error {
+	c.lastStatusCode.Store(0)
+	stats, err := c.api.Write(ctx, remote.WriteV2MessageType, req)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Successfully sent metrics via remote_write", slog.String("target", c.name), slog.Int("count", stats.AllSamples()), slog.Bool("written", !stats.NoDataWritten()))
+	return nil
+}
+
+// Returns true if the endpoint answered the last request in a way that retrying will not change,
+// e.g. a bad request or an accepted request without written samples.
+// Network errors, rate limits and server errors are temporary.
+func (c *Client) isPermanentError() bool {
+	code := int(c.lastStatusCode.Load())
+	return code != 0 && code != http.StatusTooManyRequests && code < http.StatusInternalServerError
+}
+
+// Record the outcome of a push for health reporting
+func (c *Client) setStatus(err error) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	c.lastError = err
+	if err == nil {
+		c.lastSuccess = time.Now()
+	} else {
+		c.failures++
+	}
+}
+
+// Periodically push metrics to the remote endpoint, starting immediately.
+// Failed pushes are retried with exponential backoff until they succeed or the next push is due.
+// Runs as a background goroutine and does not block the calling thread.
+func (c *Client) Run(interval time.Duration) error {
+	return c.run(interval, 0, nil, false)
+}
+
+// Push the metrics passed to Enqueue as soon as they arrive, e.g. after every completed speedtest.
+// The gatherer is still collected every interval to trigger new speedtests, but its metrics are not sent.
+// The metrics of the heartbeat gatherer are pushed every heartbeat interval, e.g. to keep speedtest_up current.
+// Failed pushes are retried with exponential backoff.
+// Runs as a background goroutine and does not block the calling thread.
+func (c *Client) RunOnCompletion(interval, heartbeat time.Duration, heartbeatGatherer prometheus.Gatherer) error {
+	if heartbeatGatherer == nil {
+		return ErrMissingGatherer{}
+	}
+	return c.run(interval, heartbeat, heartbeatGatherer, true)
+}
+
+func (c *Client) run(interval, heartbeat time.Duration, heartbeatGatherer prometheus.Gatherer, onCompletion bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel != nil {
+		return ErrClientAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.onCompletion.Store(onCompletion)
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var heartbeatC <-chan time.Time
+		if onCompletion && heartbeat > 0 {
+			heartbeatTicker := time.NewTicker(heartbeat)
+			defer heartbeatTicker.Stop()
+			heartbeatC = heartbeatTicker.C
+		}
+
+		retry := time.NewTimer(0)
+		retry.Stop()
+		defer retry.Stop()
+		backoff := retryBackoff
+
+		// Schedule a retry after a failed push, as long as something is waiting in the queue
+		handle := func(err error) {
+			c.setStatus(err)
+			if err == nil {
+				retry.Stop()
+				backoff = retryBackoff
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			queued, _, _ := c.queue.stats()
+			slog.Error("Failed to send metrics to remote endpoint", slog.String("target", c.name), slog.Int("queued", queued), "err", err)
+			if queued > 0 {
+				retry.Reset(backoff)
+				backoff = min(2*backoff, c.maxBackoff)
+			}
+		}
+		// Push the metrics, or only trigger a new speedtest when pushing on completion
+		tick := func() {
+			if !onCompletion {
+				handle(c.push(ctx))
+				return
+			}
+			_, err := c.gatherer.Gather()
+			if err != nil {
+				slog.Error("Failed to collect metrics", "err", err)
+			}
+		}
+
+		slog.Debug("Starting remote_write client", slog.String("target", c.name), slog.Bool("onCompletion", onCompletion))
+		tick()
+		for {
+			select {
+			case <-ticker.C:
+				tick()
+			case gatherer := <-c.pending:
+				handle(c.send(ctx, gatherer))
+			case <-heartbeatC:
+				handle(c.send(ctx, heartbeatGatherer))
+			case <-retry.C:
+				handle(c.flush(ctx))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Return the name of the target, empty when none was set
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Returns true if the client is currently running
+func (c *Client) IsRunning() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cancel != nil
+}
+
+// Return the current status of the client
+func (c *Client) Status() Status {
+	status := Status{Running: c.IsRunning()}
+
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	status.LastSuccess = c.lastSuccess
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	status.Queued, _, status.Dropped = c.queue.stats()
+	return status
+}
+
+// Stop the periodic push and wait for the background goroutine to exit.
+// Does nothing if the client is not running.
+func (c *Client) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	slog.Info("Stopped remote_write client", slog.String("target", c.name))
+}
+
+// Records the status code of every response, as the remote api does not expose it in its errors
+type statusCodeRoundTripper struct {
+	statusCode *atomic.Int32
+	next       http.RoundTripper
+}
+
+func (rt *statusCodeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := rt.next.RoundTrip(req)
+	if err == nil {
+		rt.statusCode.Store(int32(res.StatusCode)) // #nosec G115 -- HTTP status codes are 3 digits
+	}
+	return res, err
+}
+
+// Adds the custom headers and the credentials to every request
+type requestRoundTripper struct {
+	username    string
+	password    string
+	bearerToken string
+	headers     map[string]string
+	next        http.RoundTripper
+}
+
+func (rt *requestRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range rt.headers {
+		req.Header.Set(name, value)
+	}
+	if rt.username != "" {
+		req.SetBasicAuth(rt.username, rt.password)
+	}
+	if rt.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+rt.bearerToken)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// Returns true for headers that are set by the client itself
+func isReservedHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Content-Type", "Content-Encoding", "User-Agent", "X-Prometheus-Remote-Write-Version":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,609 @@
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/exp/api/remote"
+	writev2 "github.com/prometheus/client_golang/exp/api/remote/genproto/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Stores all received remote_write requests
+type mockStore struct {
+	requests []*writev2.Request
+	headers  []http.Header
+	// Url of the receiver, set by newFlakyReceiver
+	url  string
+	lock sync.Mutex
+}
+
+func (s *mockStore) Store(req *http.Request, _ remote.WriteMessageType) (*remote.WriteResponse, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	r := &writev2.Request{}
+	err = r.UnmarshalVT(body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r)
+	s.headers = append(s.headers, req.Header.Clone())
+
+	res := remote.NewWriteResponse()
+	res.Samples = len(r.Timeseries)
+	return res, nil
+}
+
+func (s *mockStore) Requests() []*writev2.Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// Create a remote_write receiver for testing
+func newTestReceiver(t *testing.T) (*mockStore, *httptest.Server) {
+	store := &mockStore{}
+	server := httptest.NewServer(remote.NewWriteHandler(store, remote.MessageTypes{remote.WriteV2MessageType}))
+	t.Cleanup(server.Close)
+	return store, server
+}
+
+// Convert the received series into a map of label set to value
+func seriesByLabels(req *writev2.Request) map[string]float64 {
+	res := make(map[string]float64, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		if len(ts.Samples) == 0 {
+			continue
+		}
+		labels := writev2.DesymbolizeLabels(ts.LabelsRefs, req.Symbols, nil)
+		key := ""
+		for i := 0; i < len(labels); i += 2 {
+			key += labels[i] + "=" + labels[i+1] + ","
+		}
+		res[key] = ts.Samples[0].Value
+	}
+	return res
+}
+
+func TestNewClient(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	tMatrix := []struct {
+		Name     string
+		Endpoint string
+		Gatherer prometheus.Gatherer
+		Opts     []ClientOption
+		Error    error
+	}{
+		{"MissingEndpoint", "", reg, nil, ErrMissingEndpoint{}},
+		{"MissingGatherer", "http://localhost", nil, nil, ErrMissingGatherer{}},
+		{"MissingInstance", "http://localhost", reg, []ClientOption{WithInstanceLabel("")}, ErrMissingInstance{}},
+		{"MissingJob", "http://localhost", reg, []ClientOption{WithJobLabel("")}, ErrMissingJob{}},
+		{"MissingPassword", "http://localhost", reg, []ClientOption{WithBasicAuth("user", "")}, ErrMissingAuthCredentials{}},
+		{"InvalidQueueSize", "http://localhost", reg, []ClientOption{WithQueue("", 0)}, &ErrInvalidQueueSize{Size: 0}},
+		{"InvalidBackoff", "http://localhost", reg, []ClientOption{WithMaxBackoff(0)}, &ErrInvalidBackoff{Backoff: 0}},
+		{"MissingBearerToken", "http://localhost", reg, []ClientOption{WithBearerToken("")}, ErrMissingBearerToken{}},
+		{"ConflictingAuth", "http://localhost", reg, []ClientOption{WithBasicAuth("user", "password"), WithBearerToken("token")}, ErrConflictingAuth{}},
+		{"ReservedHeader", "http://localhost", reg, []ClientOption{WithHeaders(map[string]string{"authorization": "foo"})}, &ErrReservedHeader{Name: "authorization"}},
+		{"InvalidProxyURL", "http://localhost", reg, []ClientOption{WithProxy("localhost:3128")}, &ErrInvalidProxyURL{URL: "localhost:3128"}},
+		{"InvalidTimeout", "http://localhost", reg, []ClientOption{WithTimeout(-time.Second)}, &ErrInvalidTimeout{Timeout: -time.Second}},
+		{"MissingName", "http://localhost", reg, []ClientOption{WithName("")}, ErrMissingName{}},
+		{"InvalidRelabel", "http://localhost", reg, []ClientOption{WithRelabel([]RelabelRule{{Action: "foo"}})}, &ErrInvalidRelabelAction{Action: "foo"}},
+		{"Success", "http://localhost", reg, []ClientOption{WithInstanceLabel("test"), WithJobLabel("testjob"), WithBasicAuth("user", "password")}, nil},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			c, err := NewClient(tCase.Endpoint, tCase.Gatherer, tCase.Opts...)
+
+			assert.Equal(t, tCase.Error, err)
+			if tCase.Error == nil {
+				assert.Equal(t, "test", c.instance)
+				assert.Equal(t, "testjob", c.job)
+			}
+		})
+	}
+}
+
+func TestNewClientDefaultJob(t *testing.T) {
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, newGaugeRegistry("test_gauge", 1), WithInstanceLabel("test"))
+	require.NoError(t, err, "Should create client")
+	assert.Equal(t, "promremote", c.job, "Should keep the default job of the promremote library")
+
+	require.NoError(t, c.Push(t.Context()), "Should push metrics")
+
+	requests := store.Requests()
+	require.Len(t, requests, 1, "Should have received a single request")
+	assert.Equal(t, map[string]float64{"__name__=test_gauge,instance=test,job=promremote,": 1}, seriesByLabels(requests[0]), "Should label the metrics with the default job")
+}
+
+func TestPush(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}, []string{"foo", "instance"})
+	gauge.WithLabelValues("bar", "dropped").Set(1.5)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_histogram", Help: "Test histogram", Buckets: []float64{1, 10}})
+	histogram.Observe(5)
+	reg.MustRegister(gauge, histogram)
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, reg, WithInstanceLabel("test"), WithJobLabel("testjob"), WithBasicAuth("user", "password"))
+	require.NoError(err, "Should create client")
+
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := store.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+
+	series := seriesByLabels(requests[0])
+	assert.Equal(map[string]float64{
+		"__name__=test_gauge,foo=bar,instance=test,job=testjob,":            1.5,
+		"__name__=test_histogram_bucket,instance=test,job=testjob,le=1,":    0,
+		"__name__=test_histogram_bucket,instance=test,job=testjob,le=10,":   1,
+		"__name__=test_histogram_bucket,instance=test,job=testjob,le=+Inf,": 1,
+		"__name__=test_histogram_sum,instance=test,job=testjob,":            5,
+		"__name__=test_histogram_count,instance=test,job=testjob,":          1,
+	}, series)
+
+	status := c.Status()
+	assert.False(status.LastSuccess.IsZero(), "Should record the successful push")
+	assert.Empty(status.LastError, "Should not have an error")
+
+	username, password, ok := (&http.Request{Header: store.headers[0]}).BasicAuth()
+	assert.True(ok, "Should send basic auth")
+	assert.Equal("user", username)
+	assert.Equal("password", password)
+}
+
+func TestPushBearerTokenAndHeaders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, newGaugeRegistry("test_gauge", 1),
+		WithBearerToken("secret-token"),
+		WithHeaders(map[string]string{"X-Scope-OrgID": "tenant-1"}),
+	)
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	require.Len(store.headers, 1)
+	assert.Equal("Bearer secret-token", store.headers[0].Get("Authorization"))
+	assert.Equal("tenant-1", store.headers[0].Get("X-Scope-OrgID"))
+	assert.Equal("application/x-protobuf;proto=io.prometheus.write.v2.Request", store.headers[0].Get("Content-Type"), "Should keep the protocol headers")
+}
+
+func TestPushTLS(t *testing.T) {
+	store := &mockStore{}
+	server := httptest.NewTLSServer(remote.NewWriteHandler(store, remote.MessageTypes{remote.WriteV2MessageType}))
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	t.Run("UnknownCA", func(t *testing.T) {
+		c, err := NewClient(server.URL, newGaugeRegistry("test_gauge", 1))
+		require.NoError(t, err, "Should create client")
+		assert.Error(t, c.Push(t.Context()), "Should not trust the server")
+	})
+	t.Run("CA", func(t *testing.T) {
+		c, err := NewClient(server.URL, newGaugeRegistry("test_gauge", 1), WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+		require.NoError(t, err, "Should create client")
+		assert.NoError(t, c.Push(t.Context()), "Should push metrics")
+	})
+}
+
+func TestPushProxy(t *testing.T) {
+	store, server := newTestReceiver(t)
+
+	var proxied atomic.Int32
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+
+	c, err := NewClient("http://remote-write.invalid/api/v1/write", newGaugeRegistry("test_gauge", 1), WithProxy(proxy.URL))
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.Push(t.Context()), "Should push metrics")
+
+	assert.Equal(t, int32(1), proxied.Load(), "Should send the request via the proxy")
+	assert.Len(t, store.Requests(), 1, "Should reach the endpoint")
+}
+
+func TestPushTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-done
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	// Runs before closing the server, which waits for the handler
+	t.Cleanup(func() {
+		close(done)
+	})
+
+	c, err := NewClient(server.URL, newGaugeRegistry("test_gauge", 1), WithTimeout(50*time.Millisecond))
+	require.NoError(t, err, "Should create client")
+
+	start := time.Now()
+	assert.Error(t, c.Push(t.Context()), "Should time out")
+	assert.Less(t, time.Since(start), time.Second, "Should not wait for the response")
+	assert.Equal(t, 1, c.Status().Queued, "Should retry the request later")
+}
+
+func TestPushRelabel(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}, []string{"foo"})
+	gauge.WithLabelValues("bar").Set(1)
+	reg.MustRegister(gauge, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_dropped", Help: "Test gauge"}))
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, reg, WithInstanceLabel("test"), WithJobLabel("testjob"), WithRelabel([]RelabelRule{
+		{SourceLabels: []string{"__name__"}, Regex: "test_dropped", Action: RelabelDrop},
+		{TargetLabel: "cluster", Replacement: "lab"},
+		{Regex: "foo", Action: RelabelLabelDrop},
+	}))
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.Push(t.Context()), "Should push metrics")
+
+	requests := store.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, map[string]float64{
+		"__name__=test_gauge,cluster=lab,instance=test,job=testjob,": 1,
+	}, seriesByLabels(requests[0]), "Should relabel the series before sending them")
+}
+
+func TestPushKeepsTimestamps(t *testing.T) {
+	require := require.New(t)
+
+	timestamp := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	desc := prometheus.NewDesc("test_gauge", "Test gauge", nil, nil)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.CollectorFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.NewMetricWithTimestamp(timestamp, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1))
+	}))
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, reg)
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := store.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+	assert.Equal(t, timestamp.UnixMilli(), requests[0].Timeseries[0].Samples[0].Timestamp, "Should use the timestamp of the metric")
+}
+
+func TestPushNativeHistogram(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:                        "test_histogram",
+		Help:                        "Test histogram",
+		Buckets:                     []float64{1, 10},
+		NativeHistogramBucketFactor: 1.1,
+	})
+	histogram.Observe(5)
+	histogram.Observe(7)
+	reg.MustRegister(histogram)
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, reg, WithInstanceLabel("test"), WithJobLabel("testjob"))
+	require.NoError(err, "Should create client")
+	require.NoError(c.Push(t.Context()), "Should push metrics")
+
+	requests := store.Requests()
+	require.Len(requests, 1, "Should have received a single request")
+
+	assert.Len(seriesByLabels(requests[0]), 5, "Should send the classic buckets as samples")
+
+	var native []*writev2.TimeSeries
+	for _, ts := range requests[0].Timeseries {
+		if len(ts.Histograms) > 0 {
+			native = append(native, ts)
+		}
+	}
+	require.Len(native, 1, "Should send the native histogram as a single series")
+	assert.Equal([]string{"__name__", "test_histogram", "instance", "test", "job", "testjob"}, writev2.DesymbolizeLabels(native[0].LabelsRefs, requests[0].Symbols, nil))
+	h := native[0].Histograms[0]
+	assert.Equal(uint64(2), h.GetCountInt())
+	assert.Equal(12.0, h.Sum)
+	assert.Equal(int32(3), h.Schema)
+	assert.NotEmpty(h.PositiveSpans, "Should convert the bucket spans")
+	assert.Len(h.PositiveDeltas, 2, "Should convert the bucket deltas")
+}
+
+func TestPushFailure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(server.URL, prometheus.NewRegistry())
+	require.NoError(err, "Should create client")
+
+	assert.Error(c.Push(t.Context()), "Should fail to push metrics")
+
+	status := c.Status()
+	assert.True(status.LastSuccess.IsZero(), "Should not have a successful push")
+	assert.NotEmpty(status.LastError, "Should record the error")
+	assert.False(status.Running, "Should not be running")
+}
+
+func TestRunAndStop(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, reg)
+	require.NoError(err, "Should create client")
+
+	require.NoError(c.Run(time.Hour), "Should start client")
+	assert.True(c.IsRunning(), "Client should be running")
+	assert.True(c.Status().Running, "Status should show the client as running")
+	assert.Equal(ErrClientAlreadyRunning{}, c.Run(time.Hour), "Should not start a second time")
+
+	assert.Eventually(func() bool {
+		return len(store.Requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push immediately after start")
+
+	c.Stop()
+	assert.False(c.IsRunning(), "Client should be stopped")
+	assert.NotPanics(c.Stop, "Stopping twice should not panic")
+}
+
+// Registry with a single gauge named name, set to value
+func newGaugeRegistry(name string, value float64) *prometheus.Registry {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: "Test gauge"})
+	gauge.Set(value)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(gauge)
+	return reg
+}
+
+func TestRunOnCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	gathered := &atomic.Int32{}
+	reg := newGaugeRegistry("test_gauge", 1)
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		gathered.Add(1)
+		return reg.Gather()
+	})
+
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, gatherer, WithInstanceLabel("test"), WithJobLabel("testjob"))
+	require.NoError(err, "Should create client")
+
+	c.Enqueue(newGaugeRegistry("test_result", 1))
+	assert.Empty(c.pending, "Should ignore results while not running on completion")
+
+	assert.Equal(ErrMissingGatherer{}, c.RunOnCompletion(time.Hour, time.Hour, nil), "Should require a heartbeat gatherer")
+	require.NoError(c.RunOnCompletion(time.Hour, time.Hour, newGaugeRegistry("test_up", 1)), "Should start client")
+	t.Cleanup(c.Stop)
+	assert.Equal(ErrClientAlreadyRunning{}, c.Run(time.Hour), "Should not start a second time")
+
+	assert.Eventually(func() bool {
+		return gathered.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should gather immediately to trigger a speedtest")
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(store.Requests(), "Should not push the gathered metrics")
+
+	c.Enqueue(newGaugeRegistry("test_result", 42))
+	require.Eventually(func() bool {
+		return len(store.Requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should push the result immediately")
+	assert.Equal(map[string]float64{"__name__=test_result,instance=test,job=testjob,": 42}, seriesByLabels(store.Requests()[0]), "Should only push the result")
+
+	c.Stop()
+	c.Enqueue(newGaugeRegistry("test_result", 43))
+	assert.Len(c.pending, 1, "Should keep results enqueued before stopping")
+	require.NoError(c.Flush(t.Context()), "Should flush pending results")
+	require.Len(store.Requests(), 2)
+	assert.Equal(map[string]float64{"__name__=test_result,instance=test,job=testjob,": 43}, seriesByLabels(store.Requests()[1]))
+}
+
+func TestRunOnCompletionHeartbeat(t *testing.T) {
+	store, server := newTestReceiver(t)
+
+	c, err := NewClient(server.URL, prometheus.NewRegistry(), WithInstanceLabel("test"), WithJobLabel("testjob"))
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.RunOnCompletion(time.Hour, 10*time.Millisecond, newGaugeRegistry("test_up", 1)), "Should start client")
+	t.Cleanup(c.Stop)
+
+	require.Eventually(t, func() bool {
+		return len(store.Requests()) >= 2
+	}, 5*time.Second, 10*time.Millisecond, "Should push the heartbeat periodically")
+	assert.Equal(t, map[string]float64{"__name__=test_up,instance=test,job=testjob,": 1}, seriesByLabels(store.Requests()[0]))
+}
+
+// Remote write receiver that fails with the given status code while failing is set
+func newFlakyReceiver(t *testing.T, statusCode int) (*mockStore, *atomic.Bool) {
+	store := &mockStore{}
+	handler := remote.NewWriteHandler(store, remote.MessageTypes{remote.WriteV2MessageType})
+	failing := &atomic.Bool{}
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "failing", statusCode)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	store.url = server.URL
+	return store, failing
+}
+
+func TestPushQueuesFailedRequests(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"})
+	reg.MustRegister(gauge)
+
+	store, failing := newFlakyReceiver(t, http.StatusServiceUnavailable)
+
+	c, err := NewClient(store.url, reg, WithQueue(t.TempDir(), DefaultQueueMaxSize))
+	require.NoError(err, "Should create client")
+
+	for i := 1; i <= 3; i++ {
+		gauge.Set(float64(i))
+		assert.Error(c.Push(t.Context()), "Should fail while the endpoint is down")
+	}
+	assert.Equal(3, c.Status().Queued, "Should queue the failed requests")
+
+	failing.Store(false)
+	gauge.Set(4)
+	require.NoError(c.Push(t.Context()), "Should push once the endpoint is up again")
+
+	requests := store.Requests()
+	require.Len(requests, 4, "Should replay the queued requests")
+	for i, req := range requests {
+		assert.Equal(float64(i+1), req.Timeseries[0].Samples[0].Value, "Should replay in order")
+	}
+	status := c.Status()
+	assert.Zero(status.Queued, "Should empty the queue")
+	assert.Zero(status.Dropped)
+}
+
+func TestPushDropsRejectedRequests(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	store, _ := newFlakyReceiver(t, http.StatusBadRequest)
+
+	c, err := NewClient(store.url, reg)
+	require.NoError(err, "Should create client")
+
+	assert.Error(c.Push(t.Context()), "Should report the rejected request")
+
+	status := c.Status()
+	assert.Zero(status.Queued, "Should not retry a rejected request")
+	assert.Equal(1, status.Dropped, "Should count the dropped sample")
+}
+
+func TestRunRetriesWithBackoff(t *testing.T) {
+	backoff := retryBackoff
+	retryBackoff = 10 * time.Millisecond
+	t.Cleanup(func() {
+		retryBackoff = backoff
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	store, failing := newFlakyReceiver(t, http.StatusServiceUnavailable)
+
+	c, err := NewClient(store.url, reg)
+	require.NoError(t, err, "Should create client")
+	require.NoError(t, c.Run(time.Hour), "Should start client")
+	t.Cleanup(c.Stop)
+
+	require.Eventually(t, func() bool {
+		return c.Status().Queued == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should queue the failed push")
+
+	failing.Store(false)
+
+	assert.Eventually(t, func() bool {
+		return len(store.Requests()) == 1 && c.Status().Queued == 0
+	}, 5*time.Second, 10*time.Millisecond, "Should retry before the next interval")
+	assert.Empty(t, c.Status().LastError, "Should clear the error after the retry")
+}
+
+func TestClientMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}))
+
+	store, failing := newFlakyReceiver(t, http.StatusServiceUnavailable)
+
+	c, err := NewClient(store.url, reg, WithName("mimir"), WithQueue("", 1))
+	require.NoError(t, err, "Should create client")
+	assert.Error(t, c.Push(t.Context()), "Should fail to push")
+	assert.Error(t, c.Push(t.Context()), "Should fail to push")
+
+	// A second client for another target can be registered next to it
+	other, err := NewClient("http://localhost", reg, WithName("grafana-cloud"))
+	require.NoError(t, err, "Should create client")
+
+	metrics := prometheus.NewRegistry()
+	require.NoError(t, metrics.Register(c), "Should register client as collector")
+	require.NoError(t, metrics.Register(other), "Should register the second client as collector")
+
+	values := gatherClientMetrics(t, metrics, "mimir")
+	assert.Equal(t, 1.0, values["speedtest_remote_write_queue_length"], "Should keep only the newest request")
+	assert.Positive(t, values["speedtest_remote_write_queue_bytes"])
+	assert.Equal(t, 1.0, values["speedtest_remote_write_dropped_samples_total"], "Should drop the oldest request when the queue is full")
+	assert.Equal(t, 2.0, values["speedtest_remote_write_failed_pushes_total"], "Should count the failed pushes")
+	assert.Zero(t, values["speedtest_remote_write_last_success_timestamp_seconds"], "Should not have a successful push")
+
+	failing.Store(false)
+	require.NoError(t, c.Push(t.Context()), "Should push metrics")
+	values = gatherClientMetrics(t, metrics, "mimir")
+	assert.InDelta(t, float64(time.Now().Unix()), values["speedtest_remote_write_last_success_timestamp_seconds"], 5, "Should record the successful push")
+
+	values = gatherClientMetrics(t, metrics, "grafana-cloud")
+	assert.Zero(t, values["speedtest_remote_write_failed_pushes_total"], "Should not be affected by the other target")
+}
+
+// Return the value of every metric of the given target
+func gatherClientMetrics(t *testing.T, reg prometheus.Gatherer, target string) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err, "Should gather metrics")
+
+	values := make(map[string]float64, len(families))
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			if len(m.GetLabel()) != 1 || m.GetLabel()[0].GetName() != "target" || m.GetLabel()[0].GetValue() != target {
+				continue
+			}
+			values[family.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	return values
+}
@@ -0,0 +1,193 @@
+package remote
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	writev2 "github.com/prometheus/client_golang/exp/api/remote/genproto/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Labels that are always set by the client and will be dropped from the collected metrics
+var reservedLabels = []string{"__name__", "instance", "job"}
+
+// Gather the metrics and convert them to a remote_write request
+func (c *Client) collect(gatherer prometheus.Gatherer) (*writev2.Request, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	s := writev2.NewSymbolTable()
+	req := &writev2.Request{}
+
+	for _, family := range families {
+		metricType, err := convertMetricType(family)
+		if err != nil {
+			return nil, err
+		}
+		metadata := &writev2.Metadata{
+			Type:    metricType,
+			HelpRef: s.Symbolize(family.GetHelp()),
+		}
+
+		for _, m := range family.GetMetric() {
+			timestamp := now
+			if m.TimestampMs != nil {
+				timestamp = m.GetTimestampMs()
+			}
+			for _, sample := range splitSamples(family.GetName(), m) {
+				labels, ok := relabel(c.relabel, c.labels(sample.name, m.GetLabel(), sample.extraLabels...))
+				if !ok {
+					continue
+				}
+				req.Timeseries = append(req.Timeseries, &writev2.TimeSeries{
+					Metadata:   metadata,
+					LabelsRefs: s.SymbolizeLabels(labels, nil),
+					Samples: []*writev2.Sample{
+						{
+							Value:     sample.value,
+							Timestamp: timestamp,
+						},
+					},
+				})
+			}
+			if nh := convertNativeHistogram(m.GetHistogram(), timestamp); nh != nil {
+				labels, ok := relabel(c.relabel, c.labels(family.GetName(), m.GetLabel()))
+				if !ok {
+					continue
+				}
+				req.Timeseries = append(req.Timeseries, &writev2.TimeSeries{
+					Metadata:   metadata,
+					LabelsRefs: s.SymbolizeLabels(labels, nil),
+					Histograms: []*writev2.Histogram{nh},
+				})
+			}
+		}
+	}
+
+	req.Symbols = s.Symbols()
+	return req, nil
+}
+
+// Return the sorted list of label name/value pairs for a series
+func (c *Client) labels(name string, metricLabels []*dto.LabelPair, extraLabels ...string) []string {
+	pairs := make([][2]string, 0, len(metricLabels)+len(extraLabels)/2+3)
+	pairs = append(pairs, [2]string{"__name__", name}, [2]string{"instance", c.instance}, [2]string{"job", c.job})
+	for _, l := range metricLabels {
+		if !slices.Contains(reservedLabels, l.GetName()) {
+			pairs = append(pairs, [2]string{l.GetName(), l.GetValue()})
+		}
+	}
+	for i := 0; i+1 < len(extraLabels); i += 2 {
+		pairs = append(pairs, [2]string{extraLabels[i], extraLabels[i+1]})
+	}
+	slices.SortFunc(pairs, func(a, b [2]string) int {
+		return strings.Compare(a[0], b[0])
+	})
+
+	labels := make([]string, 0, 2*len(pairs))
+	for _, p := range pairs {
+		labels = append(labels, p[0], p[1])
+	}
+	return labels
+}
+
+type sample struct {
+	name        string
+	value       float64
+	extraLabels []string
+}
+
+// Split a metric into its individual samples.
+// Summaries and histograms are expanded into their classic series representation.
+func splitSamples(name string, m *dto.Metric) []sample {
+	switch {
+	case m.Counter != nil:
+		return []sample{{name: name, value: m.Counter.GetValue()}}
+	case m.Gauge != nil:
+		return []sample{{name: name, value: m.Gauge.GetValue()}}
+	case m.Untyped != nil:
+		return []sample{{name: name, value: m.Untyped.GetValue()}}
+	case m.Summary != nil:
+		samples := make([]sample, 0, len(m.Summary.GetQuantile())+2)
+		for _, q := range m.Summary.GetQuantile() {
+			samples = append(samples, sample{name: name, value: q.GetValue(), extraLabels: []string{"quantile", formatFloat(q.GetQuantile())}})
+		}
+		return append(samples,
+			sample{name: name + "_sum", value: m.Summary.GetSampleSum()},
+			sample{name: name + "_count", value: float64(m.Summary.GetSampleCount())},
+		)
+	case m.Histogram != nil:
+		samples := make([]sample, 0, len(m.Histogram.GetBucket())+3)
+		for _, b := range m.Histogram.GetBucket() {
+			samples = append(samples, sample{name: name + "_bucket", value: float64(b.GetCumulativeCount()), extraLabels: []string{"le", formatFloat(b.GetUpperBound())}})
+		}
+		return append(samples,
+			sample{name: name + "_bucket", value: float64(m.Histogram.GetSampleCount()), extraLabels: []string{"le", "+Inf"}},
+			sample{name: name + "_sum", value: m.Histogram.GetSampleSum()},
+			sample{name: name + "_count", value: float64(m.Histogram.GetSampleCount())},
+		)
+	default:
+		return nil
+	}
+}
+
+// Convert the native buckets of a histogram, returns nil if the histogram has no native buckets.
+// The classic buckets are sent as separate series by splitSamples.
+func convertNativeHistogram(h *dto.Histogram, timestamp int64) *writev2.Histogram {
+	if h == nil || h.Schema == nil {
+		return nil
+	}
+	return &writev2.Histogram{
+		Count:          &writev2.Histogram_CountInt{CountInt: h.GetSampleCount()},
+		Sum:            h.GetSampleSum(),
+		Schema:         h.GetSchema(),
+		ZeroThreshold:  h.GetZeroThreshold(),
+		ZeroCount:      &writev2.Histogram_ZeroCountInt{ZeroCountInt: h.GetZeroCount()},
+		NegativeSpans:  convertBucketSpans(h.GetNegativeSpan()),
+		NegativeDeltas: h.GetNegativeDelta(),
+		PositiveSpans:  convertBucketSpans(h.GetPositiveSpan()),
+		PositiveDeltas: h.GetPositiveDelta(),
+		Timestamp:      timestamp,
+	}
+}
+
+func convertBucketSpans(spans []*dto.BucketSpan) []*writev2.BucketSpan {
+	res := make([]*writev2.BucketSpan, 0, len(spans))
+	for _, span := range spans {
+		res = append(res, &writev2.BucketSpan{Offset: span.GetOffset(), Length: span.GetLength()})
+	}
+	return res
+}
+
+// Map the prometheus metric type to the remote_write metric type
+func convertMetricType(family *dto.MetricFamily) (writev2.Metadata_MetricType, error) {
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		return writev2.Metadata_METRIC_TYPE_COUNTER, nil
+	case dto.MetricType_GAUGE:
+		return writev2.Metadata_METRIC_TYPE_GAUGE, nil
+	case dto.MetricType_UNTYPED:
+		return writev2.Metadata_METRIC_TYPE_UNSPECIFIED, nil
+	case dto.MetricType_SUMMARY:
+		return writev2.Metadata_METRIC_TYPE_SUMMARY, nil
+	case dto.MetricType_HISTOGRAM:
+		return writev2.Metadata_METRIC_TYPE_HISTOGRAM, nil
+	default:
+		return 0, &ErrUnknownMetricType{Name: family.GetName()}
+	}
+}
+
+// Format a float the same way prometheus does for label values
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
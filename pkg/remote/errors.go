@@ -0,0 +1,138 @@
+package remote
+
+import (
+	"strconv"
+	"time"
+)
+
+type ErrMissingEndpoint struct{}
+
+func (e ErrMissingEndpoint) Error() string {
+	return "No endpoint for prometheus remote_write provided"
+}
+
+type ErrMissingName struct{}
+
+func (e ErrMissingName) Error() string {
+	return "No name for the remote_write target provided"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrMissingJob struct{}
+
+func (e ErrMissingJob) Error() string {
+	return "No job name provided"
+}
+
+type ErrMissingGatherer struct{}
+
+func (e ErrMissingGatherer) Error() string {
+	return "No prometheus gatherer provided"
+}
+
+type ErrMissingAuthCredentials struct{}
+
+func (e ErrMissingAuthCredentials) Error() string {
+	return "Need both username and password, at least one of them is empty"
+}
+
+type ErrMissingBearerToken struct{}
+
+func (e ErrMissingBearerToken) Error() string {
+	return "No bearer token provided"
+}
+
+type ErrConflictingAuth struct{}
+
+func (e ErrConflictingAuth) Error() string {
+	return "Can not use basic auth and a bearer token at the same time"
+}
+
+type ErrReservedHeader struct {
+	Name string
+}
+
+func (e *ErrReservedHeader) Error() string {
+	return "Header " + e.Name + " is set by the remote_write client and can not be overwritten"
+}
+
+type ErrInvalidProxyURL struct {
+	URL string
+}
+
+func (e *ErrInvalidProxyURL) Error() string {
+	return "Invalid proxy url \"" + e.URL + "\", expected an http, https or socks5 url"
+}
+
+type ErrInvalidInterval struct {
+	Interval time.Duration
+}
+
+func (e *ErrInvalidInterval) Error() string {
+	return "Invalid remote_write interval " + e.Interval.String() + ", needs to be greater than 0"
+}
+
+type ErrInvalidTimeout struct {
+	Timeout time.Duration
+}
+
+func (e *ErrInvalidTimeout) Error() string {
+	return "Invalid remote_write timeout " + e.Timeout.String() + ", needs to be greater than 0"
+}
+
+type ErrMissingTargetLabel struct{}
+
+func (e ErrMissingTargetLabel) Error() string {
+	return "Relabel rules with the replace action need a target label"
+}
+
+type ErrInvalidRelabelAction struct {
+	Action string
+}
+
+func (e *ErrInvalidRelabelAction) Error() string {
+	return "Unknown relabel action \"" + e.Action + "\", expected one of replace, keep, drop, labeldrop or labelkeep"
+}
+
+type ErrInvalidRelabelRegex struct {
+	Regex string
+}
+
+func (e *ErrInvalidRelabelRegex) Error() string {
+	return "Invalid relabel regex \"" + e.Regex + "\""
+}
+
+type ErrClientAlreadyRunning struct{}
+
+func (e ErrClientAlreadyRunning) Error() string {
+	return "Only a single instance of the client can run at a time"
+}
+
+type ErrUnknownMetricType struct {
+	Name string
+}
+
+func (e *ErrUnknownMetricType) Error() string {
+	return "Metric " + e.Name + " has an unknown type"
+}
+
+type ErrInvalidQueueSize struct {
+	Size int64
+}
+
+func (e *ErrInvalidQueueSize) Error() string {
+	return "Invalid remote_write queue size " + strconv.FormatInt(e.Size, 10) + ", needs to be greater than 0"
+}
+
+type ErrInvalidBackoff struct {
+	Backoff time.Duration
+}
+
+func (e *ErrInvalidBackoff) Error() string {
+	return "Invalid remote_write backoff " + e.Backoff.String() + ", needs to be greater than 0"
+}
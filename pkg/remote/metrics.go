@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Descriptions of the metrics exposed by a client.
+// They carry the name of the target as label, so the metrics of multiple clients can be registered together.
+type clientMetrics struct {
+	queueLength    *prometheus.Desc
+	queueBytes     *prometheus.Desc
+	droppedSamples *prometheus.Desc
+	lastSuccess    *prometheus.Desc
+	failedPushes   *prometheus.Desc
+}
+
+func newClientMetrics(name string) clientMetrics {
+	var labels prometheus.Labels
+	if name != "" {
+		labels = prometheus.Labels{"target": name}
+	}
+	return clientMetrics{
+		queueLength: prometheus.NewDesc(
+			"speedtest_remote_write_queue_length",
+			"Number of remote_write requests waiting to be sent",
+			nil, labels,
+		),
+		queueBytes: prometheus.NewDesc(
+			"speedtest_remote_write_queue_bytes",
+			"Size of the remote_write requests waiting to be sent in bytes",
+			nil, labels,
+		),
+		droppedSamples: prometheus.NewDesc(
+			"speedtest_remote_write_dropped_samples_total",
+			"Number of samples dropped because the queue was full or the remote endpoint rejected them",
+			nil, labels,
+		),
+		lastSuccess: prometheus.NewDesc(
+			"speedtest_remote_write_last_success_timestamp_seconds",
+			"Unix timestamp of the last successful push to the remote endpoint, 0 if there was none yet",
+			nil, labels,
+		),
+		failedPushes: prometheus.NewDesc(
+			"speedtest_remote_write_failed_pushes_total",
+			"Number of pushes to the remote endpoint that failed",
+			nil, labels,
+		),
+	}
+}
+
+// Implements the Describe function for prometheus.Collector
+func (c *Client) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.metrics.queueLength
+	ch <- c.metrics.queueBytes
+	ch <- c.metrics.droppedSamples
+	ch <- c.metrics.lastSuccess
+	ch <- c.metrics.failedPushes
+}
+
+// Implements the Collect function for prometheus.Collector.
+// Exposes the state of the queue and the pushes, never blocks on a push.
+func (c *Client) Collect(ch chan<- prometheus.Metric) {
+	length, size, dropped := c.queue.stats()
+	ch <- prometheus.MustNewConstMetric(c.metrics.queueLength, prometheus.GaugeValue, float64(length))
+	ch <- prometheus.MustNewConstMetric(c.metrics.queueBytes, prometheus.GaugeValue, float64(size))
+	ch <- prometheus.MustNewConstMetric(c.metrics.droppedSamples, prometheus.CounterValue, float64(dropped))
+
+	c.statusLock.RLock()
+	lastSuccess, failures := c.lastSuccess, c.failures
+	c.statusLock.RUnlock()
+
+	var timestamp float64
+	if !lastSuccess.IsZero() {
+		timestamp = float64(lastSuccess.UnixMilli()) / 1000
+	}
+	ch <- prometheus.MustNewConstMetric(c.metrics.lastSuccess, prometheus.GaugeValue, timestamp)
+	ch <- prometheus.MustNewConstMetric(c.metrics.failedPushes, prometheus.CounterValue, float64(failures))
+}
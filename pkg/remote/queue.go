@@ -0,0 +1,223 @@
+package remote
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	writev2 "github.com/prometheus/client_golang/exp/api/remote/genproto/v2"
+)
+
+const queueFileSuffix = ".bin"
+
+// Queue of requests waiting to be sent, oldest first.
+// When a directory is set, every request is additionally written to disk,
+// so requests that could not be sent survive a restart of the exporter.
+type queue struct {
+	dir     string
+	maxSize int64
+
+	entries []queueEntry
+	size    int64
+	nextID  uint64
+	// Number of samples dropped since the queue was created
+	dropped int
+	// The directory is read on first use, to not interfere with a previous client using it
+	loaded bool
+	lock   sync.Mutex
+}
+
+type queueEntry struct {
+	id      uint64
+	data    []byte
+	samples int
+}
+
+// Create a new queue, keeping at most maxSize bytes of requests.
+// The queue is kept in memory only when dir is empty.
+func newQueue(dir string, maxSize int64) *queue {
+	return &queue{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+}
+
+// Read the requests persisted by a previous run.
+// Falls back to an in-memory queue if the directory can't be used.
+// Assumes the caller holds the lock.
+func (q *queue) load() {
+	if q.loaded {
+		return
+	}
+	q.loaded = true
+	if q.dir == "" {
+		return
+	}
+
+	err := os.MkdirAll(q.dir, 0700)
+	if err != nil {
+		slog.Info("Failed to create remote_write queue directory, will not persist the queue to disk", slog.String("dir", q.dir), slog.Any("error", err))
+		q.dir = ""
+		return
+	}
+
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		slog.Info("Failed to read remote_write queue directory, will not persist the queue to disk", slog.String("dir", q.dir), slog.Any("error", err))
+		q.dir = ""
+		return
+	}
+
+	// The files are sorted by name, which matches their order due to the zero padded ids
+	for _, file := range files {
+		id, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), queueFileSuffix), 10, 64)
+		if file.IsDir() || !strings.HasSuffix(file.Name(), queueFileSuffix) || err != nil {
+			continue
+		}
+		path := filepath.Join(q.dir, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("Failed to read queued remote_write request", slog.String("file", path), slog.Any("error", err))
+			continue
+		}
+		req := &writev2.Request{}
+		err = req.UnmarshalVT(data)
+		if err != nil {
+			slog.Warn("Removing corrupt remote_write request from queue", slog.String("file", path), slog.Any("error", err))
+			_ = os.Remove(path)
+			continue
+		}
+		q.entries = append(q.entries, queueEntry{id: id, data: data, samples: countSamples(req)})
+		q.size += int64(len(data))
+		q.nextID = id + 1
+	}
+	if len(q.entries) > 0 {
+		slog.Info("Loaded queued remote_write requests from disk", slog.Int("count", len(q.entries)), slog.String("dir", q.dir))
+	}
+	q.enforceMaxSize()
+}
+
+// Add a request to the end of the queue.
+// Drops the oldest requests when the queue would exceed its maximum size.
+func (q *queue) push(req *writev2.Request) error {
+	data, err := req.MarshalVT()
+	if err != nil {
+		return err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.load()
+
+	entry := queueEntry{id: q.nextID, data: data, samples: countSamples(req)}
+	q.nextID++
+	if q.dir != "" {
+		err = writeFileAtomic(q.path(entry.id), data)
+		if err != nil {
+			return err
+		}
+	}
+	q.entries = append(q.entries, entry)
+	q.size += int64(len(data))
+	q.enforceMaxSize()
+	return nil
+}
+
+// Return the oldest request without removing it
+func (q *queue) peek() (*writev2.Request, bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.load()
+
+	if len(q.entries) == 0 {
+		return nil, false, nil
+	}
+	req := &writev2.Request{}
+	err := req.UnmarshalVT(q.entries[0].data)
+	if err != nil {
+		return nil, false, err
+	}
+	return req, true, nil
+}
+
+// Remove the oldest request after it was sent
+func (q *queue) pop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.remove()
+}
+
+// Remove the oldest request without sending it, counting its samples as dropped
+func (q *queue) drop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.entries) > 0 {
+		q.dropped += q.entries[0].samples
+	}
+	q.remove()
+}
+
+// Remove the oldest entry from memory and disk.
+// Assumes the caller holds the lock.
+func (q *queue) remove() {
+	if len(q.entries) == 0 {
+		return
+	}
+	entry := q.entries[0]
+	q.entries = q.entries[1:]
+	q.size -= int64(len(entry.data))
+	if q.dir != "" {
+		err := os.Remove(q.path(entry.id))
+		if err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove sent remote_write request from disk", slog.Any("error", err))
+		}
+	}
+}
+
+// Drop the oldest requests until the queue fits its maximum size.
+// The newest request is always kept, so it is sent even when it is larger than the queue.
+// Assumes the caller holds the lock.
+func (q *queue) enforceMaxSize() {
+	for q.maxSize > 0 && q.size > q.maxSize && len(q.entries) > 1 {
+		slog.Warn("Remote_write queue is full, dropping oldest request", slog.Int("samples", q.entries[0].samples))
+		q.dropped += q.entries[0].samples
+		q.remove()
+	}
+}
+
+// Return the number of queued requests, their size in bytes and the number of dropped samples
+func (q *queue) stats() (length int, size int64, dropped int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.entries), q.size, q.dropped
+}
+
+func (q *queue) path(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, queueFileSuffix))
+}
+
+// Write the file under a temporary name first, so a crash never leaves a partial request behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Count the samples and histograms contained in the request
+func countSamples(req *writev2.Request) int {
+	count := 0
+	for _, ts := range req.Timeseries {
+		count += len(ts.Samples) + len(ts.Histograms)
+	}
+	return count
+}
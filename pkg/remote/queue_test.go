@@ -0,0 +1,133 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	writev2 "github.com/prometheus/client_golang/exp/api/remote/genproto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a request with a single sample per value
+func newTestRequest(values ...float64) *writev2.Request {
+	s := writev2.NewSymbolTable()
+	req := &writev2.Request{}
+	for _, value := range values {
+		req.Timeseries = append(req.Timeseries, &writev2.TimeSeries{
+			LabelsRefs: s.SymbolizeLabels([]string{"__name__", "test_gauge"}, nil),
+			Samples:    []*writev2.Sample{{Value: value, Timestamp: 1}},
+		})
+	}
+	req.Symbols = s.Symbols()
+	return req
+}
+
+// Return the value of the first sample of the oldest request
+func peekValue(t *testing.T, q *queue) float64 {
+	t.Helper()
+	req, ok, err := q.peek()
+	require.NoError(t, err, "Should read request")
+	require.True(t, ok, "Should have a request")
+	return req.Timeseries[0].Samples[0].Value
+}
+
+func TestQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newQueue("", DefaultQueueMaxSize)
+
+	_, ok, err := q.peek()
+	assert.NoError(err)
+	assert.False(ok, "Should start empty")
+
+	require.NoError(t, q.push(newTestRequest(1)))
+	require.NoError(t, q.push(newTestRequest(2, 3)))
+
+	length, size, dropped := q.stats()
+	assert.Equal(2, length)
+	assert.Positive(size)
+	assert.Zero(dropped)
+
+	assert.Equal(1.0, peekValue(t, q), "Should return the oldest request first")
+	q.pop()
+	assert.Equal(2.0, peekValue(t, q))
+	q.drop()
+
+	length, size, dropped = q.stats()
+	assert.Zero(length)
+	assert.Zero(size)
+	assert.Equal(2, dropped, "Should count the samples of the dropped request")
+}
+
+func TestQueueMaxSize(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := newTestRequest(1).MarshalVT()
+	require.NoError(t, err)
+
+	q := newQueue("", int64(2*len(data)))
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, q.push(newTestRequest(float64(i))))
+	}
+
+	length, _, dropped := q.stats()
+	assert.Equal(2, length, "Should keep the queue within its maximum size")
+	assert.Equal(1, dropped)
+	assert.Equal(2.0, peekValue(t, q), "Should drop the oldest request")
+
+	t.Run("LargerThanQueue", func(t *testing.T) {
+		q := newQueue("", 1)
+		require.NoError(t, q.push(newTestRequest(1)))
+
+		length, _, dropped := q.stats()
+		assert.Equal(1, length, "Should keep the newest request")
+		assert.Zero(dropped)
+	})
+}
+
+func TestQueuePersistence(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "queue")
+
+	q := newQueue(dir, DefaultQueueMaxSize)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, q.push(newTestRequest(float64(i))))
+	}
+	q.pop()
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err, "Should create the directory")
+	assert.Len(files, 2, "Should remove sent requests from disk")
+
+	// Written by something else, should be ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("foo"), 0600))
+	// Corrupt request, should be removed
+	corrupt := filepath.Join(dir, "00000000000000000100.bin")
+	require.NoError(t, os.WriteFile(corrupt, []byte{0xff, 0xff, 0xff}, 0600))
+
+	q = newQueue(dir, DefaultQueueMaxSize)
+	length, _, _ := q.stats()
+	assert.Zero(length, "Should only read the directory on first use")
+
+	assert.Equal(2.0, peekValue(t, q), "Should restore the queue in order")
+	length, _, _ = q.stats()
+	assert.Equal(2, length)
+	assert.NoFileExists(corrupt, "Should remove corrupt requests")
+
+	require.NoError(t, q.push(newTestRequest(4)))
+	assert.FileExists(filepath.Join(dir, "00000000000000000003.bin"), "Should continue the ids of the previous run")
+}
+
+func TestQueueInvalidDirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+
+	q := newQueue(filepath.Join(file, "queue"), DefaultQueueMaxSize)
+	require.NoError(t, q.push(newTestRequest(1)), "Should fall back to memory")
+
+	assert.Empty(t, q.dir)
+	assert.Equal(t, 1.0, peekValue(t, q))
+}
@@ -0,0 +1,156 @@
+package remote
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Actions for a RelabelRule, they behave like the prometheus actions of the same name
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+)
+
+const (
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+// RelabelRule modifies the labels of a series before it is sent, or drops the series.
+// The rules are applied in order, the same way prometheus applies write_relabel_configs.
+type RelabelRule struct {
+	// Labels whose values are joined with the separator and matched against the regex
+	SourceLabels []string
+	// Separator for joining the source labels, defaults to ";"
+	Separator string
+	// Anchored regular expression, defaults to "(.*)"
+	Regex string
+	// Label that is set to the replacement, only used by the replace action
+	TargetLabel string
+	// Replacement for the target label, can reference capture groups of the regex, defaults to "$1"
+	Replacement string
+	// One of replace, keep, drop, labeldrop or labelkeep, defaults to replace
+	Action string
+}
+
+// A RelabelRule with defaults applied and the regex compiled
+type relabelRule struct {
+	RelabelRule
+	regex *regexp.Regexp
+}
+
+// Apply the defaults and compile the rule, fails when it is invalid
+func newRelabelRule(rule RelabelRule) (relabelRule, error) {
+	if rule.Separator == "" {
+		rule.Separator = defaultRelabelSeparator
+	}
+	if rule.Regex == "" {
+		rule.Regex = defaultRelabelRegex
+	}
+	if rule.Replacement == "" {
+		rule.Replacement = defaultRelabelReplacement
+	}
+	if rule.Action == "" {
+		rule.Action = RelabelReplace
+	}
+
+	switch rule.Action {
+	case RelabelReplace:
+		if rule.TargetLabel == "" {
+			return relabelRule{}, ErrMissingTargetLabel{}
+		}
+	case RelabelKeep, RelabelDrop, RelabelLabelDrop, RelabelLabelKeep:
+	default:
+		return relabelRule{}, &ErrInvalidRelabelAction{Action: rule.Action}
+	}
+
+	regex, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+	if err != nil {
+		return relabelRule{}, &ErrInvalidRelabelRegex{Regex: rule.Regex}
+	}
+	return relabelRule{RelabelRule: rule, regex: regex}, nil
+}
+
+// Compile all rules, fails on the first invalid rule
+func newRelabelRules(rules []RelabelRule) ([]relabelRule, error) {
+	res := make([]relabelRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := newRelabelRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// Apply the rules to the sorted label name/value pairs of a series.
+// Returns the new sorted labels, or false when the series should be dropped.
+func relabel(rules []relabelRule, labels []string) ([]string, bool) {
+	if len(rules) == 0 {
+		return labels, true
+	}
+
+	values := make(map[string]string, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		values[labels[i]] = labels[i+1]
+	}
+
+	for _, rule := range rules {
+		source := make([]string, 0, len(rule.SourceLabels))
+		for _, name := range rule.SourceLabels {
+			source = append(source, values[name])
+		}
+		value := strings.Join(source, rule.Separator)
+
+		switch rule.Action {
+		case RelabelReplace:
+			match := rule.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			res := string(rule.regex.ExpandString(nil, rule.Replacement, value, match))
+			if res == "" {
+				delete(values, rule.TargetLabel)
+			} else {
+				values[rule.TargetLabel] = res
+			}
+		case RelabelKeep:
+			if !rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case RelabelDrop:
+			if rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case RelabelLabelDrop, RelabelLabelKeep:
+			for name := range values {
+				if rule.regex.MatchString(name) == (rule.Action == RelabelLabelDrop) {
+					delete(values, name)
+				}
+			}
+		}
+	}
+
+	// A series can't be sent without a name
+	if values["__name__"] == "" {
+		return nil, false
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	res := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		res = append(res, name, values[name])
+	}
+	return res, true
+}
@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRelabelRule(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Rule  RelabelRule
+		Error error
+	}{
+		{"Replace", RelabelRule{TargetLabel: "cluster", Replacement: "home"}, nil},
+		{"Drop", RelabelRule{SourceLabels: []string{"__name__"}, Regex: "go_.*", Action: RelabelDrop}, nil},
+		{"MissingTargetLabel", RelabelRule{Replacement: "home"}, ErrMissingTargetLabel{}},
+		{"InvalidAction", RelabelRule{Action: "hashmod"}, &ErrInvalidRelabelAction{Action: "hashmod"}},
+		{"InvalidRegex", RelabelRule{Regex: "(", Action: RelabelKeep}, &ErrInvalidRelabelRegex{Regex: "("}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			_, err := newRelabelRule(tCase.Rule)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		rule, err := newRelabelRule(RelabelRule{TargetLabel: "foo"})
+		require.NoError(t, err)
+
+		assert := assert.New(t)
+		assert.Equal(RelabelReplace, rule.Action)
+		assert.Equal(";", rule.Separator)
+		assert.Equal("(.*)", rule.Regex)
+		assert.Equal("$1", rule.Replacement)
+	})
+}
+
+func TestRelabel(t *testing.T) {
+	labels := []string{"__name__", "speedtest_up", "instance", "home", "job", "speedtest-exporter", "site", "berlin"}
+
+	tMatrix := []struct {
+		Name   string
+		Rules  []RelabelRule
+		Result []string
+	}{
+		{
+			Name:   "NoRules",
+			Result: labels,
+		},
+		{
+			Name:   "AddLabel",
+			Rules:  []RelabelRule{{TargetLabel: "cluster", Replacement: "lab"}},
+			Result: []string{"__name__", "speedtest_up", "cluster", "lab", "instance", "home", "job", "speedtest-exporter", "site", "berlin"},
+		},
+		{
+			Name:   "ReplaceWithCaptureGroups",
+			Rules:  []RelabelRule{{SourceLabels: []string{"instance", "site"}, Regex: "(.*);(.*)", TargetLabel: "instance", Replacement: "$2-$1"}},
+			Result: []string{"__name__", "speedtest_up", "instance", "berlin-home", "job", "speedtest-exporter", "site", "berlin"},
+		},
+		{
+			Name:   "ReplaceNoMatch",
+			Rules:  []RelabelRule{{SourceLabels: []string{"site"}, Regex: "munich", TargetLabel: "site", Replacement: "bavaria"}},
+			Result: labels,
+		},
+		{
+			Name:   "RemoveLabelWithEmptyReplacement",
+			Rules:  []RelabelRule{{SourceLabels: []string{"site"}, Regex: "berlin", TargetLabel: "site", Replacement: "$2"}},
+			Result: []string{"__name__", "speedtest_up", "instance", "home", "job", "speedtest-exporter"},
+		},
+		{
+			Name:   "Keep",
+			Rules:  []RelabelRule{{SourceLabels: []string{"__name__"}, Regex: "speedtest_.*", Action: RelabelKeep}},
+			Result: labels,
+		},
+		{
+			Name:  "KeepNoMatch",
+			Rules: []RelabelRule{{SourceLabels: []string{"__name__"}, Regex: "speedtest_download.*", Action: RelabelKeep}},
+		},
+		{
+			Name:  "Drop",
+			Rules: []RelabelRule{{SourceLabels: []string{"__name__"}, Regex: "speedtest_up", Action: RelabelDrop}},
+		},
+		{
+			Name:   "LabelDrop",
+			Rules:  []RelabelRule{{Regex: "site|job", Action: RelabelLabelDrop}},
+			Result: []string{"__name__", "speedtest_up", "instance", "home"},
+		},
+		{
+			Name:   "LabelKeep",
+			Rules:  []RelabelRule{{Regex: "__name__|instance", Action: RelabelLabelKeep}},
+			Result: []string{"__name__", "speedtest_up", "instance", "home"},
+		},
+		{
+			Name:  "DropName",
+			Rules: []RelabelRule{{Regex: "__name__", Action: RelabelLabelDrop}},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			rules, err := newRelabelRules(tCase.Rules)
+			require.NoError(t, err, "Should compile rules")
+
+			res, ok := relabel(rules, labels)
+			assert.Equal(t, tCase.Result != nil, ok, "Should only drop the series when expected")
+			assert.Equal(t, tCase.Result, res)
+		})
+	}
+}
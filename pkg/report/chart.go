@@ -0,0 +1,144 @@
+package report
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+)
+
+// Size of the chart in pixels, small enough to be shown inline by mail clients
+const (
+	chartWidth  = 600
+	chartHeight = 200
+	// Number of horizontal grid lines
+	chartGridLines = 4
+)
+
+// Colors of the chart, also referenced by the legend of the mail
+var (
+	colorBackground = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	colorGrid       = color.RGBA{0xE0, 0xE0, 0xE0, 0xFF}
+	colorDownload   = color.RGBA{0x1F, 0x77, 0xB4, 0xFF}
+	colorUpload     = color.RGBA{0x2C, 0xA0, 0x2C, 0xFF}
+	colorContract   = color.RGBA{0xFF, 0x7F, 0x0E, 0xFF}
+	colorFailure    = color.RGBA{0xD6, 0x27, 0x28, 0xFF}
+)
+
+// Render the download and upload speeds of the digest over time as png.
+// Failed speedtests are marked with vertical lines, the contracted download speed with a horizontal line.
+// Returns nil if there are no results to show.
+func renderChart(d Digest) ([]byte, error) {
+	if len(d.Results) == 0 {
+		return nil, nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{colorBackground}, image.Point{}, draw.Src)
+
+	maxValue := chartMax(d)
+	x := func(t time.Time) int {
+		period := d.To.Sub(d.From)
+		if period <= 0 {
+			return 0
+		}
+		return int(float64(chartWidth-1) * float64(t.Sub(d.From)) / float64(period))
+	}
+	y := func(value float64) int {
+		return chartHeight - 1 - int(float64(chartHeight-1)*value/maxValue)
+	}
+
+	for i := 1; i <= chartGridLines; i++ {
+		gridY := chartHeight - 1 - i*(chartHeight-1)/(chartGridLines+1)
+		drawLine(img, 0, gridY, chartWidth-1, gridY, colorGrid)
+	}
+	for _, compliance := range d.SLA {
+		if compliance.Target == collector.SLATargetDownload {
+			drawLine(img, 0, y(compliance.Contracted), chartWidth-1, y(compliance.Contracted), colorContract)
+		}
+	}
+
+	var prevX, prevDownload, prevUpload int
+	first := true
+	for _, result := range d.Results {
+		resultX := x(result.TimestampAsTime())
+		if !result.Success() {
+			drawLine(img, resultX, 0, resultX, chartHeight-1, colorFailure)
+			continue
+		}
+		download, upload := y(result.DownloadSpeed()), y(result.UploadSpeed())
+		if first {
+			prevX, prevDownload, prevUpload = resultX, download, upload
+			first = false
+		}
+		drawThickLine(img, prevX, prevDownload, resultX, download, colorDownload)
+		drawThickLine(img, prevX, prevUpload, resultX, upload, colorUpload)
+		prevX, prevDownload, prevUpload = resultX, download, upload
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Upper end of the y axis, leaves some room above the highest value
+func chartMax(d Digest) float64 {
+	maxValue := max(d.Download.Max, d.Upload.Max)
+	for _, compliance := range d.SLA {
+		if compliance.Target == collector.SLATargetDownload {
+			maxValue = max(maxValue, compliance.Contracted)
+		}
+	}
+	if maxValue <= 0 {
+		return 1
+	}
+	return maxValue * 1.1
+}
+
+// Draw a line with a width of 2 pixels
+func drawThickLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	drawLine(img, x0, y0, x1, y1, c)
+	drawLine(img, x0, y0-1, x1, y1-1, c)
+}
+
+// Draw a line between both points with Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
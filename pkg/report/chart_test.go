@@ -0,0 +1,56 @@
+package report
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderChart(t *testing.T) {
+	to := time.Date(2026, time.March, 9, 8, 0, 0, 0, time.UTC)
+	from := to.Add(-24 * time.Hour)
+	results := []*speedtest.SpeedtestResult{
+		newTestResult(t, from.Add(time.Hour), 90, 20, 15),
+		newTestResult(t, from.Add(12*time.Hour), 0, 0, 0),
+		newTestResult(t, to.Add(-time.Hour), 60, 10, 30),
+	}
+	d := NewDigest("testhost", from, to, results, collector.SLAOptions{Download: 100, Threshold: 0.8})
+
+	data, err := renderChart(d)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err, "Should be a valid png")
+
+	assert := assert.New(t)
+	assert.Equal(chartWidth, img.Bounds().Dx())
+	assert.Equal(chartHeight, img.Bounds().Dy())
+	assert.Equal(colorBackground, color.RGBAModel.Convert(img.At(1, chartHeight-2)))
+
+	failureX := (chartWidth - 1) / 2
+	assert.Equal(colorFailure, color.RGBAModel.Convert(img.At(failureX, chartHeight/2)), "Should mark the failed test")
+
+	contractY := chartHeight - 1 - int(float64(chartHeight-1)*100/chartMax(d))
+	assert.Equal(colorContract, color.RGBAModel.Convert(img.At(5, contractY)), "Should show the contracted download")
+
+	t.Run("NoResults", func(t *testing.T) {
+		data, err := renderChart(NewDigest("testhost", from, to, nil, collector.DefaultSLAOptions()))
+		assert.NoError(err)
+		assert.Nil(data, "Should not render a chart without results")
+	})
+}
+
+func TestChartMax(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.InDelta(110.0, chartMax(Digest{Download: Stats{Max: 100}, Upload: Stats{Max: 50}}), 0.001)
+	assert.InDelta(220.0, chartMax(Digest{Download: Stats{Max: 100}, SLA: []collector.SLACompliance{{Target: collector.SLATargetDownload, Contracted: 200}}}), 0.001, "Should include the contracted download")
+	assert.Equal(1.0, chartMax(Digest{}), "Should not divide by 0")
+}
@@ -0,0 +1,98 @@
+package report
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+)
+
+// Summary of the speedtests of an instance over a period
+type Digest struct {
+	Instance string
+	// Start of the period
+	From time.Time
+	// End of the period
+	To time.Time
+	// Number of speedtests, including failed ones
+	Tests int
+	// Number of failed speedtests
+	Failures int
+	// Download speed in Mbit/s of the successful tests
+	Download Stats
+	// Upload speed in Mbit/s of the successful tests
+	Upload Stats
+	// Ping in ms of the successful tests
+	Ping Stats
+	// Compliance with the configured targets of the SLA, empty when no contract is configured
+	SLA []collector.SLACompliance
+	// Results of the period, sorted by time
+	Results []*speedtest.SpeedtestResult
+}
+
+// Minimum, median and maximum of a measurement
+type Stats struct {
+	Min    float64
+	Median float64
+	Max    float64
+}
+
+// Create the digest of the results between from and to.
+// Results outside of the period are ignored.
+func NewDigest(instance string, from, to time.Time, results []*speedtest.SpeedtestResult, sla collector.SLAOptions) Digest {
+	d := Digest{
+		Instance: instance,
+		From:     from,
+		To:       to,
+	}
+	for _, result := range results {
+		if result == nil || result.TimestampAsTime().Before(from) || result.TimestampAsTime().After(to) {
+			continue
+		}
+		d.Results = append(d.Results, result)
+	}
+	slices.SortStableFunc(d.Results, func(a, b *speedtest.SpeedtestResult) int {
+		return cmp.Compare(a.Timestamp(), b.Timestamp())
+	})
+
+	var download, upload, ping []float64
+	for _, result := range d.Results {
+		if !result.Success() {
+			d.Failures++
+			continue
+		}
+		download = append(download, result.DownloadSpeed())
+		upload = append(upload, result.UploadSpeed())
+		ping = append(ping, result.Ping())
+	}
+	d.Tests = len(d.Results)
+	d.Download = newStats(download)
+	d.Upload = newStats(upload)
+	d.Ping = newStats(ping)
+
+	if sla.Enabled() {
+		d.SLA = sla.Compliance(d.Results)
+	}
+	return d
+}
+
+// Calculate the stats of the values, all are 0 when there are no values
+func newStats(values []float64) Stats {
+	if len(values) == 0 {
+		return Stats{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	return Stats{
+		Min:    sorted[0],
+		Median: median,
+		Max:    sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,96 @@
+package report
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a result of a speedtest run at the given time, a download of 0 creates a failed result
+func newTestResult(t *testing.T, ts time.Time, download, upload, ping float64) *speedtest.SpeedtestResult {
+	data := fmt.Sprintf(`{"download_mbps":%f,"upload_mbps":%f,"ping_ms":%f,"server_host":"example.org","client_isp":"Foo Corp.","success":%t,"timestamp":%d}`,
+		download, upload, ping, download > 0, ts.UnixMilli())
+
+	var result speedtest.SpeedtestResult
+	require.NoError(t, json.Unmarshal([]byte(data), &result))
+	return &result
+}
+
+func TestNewDigest(t *testing.T) {
+	to := time.Date(2026, time.March, 9, 8, 0, 0, 0, time.UTC)
+	from := to.Add(-7 * 24 * time.Hour)
+
+	results := []*speedtest.SpeedtestResult{
+		newTestResult(t, to.Add(-time.Hour), 90, 20, 15),
+		nil,
+		newTestResult(t, to.Add(-3*time.Hour), 60, 10, 30),
+		newTestResult(t, to.Add(-2*time.Hour), 0, 0, 0),
+		newTestResult(t, from.Add(-time.Hour), 1, 1, 100),
+		newTestResult(t, to.Add(-4*time.Hour), 100, 40, 10),
+		newTestResult(t, to.Add(-5*time.Hour), 80, 30, 20),
+	}
+	sla := collector.SLAOptions{Download: 100, Latency: 25, Threshold: 0.8, Window: time.Hour}
+
+	d := NewDigest("testhost", from, to, results, sla)
+
+	assert := assert.New(t)
+	assert.Equal("testhost", d.Instance)
+	assert.Equal(from, d.From)
+	assert.Equal(to, d.To)
+	assert.Equal(5, d.Tests, "Should ignore results outside of the period")
+	assert.Equal(1, d.Failures)
+	assert.Equal(Stats{Min: 60, Median: 85, Max: 100}, d.Download)
+	assert.Equal(Stats{Min: 10, Median: 25, Max: 40}, d.Upload)
+	assert.Equal(Stats{Min: 10, Median: 17.5, Max: 30}, d.Ping)
+	assert.Equal([]collector.SLACompliance{
+		{Target: collector.SLATargetDownload, Contracted: 100, Tests: 5, Compliant: 3},
+		{Target: collector.SLATargetLatency, Contracted: 25, Tests: 5, Compliant: 3},
+	}, d.SLA)
+
+	require.Len(t, d.Results, 5)
+	for i := 1; i < len(d.Results); i++ {
+		assert.LessOrEqual(d.Results[i-1].Timestamp(), d.Results[i].Timestamp(), "Should sort the results by time")
+	}
+
+	t.Run("WithoutSLA", func(t *testing.T) {
+		d := NewDigest("testhost", from, to, results, collector.DefaultSLAOptions())
+		assert.Empty(d.SLA)
+	})
+	t.Run("NoResults", func(t *testing.T) {
+		d := NewDigest("testhost", from, to, nil, sla)
+
+		assert.Zero(d.Tests)
+		assert.Equal(Stats{}, d.Download)
+		assert.Equal([]collector.SLACompliance{
+			{Target: collector.SLATargetDownload, Contracted: 100},
+			{Target: collector.SLATargetLatency, Contracted: 25},
+		}, d.SLA)
+	})
+}
+
+func TestNewStats(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Values []float64
+		Result Stats
+	}{
+		{"Empty", nil, Stats{}},
+		{"Single", []float64{5}, Stats{Min: 5, Median: 5, Max: 5}},
+		{"Odd", []float64{3, 1, 2}, Stats{Min: 1, Median: 2, Max: 3}},
+		{"Even", []float64{4, 1, 3, 2}, Stats{Min: 1, Median: 2.5, Max: 4}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			values := append([]float64(nil), tCase.Values...)
+			assert.Equal(t, tCase.Result, newStats(tCase.Values))
+			assert.Equal(t, values, tCase.Values, "Should not modify the values")
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package report
+
+import (
+	"strconv"
+	"time"
+)
+
+type ErrMissingHost struct{}
+
+func (e ErrMissingHost) Error() string {
+	return "No smtp server provided"
+}
+
+type ErrInvalidPort struct {
+	Port int
+}
+
+func (e *ErrInvalidPort) Error() string {
+	return "Invalid smtp port " + strconv.Itoa(e.Port) + ", needs to be between 1 and 65535"
+}
+
+type ErrMissingSender struct{}
+
+func (e ErrMissingSender) Error() string {
+	return "No sender address for the report provided"
+}
+
+type ErrMissingRecipients struct{}
+
+func (e ErrMissingRecipients) Error() string {
+	return "No recipients for the report provided"
+}
+
+type ErrInvalidAddress struct {
+	Address string
+}
+
+func (e *ErrInvalidAddress) Error() string {
+	return "Invalid email address \"" + e.Address + "\""
+}
+
+type ErrMissingSource struct{}
+
+func (e ErrMissingSource) Error() string {
+	return "No source for the results of the report provided"
+}
+
+type ErrMissingInstance struct{}
+
+func (e ErrMissingInstance) Error() string {
+	return "No instance name provided"
+}
+
+type ErrInvalidSecurity struct {
+	Security string
+}
+
+func (e *ErrInvalidSecurity) Error() string {
+	return "Invalid smtp security \"" + e.Security + "\", needs to be one of starttls, tls or none"
+}
+
+type ErrInvalidSchedule struct {
+	Schedule string
+}
+
+func (e *ErrInvalidSchedule) Error() string {
+	return "Invalid report schedule \"" + e.Schedule + "\", needs to be daily or weekly"
+}
+
+type ErrInvalidWeekday struct {
+	Weekday string
+}
+
+func (e *ErrInvalidWeekday) Error() string {
+	return "Invalid weekday \"" + e.Weekday + "\", needs to be the english name of a day, e.g. monday"
+}
+
+type ErrInvalidTimeOfDay struct {
+	Time string
+}
+
+func (e *ErrInvalidTimeOfDay) Error() string {
+	return "Invalid time of day \"" + e.Time + "\", needs to be in the format HH:MM"
+}
+
+type ErrInvalidTimeout struct {
+	Timeout time.Duration
+}
+
+func (e *ErrInvalidTimeout) Error() string {
+	return "Invalid timeout " + e.Timeout.String() + ", needs to be greater than 0"
+}
+
+type ErrStartTLSUnsupported struct{}
+
+func (e ErrStartTLSUnsupported) Error() string {
+	return "The smtp server does not support STARTTLS"
+}
+
+type ErrReporterAlreadyRunning struct{}
+
+func (e ErrReporterAlreadyRunning) Error() string {
+	return "Only a single instance of the reporter can run at a time"
+}
@@ -0,0 +1,245 @@
+package report
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image/color"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+)
+
+// Content-ID of the inline chart, referenced by the html body
+const chartContentID = "chart@speedtest-exporter"
+
+// Date format used in the subject and body of the mail
+const dateFormat = "2006-01-02"
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":    func(t time.Time) string { return t.Format(dateFormat) },
+	"percent": percent,
+	"unit":    unit,
+	"hex":     hexColor,
+}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #333333;">
+<h2>Speedtest report for {{ .Digest.Instance }}</h2>
+<p>{{ date .Digest.From }} - {{ date .Digest.To }}: {{ .Digest.Tests }} speedtests, {{ .Digest.Failures }} failed</p>
+{{- if .Digest.Results }}
+<table cellpadding="4" style="border-collapse: collapse;">
+<tr><th></th><th align="right">Min</th><th align="right">Median</th><th align="right">Max</th></tr>
+<tr><td>Download</td><td align="right">{{ printf "%.2f" .Digest.Download.Min }} Mbit/s</td><td align="right">{{ printf "%.2f" .Digest.Download.Median }} Mbit/s</td><td align="right">{{ printf "%.2f" .Digest.Download.Max }} Mbit/s</td></tr>
+<tr><td>Upload</td><td align="right">{{ printf "%.2f" .Digest.Upload.Min }} Mbit/s</td><td align="right">{{ printf "%.2f" .Digest.Upload.Median }} Mbit/s</td><td align="right">{{ printf "%.2f" .Digest.Upload.Max }} Mbit/s</td></tr>
+<tr><td>Ping</td><td align="right">{{ printf "%.2f" .Digest.Ping.Min }} ms</td><td align="right">{{ printf "%.2f" .Digest.Ping.Median }} ms</td><td align="right">{{ printf "%.2f" .Digest.Ping.Max }} ms</td></tr>
+</table>
+{{- end }}
+{{- if .Digest.SLA }}
+<h3>SLA compliance</h3>
+<table cellpadding="4" style="border-collapse: collapse;">
+<tr><th align="left">Target</th><th align="right">Contracted</th><th align="right">Compliant tests</th></tr>
+{{- range .Digest.SLA }}
+<tr><td>{{ .Target }}</td><td align="right">{{ printf "%.2f" .Contracted }} {{ unit .Target }}</td><td align="right">{{ .Compliant }} of {{ .Tests }} ({{ percent .Compliant .Tests }})</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Chart }}
+<p><img src="cid:` + chartContentID + `" alt="Download and upload speed" width="600" height="200"></p>
+<p style="font-size: small;"><span style="color: {{ hex .Colors.Download }};">&#9632; Download</span> <span style="color: {{ hex .Colors.Upload }};">&#9632; Upload</span>
+{{- if .Digest.SLA }} <span style="color: {{ hex .Colors.Contract }};">&#9632; Contracted download</span>{{ end }} <span style="color: {{ hex .Colors.Failure }};">&#9632; Failed speedtest</span></p>
+{{- end }}
+</body>
+</html>
+`))
+
+// Data of the html template
+type mailData struct {
+	Digest Digest
+	// True if the chart is embedded into the mail
+	Chart bool
+	// Colors of the chart, for the legend
+	Colors map[string]color.RGBA
+}
+
+// Create the subject of the report mail
+func subject(d Digest) string {
+	return fmt.Sprintf("Speedtest report for %s: %s - %s", d.Instance, d.From.Format(dateFormat), d.To.Format(dateFormat))
+}
+
+// Create the plain text version of the report
+func formatText(d Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Speedtest report for %s\n\n", d.Instance)
+	fmt.Fprintf(&b, "%s - %s: %d speedtests, %d failed\n", d.From.Format(dateFormat), d.To.Format(dateFormat), d.Tests, d.Failures)
+	if len(d.Results) > 0 {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "Download: min %.2f, median %.2f, max %.2f Mbit/s\n", d.Download.Min, d.Download.Median, d.Download.Max)
+		fmt.Fprintf(&b, "Upload: min %.2f, median %.2f, max %.2f Mbit/s\n", d.Upload.Min, d.Upload.Median, d.Upload.Max)
+		fmt.Fprintf(&b, "Ping: min %.2f, median %.2f, max %.2f ms\n", d.Ping.Min, d.Ping.Median, d.Ping.Max)
+	}
+	if len(d.SLA) > 0 {
+		b.WriteString("\nSLA compliance:\n")
+		for _, c := range d.SLA {
+			fmt.Fprintf(&b, "%s (contracted %.2f %s): %d of %d tests (%s)\n", c.Target, c.Contracted, unit(c.Target), c.Compliant, c.Tests, percent(c.Compliant, c.Tests))
+		}
+	}
+	return b.String()
+}
+
+// Build the mail with the report as plain text and html, the chart is embedded into the html version.
+func buildMessage(from *mail.Address, to []*mail.Address, d Digest, now time.Time) ([]byte, error) {
+	chart, err := renderChart(d)
+	if err != nil {
+		return nil, err
+	}
+	var html bytes.Buffer
+	err = htmlTemplate.Execute(&html, mailData{
+		Digest: d,
+		Chart:  len(chart) > 0,
+		Colors: map[string]color.RGBA{
+			"Download": colorDownload,
+			"Upload":   colorUpload,
+			"Contract": colorContract,
+			"Failure":  colorFailure,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	alternative := multipart.NewWriter(&body)
+
+	err = writeQuotedPrintable(alternative, textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(formatText(d)))
+	if err != nil {
+		return nil, err
+	}
+
+	var relatedBody bytes.Buffer
+	related := multipart.NewWriter(&relatedBody)
+	err = writeQuotedPrintable(related, textproto.MIMEHeader{"Content-Type": {"text/html; charset=utf-8"}}, html.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(chart) > 0 {
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Id":                {"<" + chartContentID + ">"},
+			"Content-Disposition":       {`inline; filename="chart.png"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = writeBase64(part, chart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = related.Close()
+	if err != nil {
+		return nil, err
+	}
+	part, err := alternative.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + related.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	_, err = part.Write(relatedBody.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	err = alternative.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(key, value string) {
+		msg.WriteString(key + ": " + value + "\r\n")
+	}
+	recipients := make([]string, 0, len(to))
+	for _, addr := range to {
+		recipients = append(recipients, addr.String())
+	}
+	header("From", from.String())
+	header("To", strings.Join(recipients, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject(d)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-Id", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+alternative.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// Write the content as quoted-printable part
+func writeQuotedPrintable(w *multipart.Writer, header textproto.MIMEHeader, content []byte) error {
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	_, err = qp.Write(content)
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// Write the content base64 encoded, with lines of at most 76 characters as required by RFC 2045
+func writeBase64(w io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 0 {
+		n := min(76, len(encoded))
+		_, err := w.Write([]byte(encoded[:n] + "\r\n"))
+		if err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// Create a unique id for the mail, using the domain of the sender
+func messageID(from *mail.Address) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from.Address, "@"); i >= 0 {
+		domain = from.Address[i+1:]
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
+
+// Format the color for css
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// Share of compliant tests, formatted as percentage
+func percent(compliant, tests int) string {
+	if tests == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(compliant)/float64(tests))
+}
+
+// Unit of the contracted value of a sla target
+func unit(target string) string {
+	if target == collector.SLATargetLatency {
+		return "ms"
+	}
+	return "Mbit/s"
+}
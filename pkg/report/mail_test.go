@@ -0,0 +1,167 @@
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Parts of a parsed report mail
+type parsedMail struct {
+	Header mail.Header
+	Text   string
+	HTML   string
+	Chart  []byte
+	// Content-ID of the chart
+	ChartID string
+}
+
+// Parse the mail created by buildMessage
+func parseMail(t *testing.T, msg []byte) parsedMail {
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	require.NoError(t, err, "Should be a valid mail")
+
+	res := parsedMail{Header: m.Header}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	alternative := multipart.NewReader(m.Body, params["boundary"])
+	text, err := alternative.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", text.Header.Get("Content-Type"))
+	body, err := io.ReadAll(text)
+	require.NoError(t, err)
+	res.Text = string(body)
+
+	relatedPart, err := alternative.NextPart()
+	require.NoError(t, err)
+	mediaType, params, err = mime.ParseMediaType(relatedPart.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/related", mediaType)
+
+	related := multipart.NewReader(relatedPart, params["boundary"])
+	html, err := related.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+	body, err = io.ReadAll(html)
+	require.NoError(t, err)
+	res.HTML = string(body)
+
+	chart, err := related.NextPart()
+	if err == io.EOF {
+		return res
+	}
+	require.NoError(t, err)
+	require.Equal(t, "image/png", chart.Header.Get("Content-Type"))
+	require.Equal(t, "base64", chart.Header.Get("Content-Transfer-Encoding"))
+	res.ChartID = chart.Header.Get("Content-Id")
+	body, err = io.ReadAll(chart)
+	require.NoError(t, err)
+	res.Chart, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(body)))
+	require.NoError(t, err, "Should be valid base64")
+	return res
+}
+
+func TestBuildMessage(t *testing.T) {
+	to := time.Date(2026, time.March, 9, 8, 0, 0, 0, time.UTC)
+	from := to.Add(-7 * 24 * time.Hour)
+	results := []*speedtest.SpeedtestResult{
+		newTestResult(t, to.Add(-2*time.Hour), 90, 20, 15),
+		newTestResult(t, to.Add(-time.Hour), 0, 0, 0),
+	}
+	d := NewDigest("testhost", from, to, results, collector.SLAOptions{Download: 100, Threshold: 0.8})
+
+	sender := &mail.Address{Name: "Speedtest", Address: "speedtest@example.org"}
+	recipients := []*mail.Address{{Address: "a@example.org"}, {Address: "b@example.org"}}
+	msg, err := buildMessage(sender, recipients, d, to)
+	require.NoError(t, err)
+
+	for _, line := range strings.Split(string(msg), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998, "Lines may not exceed the limit of RFC 5322")
+	}
+
+	m := parseMail(t, msg)
+
+	assert := assert.New(t)
+	assert.Equal(`"Speedtest" <speedtest@example.org>`, m.Header.Get("From"))
+	assert.Equal("<a@example.org>, <b@example.org>", m.Header.Get("To"))
+	assert.Equal("Speedtest report for testhost: 2026-03-02 - 2026-03-09", m.Header.Get("Subject"))
+	date, err := m.Header.Date()
+	assert.NoError(err)
+	assert.True(to.Equal(date))
+	assert.True(strings.HasSuffix(m.Header.Get("Message-Id"), "@example.org>"))
+
+	assert.Equal(formatText(d), strings.ReplaceAll(m.Text, "\r\n", "\n"))
+	assert.Contains(m.HTML, "Speedtest report for testhost")
+	assert.Contains(m.HTML, "2 speedtests, 1 failed")
+	assert.Contains(m.HTML, "<td>download</td>")
+	assert.Contains(m.HTML, "1 of 2 (50.0%)")
+	assert.Contains(m.HTML, `src="cid:`+chartContentID+`"`, "Should reference the chart")
+	assert.Contains(m.HTML, "#1F77B4", "Should show the legend")
+	assert.Equal("<"+chartContentID+">", m.ChartID)
+
+	chart, err := renderChart(d)
+	require.NoError(t, err)
+	assert.Equal(chart, m.Chart, "Should embed the chart")
+
+	t.Run("NoResults", func(t *testing.T) {
+		msg, err := buildMessage(sender, recipients, NewDigest("testhost", from, to, nil, collector.DefaultSLAOptions()), to)
+		require.NoError(t, err)
+
+		m := parseMail(t, msg)
+		assert.Empty(m.Chart, "Should not embed a chart")
+		assert.NotContains(m.HTML, "cid:")
+		assert.NotContains(m.HTML, "SLA compliance")
+		assert.Contains(m.Text, "0 speedtests, 0 failed")
+	})
+}
+
+func TestFormatText(t *testing.T) {
+	to := time.Date(2026, time.March, 9, 8, 0, 0, 0, time.UTC)
+	d := Digest{
+		Instance: "testhost",
+		From:     to.Add(-24 * time.Hour),
+		To:       to,
+		Tests:    4,
+		Failures: 1,
+		Download: Stats{Min: 50, Median: 80, Max: 95.5},
+		Upload:   Stats{Min: 10, Median: 20, Max: 30},
+		Ping:     Stats{Min: 8, Median: 12, Max: 40},
+		SLA: []collector.SLACompliance{
+			{Target: collector.SLATargetDownload, Contracted: 100, Tests: 4, Compliant: 2},
+			{Target: collector.SLATargetLatency, Contracted: 20, Tests: 4, Compliant: 3},
+		},
+		Results: []*speedtest.SpeedtestResult{speedtest.NewFailedSpeedtestResult()},
+	}
+
+	assert.Equal(t, `Speedtest report for testhost
+
+2026-03-08 - 2026-03-09: 4 speedtests, 1 failed
+
+Download: min 50.00, median 80.00, max 95.50 Mbit/s
+Upload: min 10.00, median 20.00, max 30.00 Mbit/s
+Ping: min 8.00, median 12.00, max 40.00 ms
+
+SLA compliance:
+download (contracted 100.00 Mbit/s): 2 of 4 tests (50.0%)
+latency (contracted 20.00 ms): 3 of 4 tests (75.0%)
+`, formatText(d))
+}
+
+func TestPercent(t *testing.T) {
+	assert.Equal(t, "n/a", percent(0, 0))
+	assert.Equal(t, "33.3%", percent(1, 3))
+	assert.Equal(t, "100.0%", percent(2, 2))
+}
@@ -0,0 +1,469 @@
+package report
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/heathcliff26/speedtest-exporter/pkg/utils"
+)
+
+// Security of the connection to the smtp server
+const (
+	// Upgrade the connection with STARTTLS, fails if the server does not support it
+	SecurityStartTLS = "starttls"
+	// Connect with implicit TLS, e.g. on port 465
+	SecurityTLS = "tls"
+	// Send the mail unencrypted, authentication is only possible with a server on localhost
+	SecurityNone = "none"
+)
+
+// Schedules of the report, the report covers the period since the previous one
+const (
+	ScheduleDaily  = "daily"
+	ScheduleWeekly = "weekly"
+)
+
+const (
+	DefaultPort     = 587
+	DefaultSecurity = SecurityStartTLS
+	DefaultSchedule = ScheduleWeekly
+	DefaultWeekday  = time.Monday
+	DefaultTimeout  = 30 * time.Second
+)
+
+// Source of the results summarized in the report, e.g. the history of the exporter
+type Source interface {
+	// Return the results of the speedtests run since the given time
+	Results(since time.Time) []*speedtest.SpeedtestResult
+}
+
+// Reporter sends a digest of the speedtest results via mail on a daily or weekly schedule
+type Reporter struct {
+	host      string
+	port      int
+	security  string
+	tlsConfig *tls.Config
+	username  string
+	password  string
+	timeout   time.Duration
+	from      *mail.Address
+	to        []*mail.Address
+
+	instance string
+	sla      collector.SLAOptions
+	source   Source
+
+	schedule string
+	weekday  time.Weekday
+	// Time of the day the report is sent, as offset from midnight
+	at time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+
+	lastSuccess time.Time
+	lastError   error
+	nextReport  time.Time
+	statusLock  sync.RWMutex
+}
+
+// Status of the reporter, used for health reporting
+type Status struct {
+	// True while the reporter is running in the background
+	Running bool
+	// Time the last report was sent successfully, zero if there was none yet
+	LastSuccess time.Time
+	// Error of the last report, empty if it was successful
+	LastError string
+	// Time the next report is due, zero if the reporter is not running
+	NextReport time.Time
+}
+
+type ReporterOption func(*Reporter) error
+
+// WithPort sets the port of the smtp server, defaults to DefaultPort.
+func WithPort(port int) ReporterOption {
+	return func(r *Reporter) error {
+		if port < 1 || port > 65535 {
+			return &ErrInvalidPort{Port: port}
+		}
+		r.port = port
+		return nil
+	}
+}
+
+// WithSecurity sets how the connection to the smtp server is secured, one of SecurityStartTLS, SecurityTLS or SecurityNone.
+// The tls config is optional, by default the certificate of the server is verified against the system pool.
+func WithSecurity(security string, tlsConfig *tls.Config) ReporterOption {
+	return func(r *Reporter) error {
+		switch security {
+		case SecurityStartTLS, SecurityTLS, SecurityNone:
+		default:
+			return &ErrInvalidSecurity{Security: security}
+		}
+		r.security = security
+		if tlsConfig != nil {
+			r.tlsConfig = tlsConfig.Clone()
+		}
+		return nil
+	}
+}
+
+// WithAuth sets the credentials for the smtp server, used with AUTH PLAIN.
+// An empty username disables authentication.
+func WithAuth(username, password string) ReporterOption {
+	return func(r *Reporter) error {
+		r.username = username
+		r.password = password
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for sending a report, defaults to DefaultTimeout.
+func WithTimeout(timeout time.Duration) ReporterOption {
+	return func(r *Reporter) error {
+		if timeout <= 0 {
+			return &ErrInvalidTimeout{Timeout: timeout}
+		}
+		r.timeout = timeout
+		return nil
+	}
+}
+
+// WithInstance sets the instance the report is about.
+// By default the hostname of the machine is used.
+func WithInstance(instance string) ReporterOption {
+	return func(r *Reporter) error {
+		if instance == "" {
+			return ErrMissingInstance{}
+		}
+		r.instance = instance
+		return nil
+	}
+}
+
+// WithSLA adds the compliance with the contracted speeds to the report.
+func WithSLA(sla collector.SLAOptions) ReporterOption {
+	return func(r *Reporter) error {
+		r.sla = sla
+		return nil
+	}
+}
+
+// WithSchedule sets when the report is sent.
+// Parameters:
+//   - schedule: ScheduleDaily or ScheduleWeekly, defaults to DefaultSchedule
+//   - weekday: Day of the week a weekly report is sent, e.g. "monday". Defaults to DefaultWeekday when empty
+//   - at: Time of the day the report is sent in the format HH:MM, in local time. Defaults to midnight when empty
+func WithSchedule(schedule, weekday, at string) ReporterOption {
+	return func(r *Reporter) error {
+		if schedule != ScheduleDaily && schedule != ScheduleWeekly {
+			return &ErrInvalidSchedule{Schedule: schedule}
+		}
+		r.schedule = schedule
+
+		r.weekday = DefaultWeekday
+		if weekday != "" {
+			day, err := ParseWeekday(weekday)
+			if err != nil {
+				return err
+			}
+			r.weekday = day
+		}
+
+		r.at = 0
+		if at != "" {
+			t, err := time.Parse("15:04", at)
+			if err != nil {
+				return &ErrInvalidTimeOfDay{Time: at}
+			}
+			r.at = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		}
+		return nil
+	}
+}
+
+// NewReporter creates a new reporter sending the digest of the results in source to the recipients.
+// Parameters:
+//   - host: Hostname of the smtp server
+//   - from: Sender address of the mail
+//   - to: Recipients of the mail
+//   - source: Source of the results
+//   - opts: optional reporter options
+func NewReporter(host, from string, to []string, source Source, opts ...ReporterOption) (*Reporter, error) {
+	if host == "" {
+		return nil, ErrMissingHost{}
+	}
+	if from == "" {
+		return nil, ErrMissingSender{}
+	}
+	if len(to) == 0 {
+		return nil, ErrMissingRecipients{}
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, &ErrInvalidAddress{Address: from}
+	}
+	recipients := make([]*mail.Address, 0, len(to))
+	for _, addr := range to {
+		recipient, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, &ErrInvalidAddress{Address: addr}
+		}
+		recipients = append(recipients, recipient)
+	}
+	if source == nil {
+		return nil, ErrMissingSource{}
+	}
+
+	r := &Reporter{
+		host:      host,
+		port:      DefaultPort,
+		security:  DefaultSecurity,
+		tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		timeout:   DefaultTimeout,
+		from:      sender,
+		to:        recipients,
+		instance:  utils.Hostname(),
+		source:    source,
+		schedule:  DefaultSchedule,
+		weekday:   DefaultWeekday,
+	}
+	for _, opt := range opts {
+		err = opt(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.tlsConfig.ServerName == "" {
+		r.tlsConfig.ServerName = host
+	}
+	return r, nil
+}
+
+// Parse the english name of a weekday, case insensitive
+func ParseWeekday(weekday string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(weekday, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, &ErrInvalidWeekday{Weekday: weekday}
+}
+
+// Return the length of the period covered by a report with the given schedule
+func Period(schedule string) time.Duration {
+	if schedule == ScheduleDaily {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// Return the length of the period covered by a report
+func (r *Reporter) Period() time.Duration {
+	return Period(r.schedule)
+}
+
+// Return the time the next report is due after now
+func (r *Reporter) next(now time.Time) time.Time {
+	year, month, day := now.Date()
+	next := time.Date(year, month, day, int(r.at/time.Hour), int(r.at%time.Hour/time.Minute), 0, 0, now.Location())
+	if r.schedule == ScheduleWeekly {
+		next = next.AddDate(0, 0, (int(r.weekday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(now) {
+		if r.schedule == ScheduleWeekly {
+			next = next.AddDate(0, 0, 7)
+		} else {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
+
+// Create the digest of the period ending now and send it to the recipients
+func (r *Reporter) Send(ctx context.Context, now time.Time) error {
+	from := now.Add(-r.Period())
+	digest := NewDigest(r.instance, from, now, r.source.Results(from), r.sla)
+
+	msg, err := buildMessage(r.from, r.to, digest, now)
+	if err == nil {
+		err = r.sendMail(ctx, msg)
+	}
+
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+	r.lastError = err
+	if err == nil {
+		r.lastSuccess = time.Now()
+	}
+	return err
+}
+
+// Deliver the mail to the smtp server
+func (r *Reporter) sendMail(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(r.host, strconv.Itoa(r.port))
+	var conn net.Conn
+	var err error
+	if r.security == SecurityTLS {
+		dialer := &tls.Dialer{Config: r.tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, r.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if r.security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported{}
+		}
+		err = c.StartTLS(r.tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if r.username != "" {
+		err = c.Auth(smtp.PlainAuth("", r.username, r.password, r.host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(r.from.Address)
+	if err != nil {
+		return err
+	}
+	for _, to := range r.to {
+		err = c.Rcpt(to.Address)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Send the report whenever it is due according to the schedule.
+// Runs as a background goroutine and does not block the calling thread.
+func (r *Reporter) Run() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cancel != nil {
+		return ErrReporterAlreadyRunning{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		slog.Debug("Starting reporter")
+		for {
+			next := r.next(time.Now())
+			r.statusLock.Lock()
+			r.nextReport = next
+			r.statusLock.Unlock()
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			err := r.Send(ctx, next)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Failed to send report", "err", err)
+			} else if err == nil {
+				slog.Info("Sent report", slog.Int("recipients", len(r.to)))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Returns true if the reporter is currently running
+func (r *Reporter) IsRunning() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.cancel != nil
+}
+
+// Return the current status of the reporter
+func (r *Reporter) Status() Status {
+	status := Status{Running: r.IsRunning()}
+
+	r.statusLock.RLock()
+	defer r.statusLock.RUnlock()
+	status.LastSuccess = r.lastSuccess
+	if r.lastError != nil {
+		status.LastError = r.lastError.Error()
+	}
+	if status.Running {
+		status.NextReport = r.nextReport
+	}
+	return status
+}
+
+// Stop the reporter and wait for the background goroutine to exit.
+// Does nothing if the reporter is not running.
+func (r *Reporter) Stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cancel == nil {
+		return
+	}
+
+	r.cancel()
+	<-r.done
+	r.cancel = nil
+	slog.Info("Stopped reporter")
+}
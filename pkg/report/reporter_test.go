@@ -0,0 +1,465 @@
+package report
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/collector"
+	"github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mail received by the mock smtp server
+type receivedMail struct {
+	From string
+	To   []string
+	Data []byte
+	// True if the mail was sent over TLS
+	TLS bool
+	// User that authenticated, empty without authentication
+	User string
+}
+
+// Minimal smtp server for tests, supporting STARTTLS, implicit TLS and AUTH PLAIN
+type mockSMTP struct {
+	listener net.Listener
+	// Used for STARTTLS, disabled when nil
+	tlsConfig *tls.Config
+	implicit  bool
+	username  string
+	password  string
+
+	mails []receivedMail
+	lock  sync.Mutex
+}
+
+// Start a mock smtp server. With starttls the server announces STARTTLS, with implicit it expects a TLS handshake on connect.
+// Returns the server and the pool containing its certificate.
+func newMockSMTP(t *testing.T, starttls, implicit bool) (*mockSMTP, *x509.CertPool) {
+	cert, pool := newTestCertificate(t)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	var l net.Listener
+	var err error
+	if implicit {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+
+	m := &mockSMTP{
+		listener: l,
+		implicit: implicit,
+		username: "user",
+		password: "password",
+	}
+	if starttls {
+		m.tlsConfig = tlsConfig
+	}
+	go m.serve()
+	t.Cleanup(func() { _ = l.Close() })
+	return m, pool
+}
+
+// Port the server is listening on
+func (m *mockSMTP) Port() int {
+	return m.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Return the received mails
+func (m *mockSMTP) Mails() []receivedMail {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]receivedMail(nil), m.mails...)
+}
+
+func (m *mockSMTP) serve() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return
+		}
+		go m.handle(conn)
+	}
+}
+
+func (m *mockSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	isTLS := m.implicit
+	var mail receivedMail
+	reply := func(code int, msg string) {
+		_ = tp.PrintfLine("%d %s", code, msg)
+	}
+
+	reply(220, "localhost ESMTP mock")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			lines := []string{"localhost"}
+			if m.tlsConfig != nil && !isTLS {
+				lines = append(lines, "STARTTLS")
+			}
+			lines = append(lines, "AUTH PLAIN")
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				_ = tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			if m.tlsConfig == nil || isTLS {
+				reply(502, "STARTTLS not supported")
+				continue
+			}
+			reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(conn, m.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			creds, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(creds), "\x00")
+			if mechanism != "PLAIN" || err != nil || len(parts) != 3 || parts[1] != m.username || parts[2] != m.password {
+				reply(535, "Authentication failed")
+				continue
+			}
+			mail.User = parts[1]
+			reply(235, "Authentication successful")
+		case "MAIL":
+			mail.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			reply(250, "OK")
+		case "RCPT":
+			mail.To = append(mail.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "Send the data")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			mail.Data = data
+			mail.TLS = isTLS
+			m.lock.Lock()
+			m.mails = append(m.mails, mail)
+			m.lock.Unlock()
+			mail = receivedMail{User: mail.User}
+			reply(250, "Queued")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(250, "OK")
+		}
+	}
+}
+
+// Create a self-signed certificate for 127.0.0.1
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// Source returning a fixed list of results
+type mockSource []*speedtest.SpeedtestResult
+
+func (s mockSource) Results(_ time.Time) []*speedtest.SpeedtestResult {
+	return s
+}
+
+func TestNewReporter(t *testing.T) {
+	source := mockSource{}
+	to := []string{"admin@example.org"}
+
+	tMatrix := []struct {
+		Name  string
+		Host  string
+		From  string
+		To    []string
+		Opts  []ReporterOption
+		Error error
+	}{
+		{"Minimal", "smtp.example.org", "speedtest@example.org", to, nil, nil},
+		{"AllOptions", "smtp.example.org", "Speedtest <speedtest@example.org>", to, []ReporterOption{
+			WithPort(465),
+			WithSecurity(SecurityTLS, &tls.Config{MinVersion: tls.VersionTLS13}),
+			WithAuth("user", "password"),
+			WithTimeout(time.Minute),
+			WithInstance("testhost"),
+			WithSLA(collector.SLAOptions{Download: 100}),
+			WithSchedule(ScheduleDaily, "", "08:30"),
+		}, nil},
+		{"MissingHost", "", "speedtest@example.org", to, nil, ErrMissingHost{}},
+		{"MissingSender", "smtp.example.org", "", to, nil, ErrMissingSender{}},
+		{"MissingRecipients", "smtp.example.org", "speedtest@example.org", nil, nil, ErrMissingRecipients{}},
+		{"InvalidSender", "smtp.example.org", "speedtest", to, nil, &ErrInvalidAddress{Address: "speedtest"}},
+		{"InvalidRecipient", "smtp.example.org", "speedtest@example.org", []string{"admin@example.org", "foo"}, nil, &ErrInvalidAddress{Address: "foo"}},
+		{"InvalidPort", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithPort(0)}, &ErrInvalidPort{Port: 0}},
+		{"InvalidSecurity", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithSecurity("ssl", nil)}, &ErrInvalidSecurity{Security: "ssl"}},
+		{"InvalidTimeout", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithTimeout(0)}, &ErrInvalidTimeout{}},
+		{"MissingInstance", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithInstance("")}, ErrMissingInstance{}},
+		{"InvalidSchedule", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithSchedule("monthly", "", "")}, &ErrInvalidSchedule{Schedule: "monthly"}},
+		{"InvalidWeekday", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithSchedule(ScheduleWeekly, "someday", "")}, &ErrInvalidWeekday{Weekday: "someday"}},
+		{"InvalidTime", "smtp.example.org", "speedtest@example.org", to, []ReporterOption{WithSchedule(ScheduleWeekly, "", "25:00")}, &ErrInvalidTimeOfDay{Time: "25:00"}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			_, err := NewReporter(tCase.Host, tCase.From, tCase.To, source, tCase.Opts...)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+
+	t.Run("MissingSource", func(t *testing.T) {
+		_, err := NewReporter("smtp.example.org", "speedtest@example.org", to, nil)
+		assert.Equal(t, ErrMissingSource{}, err)
+	})
+	t.Run("Defaults", func(t *testing.T) {
+		r, err := NewReporter("smtp.example.org", "speedtest@example.org", to, source)
+		require.NoError(t, err)
+
+		assert := assert.New(t)
+		assert.Equal(DefaultPort, r.port)
+		assert.Equal(DefaultSecurity, r.security)
+		assert.Equal("smtp.example.org", r.tlsConfig.ServerName, "Should verify the certificate against the host")
+		assert.Equal(DefaultTimeout, r.timeout)
+		assert.Equal(DefaultSchedule, r.schedule)
+		assert.Equal(DefaultWeekday, r.weekday)
+		assert.Equal(7*24*time.Hour, r.Period())
+	})
+}
+
+func TestParseWeekday(t *testing.T) {
+	assert := assert.New(t)
+
+	day, err := ParseWeekday("Friday")
+	assert.NoError(err)
+	assert.Equal(time.Friday, day)
+
+	day, err = ParseWeekday("sunday")
+	assert.NoError(err)
+	assert.Equal(time.Sunday, day)
+
+	_, err = ParseWeekday("fri")
+	assert.Equal(&ErrInvalidWeekday{Weekday: "fri"}, err)
+}
+
+func TestReporterNext(t *testing.T) {
+	// 2026-03-04 is a wednesday
+	now := time.Date(2026, time.March, 4, 10, 0, 0, 0, time.UTC)
+
+	tMatrix := []struct {
+		Name     string
+		Schedule string
+		Weekday  string
+		At       string
+		Next     time.Time
+	}{
+		{"DailyLater", ScheduleDaily, "", "12:30", time.Date(2026, time.March, 4, 12, 30, 0, 0, time.UTC)},
+		{"DailyTomorrow", ScheduleDaily, "", "08:00", time.Date(2026, time.March, 5, 8, 0, 0, 0, time.UTC)},
+		{"DailyNow", ScheduleDaily, "", "10:00", time.Date(2026, time.March, 5, 10, 0, 0, 0, time.UTC)},
+		{"WeeklyDefault", ScheduleWeekly, "", "", time.Date(2026, time.March, 9, 0, 0, 0, 0, time.UTC)},
+		{"WeeklyToday", ScheduleWeekly, "wednesday", "11:00", time.Date(2026, time.March, 4, 11, 0, 0, 0, time.UTC)},
+		{"WeeklyNextWeek", ScheduleWeekly, "wednesday", "09:00", time.Date(2026, time.March, 11, 9, 0, 0, 0, time.UTC)},
+		{"WeeklyFriday", ScheduleWeekly, "friday", "", time.Date(2026, time.March, 6, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			r, err := NewReporter("smtp.example.org", "speedtest@example.org", []string{"admin@example.org"}, mockSource{}, WithSchedule(tCase.Schedule, tCase.Weekday, tCase.At))
+			require.NoError(t, err)
+			assert.Equal(t, tCase.Next, r.next(now))
+		})
+	}
+}
+
+func TestReporterSend(t *testing.T) {
+	now := time.Now()
+	source := mockSource{
+		newTestResult(t, now.Add(-time.Hour), 90, 20, 15),
+		newTestResult(t, now.Add(-2*time.Hour), 0, 0, 0),
+	}
+	to := []string{"Admin <admin@example.org>", "ops@example.org"}
+
+	t.Run("StartTLS", func(t *testing.T) {
+		server, pool := newMockSMTP(t, true, false)
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source,
+			WithPort(server.Port()),
+			WithSecurity(SecurityStartTLS, &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}),
+			WithAuth("user", "password"),
+			WithInstance("testhost"),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, r.Send(context.Background(), now))
+
+		mails := server.Mails()
+		require.Len(t, mails, 1)
+
+		assert := assert.New(t)
+		assert.True(mails[0].TLS, "Should upgrade the connection")
+		assert.Equal("user", mails[0].User)
+		assert.Equal("speedtest@example.org", mails[0].From)
+		assert.Equal([]string{"admin@example.org", "ops@example.org"}, mails[0].To)
+
+		m := parseMail(t, mails[0].Data)
+		assert.Equal(`"Admin" <admin@example.org>, <ops@example.org>`, m.Header.Get("To"))
+		assert.Contains(m.Text, "2 speedtests, 1 failed")
+		assert.NotEmpty(m.Chart)
+
+		status := r.Status()
+		assert.False(status.Running)
+		assert.False(status.LastSuccess.IsZero())
+		assert.Empty(status.LastError)
+	})
+	t.Run("ImplicitTLS", func(t *testing.T) {
+		server, pool := newMockSMTP(t, false, true)
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source,
+			WithPort(server.Port()),
+			WithSecurity(SecurityTLS, &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}),
+			WithAuth("user", "password"),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, r.Send(context.Background(), now))
+
+		mails := server.Mails()
+		require.Len(t, mails, 1)
+		assert.True(t, mails[0].TLS)
+		assert.Equal(t, "user", mails[0].User)
+	})
+	t.Run("Unencrypted", func(t *testing.T) {
+		server, _ := newMockSMTP(t, false, false)
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source,
+			WithPort(server.Port()),
+			WithSecurity(SecurityNone, nil),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, r.Send(context.Background(), now))
+
+		mails := server.Mails()
+		require.Len(t, mails, 1)
+		assert.False(t, mails[0].TLS)
+		assert.Empty(t, mails[0].User, "Should not authenticate without credentials")
+	})
+	t.Run("StartTLSUnsupported", func(t *testing.T) {
+		server, _ := newMockSMTP(t, false, false)
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source, WithPort(server.Port()))
+		require.NoError(t, err)
+
+		assert.Equal(t, ErrStartTLSUnsupported{}, r.Send(context.Background(), now), "Should not fall back to an unencrypted connection")
+		assert.Empty(t, server.Mails())
+		assert.Equal(t, ErrStartTLSUnsupported{}.Error(), r.Status().LastError)
+	})
+	t.Run("AuthFailed", func(t *testing.T) {
+		server, pool := newMockSMTP(t, true, false)
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source,
+			WithPort(server.Port()),
+			WithSecurity(SecurityStartTLS, &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}),
+			WithAuth("user", "wrong"),
+		)
+		require.NoError(t, err)
+
+		assert.Error(t, r.Send(context.Background(), now))
+		assert.Empty(t, server.Mails())
+		assert.NotEmpty(t, r.Status().LastError)
+	})
+	t.Run("UntrustedCertificate", func(t *testing.T) {
+		server, _ := newMockSMTP(t, true, false)
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source, WithPort(server.Port()))
+		require.NoError(t, err)
+
+		assert.Error(t, r.Send(context.Background(), now), "Should verify the certificate of the server")
+		assert.Empty(t, server.Mails())
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+
+		r, err := NewReporter("127.0.0.1", "speedtest@example.org", to, source,
+			WithPort(l.Addr().(*net.TCPAddr).Port),
+			WithTimeout(100*time.Millisecond),
+		)
+		require.NoError(t, err)
+
+		start := time.Now()
+		assert.Error(t, r.Send(context.Background(), now), "Should fail when the server does not respond")
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestReporterRun(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewReporter("127.0.0.1", "speedtest@example.org", []string{"admin@example.org"}, mockSource{}, WithPort(1), WithSchedule(ScheduleDaily, "", ""))
+	require.NoError(t, err)
+
+	assert.Zero(r.Status().NextReport, "Should not have a next report while stopped")
+
+	require.NoError(t, r.Run())
+	t.Cleanup(r.Stop)
+	assert.Equal(ErrReporterAlreadyRunning{}, r.Run())
+	assert.True(r.IsRunning())
+
+	assert.Eventually(func() bool {
+		return !r.Status().NextReport.IsZero()
+	}, time.Second, 10*time.Millisecond, "Should schedule the next report")
+	status := r.Status()
+	assert.True(status.Running)
+	assert.True(status.NextReport.After(time.Now()))
+	assert.LessOrEqual(time.Until(status.NextReport), 24*time.Hour)
+	assert.Equal(0, status.NextReport.Hour())
+	assert.Equal(0, status.NextReport.Minute())
+
+	r.Stop()
+	assert.False(r.IsRunning())
+	assert.Zero(r.Status().NextReport)
+	r.Stop()
+}
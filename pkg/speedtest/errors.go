@@ -0,0 +1,73 @@
+package speedtest
+
+import (
+	"strconv"
+	"time"
+)
+
+type ErrMissingServer struct{}
+
+func (e ErrMissingServer) Error() string {
+	return "No iperf3 server provided"
+}
+
+type ErrInvalidPort struct {
+	Port int
+}
+
+func (e *ErrInvalidPort) Error() string {
+	return "Invalid iperf3 port " + strconv.Itoa(e.Port) + ", needs to be between 1 and 65535"
+}
+
+type ErrInvalidDuration struct {
+	Duration time.Duration
+}
+
+func (e *ErrInvalidDuration) Error() string {
+	return "Invalid duration " + e.Duration.String() + ", needs to be at least 1s"
+}
+
+type ErrInvalidStreams struct {
+	Streams int
+}
+
+func (e *ErrInvalidStreams) Error() string {
+	return "Invalid number of streams " + strconv.Itoa(e.Streams) + ", needs to be between 1 and 128"
+}
+
+type ErrIperf3 struct {
+	Message string
+}
+
+func (e *ErrIperf3) Error() string {
+	return "iperf3 failed: " + e.Message
+}
+
+type ErrMissingLibreSpeedServer struct{}
+
+func (e ErrMissingLibreSpeedServer) Error() string {
+	return "No LibreSpeed server or server list provided"
+}
+
+type ErrInvalidURL struct {
+	URL string
+}
+
+func (e *ErrInvalidURL) Error() string {
+	return "Invalid url \"" + e.URL + "\", needs to be an absolute http or https url"
+}
+
+type ErrNoServerAvailable struct{}
+
+func (e ErrNoServerAvailable) Error() string {
+	return "None of the LibreSpeed servers is reachable"
+}
+
+type ErrUnexpectedStatus struct {
+	URL    string
+	Status int
+}
+
+func (e *ErrUnexpectedStatus) Error() string {
+	return "Request to " + e.URL + " failed with status " + strconv.Itoa(e.Status)
+}
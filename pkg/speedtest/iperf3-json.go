@@ -0,0 +1,63 @@
+package speedtest
+
+// Data structure for the json output of iperf3
+type iperf3JSON struct {
+	Start iperf3StartJSON `json:"start"`
+	End   iperf3EndJSON   `json:"end"`
+	Error string          `json:"error"`
+}
+
+type iperf3StartJSON struct {
+	Connected    []iperf3ConnectionJSON `json:"connected"`
+	Version      string                 `json:"version"`
+	ConnectingTo iperf3HostJSON         `json:"connecting_to"`
+	TestStart    iperf3TestStartJSON    `json:"test_start"`
+}
+
+type iperf3ConnectionJSON struct {
+	LocalHost  string `json:"local_host"`
+	LocalPort  int    `json:"local_port"`
+	RemoteHost string `json:"remote_host"`
+	RemotePort int    `json:"remote_port"`
+}
+
+type iperf3HostJSON struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+type iperf3TestStartJSON struct {
+	Protocol   string `json:"protocol"`
+	NumStreams int    `json:"num_streams"`
+	Duration   int    `json:"duration"`
+	Reverse    int    `json:"reverse"`
+}
+
+type iperf3EndJSON struct {
+	Streams     []iperf3StreamJSON `json:"streams"`
+	SumSent     *iperf3SumJSON     `json:"sum_sent"`
+	SumReceived *iperf3SumJSON     `json:"sum_received"`
+	// Only reported for UDP
+	Sum *iperf3SumJSON `json:"sum"`
+}
+
+type iperf3StreamJSON struct {
+	Sender *iperf3StreamSenderJSON `json:"sender"`
+}
+
+type iperf3StreamSenderJSON struct {
+	// Unit: microseconds, only reported for TCP on Linux
+	MeanRTT int64 `json:"mean_rtt"`
+}
+
+type iperf3SumJSON struct {
+	Seconds       float64 `json:"seconds"`
+	Bytes         int64   `json:"bytes"`
+	BitsPerSecond float64 `json:"bits_per_second"`
+	// Only reported for TCP
+	Retransmits *int64 `json:"retransmits"`
+	// Only reported for UDP
+	JitterMS    float64 `json:"jitter_ms"`
+	LostPackets int64   `json:"lost_packets"`
+	Packets     int64   `json:"packets"`
+}
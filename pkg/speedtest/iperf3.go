@@ -0,0 +1,291 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"log/slog"
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const BackendIperf3 = "iperf3"
+
+const (
+	DefaultIperf3Port     = 5201
+	DefaultIperf3Duration = 10 * time.Second
+	DefaultIperf3Streams  = 1
+)
+
+// Iperf3 measures the throughput to an iperf3 server with the iperf3 binary.
+// The upload is measured by a normal run, the download by a run in reverse mode.
+type Iperf3 struct {
+	path     string
+	server   string
+	port     int
+	duration time.Duration
+	streams  int
+	udp      bool
+	bitrate  string
+}
+
+type Iperf3Option func(*Iperf3) error
+
+// WithIperf3Port sets the port of the iperf3 server, defaults to DefaultIperf3Port.
+func WithIperf3Port(port int) Iperf3Option {
+	return func(s *Iperf3) error {
+		if port < 1 || port > 65535 {
+			return &ErrInvalidPort{Port: port}
+		}
+		s.port = port
+		return nil
+	}
+}
+
+// WithIperf3Duration sets the duration of each direction, defaults to DefaultIperf3Duration.
+// iperf3 only supports whole seconds, the duration is rounded down.
+func WithIperf3Duration(duration time.Duration) Iperf3Option {
+	return func(s *Iperf3) error {
+		if duration < time.Second {
+			return &ErrInvalidDuration{Duration: duration}
+		}
+		s.duration = duration
+		return nil
+	}
+}
+
+// WithIperf3Streams sets the number of parallel streams, defaults to DefaultIperf3Streams.
+func WithIperf3Streams(streams int) Iperf3Option {
+	return func(s *Iperf3) error {
+		// Maximum supported by iperf3
+		if streams < 1 || streams > 128 {
+			return &ErrInvalidStreams{Streams: streams}
+		}
+		s.streams = streams
+		return nil
+	}
+}
+
+// WithIperf3UDP measures with UDP instead of TCP, which reports jitter and packet loss.
+// The bitrate is passed to iperf3 as is, e.g. "100M", iperf3 sends with 1 Mbit/s when it is empty.
+func WithIperf3UDP(bitrate string) Iperf3Option {
+	return func(s *Iperf3) error {
+		s.udp = true
+		s.bitrate = bitrate
+		return nil
+	}
+}
+
+// Create Iperf3, fails when it can't find the iperf3 binary
+// Arguments:
+//
+//	executable: name or full path to iperf3 binary
+//	server: host of the iperf3 server
+func NewIperf3(executable, server string, opts ...Iperf3Option) (*Iperf3, error) {
+	if server == "" {
+		return nil, ErrMissingServer{}
+	}
+
+	s := &Iperf3{
+		server:   server,
+		port:     DefaultIperf3Port,
+		duration: DefaultIperf3Duration,
+		streams:  DefaultIperf3Streams,
+	}
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := exec.LookPath(executable)
+	if errors.Is(err, exec.ErrDot) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.path = path
+
+	return s, nil
+}
+
+// Get path of the iperf3 binary
+func (s *Iperf3) Path() string {
+	return s.path
+}
+
+// Verify that the iperf3 binary can still be executed
+func (s *Iperf3) Check() error {
+	return checkExecutable(s.path)
+}
+
+// Arguments for a run of iperf3, reverse measures the download instead of the upload
+func (s *Iperf3) args(reverse bool) []string {
+	args := []string{
+		"--client", s.server,
+		"--port", strconv.Itoa(s.port),
+		"--time", strconv.Itoa(int(s.duration / time.Second)),
+		"--parallel", strconv.Itoa(s.streams),
+		"--json",
+	}
+	if s.udp {
+		args = append(args, "--udp")
+		if s.bitrate != "" {
+			args = append(args, "--bitrate", s.bitrate)
+		}
+	}
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	return args
+}
+
+var makeIperf3Cmd = func(ctx context.Context, path string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, path, args...)
+}
+
+// Run iperf3 against the server and parse the result
+func (s *Iperf3) Speedtest(ctx context.Context) *SpeedtestResult {
+	ctx, span := startRunSpan(ctx, BackendIperf3)
+	res := s.speedtest(ctx)
+	endRunSpan(span, res)
+	return res
+}
+
+// Run the upload and download, each direction is traced as child span
+func (s *Iperf3) speedtest(ctx context.Context) *SpeedtestResult {
+	start := time.Now()
+
+	upload, err := s.run(ctx, "upload", false)
+	if err != nil {
+		return NewFailedSpeedtestResult()
+	}
+	download, err := s.run(ctx, "download", true)
+	if err != nil {
+		return NewFailedSpeedtestResult()
+	}
+
+	var ping, jitter float64
+	var packetLoss *float64
+	var retransmits *int64
+	if s.udp {
+		jitter = (upload.received().JitterMS + download.received().JitterMS) / 2
+		lost := upload.received().LostPackets + download.received().LostPackets
+		packets := upload.received().Packets + download.received().Packets
+		if packets > 0 {
+			loss := float64(lost) / float64(packets) * 100
+			packetLoss = &loss
+		}
+	} else {
+		// The rtt is measured by the sender, which is the server for the download
+		ping = upload.meanRTT()
+		if ping == 0 {
+			ping = download.meanRTT()
+		}
+		if upload.sent().Retransmits != nil && download.sent().Retransmits != nil {
+			sum := *upload.sent().Retransmits + *download.sent().Retransmits
+			retransmits = &sum
+		}
+	}
+
+	host := upload.Start.ConnectingTo.Host
+	if host == "" {
+		host = s.server
+	}
+	var clientIP string
+	if len(upload.Start.Connected) > 0 {
+		clientIP = upload.Start.Connected[0].LocalHost
+	}
+	dataUsed := convertBytesToMB(upload.sent().Bytes) + convertBytesToMB(download.sent().Bytes)
+
+	res := NewSpeedtestResult(jitter, ping, download.throughput(), upload.throughput(), dataUsed, net.JoinHostPort(s.server, strconv.Itoa(s.port)), host, "", clientIP, time.Since(start))
+	res.backend = BackendIperf3
+	res.packetLoss = packetLoss
+	res.retransmits = retransmits
+
+	printSuccessMessage(res)
+
+	return res
+}
+
+// Execute a single run of iperf3 and parse the output.
+// iperf3 reports errors in the json output, so it is parsed even when the process fails.
+func (s *Iperf3) run(ctx context.Context, direction string, reverse bool) (*iperf3JSON, error) {
+	phaseCtx, span := startPhaseSpan(ctx, direction)
+	cmd := makeIperf3Cmd(phaseCtx, s.Path(), s.args(reverse)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var out iperf3JSON
+	err := json.Unmarshal(stdout.Bytes(), &out)
+	switch {
+	case err == nil && out.Error != "":
+		err = &ErrIperf3{Message: out.Error}
+	case runErr != nil:
+		err = runErr
+	case err == nil && (out.received() == nil || out.sent() == nil):
+		err = &ErrIperf3{Message: "no summary in output"}
+	}
+	if err != nil {
+		endPhaseSpan(span, err, attribute.String("process.executable.path", s.Path()))
+		slog.Error("Could not run iperf3", slog.String("direction", direction), "error", err, slog.String("stdout", stdout.String()), slog.String("stderr", stderr.String()))
+		return nil, err
+	}
+
+	attr := attrUpload
+	if reverse {
+		attr = attrDownload
+	}
+	endPhaseSpan(span, nil,
+		attribute.String("process.executable.path", s.Path()),
+		attrServerHost.String(out.Start.ConnectingTo.Host),
+		attr.Float64(out.throughput()),
+	)
+	return &out, nil
+}
+
+// Summary of the received data, UDP results of older iperf3 versions only contain a single summary
+func (o *iperf3JSON) received() *iperf3SumJSON {
+	if o.End.SumReceived != nil {
+		return o.End.SumReceived
+	}
+	return o.End.Sum
+}
+
+// Summary of the sent data, UDP results of older iperf3 versions only contain a single summary
+func (o *iperf3JSON) sent() *iperf3SumJSON {
+	if o.End.SumSent != nil {
+		return o.End.SumSent
+	}
+	return o.End.Sum
+}
+
+// Throughput of the run in Mbit/s, measured by the receiver
+func (o *iperf3JSON) throughput() float64 {
+	return convertBitsToMbits(o.received().BitsPerSecond)
+}
+
+// Average round trip time of the streams in ms, 0 if not measured
+func (o *iperf3JSON) meanRTT() float64 {
+	var sum int64
+	var count int64
+	for _, stream := range o.End.Streams {
+		if stream.Sender != nil && stream.Sender.MeanRTT > 0 {
+			sum += stream.Sender.MeanRTT
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count) / 1000
+}
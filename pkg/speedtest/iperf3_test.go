@@ -0,0 +1,151 @@
+package speedtest
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIperf3(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Server string
+		Opts   []Iperf3Option
+		Error  error
+	}{
+		{"MissingServer", "", nil, ErrMissingServer{}},
+		{"InvalidPort", "iperf.example.org", []Iperf3Option{WithIperf3Port(0)}, &ErrInvalidPort{Port: 0}},
+		{"InvalidDuration", "iperf.example.org", []Iperf3Option{WithIperf3Duration(500 * time.Millisecond)}, &ErrInvalidDuration{Duration: 500 * time.Millisecond}},
+		{"InvalidStreams", "iperf.example.org", []Iperf3Option{WithIperf3Streams(129)}, &ErrInvalidStreams{Streams: 129}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			s, err := NewIperf3("testdata/iperf3.sh", tCase.Server, tCase.Opts...)
+			assert.Nil(t, s)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+
+	t.Run("MissingBinary", func(t *testing.T) {
+		_, err := NewIperf3("/path/to/nothing", "iperf.example.org")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s, err := NewIperf3("testdata/iperf3.sh", "iperf.example.org")
+		require.NoError(t, err, "Should create iperf3")
+		assert.Contains(s.Path(), "testdata/iperf3.sh")
+		assert.Equal([]string{"--client", "iperf.example.org", "--port", "5201", "--time", "10", "--parallel", "1", "--json"}, s.args(false), "Should use the defaults")
+
+		s, err = NewIperf3("testdata/iperf3.sh", "iperf.example.org", WithIperf3Port(5202), WithIperf3Duration(30*time.Second), WithIperf3Streams(4), WithIperf3UDP("100M"))
+		require.NoError(t, err, "Should create iperf3")
+		assert.Equal([]string{"--client", "iperf.example.org", "--port", "5202", "--time", "30", "--parallel", "4", "--json", "--udp", "--bitrate", "100M", "--reverse"}, s.args(true))
+	})
+}
+
+// Run the iperf3 stand-in script with bash, as the executable bit may be lost on checkout
+func mockIperf3Cmd(t *testing.T) {
+	makeIperf3Cmd = func(ctx context.Context, path string, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "bash", append([]string{path}, args...)...)
+	}
+	t.Cleanup(func() {
+		makeIperf3Cmd = func(ctx context.Context, path string, args ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, path, args...)
+		}
+	})
+}
+
+func TestRunSpeedtestForIperf3(t *testing.T) {
+	mockIperf3Cmd(t)
+
+	t.Run("TCP", func(t *testing.T) {
+		s, err := NewIperf3("testdata/iperf3.sh", "iperf.example.org")
+		require.NoError(t, err, "Should create iperf3")
+
+		result := s.Speedtest(t.Context())
+		require.True(t, result.Success(), "Speedtest should succeed")
+
+		assert := assert.New(t)
+		assert.InDelta(931.564032, result.DownloadSpeed(), 0.000001, "Should use the receiver of the reverse run")
+		assert.InDelta(49.0123456, result.UploadSpeed(), 0.000001, "Should use the receiver of the forward run")
+		assert.InDelta(14.512, result.Ping(), 0.000001, "Should use the rtt of the forward run")
+		assert.Zero(result.JitterLatency())
+		assert.InDelta(1227.096064, result.DataUsed(), 0.000001)
+		assert.Equal("iperf.example.org:5201", result.ServerID())
+		assert.Equal("iperf.example.org", result.ServerHost())
+		assert.Equal("192.168.1.20", result.ClientIP())
+		assert.Equal(BackendIperf3, result.Backend())
+
+		retransmits, ok := result.Retransmits()
+		assert.True(ok, "Should measure retransmits")
+		assert.Equal(int64(42), retransmits)
+		_, ok = result.PacketLoss()
+		assert.False(ok, "Should not measure packet loss with tcp")
+	})
+	t.Run("UDP", func(t *testing.T) {
+		s, err := NewIperf3("testdata/iperf3.sh", "iperf.example.org", WithIperf3UDP("100M"))
+		require.NoError(t, err, "Should create iperf3")
+
+		result := s.Speedtest(t.Context())
+		require.True(t, result.Success(), "Speedtest should succeed")
+
+		assert := assert.New(t)
+		assert.InDelta(100, result.DownloadSpeed(), 0.000001)
+		assert.InDelta(50, result.UploadSpeed(), 0.000001)
+		assert.InDelta(0.3, result.JitterLatency(), 0.000001, "Should average the jitter of both runs")
+		assert.Zero(result.Ping())
+		assert.InDelta(187.5, result.DataUsed(), 0.000001)
+
+		packetLoss, ok := result.PacketLoss()
+		assert.True(ok, "Should measure packet loss")
+		assert.InDelta(0.5, packetLoss, 0.000001)
+		_, ok = result.Retransmits()
+		assert.False(ok, "Should not measure retransmits with udp")
+	})
+	t.Run("Error", func(t *testing.T) {
+		s, err := NewIperf3("testdata/iperf3.sh", "unreachable.example.org")
+		require.NoError(t, err, "Should create iperf3")
+
+		assert.False(t, s.Speedtest(t.Context()).Success(), "Speedtest should fail")
+	})
+}
+
+func TestCancelSpeedtestForIperf3(t *testing.T) {
+	s, err := NewIperf3("testdata/iperf3.sh", "iperf.example.org")
+	require.NoError(t, err, "Should create iperf3")
+	makeIperf3Cmd = func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sleep", "10")
+	}
+	t.Cleanup(func() {
+		makeIperf3Cmd = func(ctx context.Context, path string, args ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, path, args...)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	result := s.Speedtest(ctx)
+
+	assert.False(t, result.Success(), "Cancelled speedtest should fail")
+}
+
+func TestIperf3MeanRTT(t *testing.T) {
+	assert := assert.New(t)
+
+	out := iperf3JSON{End: iperf3EndJSON{Streams: []iperf3StreamJSON{
+		{Sender: &iperf3StreamSenderJSON{MeanRTT: 10000}},
+		{Sender: &iperf3StreamSenderJSON{MeanRTT: 20000}},
+		{Sender: &iperf3StreamSenderJSON{}},
+		{},
+	}}}
+	assert.InDelta(15, out.meanRTT(), 0.000001, "Should average the streams measuring the rtt")
+	assert.Zero((&iperf3JSON{}).meanRTT(), "Should return 0 when not measured")
+}
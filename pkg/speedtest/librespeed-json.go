@@ -0,0 +1,28 @@
+package speedtest
+
+import "encoding/json/jsontext"
+
+// Data structure of a server in a LibreSpeed server list
+type libreSpeedServerJSON struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Server   string `json:"server"`
+	DLURL    string `json:"dlURL"`
+	ULURL    string `json:"ulURL"`
+	PingURL  string `json:"pingURL"`
+	GetIPURL string `json:"getIpURL"`
+}
+
+// Data structure for the json output of getIP.php
+type libreSpeedIPJSON struct {
+	// Formatted as "<ip> - <isp>, <country> (<distance>)", everything but the ip is optional
+	ProcessedString string `json:"processedString"`
+	// Empty string when the server has no ipinfo.io access
+	RawISPInfo jsontext.Value `json:"rawIspInfo"`
+}
+
+// Subset of the ipinfo.io response in rawIspInfo
+type libreSpeedISPInfoJSON struct {
+	// Formatted as "AS<number> <isp>"
+	Org string `json:"org"`
+}
@@ -0,0 +1,541 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const BackendLibreSpeed = "librespeed"
+
+const (
+	DefaultLibreSpeedDuration = 10 * time.Second
+	DefaultLibreSpeedStreams  = 3
+)
+
+const (
+	// Number of pings used to measure the latency and jitter
+	libreSpeedPings = 10
+	// Number of pings used to select the server with the lowest latency
+	libreSpeedSelectPings = 3
+	// Timeout for requests that are not part of the throughput measurement
+	libreSpeedRequestTimeout = 10 * time.Second
+	// Size of the garbage requested by a download request in MiB, same as the LibreSpeed web client
+	libreSpeedChunkSize = 100
+	// Size of the body of an upload request
+	libreSpeedUploadSize = 4 << 20
+)
+
+// Paths of the LibreSpeed backend, relative to the url of the server
+const (
+	libreSpeedDLPath    = "garbage.php"
+	libreSpeedULPath    = "empty.php"
+	libreSpeedPingPath  = "empty.php"
+	libreSpeedGetIPPath = "getIP.php"
+)
+
+// LibreSpeed runs speedtests against LibreSpeed servers with the http protocol of the LibreSpeed web client.
+// When multiple servers are available, the one with the lowest latency is used.
+type LibreSpeed struct {
+	servers    []libreSpeedServerJSON
+	serverList string
+	duration   time.Duration
+	streams    int
+	client     *http.Client
+}
+
+type LibreSpeedOption func(*LibreSpeed) error
+
+// WithLibreSpeedServers adds servers by the url of their backend, e.g. "https://speedtest.example.org/backend".
+func WithLibreSpeedServers(servers ...string) LibreSpeedOption {
+	return func(s *LibreSpeed) error {
+		for _, server := range servers {
+			err := validateURL(server)
+			if err != nil {
+				return err
+			}
+			s.servers = append(s.servers, libreSpeedServerJSON{
+				Server:   server,
+				DLURL:    libreSpeedDLPath,
+				ULURL:    libreSpeedULPath,
+				PingURL:  libreSpeedPingPath,
+				GetIPURL: libreSpeedGetIPPath,
+			})
+		}
+		return nil
+	}
+}
+
+// WithLibreSpeedServerList fetches the servers from a json server list in the format used by the LibreSpeed web client before every run.
+func WithLibreSpeedServerList(serverList string) LibreSpeedOption {
+	return func(s *LibreSpeed) error {
+		err := validateURL(serverList)
+		if err != nil {
+			return err
+		}
+		s.serverList = serverList
+		return nil
+	}
+}
+
+// WithLibreSpeedDuration sets the duration of the download and the upload, defaults to DefaultLibreSpeedDuration.
+func WithLibreSpeedDuration(duration time.Duration) LibreSpeedOption {
+	return func(s *LibreSpeed) error {
+		if duration < time.Second {
+			return &ErrInvalidDuration{Duration: duration}
+		}
+		s.duration = duration
+		return nil
+	}
+}
+
+// WithLibreSpeedStreams sets the number of parallel requests, defaults to DefaultLibreSpeedStreams.
+func WithLibreSpeedStreams(streams int) LibreSpeedOption {
+	return func(s *LibreSpeed) error {
+		if streams < 1 || streams > 128 {
+			return &ErrInvalidStreams{Streams: streams}
+		}
+		s.streams = streams
+		return nil
+	}
+}
+
+// Create LibreSpeed, needs at least one server or a server list
+func NewLibreSpeed(opts ...LibreSpeedOption) (*LibreSpeed, error) {
+	s := &LibreSpeed{
+		duration: DefaultLibreSpeedDuration,
+		streams:  DefaultLibreSpeedStreams,
+	}
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(s.servers) == 0 && s.serverList == "" {
+		return nil, ErrMissingLibreSpeedServer{}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = s.streams
+	s.client = &http.Client{Transport: transport}
+
+	return s, nil
+}
+
+// Check that the url is an absolute http or https url
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrInvalidURL{URL: raw}
+	}
+	return nil
+}
+
+// Run a speedtest against the LibreSpeed server with the lowest latency
+func (s *LibreSpeed) Speedtest(ctx context.Context) *SpeedtestResult {
+	ctx, span := startRunSpan(ctx, BackendLibreSpeed)
+	res := s.speedtest(ctx)
+	endRunSpan(span, res)
+	return res
+}
+
+// Run the phases of the speedtest, each phase is traced as a child span
+func (s *LibreSpeed) speedtest(ctx context.Context) *SpeedtestResult {
+	start := time.Now()
+
+	servers := s.servers
+	if s.serverList != "" {
+		phaseCtx, span := startPhaseSpan(ctx, "fetch_server_list")
+		list, err := s.fetchServerList(phaseCtx)
+		endPhaseSpan(span, err, attrServerCount.Int(len(list)))
+		if err != nil {
+			slog.Error("Could not fetch LibreSpeed server list", slog.String("url", s.serverList), "error", err)
+			return NewFailedSpeedtestResult()
+		}
+		servers = append(append([]libreSpeedServerJSON(nil), servers...), list...)
+	}
+
+	phaseCtx, span := startPhaseSpan(ctx, "select_server")
+	server, err := s.selectServer(phaseCtx, servers)
+	if err != nil {
+		endPhaseSpan(span, err, attrServerCount.Int(len(servers)))
+		slog.Error("Failed to find a reachable LibreSpeed server", "error", err)
+		return NewFailedSpeedtestResult()
+	}
+	serverURL, _ := server.resolve("")
+	endPhaseSpan(span, nil,
+		attrServerCount.Int(len(servers)),
+		attrServerID.String(server.id()),
+		attrServerHost.String(serverURL.Hostname()),
+		attrServerLocation.String(server.Name),
+	)
+
+	phaseCtx, span = startPhaseSpan(ctx, "ping")
+	ping, jitter, err := s.ping(phaseCtx, server, libreSpeedPings)
+	endPhaseSpan(span, err, attrPing.Float64(ping), attrJitter.Float64(jitter))
+	if err != nil {
+		slog.Error("Failed to run ping test", "error", err)
+		return NewFailedSpeedtestResult()
+	}
+
+	phaseCtx, span = startPhaseSpan(ctx, "download")
+	downloaded, downloadMbps, err := s.measure(phaseCtx, server, s.download)
+	endPhaseSpan(span, err, attrDownload.Float64(downloadMbps))
+	if err != nil {
+		slog.Error("Failed to run download test", "error", err)
+		return NewFailedSpeedtestResult()
+	}
+
+	phaseCtx, span = startPhaseSpan(ctx, "upload")
+	uploaded, uploadMbps, err := s.measure(phaseCtx, server, s.upload)
+	endPhaseSpan(span, err, attrUpload.Float64(uploadMbps))
+	if err != nil {
+		slog.Error("Failed to run upload test", "error", err)
+		return NewFailedSpeedtestResult()
+	}
+
+	phaseCtx, span = startPhaseSpan(ctx, "get_ip")
+	ip, isp, err := s.getIP(phaseCtx, server)
+	if err != nil {
+		endPhaseSpan(span, err)
+		slog.Error("Failed to fetch client information", "error", err)
+		return NewFailedSpeedtestResult()
+	}
+	endPhaseSpan(span, nil, attrISP.String(isp))
+
+	dataUsed := convertBytesToMB(downloaded) + convertBytesToMB(uploaded)
+
+	res := NewSpeedtestResult(jitter, ping, downloadMbps, uploadMbps, dataUsed, server.id(), serverURL.Hostname(), isp, ip, time.Since(start))
+	res.serverLocation = server.Name
+	res.backend = BackendLibreSpeed
+
+	printSuccessMessage(res)
+
+	return res
+}
+
+// Fetch the servers from the server list, protocol-relative server urls use the scheme of the list
+func (s *LibreSpeed) fetchServerList(ctx context.Context) ([]libreSpeedServerJSON, error) {
+	ctx, cancel := context.WithTimeout(ctx, libreSpeedRequestTimeout)
+	defer cancel()
+
+	body, err := s.get(ctx, s.serverList)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []libreSpeedServerJSON
+	err = json.Unmarshal(body, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := strings.SplitN(s.serverList, ":", 2)[0]
+	for i := range list {
+		if strings.HasPrefix(list[i].Server, "//") {
+			list[i].Server = scheme + ":" + list[i].Server
+		}
+	}
+	return list, nil
+}
+
+// Select the server with the lowest latency, unreachable servers are skipped
+func (s *LibreSpeed) selectServer(ctx context.Context, servers []libreSpeedServerJSON) (libreSpeedServerJSON, error) {
+	if len(servers) == 1 {
+		return servers[0], nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, libreSpeedRequestTimeout)
+	defer cancel()
+
+	pings := make([]float64, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Go(func() {
+			ping, _, err := s.ping(ctx, server, libreSpeedSelectPings)
+			if err != nil {
+				slog.Debug("LibreSpeed server is not reachable", slog.String("server", server.Server), "error", err)
+				pings[i] = -1
+				return
+			}
+			pings[i] = ping
+		})
+	}
+	wg.Wait()
+
+	selected := -1
+	for i, ping := range pings {
+		if ping >= 0 && (selected < 0 || ping < pings[selected]) {
+			selected = i
+		}
+	}
+	if selected < 0 {
+		return libreSpeedServerJSON{}, ErrNoServerAvailable{}
+	}
+	return servers[selected], nil
+}
+
+// Measure the latency with the given number of pings, returns the lowest ping and the average
+// difference between consecutive pings as jitter in ms, same as the LibreSpeed web client.
+func (s *LibreSpeed) ping(ctx context.Context, server libreSpeedServerJSON, count int) (float64, float64, error) {
+	u, err := server.resolve(server.PingURL)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Establish the connection first, so the handshake is not part of the measurement
+	_, err = s.get(ctx, withCacheBuster(u).String())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var ping, jitter, last float64
+	for i := range count {
+		start := time.Now()
+		_, err = s.get(ctx, withCacheBuster(u).String())
+		if err != nil {
+			return 0, 0, err
+		}
+		rtt := float64(time.Since(start).Microseconds()) / 1000
+
+		if i == 0 || rtt < ping {
+			ping = rtt
+		}
+		if i > 0 {
+			jitter += math.Abs(rtt - last)
+		}
+		last = rtt
+	}
+	if count > 1 {
+		jitter /= float64(count - 1)
+	}
+	return ping, jitter, nil
+}
+
+// Run the transfer in parallel streams for the configured duration.
+// Returns the number of transferred bytes and the throughput in Mbit/s.
+func (s *LibreSpeed) measure(ctx context.Context, server libreSpeedServerJSON, transfer func(context.Context, libreSpeedServerJSON, *atomic.Int64) error) (int64, float64, error) {
+	measureCtx, cancel := context.WithTimeout(ctx, s.duration)
+	defer cancel()
+
+	var transferred atomic.Int64
+	errs := make([]error, s.streams)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := range s.streams {
+		wg.Go(func() {
+			for measureCtx.Err() == nil {
+				err := transfer(measureCtx, server, &transferred)
+				if err != nil && measureCtx.Err() == nil {
+					errs[i] = err
+					cancel()
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// The measurement ends by the deadline, any other reason is a failure
+	err := errors.Join(errs...)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bytes := transferred.Load()
+	return bytes, convertBytesToMbits(bytes) / elapsed.Seconds(), nil
+}
+
+// Download garbage from the server until the context is done
+func (s *LibreSpeed) download(ctx context.Context, server libreSpeedServerJSON, transferred *atomic.Int64) error {
+	u, err := server.resolve(server.DLURL)
+	if err != nil {
+		return err
+	}
+	u = withCacheBuster(u)
+	q := u.Query()
+	q.Set("ckSize", strconv.Itoa(libreSpeedChunkSize))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return &ErrUnexpectedStatus{URL: u.Redacted(), Status: res.StatusCode}
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := res.Body.Read(buf)
+		transferred.Add(int64(n))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Data sent by upload requests, only created once as generating it is slow
+var libreSpeedUploadData = sync.OnceValue(func() []byte {
+	data := make([]byte, libreSpeedUploadSize)
+	_, _ = rand.Read(data)
+	return data
+})
+
+// Upload data to the server until the context is done
+func (s *LibreSpeed) upload(ctx context.Context, server libreSpeedServerJSON, transferred *atomic.Int64) error {
+	u, err := server.resolve(server.ULURL)
+	if err != nil {
+		return err
+	}
+	u = withCacheBuster(u)
+
+	body := &countingReader{r: bytes.NewReader(libreSpeedUploadData()), n: transferred}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = libreSpeedUploadSize
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return &ErrUnexpectedStatus{URL: u.Redacted(), Status: res.StatusCode}
+	}
+	return nil
+}
+
+// Matches the ASN prefix of the org reported by ipinfo.io
+var asnPrefix = regexp.MustCompile(`^AS\d+ `)
+
+// Fetch the public ip and isp of the client from the server
+func (s *LibreSpeed) getIP(ctx context.Context, server libreSpeedServerJSON) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, libreSpeedRequestTimeout)
+	defer cancel()
+
+	u, err := server.resolve(server.GetIPURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	q.Set("isp", "true")
+	u.RawQuery = q.Encode()
+
+	body, err := s.get(ctx, u.String())
+	if err != nil {
+		return "", "", err
+	}
+
+	var out libreSpeedIPJSON
+	err = json.Unmarshal(body, &out)
+	if err != nil {
+		return "", "", err
+	}
+
+	ip, isp, _ := strings.Cut(out.ProcessedString, " - ")
+
+	var info libreSpeedISPInfoJSON
+	if json.Unmarshal(out.RawISPInfo, &info) == nil && info.Org != "" {
+		isp = asnPrefix.ReplaceAllString(info.Org, "")
+	} else if i := strings.LastIndex(isp, ", "); i >= 0 {
+		// Remove the country and distance
+		isp = isp[:i]
+	}
+	return strings.TrimSpace(ip), isp, nil
+}
+
+// Send a GET request and return the body, fails on any status but 200
+func (s *LibreSpeed) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &ErrUnexpectedStatus{URL: req.URL.Redacted(), Status: res.StatusCode}
+	}
+	return io.ReadAll(res.Body)
+}
+
+// ID of the server in the server list, servers without an id are identified by their url
+func (server libreSpeedServerJSON) id() string {
+	if server.ID != 0 {
+		return strconv.Itoa(server.ID)
+	}
+	return server.Server
+}
+
+// Resolve a path relative to the url of the server
+func (server libreSpeedServerJSON) resolve(path string) (*url.URL, error) {
+	base, err := url.Parse(server.Server)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	return base.ResolveReference(ref), nil
+}
+
+// Add a random parameter to the url to prevent caching, same as the LibreSpeed web client
+func withCacheBuster(u *url.URL) *url.URL {
+	res := *u
+	q := res.Query()
+	q.Set("r", newRunID())
+	res.RawQuery = q.Encode()
+	return &res
+}
+
+// Counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,232 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// In-process stand-in for a LibreSpeed server with the backend in /backend
+type mockLibreSpeed struct {
+	*httptest.Server
+
+	// Status returned for downloads, 200 when 0
+	DownloadStatus int
+	// Raw isp info returned by getIP.php
+	RawISPInfo string
+
+	pings     atomic.Int64
+	downloads atomic.Int64
+	uploads   atomic.Int64
+}
+
+func newMockLibreSpeed(t *testing.T) *mockLibreSpeed {
+	m := &mockLibreSpeed{RawISPInfo: `{"ip":"203.0.113.10","org":"AS64496 Foo Corp.","country":"DE"}`}
+
+	chunk := make([]byte, 1<<20)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /backend/garbage.php", func(w http.ResponseWriter, r *http.Request) {
+		m.downloads.Add(1)
+		if m.DownloadStatus != 0 {
+			w.WriteHeader(m.DownloadStatus)
+			return
+		}
+		size, err := strconv.Atoi(r.URL.Query().Get("ckSize"))
+		if err != nil {
+			size = 4
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		for range size {
+			_, err := w.Write(chunk)
+			if err != nil {
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/backend/empty.php", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			m.uploads.Add(1)
+			_, _ = io.Copy(io.Discard, r.Body)
+		} else {
+			m.pings.Add(1)
+		}
+		w.Header().Set("Cache-Control", "no-store")
+	})
+	mux.HandleFunc("GET /backend/getIP.php", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"processedString":"203.0.113.10 - Foo Corp., DE (12 km)","rawIspInfo":%s}`, m.RawISPInfo)
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// Create a LibreSpeed backend with a short duration to keep the tests fast
+func newTestLibreSpeed(t *testing.T, opts ...LibreSpeedOption) *LibreSpeed {
+	s, err := NewLibreSpeed(append(opts, WithLibreSpeedStreams(2))...)
+	require.NoError(t, err, "Should create LibreSpeed")
+	s.duration = 200 * time.Millisecond
+	return s
+}
+
+func TestNewLibreSpeed(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Opts  []LibreSpeedOption
+		Error error
+	}{
+		{"MissingServer", nil, ErrMissingLibreSpeedServer{}},
+		{"InvalidServer", []LibreSpeedOption{WithLibreSpeedServers("speedtest.example.org/backend")}, &ErrInvalidURL{URL: "speedtest.example.org/backend"}},
+		{"InvalidServerList", []LibreSpeedOption{WithLibreSpeedServerList("ftp://speedtest.example.org/servers.json")}, &ErrInvalidURL{URL: "ftp://speedtest.example.org/servers.json"}},
+		{"InvalidDuration", []LibreSpeedOption{WithLibreSpeedServers("https://speedtest.example.org"), WithLibreSpeedDuration(0)}, &ErrInvalidDuration{Duration: 0}},
+		{"InvalidStreams", []LibreSpeedOption{WithLibreSpeedServers("https://speedtest.example.org"), WithLibreSpeedStreams(0)}, &ErrInvalidStreams{Streams: 0}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			s, err := NewLibreSpeed(tCase.Opts...)
+			assert.Nil(t, s)
+			assert.Equal(t, tCase.Error, err)
+		})
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s, err := NewLibreSpeed(WithLibreSpeedServers("https://a.example.org/backend", "https://b.example.org"), WithLibreSpeedServerList("https://example.org/servers.json"), WithLibreSpeedDuration(15*time.Second), WithLibreSpeedStreams(6))
+		require.NoError(t, err, "Should create LibreSpeed")
+		assert.Len(s.servers, 2)
+		assert.Equal("https://example.org/servers.json", s.serverList)
+		assert.Equal(15*time.Second, s.duration)
+		assert.Equal(6, s.streams)
+
+		s, err = NewLibreSpeed(WithLibreSpeedServerList("https://example.org/servers.json"))
+		require.NoError(t, err, "Should create LibreSpeed")
+		assert.Equal(DefaultLibreSpeedDuration, s.duration)
+		assert.Equal(DefaultLibreSpeedStreams, s.streams)
+	})
+}
+
+func TestRunSpeedtestForLibreSpeed(t *testing.T) {
+	t.Run("Server", func(t *testing.T) {
+		m := newMockLibreSpeed(t)
+		s := newTestLibreSpeed(t, WithLibreSpeedServers(m.URL+"/backend"))
+
+		result := s.Speedtest(t.Context())
+		require.True(t, result.Success(), "Speedtest should succeed")
+
+		assert := assert.New(t)
+		assert.Positive(result.DownloadSpeed())
+		assert.Positive(result.UploadSpeed())
+		assert.Positive(result.Ping())
+		assert.Positive(result.DataUsed())
+		assert.Equal(m.URL+"/backend", result.ServerID(), "Should identify servers without id by their url")
+		assert.Equal("127.0.0.1", result.ServerHost())
+		assert.Equal("Foo Corp.", result.ClientISP(), "Should remove the ASN from the org")
+		assert.Equal("203.0.113.10", result.ClientIP())
+		assert.Equal(BackendLibreSpeed, result.Backend())
+
+		assert.Equal(int64(libreSpeedPings+1), m.pings.Load(), "Should only ping a single server once per ping")
+		assert.Positive(m.downloads.Load())
+		assert.Positive(m.uploads.Load())
+	})
+	t.Run("ServerList", func(t *testing.T) {
+		m := newMockLibreSpeed(t)
+
+		// The first server is not reachable and needs to be skipped
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+
+		list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `[
+				{"id":1,"name":"Offline","server":"%s/backend/","dlURL":"garbage.php","ulURL":"empty.php","pingURL":"empty.php","getIpURL":"getIP.php"},
+				{"id":42,"name":"Frankfurt, Germany","server":"//%s/backend","dlURL":"garbage.php","ulURL":"empty.php","pingURL":"empty.php","getIpURL":"getIP.php"}
+			]`, unreachable.URL, m.Listener.Addr().String())
+		}))
+		t.Cleanup(list.Close)
+
+		s := newTestLibreSpeed(t, WithLibreSpeedServerList(list.URL+"/servers.json"))
+
+		result := s.Speedtest(t.Context())
+		require.True(t, result.Success(), "Speedtest should succeed")
+
+		assert := assert.New(t)
+		assert.Equal("42", result.ServerID(), "Should select the reachable server")
+		assert.Equal("Frankfurt, Germany", result.ServerLocation())
+		assert.Positive(result.DownloadSpeed())
+	})
+	t.Run("WithoutISPInfo", func(t *testing.T) {
+		m := newMockLibreSpeed(t)
+		m.RawISPInfo = `""`
+		s := newTestLibreSpeed(t, WithLibreSpeedServers(m.URL+"/backend"))
+
+		result := s.Speedtest(t.Context())
+		require.True(t, result.Success(), "Speedtest should succeed")
+		assert.Equal(t, "Foo Corp.", result.ClientISP(), "Should parse the isp from the processed string")
+	})
+	t.Run("NoServerAvailable", func(t *testing.T) {
+		a := httptest.NewServer(http.NotFoundHandler())
+		b := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(a.Close)
+		t.Cleanup(b.Close)
+		s := newTestLibreSpeed(t, WithLibreSpeedServers(a.URL, b.URL))
+
+		assert.False(t, s.Speedtest(t.Context()).Success(), "Speedtest should fail")
+	})
+	t.Run("DownloadFailed", func(t *testing.T) {
+		m := newMockLibreSpeed(t)
+		m.DownloadStatus = http.StatusInternalServerError
+		s := newTestLibreSpeed(t, WithLibreSpeedServers(m.URL+"/backend"))
+
+		assert.False(t, s.Speedtest(t.Context()).Success(), "Speedtest should fail")
+		assert.Zero(t, m.uploads.Load(), "Should abort before the upload")
+	})
+}
+
+func TestCancelSpeedtestForLibreSpeed(t *testing.T) {
+	m := newMockLibreSpeed(t)
+	s := newTestLibreSpeed(t, WithLibreSpeedServers(m.URL+"/backend"))
+	s.duration = 10 * time.Second
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result := s.Speedtest(ctx)
+
+	assert.False(t, result.Success(), "Cancelled speedtest should fail")
+	assert.Less(t, time.Since(start), 5*time.Second, "Should abort the measurement")
+}
+
+func TestLibreSpeedServerResolve(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Server string
+		Path   string
+		Result string
+	}{
+		{"WithoutSlash", "https://example.org/backend", "garbage.php", "https://example.org/backend/garbage.php"},
+		{"WithSlash", "https://example.org/backend/", "garbage.php", "https://example.org/backend/garbage.php"},
+		{"AbsolutePath", "https://example.org/backend", "/speedtest/empty.php", "https://example.org/speedtest/empty.php"},
+		{"Root", "https://example.org", "getIP.php", "https://example.org/getIP.php"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			u, err := libreSpeedServerJSON{Server: tCase.Server}.resolve(tCase.Path)
+			require.NoError(t, err)
+			assert.Equal(t, tCase.Result, u.String())
+		})
+	}
+}
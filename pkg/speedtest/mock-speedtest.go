@@ -1,6 +1,9 @@
 package speedtest
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type MockSpeedtest struct {
 	Callback func()
@@ -8,11 +11,11 @@ type MockSpeedtest struct {
 	Result   *SpeedtestResult
 }
 
-func (s *MockSpeedtest) Speedtest() *SpeedtestResult {
+func (s *MockSpeedtest) Speedtest(ctx context.Context) *SpeedtestResult {
 	if s.Callback != nil {
 		s.Callback()
 	}
-	if s.Fail {
+	if s.Fail || ctx.Err() != nil {
 		return NewFailedSpeedtestResult()
 	}
 	return s.Result
@@ -21,5 +24,10 @@ func (s *MockSpeedtest) Speedtest() *SpeedtestResult {
 func MockSpeedtestResult(timestamp int64) *SpeedtestResult {
 	result := NewSpeedtestResult(0.5, 15, 876.53, 12.34, 950.3079, "1234", "example.org", "Foo Corp.", "127.0.0.1", 251234*time.Millisecond)
 	result.timestamp = timestamp
+	result.serverLocation = "Frankfurt, Germany"
+	result.backend = "mock"
+	result.iface = "eth0"
+	packetLoss := 0.25
+	result.packetLoss = &packetLoss
 	return result
 }
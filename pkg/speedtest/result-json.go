@@ -7,7 +7,7 @@ type resultJSON struct {
 	Ping       resultPingJSON      `json:"ping"`
 	Download   resultBandwidthJSON `json:"download"`
 	Upload     resultBandwidthJSON `json:"upload"`
-	PacketLoss float64             `json:"packetLoss"`
+	PacketLoss *float64            `json:"packetLoss"`
 	ISP        string              `json:"isp"`
 	Interface  resultInterfaceJSON `json:"interface"`
 	Server     resultServerJSON    `json:"server"`
@@ -2,14 +2,19 @@ package speedtest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json/v2"
 	"errors"
 	"log/slog"
 	"os/exec"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const BackendSpeedtestCLI = "speedtest-cli"
+
 type SpeedtestCLI struct {
 	path string
 }
@@ -36,36 +41,63 @@ func (s *SpeedtestCLI) Path() string {
 	return s.path
 }
 
-var makeCmd = func(path string) *exec.Cmd {
-	return exec.Command(path, "--format=json-pretty", "--accept-license", "--accept-gdpr")
+// Verify that the speedtest-cli binary can still be executed
+func (s *SpeedtestCLI) Check() error {
+	return checkExecutable(s.path)
+}
+
+var makeCmd = func(ctx context.Context, path string) *exec.Cmd {
+	return exec.CommandContext(ctx, path, "--format=json-pretty", "--accept-license", "--accept-gdpr")
 }
 
 // Execute the speedtest-cli binary and parse the result
-func (s *SpeedtestCLI) Speedtest() *SpeedtestResult {
+func (s *SpeedtestCLI) Speedtest(ctx context.Context) *SpeedtestResult {
+	ctx, span := startRunSpan(ctx, BackendSpeedtestCLI)
+	res := s.speedtest(ctx)
+	endRunSpan(span, res)
+	return res
+}
+
+// Run the speedtest, the process execution and parsing of the output are traced as child spans
+func (s *SpeedtestCLI) speedtest(ctx context.Context) *SpeedtestResult {
 	start := time.Now()
 
-	cmd := makeCmd(s.Path())
+	phaseCtx, span := startPhaseSpan(ctx, "exec")
+	cmd := makeCmd(phaseCtx, s.Path())
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
+	endPhaseSpan(span, err, attribute.String("process.executable.path", s.Path()))
 	if err != nil {
 		slog.Error("Could not execute speedtest", "error", err, slog.String("stdout", stdout.String()), slog.String("stderr", stderr.String()))
 		return NewFailedSpeedtestResult()
 	}
 
+	_, span = startPhaseSpan(ctx, "parse_json")
 	var out resultJSON
 	err = json.UnmarshalRead(&stdout, &out)
 	if err != nil {
+		endPhaseSpan(span, err)
 		slog.Error("Parsing JSON output from speedtest failed", "error", err, slog.String("output", stdout.String()))
 		return NewFailedSpeedtestResult()
 	}
+	endPhaseSpan(span, nil,
+		attrServerID.String(strconv.Itoa(out.Server.Id)),
+		attrServerHost.String(out.Server.Host),
+		attrServerLocation.String(formatLocation(out.Server.Location, out.Server.Country)),
+	)
 
 	downloadMbps := convertBytesToMbits(out.Download.Bandwidth)
 	uploadMbps := convertBytesToMbits(out.Upload.Bandwidth)
 	dataUsed := convertBytesToMB(out.Download.Bytes) + convertBytesToMB(out.Upload.Bytes)
 
 	res := NewSpeedtestResult(out.Ping.Jitter, out.Ping.Latency, downloadMbps, uploadMbps, dataUsed, strconv.Itoa(out.Server.Id), out.Server.Host, out.ISP, out.Interface.ExternalIP, time.Since(start))
+	res.serverLocation = formatLocation(out.Server.Location, out.Server.Country)
+	res.backend = BackendSpeedtestCLI
+	res.iface = out.Interface.Name
+	// Only reported by speedtest-cli when the server supports measuring it
+	res.packetLoss = out.PacketLoss
 
 	printSuccessMessage(res)
 
@@ -1,9 +1,11 @@
 package speedtest
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,19 +27,49 @@ func TestNewSpeedtestCLI(t *testing.T) {
 	})
 }
 
+func TestCheckSpeedtestCLI(t *testing.T) {
+	s, err := NewSpeedtestCLI("testdata/speedtest-cli.sh")
+	require.NoError(t, err, "Should create speedtest-cli")
+	assert.NoError(t, s.Check(), "Should find the binary")
+
+	s.path = "/path/to/nothing"
+	assert.ErrorIs(t, s.Check(), os.ErrNotExist, "Should fail when the binary was removed")
+}
+
 func TestRunSpeedtestForCLI(t *testing.T) {
 	s, err := NewSpeedtestCLI("testdata/speedtest-cli.sh")
 	require.NoError(t, err, "Should create speedtest-cli")
-	makeCmd = func(path string) *exec.Cmd {
-		return exec.Command("bash", "-c", path)
+	makeCmd = func(ctx context.Context, path string) *exec.Cmd {
+		return exec.CommandContext(ctx, "bash", "-c", path)
 	}
 
 	expectedResult := NewSpeedtestResult(0.629, 17.148, 931.564032, 49.4518, 1141.3079899999998, "60440", "speedtest.hannover.jonasdevries.de", "Some ISP", "100.107.156.96", 0)
+	expectedResult.serverLocation = "Hannover, Germany"
+	expectedResult.backend = BackendSpeedtestCLI
+	expectedResult.iface = "eth0"
+	packetLoss := 0.0
+	expectedResult.packetLoss = &packetLoss
 
-	result := s.Speedtest()
+	result := s.Speedtest(t.Context())
 
 	expectedResult.timestamp = result.timestamp // sync timestamps for comparison
 	expectedResult.duration = result.duration   // sync duration for comparison
+	expectedResult.runID = result.runID         // sync run ID for comparison
 
 	assert.Equal(t, result, expectedResult)
 }
+
+func TestCancelSpeedtestForCLI(t *testing.T) {
+	s, err := NewSpeedtestCLI("testdata/speedtest-cli.sh")
+	require.NoError(t, err, "Should create speedtest-cli")
+	makeCmd = func(ctx context.Context, _ string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sleep", "10")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	result := s.Speedtest(ctx)
+
+	assert.False(t, result.Success(), "Cancelled speedtest should fail")
+}
@@ -1,12 +1,16 @@
 package speedtest
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"time"
 
 	"github.com/showwin/speedtest-go/speedtest"
 )
 
+const BackendSpeedtestGo = "speedtest-go"
+
 type SpeedtestGo struct {
 }
 
@@ -16,43 +20,84 @@ func NewSpeedtest() *SpeedtestGo {
 }
 
 // Use the speedtest-go api to run a speedtest and parse the result
-func (s *SpeedtestGo) Speedtest() *SpeedtestResult {
+func (s *SpeedtestGo) Speedtest(ctx context.Context) *SpeedtestResult {
+	ctx, span := startRunSpan(ctx, BackendSpeedtestGo)
+	res := s.speedtest(ctx)
+	endRunSpan(span, res)
+	return res
+}
+
+// Run the phases of the speedtest, each phase is traced as a child span
+func (s *SpeedtestGo) speedtest(ctx context.Context) *SpeedtestResult {
 	start := time.Now()
 
 	client := speedtest.New()
 
-	serverList, err := client.FetchServers()
+	phaseCtx, span := startPhaseSpan(ctx, "fetch_server_list")
+	serverList, err := client.FetchServerListContext(phaseCtx)
+	endPhaseSpan(span, err, attrServerCount.Int(len(serverList)))
 	if err != nil {
 		slog.Error("Could not fetch server list", "error", err)
 		return NewFailedSpeedtestResult()
 	}
+
+	_, span = startPhaseSpan(ctx, "select_server")
 	targets, err := serverList.FindServer([]int{})
+	if err == nil && len(targets) != 1 {
+		err = errors.New("FindServer returned more than one server")
+	}
 	if err != nil {
+		endPhaseSpan(span, err)
 		slog.Error("Failed to find closest server", "error", err)
 		return NewFailedSpeedtestResult()
 	}
-	if len(targets) != 1 {
-		slog.Error("FindServer returned more than one server")
+	server := targets[0]
+	endPhaseSpan(span, nil,
+		attrServerID.String(server.ID),
+		attrServerHost.String(server.Host),
+		attrServerLocation.String(formatLocation(server.Name, server.Country)),
+	)
+
+	phaseCtx, span = startPhaseSpan(ctx, "ping")
+	err = server.PingTestContext(phaseCtx, nil)
+	endPhaseSpan(span, err, attrPing.Float64(float64(server.Latency.Milliseconds())), attrJitter.Float64(float64(server.Jitter.Milliseconds())))
+	if err != nil {
+		slog.Error("Failed to run ping test", "error", err)
 		return NewFailedSpeedtestResult()
 	}
-	server := targets[0]
 
-	err = server.TestAll()
+	phaseCtx, span = startPhaseSpan(ctx, "download")
+	err = server.DownloadTestContext(phaseCtx)
+	endPhaseSpan(span, err, attrDownload.Float64(convertBytesToMbits(server.DLSpeed)))
 	if err != nil {
-		slog.Error("Failed to run speedtest", "error", err)
+		slog.Error("Failed to run download test", "error", err)
 		return NewFailedSpeedtestResult()
 	}
-	user, err := client.FetchUserInfo()
+
+	phaseCtx, span = startPhaseSpan(ctx, "upload")
+	err = server.UploadTestContext(phaseCtx)
+	endPhaseSpan(span, err, attrUpload.Float64(convertBytesToMbits(server.ULSpeed)))
+	if err != nil {
+		slog.Error("Failed to run upload test", "error", err)
+		return NewFailedSpeedtestResult()
+	}
+
+	phaseCtx, span = startPhaseSpan(ctx, "fetch_user_info")
+	user, err := client.FetchUserInfoContext(phaseCtx)
 	if err != nil {
+		endPhaseSpan(span, err)
 		slog.Error("Failed to fetch client information", "error", err)
 		return NewFailedSpeedtestResult()
 	}
+	endPhaseSpan(span, nil, attrISP.String(user.Isp))
 
 	downloadMbps := convertBytesToMbits(server.DLSpeed)
 	uploadMbps := convertBytesToMbits(server.ULSpeed)
 	dataUsed := convertBytesToMB(server.Context.GetTotalDownload()) + convertBytesToMB(server.Context.GetTotalUpload())
 
 	res := NewSpeedtestResult(float64(server.Jitter.Milliseconds()), float64(server.Latency.Milliseconds()), downloadMbps, uploadMbps, dataUsed, server.ID, server.Host, user.Isp, user.IP, time.Since(start))
+	res.serverLocation = formatLocation(server.Name, server.Country)
+	res.backend = BackendSpeedtestGo
 
 	printSuccessMessage(res)
 
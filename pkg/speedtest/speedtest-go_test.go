@@ -13,7 +13,7 @@ func TestRunSpeedtestForGo(t *testing.T) {
 	}
 
 	s := NewSpeedtest()
-	result := s.Speedtest()
+	result := s.Speedtest(t.Context())
 	require.True(t, result.Success(), "Speedtest should succeed")
 
 	assert := assert.New(t)
@@ -0,0 +1,22 @@
+#!/bin/bash
+
+base_dir="$(dirname "${0}" | xargs realpath)"
+
+protocol="tcp"
+direction="upload"
+for arg in "$@"; do
+    case "${arg}" in
+    --udp)
+        protocol="udp"
+        ;;
+    --reverse)
+        direction="download"
+        ;;
+    unreachable.example.org)
+        cat "${base_dir}/iperf3-error.json"
+        exit 1
+        ;;
+    esac
+done
+
+cat "${base_dir}/iperf3-${protocol}-${direction}.json"
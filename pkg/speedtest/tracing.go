@@ -0,0 +1,72 @@
+package speedtest
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/heathcliff26/speedtest-exporter/pkg/speedtest"
+
+// Uses the global tracer provider, spans are dropped unless tracing has been configured
+var tracer = otel.Tracer(tracerName)
+
+// Attribute keys used on the spans
+const (
+	attrBackend        = attribute.Key("speedtest.backend")
+	attrRunID          = attribute.Key("speedtest.run_id")
+	attrSuccess        = attribute.Key("speedtest.success")
+	attrServerID       = attribute.Key("speedtest.server.id")
+	attrServerHost     = attribute.Key("speedtest.server.host")
+	attrServerLocation = attribute.Key("speedtest.server.location")
+	attrServerCount    = attribute.Key("speedtest.server.count")
+	attrPing           = attribute.Key("speedtest.ping_ms")
+	attrJitter         = attribute.Key("speedtest.jitter_ms")
+	attrDownload       = attribute.Key("speedtest.download_mbps")
+	attrUpload         = attribute.Key("speedtest.upload_mbps")
+	attrDataUsed       = attribute.Key("speedtest.data_used_mb")
+	attrISP            = attribute.Key("speedtest.client.isp")
+)
+
+// Start the root span of a speedtest run
+func startRunSpan(ctx context.Context, backend string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "speedtest", trace.WithAttributes(attrBackend.String(backend)))
+}
+
+// Add the result to the root span and end it
+func endRunSpan(span trace.Span, res *SpeedtestResult) {
+	span.SetAttributes(attrRunID.String(res.RunID()), attrSuccess.Bool(res.Success()))
+	if res.Success() {
+		span.SetAttributes(
+			attrServerID.String(res.ServerID()),
+			attrServerHost.String(res.ServerHost()),
+			attrServerLocation.String(res.ServerLocation()),
+			attrPing.Float64(res.Ping()),
+			attrJitter.Float64(res.JitterLatency()),
+			attrDownload.Float64(res.DownloadSpeed()),
+			attrUpload.Float64(res.UploadSpeed()),
+			attrDataUsed.Float64(res.DataUsed()),
+		)
+	} else {
+		span.SetStatus(codes.Error, "speedtest failed")
+	}
+	span.End()
+}
+
+// Start the span of a single phase of the speedtest
+func startPhaseSpan(ctx context.Context, phase string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "speedtest."+phase)
+}
+
+// Record the error and attributes of a phase and end its span
+func endPhaseSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attrs...)
+	span.End()
+}
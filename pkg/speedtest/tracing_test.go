@@ -0,0 +1,93 @@
+package speedtest
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpeedtestSpans(t *testing.T) {
+	// The global provider can only be delegated to once, so all cases share the same recorder
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	s, err := NewSpeedtestCLI("testdata/speedtest-cli.sh")
+	require.NoError(t, err, "Should create speedtest-cli")
+
+	spansByName := func() map[string]sdktrace.ReadOnlySpan {
+		spans := make(map[string]sdktrace.ReadOnlySpan)
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		return spans
+	}
+	attributes := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		return attrs
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		recorder.Reset()
+		makeCmd = func(ctx context.Context, path string) *exec.Cmd {
+			return exec.CommandContext(ctx, "bash", "-c", path)
+		}
+
+		result := s.Speedtest(t.Context())
+		require.True(result.Success(), "Speedtest should succeed")
+
+		spans := spansByName()
+		require.Len(spans, 3, "Should record the run and both phases")
+		root := spans["speedtest"]
+		require.NotNil(root, "Should record the root span")
+
+		for _, name := range []string{"speedtest.exec", "speedtest.parse_json"} {
+			span := spans[name]
+			if assert.NotNil(span, "Should record span %s", name) {
+				assert.Equal(root.SpanContext().SpanID(), span.Parent().SpanID(), "Phase %s should be a child of the run", name)
+				assert.Equal(codes.Unset, span.Status().Code, "Phase %s should not have an error", name)
+			}
+		}
+
+		attrs := attributes(root)
+		assert.Equal(BackendSpeedtestCLI, attrs[attrBackend].AsString())
+		assert.Equal(result.RunID(), attrs[attrRunID].AsString())
+		assert.True(attrs[attrSuccess].AsBool())
+		assert.Equal("60440", attrs[attrServerID].AsString())
+		assert.Equal(result.DownloadSpeed(), attrs[attrDownload].AsFloat64())
+
+		attrs = attributes(spans["speedtest.parse_json"])
+		assert.Equal("speedtest.hannover.jonasdevries.de", attrs[attrServerHost].AsString())
+		assert.Equal("Hannover, Germany", attrs[attrServerLocation].AsString())
+	})
+	t.Run("Failure", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		recorder.Reset()
+		makeCmd = func(ctx context.Context, _ string) *exec.Cmd {
+			return exec.CommandContext(ctx, "false")
+		}
+
+		result := s.Speedtest(t.Context())
+		require.False(result.Success(), "Speedtest should fail")
+
+		spans := spansByName()
+		require.Len(spans, 2, "Should not record the parse phase")
+		assert.Equal(codes.Error, spans["speedtest"].Status().Code, "Run should be marked as failed")
+		assert.Equal(codes.Error, spans["speedtest.exec"].Status().Code, "Exec phase should be marked as failed")
+		assert.NotEmpty(spans["speedtest.exec"].Events(), "Should record the error")
+		assert.False(attributes(spans["speedtest"])[attrSuccess].AsBool())
+	})
+}
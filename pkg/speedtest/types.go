@@ -1,33 +1,49 @@
 package speedtest
 
 import (
+	"context"
 	"encoding/json/jsontext"
 	"encoding/json/v2"
 	"time"
 )
 
 type Speedtest interface {
-	Speedtest() *SpeedtestResult
+	// Run a speedtest and return the result.
+	// The speedtest should be aborted when ctx is cancelled.
+	Speedtest(ctx context.Context) *SpeedtestResult
+}
+
+// Implemented by backends depending on resources that can become unavailable after the backend was created
+type Checker interface {
+	// Return an error if the backend is not able to run a speedtest
+	Check() error
 }
 
 type SpeedtestResult struct {
-	jitterLatency float64 // ms
-	ping          float64 // ms
-	downloadSpeed float64 // Mbit/s
-	uploadSpeed   float64 // Mbit/s
-	dataUsed      float64 // MB
-	serverID      string
-	serverHost    string
-	clientISP     string
-	clientIP      string
-	success       bool
-	timestamp     int64 // milliseconds since Unix epoch
-	duration      int64 // milliseconds
+	runID          string
+	jitterLatency  float64  // ms
+	ping           float64  // ms
+	downloadSpeed  float64  // Mbit/s
+	uploadSpeed    float64  // Mbit/s
+	dataUsed       float64  // MB
+	packetLoss     *float64 // %, nil if not measured by the backend
+	retransmits    *int64   // nil if not measured by the backend
+	serverID       string
+	serverHost     string
+	serverLocation string
+	clientISP      string
+	clientIP       string
+	backend        string
+	iface          string
+	success        bool
+	timestamp      int64 // milliseconds since Unix epoch
+	duration       int64 // milliseconds
 }
 
 // Create a new SpeedtestResult for a failed speedtest.
 func NewFailedSpeedtestResult() *SpeedtestResult {
 	return &SpeedtestResult{
+		runID:     newRunID(),
 		success:   false,
 		timestamp: time.Now().UnixMilli(),
 	}
@@ -36,6 +52,7 @@ func NewFailedSpeedtestResult() *SpeedtestResult {
 // Create a new SpeedtestResult from a successful speedrun
 func NewSpeedtestResult(jitterLatency, ping, downloadSpeed, uploadSpeed, dataUsed float64, serverID, serverHost, clientISP, clientIP string, duration time.Duration) *SpeedtestResult {
 	return &SpeedtestResult{
+		runID:         newRunID(),
 		jitterLatency: jitterLatency,
 		ping:          ping,
 		downloadSpeed: downloadSpeed,
@@ -51,6 +68,11 @@ func NewSpeedtestResult(jitterLatency, ping, downloadSpeed, uploadSpeed, dataUse
 	}
 }
 
+// Unique ID of the speedtest run, empty for results created by older versions
+func (r *SpeedtestResult) RunID() string {
+	return r.runID
+}
+
 // Jitter latency of ping in ms
 func (r *SpeedtestResult) JitterLatency() float64 {
 	return r.jitterLatency
@@ -76,6 +98,24 @@ func (r *SpeedtestResult) DataUsed() float64 {
 	return r.dataUsed
 }
 
+// Packet loss in percent.
+// Returns false if the backend did not measure it.
+func (r *SpeedtestResult) PacketLoss() (float64, bool) {
+	if r.packetLoss == nil {
+		return 0, false
+	}
+	return *r.packetLoss, true
+}
+
+// Number of retransmitted TCP segments.
+// Returns false if the backend did not measure it.
+func (r *SpeedtestResult) Retransmits() (int64, bool) {
+	if r.retransmits == nil {
+		return 0, false
+	}
+	return *r.retransmits, true
+}
+
 // ID of the speedtest server used for the test
 func (r *SpeedtestResult) ServerID() string {
 	return r.serverID
@@ -86,6 +126,11 @@ func (r *SpeedtestResult) ServerHost() string {
 	return r.serverHost
 }
 
+// Location of the speedtest server used for the test, e.g. "Frankfurt, Germany"
+func (r *SpeedtestResult) ServerLocation() string {
+	return r.serverLocation
+}
+
 // ISP name of the client/connection
 func (r *SpeedtestResult) ClientISP() string {
 	return r.clientISP
@@ -96,6 +141,16 @@ func (r *SpeedtestResult) ClientIP() string {
 	return r.clientIP
 }
 
+// Name of the speedtest implementation that produced the result
+func (r *SpeedtestResult) Backend() string {
+	return r.backend
+}
+
+// Name of the local network interface used for the test, empty if unknown
+func (r *SpeedtestResult) Interface() string {
+	return r.iface
+}
+
 // Indicates if the test was successful
 func (r *SpeedtestResult) Success() bool {
 	return r.success
@@ -117,37 +172,56 @@ func (r *SpeedtestResult) Duration() int64 {
 	return r.duration
 }
 
+// Return a copy of the result with the client IP replaced, e.g. to anonymize it
+func (r *SpeedtestResult) WithClientIP(ip string) *SpeedtestResult {
+	res := *r
+	res.clientIP = ip
+	return &res
+}
+
 type speedtestResultJSONAlias struct {
-	JitterLatency float64 `json:"jitter_latency_ms"`
-	Ping          float64 `json:"ping_ms"`
-	DownloadSpeed float64 `json:"download_mbps"`
-	UploadSpeed   float64 `json:"upload_mbps"`
-	DataUsed      float64 `json:"data_used_mb"`
-	ServerID      string  `json:"server_id"`
-	ServerHost    string  `json:"server_host"`
-	ClientISP     string  `json:"client_isp"`
-	ClientIP      string  `json:"client_ip"`
-	Success       bool    `json:"success"`
-	Timestamp     int64   `json:"timestamp"`
-	Duration      int64   `json:"duration_ms"`
+	RunID          string   `json:"run_id,omitempty"`
+	JitterLatency  float64  `json:"jitter_latency_ms"`
+	Ping           float64  `json:"ping_ms"`
+	DownloadSpeed  float64  `json:"download_mbps"`
+	UploadSpeed    float64  `json:"upload_mbps"`
+	DataUsed       float64  `json:"data_used_mb"`
+	PacketLoss     *float64 `json:"packet_loss_percent,omitempty"`
+	Retransmits    *int64   `json:"retransmits,omitempty"`
+	ServerID       string   `json:"server_id"`
+	ServerHost     string   `json:"server_host"`
+	ServerLocation string   `json:"server_location,omitempty"`
+	ClientISP      string   `json:"client_isp"`
+	ClientIP       string   `json:"client_ip,omitempty"`
+	Backend        string   `json:"backend,omitempty"`
+	Interface      string   `json:"interface,omitempty"`
+	Success        bool     `json:"success"`
+	Timestamp      int64    `json:"timestamp"`
+	Duration       int64    `json:"duration_ms"`
 }
 
 // MarshalJSON implements json.Marshaler so the (unexported) fields of
 // SpeedtestResult can be serialized with meaningful JSON keys.
 func (r *SpeedtestResult) MarshalJSON() ([]byte, error) {
 	a := speedtestResultJSONAlias{
-		JitterLatency: r.jitterLatency,
-		Ping:          r.ping,
-		DownloadSpeed: r.downloadSpeed,
-		UploadSpeed:   r.uploadSpeed,
-		DataUsed:      r.dataUsed,
-		ServerID:      r.serverID,
-		ServerHost:    r.serverHost,
-		ClientISP:     r.clientISP,
-		ClientIP:      r.clientIP,
-		Success:       r.success,
-		Timestamp:     r.timestamp,
-		Duration:      r.duration,
+		RunID:          r.runID,
+		JitterLatency:  r.jitterLatency,
+		Ping:           r.ping,
+		DownloadSpeed:  r.downloadSpeed,
+		UploadSpeed:    r.uploadSpeed,
+		DataUsed:       r.dataUsed,
+		PacketLoss:     r.packetLoss,
+		Retransmits:    r.retransmits,
+		ServerID:       r.serverID,
+		ServerHost:     r.serverHost,
+		ServerLocation: r.serverLocation,
+		ClientISP:      r.clientISP,
+		ClientIP:       r.clientIP,
+		Backend:        r.backend,
+		Interface:      r.iface,
+		Success:        r.success,
+		Timestamp:      r.timestamp,
+		Duration:       r.duration,
 	}
 
 	return json.Marshal(a, jsontext.WithIndent("  "))
@@ -161,15 +235,21 @@ func (r *SpeedtestResult) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	r.runID = a.RunID
 	r.jitterLatency = a.JitterLatency
 	r.ping = a.Ping
 	r.downloadSpeed = a.DownloadSpeed
 	r.uploadSpeed = a.UploadSpeed
 	r.dataUsed = a.DataUsed
+	r.packetLoss = a.PacketLoss
+	r.retransmits = a.Retransmits
 	r.serverID = a.ServerID
 	r.serverHost = a.ServerHost
+	r.serverLocation = a.ServerLocation
 	r.clientISP = a.ClientISP
 	r.clientIP = a.ClientIP
+	r.backend = a.Backend
+	r.iface = a.Interface
 	r.success = a.Success
 	r.timestamp = a.Timestamp
 	r.duration = a.Duration
@@ -15,7 +15,9 @@ func TestNewFailedSpeedtestResult(t *testing.T) {
 
 	result := NewFailedSpeedtestResult()
 	assert.NotZero(result.Timestamp(), "Failed result should have timestamp")
+	assert.NotEmpty(result.RunID(), "Failed result should have a run ID")
 	expectedResult.timestamp = result.timestamp // align timestamps for comparison
+	expectedResult.runID = result.runID
 	assert.Equal(expectedResult, result, "Should match expected failed SpeedtestResult")
 }
 
@@ -39,7 +41,14 @@ func TestNewSpeedtestResult(t *testing.T) {
 	actualResult := NewSpeedtestResult(0.5, 15, 876.53, 12.34, 950.3079, "1234", "example.org", "Foo Corp.", "127.0.0.1", 231234*time.Millisecond)
 
 	assert.InDelta(time.Now().UnixMilli(), actualResult.Timestamp(), 10, "Timestamp should be close to current time")
+	assert.NotEmpty(actualResult.RunID(), "Result should have a run ID")
+	assert.NotEqual(NewSpeedtestResult(0, 0, 0, 0, 0, "", "", "", "", 0).RunID(), actualResult.RunID(), "Run IDs should be unique")
+	_, measured := actualResult.PacketLoss()
+	assert.False(measured, "Packet loss should only be set by backends measuring it")
+	_, measured = actualResult.Retransmits()
+	assert.False(measured, "Retransmits should only be set by backends measuring them")
 	expectedResult.timestamp = actualResult.timestamp // align timestamps for comparison
+	expectedResult.runID = actualResult.runID
 	assert.Equal(expectedResult, actualResult, "NewSpeedtestResult should create the expected SpeedtestResult")
 }
 
@@ -47,6 +56,8 @@ func TestSpeedtestResultJSON(t *testing.T) {
 	assert := assert.New(t)
 
 	result := MockSpeedtestResult(1234)
+	retransmits := int64(42)
+	result.retransmits = &retransmits
 
 	jsonData, err := result.MarshalJSON()
 	assert.NoError(err, "Should marshal SpeedtestResult to JSON without error")
@@ -68,3 +79,14 @@ func TestSpeedtestResultTimestampAsTime(t *testing.T) {
 
 	assert.Equal(t, time.UnixMilli(r.timestamp), r.TimestampAsTime(), "TimestampAsTime should return correct time.Time representation")
 }
+
+func TestSpeedtestResultWithClientIP(t *testing.T) {
+	assert := assert.New(t)
+
+	result := MockSpeedtestResult(1000)
+	anonymized := result.WithClientIP("127.0.0.0/24")
+
+	assert.Equal("127.0.0.0/24", anonymized.ClientIP())
+	assert.Equal("127.0.0.1", result.ClientIP(), "Should not modify the original result")
+	assert.Equal(result.RunID(), anonymized.RunID(), "Should keep the other fields")
+}
@@ -1,7 +1,10 @@
 package speedtest
 
 import (
+	"crypto/rand"
+	"errors"
 	"log/slog"
+	"os/exec"
 	"time"
 
 	"github.com/showwin/speedtest-go/speedtest"
@@ -22,9 +25,37 @@ func convertBytesToMB[T Number](bytes T) float64 {
 	return float64(bytes) / speedtest.MB
 }
 
+// Convert unit bits to megabits
+func convertBitsToMbits(bits float64) float64 {
+	return bits / speedtest.MB
+}
+
+// Verify that the executable at path exists and has the executable bit set
+func checkExecutable(path string) error {
+	_, err := exec.LookPath(path)
+	if errors.Is(err, exec.ErrDot) {
+		err = nil
+	}
+	return err
+}
+
+// Generate a unique ID for a speedtest run
+func newRunID() string {
+	return rand.Text()
+}
+
+// Combine city and country of a server into a single location
+func formatLocation(city, country string) string {
+	if city == "" || country == "" {
+		return city + country
+	}
+	return city + ", " + country
+}
+
 // Print the log message for a successful speedtest
 func printSuccessMessage(res *SpeedtestResult) {
 	slog.Info("Successfully ran speedtest",
+		slog.String("runID", res.RunID()),
 		slog.Float64("jitterLatency", res.JitterLatency()),
 		slog.Float64("ping", res.Ping()),
 		slog.Float64("downloadSpeed", res.DownloadSpeed()),
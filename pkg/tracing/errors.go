@@ -0,0 +1,21 @@
+package tracing
+
+type ErrMissingEndpoint struct{}
+
+func (e ErrMissingEndpoint) Error() string {
+	return "No endpoint for the OTLP trace exporter provided"
+}
+
+type ErrInvalidEndpoint struct {
+	Endpoint string
+}
+
+func (e *ErrInvalidEndpoint) Error() string {
+	return "Invalid OTLP endpoint \"" + e.Endpoint + "\", needs to be a http or https url"
+}
+
+type ErrInvalidSampleRatio struct{}
+
+func (e ErrInvalidSampleRatio) Error() string {
+	return "The sample ratio needs to be between 0 and 1"
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/heathcliff26/speedtest-exporter/pkg/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const serviceName = "speedtest-exporter"
+
+// Configure the export of traces
+type Options struct {
+	// Full url of the OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+	// Additional headers sent with every export, e.g. for authentication
+	Headers map[string]string
+	// Share of speedtest runs that are traced, between 0 and 1
+	SampleRatio float64
+	// Name of this instance, added as service.instance.id to the resource
+	Instance string
+}
+
+// Verify that the endpoint is a valid http(s) url and the sample ratio is valid
+func (o Options) Validate() error {
+	if o.Endpoint == "" {
+		return ErrMissingEndpoint{}
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrInvalidEndpoint{Endpoint: o.Endpoint}
+	}
+	if o.SampleRatio < 0 || o.SampleRatio > 1 {
+		return ErrInvalidSampleRatio{}
+	}
+	return nil
+}
+
+// Exports the spans of the exporter via OTLP/HTTP
+type Provider struct {
+	tp *sdktrace.TracerProvider
+}
+
+// Create a new provider and register it as global tracer provider.
+// Spans are exported in batches in the background.
+func NewProvider(ctx context.Context, opts Options) (*Provider, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.Endpoint), otlptracehttp.WithHeaders(opts.Headers))
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version.BuildInfo().Version),
+		attribute.String("service.instance.id", opts.Instance),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return &Provider{tp: tp}, nil
+}
+
+// Export all remaining spans and stop the provider.
+// This method is safe to call even if the Provider instance is nil.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.tp.Shutdown(ctx)
+}
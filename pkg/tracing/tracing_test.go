@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestValidate(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Opts  Options
+		Error string
+	}{
+		{
+			Name: "Valid",
+			Opts: Options{Endpoint: "http://localhost:4318/v1/traces", SampleRatio: 1},
+		},
+		{
+			Name: "ValidHTTPS",
+			Opts: Options{Endpoint: "https://otel.example.org/v1/traces", SampleRatio: 0},
+		},
+		{
+			Name:  "MissingEndpoint",
+			Opts:  Options{SampleRatio: 1},
+			Error: "tracing.ErrMissingEndpoint",
+		},
+		{
+			Name:  "NoScheme",
+			Opts:  Options{Endpoint: "localhost:4318", SampleRatio: 1},
+			Error: "*tracing.ErrInvalidEndpoint",
+		},
+		{
+			Name:  "GRPCScheme",
+			Opts:  Options{Endpoint: "grpc://localhost:4317", SampleRatio: 1},
+			Error: "*tracing.ErrInvalidEndpoint",
+		},
+		{
+			Name:  "NegativeRatio",
+			Opts:  Options{Endpoint: "http://localhost:4318/v1/traces", SampleRatio: -0.1},
+			Error: "tracing.ErrInvalidSampleRatio",
+		},
+		{
+			Name:  "RatioTooLarge",
+			Opts:  Options{Endpoint: "http://localhost:4318/v1/traces", SampleRatio: 1.5},
+			Error: "tracing.ErrInvalidSampleRatio",
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			err := tCase.Opts.Validate()
+
+			if tCase.Error == "" {
+				assert.NoError(t, err, "Should be valid")
+			} else {
+				require.Error(t, err, "Should be invalid")
+				assert.Equal(t, tCase.Error, reflect.TypeOf(err).String(), "Should receive the expected error")
+			}
+		})
+	}
+}
+
+func TestProviderExportsSpans(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(t.Context(), Options{
+		Endpoint:    srv.URL + "/v1/traces",
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		SampleRatio: 1,
+		Instance:    "test-instance",
+	})
+	require.NoError(err, "Should create provider")
+
+	_, span := otel.Tracer("test").Start(t.Context(), "test-span")
+	span.End()
+
+	require.NoError(p.Shutdown(t.Context()), "Should flush the spans on shutdown")
+
+	var r *http.Request
+	select {
+	case r = <-requests:
+	default:
+		require.FailNow("Should have exported the spans")
+	}
+	assert.Equal("/v1/traces", r.URL.Path)
+	assert.Equal("Bearer token", r.Header.Get("Authorization"), "Should send the configured headers")
+
+	var req coltracepb.ExportTraceServiceRequest
+	require.NoError(proto.Unmarshal(<-bodies, &req), "Should send a valid OTLP request")
+	require.Len(req.GetResourceSpans(), 1)
+
+	resourceAttrs := make(map[string]string)
+	for _, kv := range req.GetResourceSpans()[0].GetResource().GetAttributes() {
+		resourceAttrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	assert.Equal(serviceName, resourceAttrs["service.name"])
+	assert.Equal("test-instance", resourceAttrs["service.instance.id"])
+
+	scopeSpans := req.GetResourceSpans()[0].GetScopeSpans()
+	require.Len(scopeSpans, 1)
+	require.Len(scopeSpans[0].GetSpans(), 1)
+	assert.Equal("test-span", scopeSpans[0].GetSpans()[0].GetName())
+}
+
+func TestNilProvider(t *testing.T) {
+	var p *Provider
+	assert.NoError(t, p.Shutdown(t.Context()), "Should not fail on nil provider")
+}
+
+func TestNewProviderInvalidOptions(t *testing.T) {
+	p, err := NewProvider(t.Context(), Options{})
+
+	assert.Nil(t, p)
+	assert.Equal(t, ErrMissingEndpoint{}, err)
+}
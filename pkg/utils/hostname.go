@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Return the hostname of the machine, used as default instance.
+// Falls back to localhost when the hostname can not be retrieved.
+func Hostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		slog.Error("Failed to retrieve hostname, using localhost instead", "err", err)
+		return "localhost"
+	}
+	return hostname
+}
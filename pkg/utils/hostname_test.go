@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostname(t *testing.T) {
+	expected, err := os.Hostname()
+	if err != nil {
+		expected = "localhost"
+	}
+	assert.Equal(t, expected, Hostname())
+}
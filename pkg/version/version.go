@@ -7,8 +7,15 @@ import (
 
 const Name = "speedtest-exporter"
 
-// Return a formated string containing the version, git commit and go version the app was compiled with.
-func Version() string {
+// Information about the build of the app
+type Info struct {
+	Version   string
+	Commit    string
+	GoVersion string
+}
+
+// Return the version, short git commit and go version the app was compiled with.
+func BuildInfo() Info {
 	var commit string
 	buildinfo, _ := debug.ReadBuildInfo()
 	for _, item := range buildinfo.Settings {
@@ -23,10 +30,21 @@ func Version() string {
 		commit = "Unknown"
 	}
 
+	return Info{
+		Version:   buildinfo.Main.Version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Return a formated string containing the version, git commit and go version the app was compiled with.
+func Version() string {
+	info := BuildInfo()
+
 	result := Name + ":\n"
-	result += "    Version: " + buildinfo.Main.Version + "\n"
-	result += "    Commit:  " + commit + "\n"
-	result += "    Go:      " + runtime.Version() + "\n"
+	result += "    Version: " + info.Version + "\n"
+	result += "    Commit:  " + info.Commit + "\n"
+	result += "    Go:      " + info.GoVersion + "\n"
 
 	return result
 }
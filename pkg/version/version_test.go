@@ -30,3 +30,16 @@ func TestVersion(t *testing.T) {
 
 	assert.Equal("", lines[4], "Should have trailing newline")
 }
+
+func TestBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	info := BuildInfo()
+
+	buildinfo, _ := debug.ReadBuildInfo()
+
+	assert.Equal(buildinfo.Main.Version, info.Version)
+	assert.NotEmpty(info.Commit)
+	assert.LessOrEqual(len(info.Commit), 7, "Should shorten the commit")
+	assert.Equal(runtime.Version(), info.GoVersion)
+}
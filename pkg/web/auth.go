@@ -0,0 +1,72 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Used to compare against when a user does not exist, to avoid leaking valid usernames through timing.
+// This is the bcrypt hash of "password" with the default cost.
+var dummyHash = []byte("$2a$10$K1H1Cu6SHY8CdV600KAYAe81MpQrK.fadY4Op1qzGQJsZYtoq01si")
+
+// Protects http handlers with basic authentication.
+// Passwords are stored as bcrypt hashes.
+type BasicAuth struct {
+	users atomic.Pointer[map[string]string]
+}
+
+// Create a new BasicAuth with the given users.
+// Arguments:
+//
+//	users: Map of usernames to bcrypt hashed passwords, authentication is disabled when empty
+func NewBasicAuth(users map[string]string) *BasicAuth {
+	a := &BasicAuth{}
+	a.SetUsers(users)
+	return a
+}
+
+// Replace the users allowed to authenticate
+func (a *BasicAuth) SetUsers(users map[string]string) {
+	a.users.Store(&users)
+}
+
+// Returns true when authentication is required
+func (a *BasicAuth) Enabled() bool {
+	return len(*a.users.Load()) > 0
+}
+
+// Check if the given credentials are valid
+func (a *BasicAuth) authenticate(username, password string) bool {
+	users := *a.users.Load()
+	hash, ok := users[username]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Wrap the given handler, requiring basic authentication for all requests when enabled
+func (a *BasicAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if ok && a.authenticate(username, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok {
+			slog.Debug("Failed authentication attempt", slog.String("user", username), slog.String("remote", r.RemoteAddr))
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="speedtest-exporter", charset="UTF-8"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func hashPassword(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err, "Should hash password")
+	return string(hash)
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	auth := NewBasicAuth(map[string]string{
+		"somebody": hashPassword(t, "secret"),
+	})
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tMatrix := []struct {
+		Name               string
+		Username, Password string
+		SetAuth            bool
+		Status             int
+	}{
+		{"NoCredentials", "", "", false, http.StatusUnauthorized},
+		{"WrongPassword", "somebody", "wrong", true, http.StatusUnauthorized},
+		{"UnknownUser", "nobody", "secret", true, http.StatusUnauthorized},
+		{"Success", "somebody", "secret", true, http.StatusOK},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tCase.SetAuth {
+				req.SetBasicAuth(tCase.Username, tCase.Password)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(tCase.Status, rr.Code)
+			if tCase.Status == http.StatusUnauthorized {
+				assert.NotEmpty(rr.Header().Get("WWW-Authenticate"), "Should ask for credentials")
+			}
+		})
+	}
+}
+
+func TestBasicAuthDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	auth := NewBasicAuth(nil)
+	assert.False(auth.Enabled(), "Should be disabled without users")
+
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(http.StatusOK, rr.Code, "Should not require credentials")
+}
+
+func TestSetUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	auth := NewBasicAuth(map[string]string{"old": hashPassword(t, "secret")})
+	auth.SetUsers(map[string]string{"new": hashPassword(t, "secret")})
+
+	assert.True(auth.Enabled())
+	assert.False(auth.authenticate("old", "secret"), "Old user should be removed")
+	assert.True(auth.authenticate("new", "secret"), "New user should be accepted")
+
+	auth.SetUsers(nil)
+	assert.False(auth.Enabled(), "Should disable authentication")
+}
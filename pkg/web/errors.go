@@ -0,0 +1,33 @@
+package web
+
+type ErrInvalidClientCA struct {
+	Path string
+}
+
+func (e *ErrInvalidClientCA) Error() string {
+	return "No valid certificates found in client CA file " + e.Path
+}
+
+type ErrInvalidListenAddress struct {
+	Address string
+}
+
+func (e *ErrInvalidListenAddress) Error() string {
+	return "Invalid listen address \"" + e.Address + "\", expected host:port, [ipv6]:port or unix:/path"
+}
+
+type ErrNotASocket struct {
+	Path string
+}
+
+func (e *ErrNotASocket) Error() string {
+	return "Refusing to replace " + e.Path + ", the file exists but is not a unix socket"
+}
+
+type ErrSocketInUse struct {
+	Path string
+}
+
+func (e *ErrSocketInUse) Error() string {
+	return "Unix socket " + e.Path + " is already in use"
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Prefix used to mark an address as a unix socket
+const unixPrefix = "unix:"
+
+// Parse a listen address into the network and address used by net.Listen.
+// Supported formats are "host:port", "[ipv6]:port", ":port" and "unix:/path/to/socket".
+func ParseListenAddress(address string) (string, string, error) {
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		if path == "" {
+			return "", "", &ErrInvalidListenAddress{Address: address}
+		}
+		return "unix", path, nil
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", &ErrInvalidListenAddress{Address: address}
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return "", "", &ErrInvalidListenAddress{Address: address}
+	}
+	return "tcp", address, nil
+}
+
+// Listen on the given address.
+// Unix sockets are created with the given permissions and group, stale sockets from a previous run are removed.
+// Arguments:
+//
+//	address: Address in one of the formats supported by ParseListenAddress
+//	socketMode: Permissions of the unix socket, ignored for tcp
+//	socketGroup: Optional group owning the unix socket, ignored for tcp
+func Listen(address string, socketMode fs.FileMode, socketGroup string) (net.Listener, error) {
+	network, addr, err := ParseListenAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if network != "unix" {
+		return net.Listen(network, addr)
+	}
+
+	err = removeStaleSocket(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setSocketPermissions(addr, socketMode, socketGroup)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Remove a leftover socket file, e.g. after a crash.
+// Refuses to remove anything that is not a socket or a socket that is still in use.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode().Type() != fs.ModeSocket {
+		return &ErrNotASocket{Path: path}
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		_ = conn.Close()
+		return &ErrSocketInUse{Path: path}
+	}
+
+	return os.Remove(path)
+}
+
+// Apply the permissions and group to the socket file
+func setSocketPermissions(path string, mode fs.FileMode, group string) error {
+	err := os.Chmod(path, mode)
+	if err != nil {
+		return err
+	}
+
+	if group == "" {
+		return nil
+	}
+
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		g, err = user.LookupGroupId(group)
+		if err != nil {
+			return err
+		}
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, -1, gid)
+}
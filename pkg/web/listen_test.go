@@ -0,0 +1,137 @@
+package web
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tMatrix := []struct {
+		Name, Address   string
+		Network, Result string
+		Error           bool
+	}{
+		{"PortOnly", ":8080", "tcp", ":8080", false},
+		{"IPv4", "192.168.1.10:8080", "tcp", "192.168.1.10:8080", false},
+		{"Hostname", "localhost:8080", "tcp", "localhost:8080", false},
+		{"IPv6", "[::1]:8080", "tcp", "[::1]:8080", false},
+		{"UnixSocket", "unix:/run/speedtest-exporter.sock", "unix", "/run/speedtest-exporter.sock", false},
+		{"MissingPort", "192.168.1.10", "", "", true},
+		{"UnbracketedIPv6", "::1:8080", "", "", true},
+		{"InvalidPort", "localhost:http", "", "", true},
+		{"PortZero", ":0", "", "", true},
+		{"PortOutOfRange", ":65536", "", "", true},
+		{"EmptyUnixPath", "unix:", "", "", true},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			network, address, err := ParseListenAddress(tCase.Address)
+
+			if tCase.Error {
+				assert.Equal(&ErrInvalidListenAddress{Address: tCase.Address}, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tCase.Network, network)
+			assert.Equal(tCase.Result, address)
+		})
+	}
+}
+
+// Send a request to the server listening on the unix socket
+func getUnix(t *testing.T, path string) (*http.Response, error) {
+	t.Helper()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	return client.Get("http://unix/")
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		path := filepath.Join(t.TempDir(), "test.sock")
+
+		l, err := Listen("unix:"+path, 0600, "")
+		require.NoError(err, "Should listen on unix socket")
+
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})}
+		go func() {
+			_ = server.Serve(l)
+		}()
+		t.Cleanup(func() {
+			_ = server.Close()
+		})
+
+		info, err := os.Stat(path)
+		require.NoError(err, "Socket should exist")
+		assert.Equal(fs.FileMode(0600), info.Mode().Perm(), "Should set socket permissions")
+
+		res, err := getUnix(t, path)
+		require.NoError(err, "Should connect via unix socket")
+		defer res.Body.Close()
+		assert.Equal(http.StatusOK, res.StatusCode)
+
+		_, err = Listen("unix:"+path, 0600, "")
+		assert.Equal(&ErrSocketInUse{Path: path}, err, "Should not replace a socket in use")
+	})
+	t.Run("RemoveStaleSocket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.sock")
+
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err, "Should create socket")
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		l, err := Listen("unix:"+path, 0660, "")
+		require.NoError(t, err, "Should replace stale socket")
+		assert.NoError(t, l.Close())
+	})
+	t.Run("NotASocket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.sock")
+		require.NoError(t, os.WriteFile(path, []byte("important data"), 0600))
+
+		_, err := Listen("unix:"+path, 0660, "")
+
+		assert.Equal(t, &ErrNotASocket{Path: path}, err, "Should not remove regular files")
+	})
+	t.Run("UnknownGroup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.sock")
+
+		_, err := Listen("unix:"+path, 0660, "group-does-not-exist")
+
+		assert.Error(t, err, "Should fail with unknown group")
+		assert.NoFileExists(t, path, "Should clean up the socket")
+	})
+}
+
+func TestListenTCP(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", 0, "")
+	assert.Equal(t, &ErrInvalidListenAddress{Address: "127.0.0.1:0"}, err, "Should reject random port")
+	assert.Nil(t, l)
+
+	l, err = Listen("127.0.0.1:18080", 0, "")
+	require.NoError(t, err, "Should listen on tcp address")
+	assert.Equal(t, "127.0.0.1:18080", l.Addr().String())
+	assert.NoError(t, l.Close())
+}
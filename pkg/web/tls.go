@@ -0,0 +1,119 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Loads a certificate from disk and reloads it whenever the files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	lock    sync.Mutex
+}
+
+// Create a new TLS config for the server.
+// The certificate is reloaded from disk when the files change.
+// When clientCAFile is not empty, client certificates are verified against the CA.
+// Connections without a certificate are still accepted, so probes can connect, use RequireClientCert to reject their requests.
+// Arguments:
+//
+//	certFile: Path to the server certificate
+//	keyFile: Path to the private key of the server certificate
+//	clientCAFile: Optional path to the CA used to verify client certificates
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	_, err := r.GetCertificate(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	if clientCAFile != "" {
+		// #nosec G304: Local users can decide on the file path freely.
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, &ErrInvalidClientCA{Path: clientCAFile}
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+// Wrap the given handler, rejecting requests without a verified client certificate
+func RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			slog.Debug("Rejected request without client certificate", slog.String("remote", r.RemoteAddr))
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Return the current certificate, reloading it from disk if the files have been modified.
+// When reloading fails, the previous certificate will be used.
+// Implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return r.fallback(err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return r.fallback(err)
+	}
+
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return r.fallback(err)
+	}
+	if r.cert != nil {
+		slog.Info("Reloaded TLS certificate", slog.String("cert", r.certFile), slog.String("key", r.keyFile))
+	}
+
+	r.cert = &cert
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	return r.cert, nil
+}
+
+// Return the previously loaded certificate when available, otherwise the error.
+// Assumes the caller holds the lock.
+func (r *certReloader) fallback(err error) (*tls.Certificate, error) {
+	if r.cert == nil {
+		return nil, err
+	}
+	slog.Error("Failed to reload TLS certificate, continuing with the previous one", slog.String("cert", r.certFile), slog.String("key", r.keyFile), "err", err)
+	return r.cert, nil
+}
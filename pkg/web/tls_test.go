@@ -0,0 +1,226 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a certificate, self-signed when parent is nil
+func createCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Should generate key")
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err, "Should generate serial")
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err, "Should create certificate")
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err, "Should parse certificate")
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "Should marshal key")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return cert, key, certPEM, keyPEM
+}
+
+// Write a self-signed server certificate to dir
+func writeServerCert(t *testing.T, dir, cn string) (string, string) {
+	t.Helper()
+
+	_, _, certPEM, keyPEM := createCert(t, cn, nil, nil, false)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0600), "Should write certificate")
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600), "Should write key")
+	return certFile, keyFile
+}
+
+// Responds to every request with 200
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// Start a TLS server with the given config and return its address.
+// Does not use StartTLS, as it would override the certificate of the config.
+func newTLSServer(t *testing.T, cfg *tls.Config, handler http.Handler) string {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = tls.NewListener(server.Listener, cfg)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+// Connect to the server and return the common name of the presented certificate
+func serverCertName(t *testing.T, addr string) string {
+	t.Helper()
+
+	// #nosec G402: Only used to inspect the certificate in tests.
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err, "Should connect to server")
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("MissingFiles", func(t *testing.T) {
+		_, err := NewTLSConfig("does-not-exist.crt", "does-not-exist.key", "")
+
+		assert.Error(t, err, "Should fail without certificate")
+	})
+	t.Run("InvalidClientCA", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeServerCert(t, dir, "server")
+		caFile := filepath.Join(dir, "ca.crt")
+		require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+
+		_, err := NewTLSConfig(certFile, keyFile, caFile)
+
+		assert.Equal(t, &ErrInvalidClientCA{Path: caFile}, err)
+	})
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+
+		certFile, keyFile := writeServerCert(t, t.TempDir(), "server")
+
+		cfg, err := NewTLSConfig(certFile, keyFile, "")
+
+		require.NoError(t, err, "Should create config")
+		assert.Equal(uint16(tls.VersionTLS12), cfg.MinVersion)
+		assert.Equal(tls.NoClientCert, cfg.ClientAuth)
+	})
+}
+
+func TestCertificateReload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := writeServerCert(t, dir, "first")
+
+	cfg, err := NewTLSConfig(certFile, keyFile, "")
+	require.NoError(err, "Should create config")
+
+	addr := newTLSServer(t, cfg, okHandler)
+
+	assert.Equal("first", serverCertName(t, addr))
+
+	writeServerCert(t, dir, "second")
+	// Ensure the modification time changes even on filesystems with coarse timestamps
+	future := time.Now().Add(time.Minute)
+	require.NoError(os.Chtimes(certFile, future, future))
+	require.NoError(os.Chtimes(keyFile, future, future))
+
+	assert.Equal("second", serverCertName(t, addr), "Should serve the new certificate")
+
+	require.NoError(os.WriteFile(certFile, []byte("broken"), 0600))
+	future = future.Add(time.Minute)
+	require.NoError(os.Chtimes(certFile, future, future))
+
+	assert.Equal("second", serverCertName(t, addr), "Should keep the previous certificate when reloading fails")
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeServerCert(t, dir, "server")
+
+	ca, caKey, caPEM, _ := createCert(t, "ca", nil, nil, true)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0600))
+
+	cfg, err := NewTLSConfig(certFile, keyFile, caFile)
+	require.NoError(t, err, "Should create config")
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+
+	url := "https://" + newTLSServer(t, cfg, RequireClientCert(okHandler))
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				// #nosec G402: The server certificate is self-signed in tests.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs},
+			},
+		}
+	}
+
+	t.Run("NoClientCert", func(t *testing.T) {
+		res, err := newClient().Get(url)
+
+		require.NoError(t, err, "Should accept the connection, so probes can connect")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusForbidden, res.StatusCode, "Should reject requests without certificate")
+	})
+	t.Run("UnknownClientCert", func(t *testing.T) {
+		otherCA, otherKey, _, _ := createCert(t, "other-ca", nil, nil, true)
+		_, _, clientCertPEM, clientKeyPEM := createCert(t, "client", otherCA, otherKey, false)
+		clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+		require.NoError(t, err, "Should load client certificate")
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					// #nosec G402: The server certificate is self-signed in tests.
+					InsecureSkipVerify: true,
+					// Send the certificate even though it does not match the CAs requested by the server
+					GetClientCertificate: func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						return &clientCert, nil
+					},
+				},
+			},
+		}
+
+		_, err = client.Get(url)
+
+		assert.Error(t, err, "Should reject certificates not signed by the CA")
+	})
+	t.Run("ValidClientCert", func(t *testing.T) {
+		_, _, clientCertPEM, clientKeyPEM := createCert(t, "client", ca, caKey, false)
+		clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+		require.NoError(t, err, "Should load client certificate")
+
+		res, err := newClient(clientCert).Get(url)
+
+		require.NoError(t, err, "Should accept client certificate")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}